@@ -0,0 +1,262 @@
+package function
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// chainPath holds the head of the chain and the checkpoints, it
+// cannot clash with a user since logins cannot start with "_"
+const chainPath = "_chain"
+
+// ChainHead is the last event added to the chain
+type ChainHead struct {
+	Sequence int64  `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// ChainAnchor is where the chain starts, the first event kept must have
+// its sequence and previous hash. It starts at the first event and moves
+// forward when old events expire, so that removing the oldest events is
+// detected rather than taken for expiry.
+type ChainAnchor struct {
+	Sequence  int64  `json:"sequence"`
+	PrevHash  string `json:"prevHash"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Checkpoint signs the hash of the chain at a sequence so that the
+// chain cannot be rewritten without the signing key
+type Checkpoint struct {
+	Sequence  int64     `json:"sequence"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Signature string    `json:"signature"`
+}
+
+// VerifyReport is the result of walking the chain
+type VerifyReport struct {
+	Valid       bool   `json:"valid"`
+	Events      int    `json:"events"`
+	Unchained   int    `json:"unchained"`
+	First       int64  `json:"first"`
+	Last        int64  `json:"last"`
+	Checkpoints int    `json:"checkpoints"`
+	BrokenAt    int64  `json:"brokenAt,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+
+	// CheckpointsVerified is false when there is no checkpoint key, then
+	// only the links between events are verified
+	CheckpointsVerified bool `json:"checkpointsVerified"`
+}
+
+// hashEvent gives the SHA256 of the event with its own hash left out,
+// the previous hash is included so each event depends on the last
+func hashEvent(event sdk.AuditEvent) string {
+	event.Hash = ""
+	bytesOut, _ := json.Marshal(&event)
+
+	digest := sha256.Sum256(bytesOut)
+	return hex.EncodeToString(digest[:])
+}
+
+// chainEvent links the event to the head of the chain and gives the new head
+func chainEvent(event *sdk.AuditEvent, head ChainHead) ChainHead {
+	event.Sequence = head.Sequence + 1
+	event.PrevHash = head.Hash
+	event.Hash = hashEvent(*event)
+
+	return ChainHead{Sequence: event.Sequence, Hash: event.Hash}
+}
+
+func signCheckpoint(checkpoint Checkpoint, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fmt.Sprintf("%d:%s:%s",
+		checkpoint.Sequence,
+		checkpoint.Hash,
+		checkpoint.Timestamp.UTC().Format(time.RFC3339Nano))))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validCheckpoint(checkpoint Checkpoint, key []byte) bool {
+	want := signCheckpoint(checkpoint, key)
+	return hmac.Equal([]byte(want), []byte(checkpoint.Signature))
+}
+
+func signAnchor(anchor ChainAnchor, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fmt.Sprintf("anchor:%d:%s", anchor.Sequence, anchor.PrevHash)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validAnchor(anchor ChainAnchor, key []byte) bool {
+	want := signAnchor(anchor, key)
+	return hmac.Equal([]byte(want), []byte(anchor.Signature))
+}
+
+// nextAnchor gives the anchor for the events which remain after expiry,
+// when none remain the chain starts again after the head
+func nextAnchor(events []sdk.AuditEvent, head ChainHead) ChainAnchor {
+	anchor := ChainAnchor{Sequence: head.Sequence + 1, PrevHash: head.Hash}
+	for _, event := range events {
+		if event.Sequence > 0 && event.Sequence < anchor.Sequence {
+			anchor = ChainAnchor{Sequence: event.Sequence, PrevHash: event.PrevHash}
+		}
+	}
+	return anchor
+}
+
+// checkpointInterval is the number of events between checkpoints
+func checkpointInterval() int64 {
+	if val, ok := os.LookupEnv("checkpoint_interval"); ok && len(val) > 0 {
+		if interval, err := strconv.ParseInt(val, 10, 64); err == nil && interval > 0 {
+			return interval
+		}
+	}
+	return 100
+}
+
+func readCheckpointKey() ([]byte, error) {
+	key, err := sdk.ReadSecret("audit-checkpoint-key")
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("audit-checkpoint-key is empty")
+	}
+	return []byte(key), nil
+}
+
+// verifyChain walks the events in order of sequence and reports the first
+// link which is broken. The chain must start at the anchor, which is the
+// first event until old events expire, an empty anchor is the first event.
+// Events written before the chain began are counted as unchained, any
+// unchained event after that breaks the chain. Without a key the
+// checkpoints and the anchor cannot be trusted, so they are left out.
+func verifyChain(events []sdk.AuditEvent, checkpoints []Checkpoint, head ChainHead, anchor ChainAnchor, key []byte) VerifyReport {
+	report := VerifyReport{Checkpoints: len(checkpoints), CheckpointsVerified: len(key) > 0}
+	if !report.CheckpointsVerified {
+		checkpoints = nil
+	}
+
+	chained := []sdk.AuditEvent{}
+	unchained := []sdk.AuditEvent{}
+	for _, event := range events {
+		if event.Sequence == 0 {
+			unchained = append(unchained, event)
+			continue
+		}
+		chained = append(chained, event)
+	}
+
+	sort.SliceStable(chained, func(i, j int) bool {
+		return chained[i].Sequence < chained[j].Sequence
+	})
+
+	report.Events = len(chained)
+	report.Unchained = len(unchained)
+
+	broken := func(sequence int64, reason string) VerifyReport {
+		report.BrokenAt = sequence
+		report.Reason = reason
+		return report
+	}
+
+	if len(chained) > 0 {
+		started := chained[0].Timestamp
+		for _, event := range chained {
+			if event.Timestamp.Before(started) {
+				started = event.Timestamp
+			}
+		}
+		for _, event := range unchained {
+			if !event.Timestamp.Before(started) {
+				return broken(0, fmt.Sprintf("event at %s is not chained", event.Timestamp.UTC().Format(time.RFC3339)))
+			}
+		}
+	}
+
+	if anchor.Sequence == 0 {
+		anchor = ChainAnchor{Sequence: 1}
+	} else if report.CheckpointsVerified && !validAnchor(anchor, key) {
+		return broken(anchor.Sequence, "anchor signature is not valid")
+	}
+	report.Last = anchor.Sequence - 1
+
+	for _, checkpoint := range checkpoints {
+		if !validCheckpoint(checkpoint, key) {
+			return broken(checkpoint.Sequence, "checkpoint signature is not valid")
+		}
+	}
+
+	signed := map[int64]string{}
+	for _, checkpoint := range checkpoints {
+		signed[checkpoint.Sequence] = checkpoint.Hash
+	}
+
+	for i, event := range chained {
+		if i == 0 {
+			report.First = event.Sequence
+
+			if event.Sequence > anchor.Sequence {
+				return broken(anchor.Sequence, "event is missing from the start of the chain")
+			}
+			if event.Sequence < anchor.Sequence {
+				return broken(event.Sequence, "event is before the start of the chain")
+			}
+			if event.PrevHash != anchor.PrevHash {
+				return broken(event.Sequence, "previous hash does not match the start of the chain")
+			}
+		}
+
+		if hashEvent(event) != event.Hash {
+			return broken(event.Sequence, "hash does not match the event")
+		}
+
+		if i > 0 {
+			prev := chained[i-1]
+			if event.Sequence != prev.Sequence+1 {
+				return broken(prev.Sequence+1, "event is missing")
+			}
+			if event.PrevHash != prev.Hash {
+				return broken(event.Sequence, "previous hash does not match")
+			}
+		}
+
+		if hash, ok := signed[event.Sequence]; ok && hash != event.Hash {
+			return broken(event.Sequence, "hash does not match the checkpoint")
+		}
+
+		report.Last = event.Sequence
+	}
+
+	// Events removed from the end leave the chain intact, so compare
+	// against the head and the last checkpoint
+	expected := head.Sequence
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Sequence > expected {
+			expected = checkpoint.Sequence
+		}
+	}
+
+	if expected > report.Last {
+		return broken(report.Last+1, "event is missing")
+	}
+	if len(chained) > 0 && head.Sequence == report.Last && head.Hash != chained[len(chained)-1].Hash {
+		return broken(report.Last, "hash does not match the head of the chain")
+	}
+
+	report.Valid = true
+	return report
+}
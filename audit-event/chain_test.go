@@ -0,0 +1,257 @@
+package function
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+var testKey = []byte("checkpoint-key")
+
+func buildChain(t *testing.T, count int) ([]sdk.AuditEvent, []Checkpoint, ChainHead) {
+	events := []sdk.AuditEvent{}
+	checkpoints := []Checkpoint{}
+	head := ChainHead{}
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < count; i++ {
+		event := sdk.AuditEvent{
+			Source:    "buildshiprun",
+			Owner:     "alexellis",
+			Message:   fmt.Sprintf("event %d", i),
+			Timestamp: now.Add(time.Duration(i) * time.Second),
+		}
+		head = chainEvent(&event, head)
+		events = append(events, event)
+
+		if head.Sequence%2 == 0 {
+			checkpoint := Checkpoint{Sequence: head.Sequence, Hash: head.Hash, Timestamp: now}
+			checkpoint.Signature = signCheckpoint(checkpoint, testKey)
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+
+	return events, checkpoints, head
+}
+
+func Test_verifyChain_Valid(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+
+	report := verifyChain(events, checkpoints, head, ChainAnchor{}, testKey)
+	if !report.Valid {
+		t.Fatalf("want a valid chain, got broken at %d: %s", report.BrokenAt, report.Reason)
+	}
+	if report.First != 1 || report.Last != 5 || report.Checkpoints != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func Test_verifyChain_EditedEvent(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+	events[2].Message = "nothing happened"
+
+	report := verifyChain(events, checkpoints, head, ChainAnchor{}, testKey)
+	if report.Valid || report.BrokenAt != 3 {
+		t.Errorf("want broken at 3, got %+v", report)
+	}
+}
+
+func Test_verifyChain_RehashedEvent(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+	events[2].Message = "nothing happened"
+	events[2].Hash = hashEvent(events[2])
+
+	report := verifyChain(events, checkpoints, head, ChainAnchor{}, testKey)
+	if report.Valid || report.BrokenAt != 4 {
+		t.Errorf("want broken at 4 where the previous hash no longer matches, got %+v", report)
+	}
+}
+
+func Test_verifyChain_RemovedEvent(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+	events = append(events[:1], events[2:]...)
+
+	report := verifyChain(events, checkpoints, head, ChainAnchor{}, testKey)
+	if report.Valid || report.BrokenAt != 2 || report.Reason != "event is missing" {
+		t.Errorf("want event 2 to be missing, got %+v", report)
+	}
+}
+
+func Test_verifyChain_TruncatedChain(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+
+	report := verifyChain(events[:3], checkpoints, head, ChainAnchor{}, testKey)
+	if report.Valid || report.BrokenAt != 4 {
+		t.Errorf("want event 4 to be missing, got %+v", report)
+	}
+}
+
+func Test_verifyChain_ForgedCheckpoint(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+
+	report := verifyChain(events, checkpoints, head, ChainAnchor{}, []byte("another-key"))
+	if report.Valid || report.Reason != "checkpoint signature is not valid" {
+		t.Errorf("want an invalid checkpoint, got %+v", report)
+	}
+}
+
+func Test_verifyChain_WithoutKey(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+	checkpoints[0].Signature = "forged"
+
+	report := verifyChain(events, checkpoints, head, ChainAnchor{}, nil)
+	if !report.Valid || report.CheckpointsVerified {
+		t.Errorf("want a valid chain without verified checkpoints, got %+v", report)
+	}
+
+	events[2].Message = "nothing happened"
+	if report := verifyChain(events, checkpoints, head, ChainAnchor{}, nil); report.Valid || report.BrokenAt != 3 {
+		t.Errorf("want broken at 3 without a key, got %+v", report)
+	}
+}
+
+func Test_verifyChain_ExpiredStart(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+
+	anchor := nextAnchor(events[2:], head)
+	anchor.Signature = signAnchor(anchor, testKey)
+
+	report := verifyChain(events[2:], checkpoints, head, anchor, testKey)
+	if !report.Valid || report.First != 3 {
+		t.Errorf("want a valid chain from 3, got %+v", report)
+	}
+}
+
+func Test_verifyChain_OldestEventsRemoved(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+
+	report := verifyChain(events[2:], checkpoints, head, ChainAnchor{}, testKey)
+	if report.Valid || report.BrokenAt != 1 {
+		t.Errorf("want broken at 1, got %+v", report)
+	}
+}
+
+func Test_verifyChain_ForgedAnchor(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 5)
+
+	anchor := nextAnchor(events[2:], head)
+	anchor.Signature = signAnchor(anchor, []byte("another-key"))
+
+	report := verifyChain(events[2:], checkpoints, head, anchor, testKey)
+	if report.Valid || report.Reason != "anchor signature is not valid" {
+		t.Errorf("want a forged anchor to be found, got %+v", report)
+	}
+}
+
+func Test_verifyChain_AllExpired(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 4)
+
+	anchor := nextAnchor(nil, head)
+	anchor.Signature = signAnchor(anchor, testKey)
+
+	report := verifyChain(nil, checkpoints, head, anchor, testKey)
+	if !report.Valid {
+		t.Errorf("want a valid chain once every event expired, got %+v", report)
+	}
+
+	report = verifyChain(events[3:], checkpoints, head, anchor, testKey)
+	if report.Valid || report.BrokenAt != 4 {
+		t.Errorf("want broken at 4 for an event before the anchor, got %+v", report)
+	}
+}
+
+func Test_verifyChain_UnchainedEvents(t *testing.T) {
+	events, checkpoints, head := buildChain(t, 4)
+
+	legacy := sdk.AuditEvent{Source: "git-tar", Timestamp: events[0].Timestamp.Add(-time.Hour)}
+	report := verifyChain(append([]sdk.AuditEvent{legacy}, events...), checkpoints, head, ChainAnchor{}, testKey)
+	if !report.Valid || report.Unchained != 1 {
+		t.Errorf("want a valid chain with one unchained event before it, got %+v", report)
+	}
+
+	inserted := sdk.AuditEvent{Source: "git-tar", Timestamp: events[2].Timestamp}
+	report = verifyChain(append(events, inserted), checkpoints, head, ChainAnchor{}, testKey)
+	if report.Valid {
+		t.Errorf("want an unchained event after the chain began to break it, got %+v", report)
+	}
+}
+
+func Test_appendToChain_FilesystemStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secrets, _ := ioutil.TempDir("", "secrets")
+	defer os.RemoveAll(secrets)
+	ioutil.WriteFile(secrets+"/audit-checkpoint-key", testKey, 0600)
+	os.Setenv("secret_mount_path", secrets)
+	defer os.Unsetenv("secret_mount_path")
+
+	store, _ := newFilesystemStore(dir)
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		event := sdk.AuditEvent{Source: "git-tar", Owner: "alexellis", Timestamp: now.Add(time.Duration(i) * time.Second)}
+		if err := appendToChain(store, event, 2, now); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	events, _ := store.ListAll()
+	checkpoints, _ := store.ListCheckpoints()
+	head, _ := store.ReadHead()
+
+	if len(events) != 4 || len(checkpoints) != 2 || head.Sequence != 4 {
+		t.Fatalf("want 4 events, 2 checkpoints and head 4, got %d, %d, %d", len(events), len(checkpoints), head.Sequence)
+	}
+
+	report := verifyChain(events, checkpoints, head, ChainAnchor{}, testKey)
+	if !report.Valid {
+		t.Errorf("want a valid chain, got %+v", report)
+	}
+}
+
+func Test_expireEvents_MovesAnchor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := newFilesystemStore(dir)
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		event := sdk.AuditEvent{Source: "git-tar", Owner: "alexellis", Timestamp: now.Add(time.Duration(i) * 24 * time.Hour)}
+		if err := appendToChain(store, event, 100, now); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	removed, err := expireEvents(store, now.Add(48*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if removed != 2 {
+		t.Errorf("want 2 days removed, got %d", removed)
+	}
+
+	events, _ := store.ListAll()
+	head, _ := store.ReadHead()
+	anchor, _ := store.ReadAnchor()
+
+	if anchor.Sequence != 3 {
+		t.Errorf("want the anchor at 3, got %d", anchor.Sequence)
+	}
+
+	report := verifyChain(events, nil, head, anchor, nil)
+	if !report.Valid || report.First != 3 {
+		t.Errorf("want a valid chain from 3, got %+v", report)
+	}
+}
@@ -0,0 +1,227 @@
+package function
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// FilesystemStore writes one JSON file per event under BasePath
+type FilesystemStore struct {
+	BasePath string
+}
+
+func newFilesystemStore(basePath string) (*FilesystemStore, error) {
+	if err := os.MkdirAll(basePath, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FilesystemStore{BasePath: basePath}, nil
+}
+
+// Append writes the event to disk and returns its path
+func (s *FilesystemStore) Append(event sdk.AuditEvent) (string, error) {
+	eventPath, err := getPath(&event)
+	if err != nil {
+		return "", err
+	}
+	fullPath := filepath.Join(s.BasePath, filepath.FromSlash(eventPath))
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return fullPath, err
+	}
+
+	bytesOut, err := json.Marshal(&event)
+	if err != nil {
+		return fullPath, err
+	}
+
+	// O_EXCL so that an event is never written over another one
+	file, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fullPath, err
+	}
+
+	if _, err := file.Write(bytesOut); err != nil {
+		file.Close()
+		return fullPath, err
+	}
+	return fullPath, file.Close()
+}
+
+// List reads every event found under the query's prefix
+func (s *FilesystemStore) List(query Query) ([]sdk.AuditEvent, error) {
+	prefix, err := query.prefix()
+	if err != nil {
+		return nil, err
+	}
+	return s.readEvents(filepath.Join(s.BasePath, filepath.FromSlash(prefix)))
+}
+
+// ListAll reads every event, leaving out the chain's head and checkpoints
+func (s *FilesystemStore) ListAll() ([]sdk.AuditEvent, error) {
+	return s.readEvents(s.BasePath)
+}
+
+func (s *FilesystemStore) readEvents(root string) ([]sdk.AuditEvent, error) {
+	events := []sdk.AuditEvent{}
+
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return events, nil
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		if info.IsDir() && info.Name() == chainPath {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		event := sdk.AuditEvent{}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+
+		events = append(events, event)
+		return nil
+	})
+
+	return events, err
+}
+
+// Expire removes the directory for each day which ended before the given time
+func (s *FilesystemStore) Expire(before time.Time) (int, error) {
+	days, err := filepath.Glob(filepath.Join(s.BasePath, "*", "*", "*", "*"))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, dayPath := range days {
+		rel, _ := filepath.Rel(s.BasePath, dayPath)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+
+		day, ok := parseDay(parts[1:])
+		if !ok || !expired(day, before) {
+			continue
+		}
+
+		if err := os.RemoveAll(dayPath); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// ReadHead reads the head of the chain, which is empty before the
+// first event is added
+func (s *FilesystemStore) ReadHead() (ChainHead, error) {
+	head := ChainHead{}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.BasePath, filepath.FromSlash(getHeadPath())))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return head, nil
+		}
+		return head, err
+	}
+
+	err = json.Unmarshal(data, &head)
+	return head, err
+}
+
+// WriteHead replaces the head of the chain
+func (s *FilesystemStore) WriteHead(head ChainHead) error {
+	return s.writeJSON(getHeadPath(), &head)
+}
+
+// ReadAnchor reads the start of the chain, which is empty until events
+// first expire
+func (s *FilesystemStore) ReadAnchor() (ChainAnchor, error) {
+	anchor := ChainAnchor{}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.BasePath, filepath.FromSlash(getAnchorPath())))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return anchor, nil
+		}
+		return anchor, err
+	}
+
+	err = json.Unmarshal(data, &anchor)
+	return anchor, err
+}
+
+// WriteAnchor replaces the start of the chain
+func (s *FilesystemStore) WriteAnchor(anchor ChainAnchor) error {
+	return s.writeJSON(getAnchorPath(), &anchor)
+}
+
+// WriteCheckpoint writes a file for the checkpoint
+func (s *FilesystemStore) WriteCheckpoint(checkpoint Checkpoint) error {
+	return s.writeJSON(getCheckpointPath(&checkpoint), &checkpoint)
+}
+
+// ListCheckpoints reads every checkpoint in order of sequence
+func (s *FilesystemStore) ListCheckpoints() ([]Checkpoint, error) {
+	checkpoints := []Checkpoint{}
+
+	paths, err := filepath.Glob(filepath.Join(s.BasePath, chainPath, "checkpoints", "*.json"))
+	if err != nil {
+		return checkpoints, err
+	}
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return checkpoints, err
+		}
+
+		checkpoint := Checkpoint{}
+		if err := json.Unmarshal(data, &checkpoint); err != nil {
+			return checkpoints, err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, nil
+}
+
+// writeJSON writes to a temporary file first so that a reader never
+// sees part of a file
+func (s *FilesystemStore) writeJSON(path string, value interface{}) error {
+	fullPath := filepath.Join(s.BasePath, filepath.FromSlash(path))
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return err
+	}
+
+	bytesOut, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := fullPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, bytesOut, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, fullPath)
+}
@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/alexellis/hmac v0.0.0-20180624210714-d5d71edd7bc7
+	github.com/minio/minio-go v6.0.14+incompatible
 	github.com/openfaas/faas-provider v0.0.0-20191011092439-98c25c3919da
 	github.com/openfaas/openfaas-cloud v0.0.0-20200303103051-6c3e056a6ac4
 	github.com/sirupsen/logrus v1.7.0
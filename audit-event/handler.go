@@ -1,64 +1,361 @@
 package function
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/openfaas/openfaas-cloud/sdk"
 )
 
-// SlackMessage encapsulates a message for the Slack
-// incoming webhook API
-type SlackMessage struct {
-	Text string `json:"text"`
-}
+const (
+	expiryMarkerPath = "/tmp/audit-event-expired"
+	chainLockPath    = "/tmp/audit-event-chain.lock"
+)
 
-// Handle collects events from other functions for auditing. These can
-// be connected to a Slack webhook URL or the function can be swapped
-// for the echo  function for storage in container logs.
+// Handle collects events from other functions for auditing and sends
+// them to the sinks configured in audit_sinks_path, such as Slack,
+// Teams, Discord, a webhook, a file or an S3 bucket. When storage is set
+// events are also persisted in a hash chain and a GET request with ?user=
+// queries them, without a user it returns the number of events sent to,
+// failed and retried for each sink. A POST to /verify walks the chain.
+// Events must be signed with the payload-secret.
 func Handle(req []byte) string {
+	if os.Getenv("Http_Method") == http.MethodGet {
+		rawQuery := os.Getenv("Http_Query")
+		if len(rawQuery) > 0 {
+			return queryEvents(rawQuery)
+		}
+
+		stats, err := readStats(statsPath())
+		if err != nil {
+			log.Printf("unable to read sink stats: %s", err.Error())
+			os.Exit(1)
+		}
+
+		out, _ := json.Marshal(stats)
+		return string(out)
+	}
+
+	if os.Getenv("Http_Path") == "/verify" {
+		return verifyEvents()
+	}
+
+	// Events are signed by the functions which send them, so that a
+	// client cannot add to the chain or the sinks
+	hmacErr := sdk.ValidHMAC(&req, "payload-secret", os.Getenv("Http_X_Cloud_Signature"))
+	if hmacErr != nil {
+		log.Printf("hmac error %s\n", hmacErr.Error())
+		os.Exit(1)
+	}
 
 	event := sdk.AuditEvent{}
 
 	json.Unmarshal(req, &event)
 
+	if _, err := getPath(&event); err != nil {
+		log.Printf("rejected event: %s", err.Error())
+		os.Exit(1)
+	}
+
+	// The chain is only written by audit-event
+	event.Sequence = 0
+	event.PrevHash = ""
+	event.Hash = ""
+
 	log.Printf("Event: %s", req)
 
-	if slackURL, ok := os.LookupEnv("slack_url"); ok && len(slackURL) > 0 {
-		reader, encapsulateErr := encapsulateSlackReq(event)
-		if encapsulateErr != nil {
-			log.Panic(encapsulateErr)
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	persistEvent(event)
+
+	config, err := readSinksConfig()
+	if err != nil {
+		log.Printf("%s", err.Error())
+		os.Exit(1)
+	}
+
+	sinks := config.Select(event)
+	if len(sinks) == 0 {
+		return fmt.Sprintf("audit-event: done")
+	}
+
+	results := sendAll(sinks, event, getRetryPolicy())
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			log.Printf("Sink %s failed after %d attempt(s): %s", result.Sink, result.Attempts, result.Err.Error())
+		} else {
+			log.Printf("Sent to sink %s", result.Sink)
 		}
+	}
+
+	if err := updateStats(statsPath(), results, time.Now().UTC()); err != nil {
+		log.Printf("unable to update sink stats: %s", err.Error())
+	}
 
-		res, err := http.Post(slackURL, "application/json", reader)
+	return fmt.Sprintf("audit-event: done, sent to %d sink(s), %d failed", len(results)-failed, failed)
+}
+
+// persistEvent adds the event to the chain in the store and removes
+// expired events at most once an hour, errors are logged so that the
+// event is still sent to the sinks
+func persistEvent(event sdk.AuditEvent) {
+	store, err := newStore()
+	if err != nil {
+		log.Printf("audit-event store error: %s", err.Error())
+		return
+	}
+	if store == nil {
+		return
+	}
 
+	err = withLock(chainLockPath, func() error {
+		return appendToChain(store, event, checkpointInterval(), time.Now().UTC())
+	})
+	if err != nil {
+		log.Printf("error persisting event: %s", err.Error())
+		return
+	}
+
+	keep := retention()
+	now := time.Now().UTC()
+	if keep > 0 && expireDue(expiryMarkerPath, time.Hour, now) {
+		var removed int
+		err := withLock(chainLockPath, func() error {
+			var expireErr error
+			removed, expireErr = expireEvents(store, now.Add(-keep))
+			return expireErr
+		})
 		if err != nil {
-			log.Println(err)
+			log.Printf("error expiring events: %s", err.Error())
 		} else {
-			log.Println("Posted to Slack: ", res.Status)
+			log.Printf("Expired events older than %s, removed: %d", keep, removed)
 		}
 	}
+}
+
+// expireEvents removes the events which ended before the given time and
+// moves the anchor to the first event which remains
+func expireEvents(store Store, before time.Time) (int, error) {
+	removed, err := store.Expire(before)
+	if err != nil {
+		return removed, err
+	}
+
+	events, err := store.ListAll()
+	if err != nil {
+		return removed, err
+	}
 
-	return fmt.Sprintf("audit-event: done")
+	head, err := store.ReadHead()
+	if err != nil {
+		return removed, err
+	}
+
+	anchor := nextAnchor(events, head)
+	if key, keyErr := readCheckpointKey(); keyErr == nil {
+		anchor.Signature = signAnchor(anchor, key)
+	}
+
+	return removed, store.WriteAnchor(anchor)
 }
 
-func encapsulateSlackReq(event sdk.AuditEvent) (io.Reader, error) {
-	msg := SlackMessage{
-		Text: fmt.Sprintf("[%s] %s/%s: '%s'",
-			event.Source,
-			event.Owner,
-			event.Repo,
-			event.Message)}
+// appendToChain links the event to the head of the chain, writes it and
+// signs a checkpoint after every interval events
+func appendToChain(store Store, event sdk.AuditEvent, interval int64, now time.Time) error {
+	head, err := store.ReadHead()
+	if err != nil {
+		return err
+	}
+
+	head = chainEvent(&event, head)
+
+	fullPath, err := store.Append(event)
+	if err != nil {
+		return fmt.Errorf("error writing: %s, error: %s", fullPath, err.Error())
+	}
+
+	if err := store.WriteHead(head); err != nil {
+		return err
+	}
+
+	if head.Sequence%interval != 0 {
+		return nil
+	}
+
+	key, err := readCheckpointKey()
+	if err != nil {
+		log.Printf("unable to sign checkpoint at %d: %s", head.Sequence, err.Error())
+		return nil
+	}
+
+	checkpoint := Checkpoint{
+		Sequence:  head.Sequence,
+		Hash:      head.Hash,
+		Timestamp: now,
+	}
+	checkpoint.Signature = signCheckpoint(checkpoint, key)
 
-	bytesOut, marshalErr := json.Marshal(msg)
-	if marshalErr != nil {
-		return nil, marshalErr
+	return store.WriteCheckpoint(checkpoint)
+}
+
+// verifyEvents walks the whole chain in the store
+func verifyEvents() string {
+	store, err := newStore()
+	if err != nil {
+		log.Printf("audit-event store error: %s", err.Error())
+		os.Exit(1)
+	}
+	if store == nil {
+		return "audit-event: storage is not configured"
+	}
+
+	key, err := readCheckpointKey()
+	if err != nil {
+		log.Printf("Checkpoints are not verified without a checkpoint key: %s", err.Error())
+	}
+
+	events, err := store.ListAll()
+	if err != nil {
+		log.Printf("error listing events: %s", err.Error())
+		os.Exit(1)
+	}
+
+	checkpoints, err := store.ListCheckpoints()
+	if err != nil {
+		log.Printf("error listing checkpoints: %s", err.Error())
+		os.Exit(1)
+	}
+
+	head, err := store.ReadHead()
+	if err != nil {
+		log.Printf("error reading head of chain: %s", err.Error())
+		os.Exit(1)
+	}
+
+	anchor, err := store.ReadAnchor()
+	if err != nil {
+		log.Printf("error reading anchor of chain: %s", err.Error())
+		os.Exit(1)
+	}
+
+	report := verifyChain(events, checkpoints, head, anchor, key)
+	if !report.Valid {
+		log.Printf("Audit chain broken at %d: %s", report.BrokenAt, report.Reason)
+	}
+
+	bytesOut, _ := json.Marshal(report)
+	return string(bytesOut)
+}
+
+func queryEvents(rawQuery string) string {
+	query, parseErr := parseQuery(rawQuery)
+	if parseErr != nil {
+		return parseErr.Error()
+	}
+
+	store, err := newStore()
+	if err != nil {
+		log.Printf("audit-event store error: %s", err.Error())
+		os.Exit(1)
+	}
+	if store == nil {
+		return "audit-event: storage is not configured"
+	}
+
+	events, err := store.List(query)
+	if err != nil {
+		log.Printf("error listing events for %s, error: %s", query.Owner, err.Error())
+		os.Exit(1)
+	}
+
+	page := paginate(filterEvents(events, query), query.Page, query.PageSize)
+
+	bytesOut, _ := json.Marshal(page)
+	return string(bytesOut)
+}
+
+// RetryPolicy controls how many times a sink is tried for each event
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+func getRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{
+		Attempts: 3,
+		Backoff:  500 * time.Millisecond,
+	}
+
+	if val, ok := os.LookupEnv("sink_attempts"); ok && len(val) > 0 {
+		if attempts, err := strconv.Atoi(val); err == nil && attempts > 0 {
+			policy.Attempts = attempts
+		}
+	}
+
+	if val, ok := os.LookupEnv("sink_backoff"); ok && len(val) > 0 {
+		if backoff, err := time.ParseDuration(val); err == nil {
+			policy.Backoff = backoff
+		}
+	}
+
+	return policy
+}
+
+// sendAll sends the event to each sink at the same time, so that a slow
+// sink does not hold up the others
+func sendAll(sinks []SinkConfig, event sdk.AuditEvent, policy RetryPolicy) []SinkResult {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	results := make([]SinkResult, len(sinks))
+	wg := sync.WaitGroup{}
+
+	for i, config := range sinks {
+		wg.Add(1)
+		go func(i int, config SinkConfig) {
+			defer wg.Done()
+
+			sink, err := newSink(config, client)
+			if err != nil {
+				results[i] = SinkResult{Sink: config.Name, Err: err}
+				return
+			}
+
+			results[i] = send(config.Name, sink, event, policy)
+		}(i, config)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// send retries a sink with a backoff which doubles after each attempt
+func send(name string, sink Sink, event sdk.AuditEvent, policy RetryPolicy) SinkResult {
+	result := SinkResult{Sink: name}
+	backoff := policy.Backoff
+
+	for result.Attempts < policy.Attempts {
+		if result.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff = backoff * 2
+		}
+
+		result.Attempts++
+		result.Err = sink.Send(event)
+		if result.Err == nil {
+			break
+		}
 	}
 
-	return bytes.NewReader(bytesOut), nil
+	return result
 }
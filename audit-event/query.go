@@ -0,0 +1,167 @@
+package function
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// EventPage is a page of audit events, newest first
+type EventPage struct {
+	Events   []sdk.AuditEvent `json:"events"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"pageSize"`
+	Total    int              `json:"total"`
+}
+
+// Query selects the audit events for a user, optionally by repo,
+// source, type and time range
+type Query struct {
+	Owner    string
+	Repo     string
+	Source   string
+	Type     string
+	Since    time.Time
+	Until    time.Time
+	Page     int
+	PageSize int
+}
+
+// prefix gives the narrowest path which contains every
+// event matched by the query
+func (q Query) prefix() (string, error) {
+	owner, err := ownerPath(q.Owner)
+	if err != nil {
+		return "", err
+	}
+	return owner + "/", nil
+}
+
+func parseQuery(queryRaw string) (Query, error) {
+	vals, err := url.ParseQuery(queryRaw)
+	if err != nil {
+		return Query{}, err
+	}
+
+	q := Query{
+		Owner:    vals.Get("user"),
+		Repo:     vals.Get("repo"),
+		Source:   vals.Get("source"),
+		Type:     vals.Get("type"),
+		Page:     1,
+		PageSize: defaultPageSize,
+	}
+
+	if len(q.Owner) == 0 {
+		return q, fmt.Errorf("user is required in the querystring i.e. ?user=alexellis")
+	}
+
+	if _, err := q.prefix(); err != nil {
+		return q, err
+	}
+
+	if val := vals.Get("since"); len(val) > 0 {
+		since, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return q, fmt.Errorf("since must be an RFC3339 time, got: %q", val)
+		}
+		q.Since = since
+	}
+
+	if val := vals.Get("until"); len(val) > 0 {
+		until, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return q, fmt.Errorf("until must be an RFC3339 time, got: %q", val)
+		}
+		q.Until = until
+	}
+
+	if val := vals.Get("page"); len(val) > 0 {
+		page, err := strconv.Atoi(val)
+		if err != nil || page < 1 {
+			return q, fmt.Errorf("page must be a positive integer, got: %q", val)
+		}
+		q.Page = page
+	}
+
+	if val := vals.Get("page_size"); len(val) > 0 {
+		pageSize, err := strconv.Atoi(val)
+		if err != nil || pageSize < 1 {
+			return q, fmt.Errorf("page_size must be a positive integer, got: %q", val)
+		}
+		if pageSize > maxPageSize {
+			pageSize = maxPageSize
+		}
+		q.PageSize = pageSize
+	}
+
+	return q, nil
+}
+
+// Matches is true when the event was for the query's owner and meets
+// the other criteria which were given
+func (q Query) Matches(event sdk.AuditEvent) bool {
+	if !strings.EqualFold(event.Owner, q.Owner) {
+		return false
+	}
+	if len(q.Repo) > 0 && event.Repo != q.Repo {
+		return false
+	}
+	if len(q.Source) > 0 && event.Source != q.Source {
+		return false
+	}
+	if len(q.Type) > 0 && string(event.Type) != q.Type {
+		return false
+	}
+	if !q.Since.IsZero() && event.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !event.Timestamp.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+func filterEvents(events []sdk.AuditEvent, q Query) []sdk.AuditEvent {
+	filtered := []sdk.AuditEvent{}
+	for _, event := range events {
+		if q.Matches(event) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+// paginate sorts events newest first and returns the requested page
+func paginate(events []sdk.AuditEvent, page, pageSize int) EventPage {
+	sortNewestFirst(events)
+
+	result := EventPage{
+		Events:   []sdk.AuditEvent{},
+		Page:     page,
+		PageSize: pageSize,
+		Total:    len(events),
+	}
+
+	start := (page - 1) * pageSize
+	if start >= len(events) {
+		return result
+	}
+
+	end := start + pageSize
+	if end > len(events) {
+		end = len(events)
+	}
+
+	result.Events = events[start:end]
+	return result
+}
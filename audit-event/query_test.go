@@ -0,0 +1,127 @@
+package function
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_parseQuery(t *testing.T) {
+	tests := []struct {
+		title        string
+		query        string
+		wantErr      bool
+		wantPageSize int
+	}{
+		{
+			title:        "user only uses defaults",
+			query:        "user=alexellis",
+			wantPageSize: defaultPageSize,
+		},
+		{
+			title:        "all filters",
+			query:        "user=alexellis&repo=fn&source=buildshiprun&type=deploy.failed&since=2020-03-01T00:00:00Z&until=2020-03-02T00:00:00Z",
+			wantPageSize: defaultPageSize,
+		},
+		{
+			title:        "page size is capped",
+			query:        "user=alexellis&page_size=1000",
+			wantPageSize: maxPageSize,
+		},
+		{
+			title:   "user is required",
+			query:   "repo=fn",
+			wantErr: true,
+		},
+		{
+			title:   "user cannot reach the chain",
+			query:   "user=_chain",
+			wantErr: true,
+		},
+		{
+			title:   "user cannot hold a path",
+			query:   "user=alexellis/../rgee0",
+			wantErr: true,
+		},
+		{
+			title:   "since must be a time",
+			query:   "user=alexellis&since=yesterday",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			q, err := parseQuery(test.query)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if q.PageSize != test.wantPageSize {
+				t.Errorf("want page size %d, got %d", test.wantPageSize, q.PageSize)
+			}
+		})
+	}
+}
+
+func Test_Query_Matches(t *testing.T) {
+	ts := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	event := sdk.AuditEvent{
+		Owner:     "alexellis",
+		Repo:      "fn",
+		Source:    "buildshiprun",
+		Type:      sdk.AuditDeployFailed,
+		Timestamp: ts,
+	}
+
+	tests := []struct {
+		title string
+		query Query
+		want  bool
+	}{
+		{"owner ignores case", Query{Owner: "AlexEllis"}, true},
+		{"other owner", Query{Owner: "openfaas"}, false},
+		{"repo", Query{Owner: "alexellis", Repo: "other"}, false},
+		{"source", Query{Owner: "alexellis", Source: "git-tar"}, false},
+		{"type", Query{Owner: "alexellis", Type: "deploy.failed"}, true},
+		{"in range", Query{Owner: "alexellis", Since: ts.Add(-time.Hour), Until: ts.Add(time.Hour)}, true},
+		{"until is exclusive", Query{Owner: "alexellis", Until: ts}, false},
+		{"before since", Query{Owner: "alexellis", Since: ts.Add(time.Second)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			if got := test.query.Matches(event); got != test.want {
+				t.Errorf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_paginate(t *testing.T) {
+	ts := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []sdk.AuditEvent{
+		{Message: "1", Timestamp: ts},
+		{Message: "3", Timestamp: ts.Add(2 * time.Minute)},
+		{Message: "2", Timestamp: ts.Add(time.Minute)},
+	}
+
+	page := paginate(events, 1, 2)
+	if page.Total != 3 || len(page.Events) != 2 {
+		t.Fatalf("want 2 of 3 events, got %d of %d", len(page.Events), page.Total)
+	}
+	if page.Events[0].Message != "3" {
+		t.Errorf("want newest first, got %s", page.Events[0].Message)
+	}
+
+	page = paginate(events, 3, 2)
+	if len(page.Events) != 0 {
+		t.Errorf("want an empty page, got %d events", len(page.Events))
+	}
+}
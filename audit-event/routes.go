@@ -0,0 +1,165 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const (
+	// FailureClass is for events which report something going wrong
+	FailureClass = "failure"
+	// InfoClass is for every other event
+	InfoClass = "info"
+)
+
+// SinkConfig configures one destination for audit events
+type SinkConfig struct {
+	// Name is used by routes and in the sink statistics
+	Name string `json:"name"`
+
+	// Type is one of slack, webhook, teams, discord, file or s3
+	Type string `json:"type"`
+
+	// URL for the slack, webhook, teams and discord types
+	URL string `json:"url,omitempty"`
+
+	// Secret signs the body sent to a webhook in the X-Cloud-Signature header
+	Secret string `json:"secret,omitempty"`
+
+	// Path of the JSON Lines file for the file type
+	Path string `json:"path,omitempty"`
+
+	// Bucket and Prefix for the s3 type, the bucket defaults to s3_bucket
+	Bucket string `json:"bucket,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Route sends the events it matches to its sinks, an empty list of
+// sources, owners, types or classes matches any value
+type Route struct {
+	Sinks   []string `json:"sinks"`
+	Sources []string `json:"sources,omitempty"`
+	Owners  []string `json:"owners,omitempty"`
+	Types   []string `json:"types,omitempty"`
+	Classes []string `json:"classes,omitempty"`
+}
+
+// SinksConfig is read from the file given by audit_sinks_path
+type SinksConfig struct {
+	Sinks []SinkConfig `json:"sinks"`
+
+	// Routes select sinks for each event, when there are no
+	// routes every event is sent to every sink
+	Routes []Route `json:"routes,omitempty"`
+}
+
+// readSinksConfig reads the sinks from the file at audit_sinks_path, when
+// the env-var is not set slack_url is used as the only sink if present
+func readSinksConfig() (*SinksConfig, error) {
+	configPath := os.Getenv("audit_sinks_path")
+	if len(configPath) == 0 {
+		config := &SinksConfig{}
+		if slackURL, ok := os.LookupEnv("slack_url"); ok && len(slackURL) > 0 {
+			config.Sinks = append(config.Sinks, SinkConfig{Name: "slack", Type: SlackSink, URL: slackURL})
+		}
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sinks from %s: %s", configPath, err.Error())
+	}
+
+	config := &SinksConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("unable to parse sinks from %s: %s", configPath, err.Error())
+	}
+
+	names := map[string]bool{}
+	for _, sink := range config.Sinks {
+		if len(sink.Name) == 0 || names[sink.Name] {
+			return nil, fmt.Errorf("each sink needs a unique name, got: %q", sink.Name)
+		}
+		names[sink.Name] = true
+	}
+
+	for _, route := range config.Routes {
+		for _, name := range route.Sinks {
+			if !names[name] {
+				return nil, fmt.Errorf("route refers to an unknown sink: %q", name)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// Select gives the sinks for an event in the order they are configured
+func (c *SinksConfig) Select(event sdk.AuditEvent) []SinkConfig {
+	if len(c.Routes) == 0 {
+		return c.Sinks
+	}
+
+	selected := map[string]bool{}
+	for _, route := range c.Routes {
+		if route.Matches(event) {
+			for _, name := range route.Sinks {
+				selected[name] = true
+			}
+		}
+	}
+
+	sinks := []SinkConfig{}
+	for _, sink := range c.Sinks {
+		if selected[sink.Name] {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+// Matches returns true when the event matches every criteria of the route
+func (r Route) Matches(event sdk.AuditEvent) bool {
+	return matchesValue(r.Sources, event.Source) &&
+		matchesValue(r.Owners, event.Owner) &&
+		matchesValue(r.Types, string(event.Type)) &&
+		matchesValue(r.Classes, classify(event))
+}
+
+func matchesValue(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// classify gives the class of an event from its severity, events from
+// older functions without a severity are classified by their message
+func classify(event sdk.AuditEvent) string {
+	switch event.Severity {
+	case sdk.SeverityError, sdk.SeverityWarning:
+		return FailureClass
+	case sdk.SeverityInfo:
+		return InfoClass
+	}
+
+	message := strings.ToLower(event.Message)
+
+	for _, word := range []string{"fail", "error", "unable", "rejected", "invalid"} {
+		if strings.Contains(message, word) {
+			return FailureClass
+		}
+	}
+	return InfoClass
+}
@@ -0,0 +1,154 @@
+package function
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_readSinksConfig_FallsBackToSlackURL(t *testing.T) {
+	os.Unsetenv("audit_sinks_path")
+	os.Setenv("slack_url", "http://slack.example.com/hook")
+	defer os.Unsetenv("slack_url")
+
+	config, err := readSinksConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if len(config.Sinks) != 1 || config.Sinks[0].Type != SlackSink {
+		t.Errorf("want a single slack sink, got: %v", config.Sinks)
+	}
+}
+
+func Test_readSinksConfig_RejectsUnknownSinkInRoute(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit-event")
+	defer os.RemoveAll(dir)
+
+	configPath := path.Join(dir, "sinks.json")
+	ioutil.WriteFile(configPath, []byte(`{"sinks": [{"name": "ops", "type": "slack", "url": "http://slack"}],
+"routes": [{"sinks": ["security"]}]}`), 0600)
+
+	os.Setenv("audit_sinks_path", configPath)
+	defer os.Unsetenv("audit_sinks_path")
+
+	_, err := readSinksConfig()
+	if err == nil {
+		t.Fatalf("want an error for a route to an unknown sink")
+	}
+}
+
+func Test_Select(t *testing.T) {
+	config := SinksConfig{
+		Sinks: []SinkConfig{
+			{Name: "ops", Type: SlackSink},
+			{Name: "security", Type: WebhookSink},
+			{Name: "archive", Type: FileSink},
+		},
+		Routes: []Route{
+			{Sinks: []string{"archive"}},
+			{Sinks: []string{"ops"}, Classes: []string{FailureClass}},
+			{Sinks: []string{"security"}, Sources: []string{"import-secrets"}},
+		},
+	}
+
+	cases := []struct {
+		title string
+		event sdk.AuditEvent
+		want  []string
+	}{
+		{
+			title: "info event goes to the archive only",
+			event: sdk.AuditEvent{Source: "buildshiprun", Message: "deployed alexellis-fn"},
+			want:  []string{"archive"},
+		},
+		{
+			title: "failure goes to ops",
+			event: sdk.AuditEvent{Source: "buildshiprun", Message: "Unable to deploy fn"},
+			want:  []string{"ops", "archive"},
+		},
+		{
+			title: "source route matches",
+			event: sdk.AuditEvent{Source: "import-secrets", Message: "imported secret"},
+			want:  []string{"security", "archive"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			sinks := config.Select(tc.event)
+
+			got := map[string]bool{}
+			for _, sink := range sinks {
+				got[sink.Name] = true
+			}
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("want sinks %v, got %v", tc.want, sinks)
+			}
+			for _, name := range tc.want {
+				if !got[name] {
+					t.Errorf("want sink %s, got %v", name, sinks)
+				}
+			}
+		})
+	}
+}
+
+func Test_Select_NoRoutesSendsToEverySink(t *testing.T) {
+	config := SinksConfig{
+		Sinks: []SinkConfig{{Name: "a"}, {Name: "b"}},
+	}
+
+	sinks := config.Select(sdk.AuditEvent{Source: "git-tar"})
+	if len(sinks) != 2 {
+		t.Errorf("want 2 sinks, got %d", len(sinks))
+	}
+}
+
+func Test_RouteMatches_Owner(t *testing.T) {
+	route := Route{Owners: []string{"alexellis"}}
+
+	if !route.Matches(sdk.AuditEvent{Owner: "AlexEllis"}) {
+		t.Errorf("want owner to match regardless of case")
+	}
+	if route.Matches(sdk.AuditEvent{Owner: "openfaas"}) {
+		t.Errorf("want other owners not to match")
+	}
+}
+
+func Test_RouteMatches_Type(t *testing.T) {
+	route := Route{Types: []string{string(sdk.AuditDeployFailed)}}
+
+	if !route.Matches(sdk.AuditEvent{Type: sdk.AuditDeployFailed}) {
+		t.Errorf("want deploy.failed to match")
+	}
+	if route.Matches(sdk.AuditEvent{Type: sdk.AuditDeploySucceeded}) {
+		t.Errorf("want deploy.succeeded not to match")
+	}
+}
+
+func Test_classify(t *testing.T) {
+	cases := []struct {
+		title string
+		event sdk.AuditEvent
+		want  string
+	}{
+		{"error severity", sdk.AuditEvent{Severity: sdk.SeverityError, Message: "deployed"}, FailureClass},
+		{"warning severity", sdk.AuditEvent{Severity: sdk.SeverityWarning}, FailureClass},
+		{"info severity", sdk.AuditEvent{Severity: sdk.SeverityInfo, Message: "0 errors"}, InfoClass},
+		{"no severity, failure message", sdk.AuditEvent{Message: "buildshiprun failure: timeout"}, FailureClass},
+		{"no severity, info message", sdk.AuditEvent{Message: "deployed fn"}, InfoClass},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			if got := classify(tc.event); got != tc.want {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
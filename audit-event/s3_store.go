@@ -0,0 +1,248 @@
+package function
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	minio "github.com/minio/minio-go"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const objectPrefix = "audit-log/"
+
+// S3Store writes one JSON object per event to an S3 or Minio bucket
+type S3Store struct {
+	Client *minio.Client
+	Bucket string
+	Region string
+}
+
+func newS3Store() (*S3Store, error) {
+	region := regionName()
+
+	minioClient, connectErr := connectToMinio(region)
+	if connectErr != nil {
+		return nil, connectErr
+	}
+
+	return &S3Store{
+		Client: minioClient,
+		Bucket: bucketName(),
+		Region: region,
+	}, nil
+}
+
+// Append writes the event to the bucket and returns its object name
+func (s *S3Store) Append(event sdk.AuditEvent) (string, error) {
+	eventPath, err := getPath(&event)
+	if err != nil {
+		return "", err
+	}
+	fullPath := objectPrefix + eventPath
+
+	bytesOut, err := json.Marshal(&event)
+	if err != nil {
+		return fullPath, err
+	}
+
+	s.Client.MakeBucket(s.Bucket, s.Region)
+
+	reader := bytes.NewReader(bytesOut)
+	_, err = s.Client.PutObject(s.Bucket,
+		fullPath,
+		reader,
+		int64(reader.Len()),
+		minio.PutObjectOptions{ContentType: "application/json"})
+
+	return fullPath, err
+}
+
+// List reads every object found under the query's prefix
+func (s *S3Store) List(query Query) ([]sdk.AuditEvent, error) {
+	prefix, err := query.prefix()
+	if err != nil {
+		return nil, err
+	}
+	return s.readEvents(objectPrefix + prefix)
+}
+
+// ListAll reads every event, leaving out the chain's head and checkpoints
+func (s *S3Store) ListAll() ([]sdk.AuditEvent, error) {
+	return s.readEvents(objectPrefix)
+}
+
+func (s *S3Store) readEvents(prefix string) ([]sdk.AuditEvent, error) {
+	events := []sdk.AuditEvent{}
+
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	for info := range s.Client.ListObjects(s.Bucket, prefix, true, doneCh) {
+		if info.Err != nil {
+			return events, info.Err
+		}
+
+		if strings.HasPrefix(info.Key, objectPrefix+chainPath+"/") {
+			continue
+		}
+
+		obj, err := s.Client.GetObject(s.Bucket, info.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return events, err
+		}
+
+		data, err := ioutil.ReadAll(obj)
+		obj.Close()
+		if err != nil {
+			return events, err
+		}
+
+		event := sdk.AuditEvent{}
+		if err := json.Unmarshal(data, &event); err != nil {
+			log.Printf("skipping unreadable event %s, error: %s", info.Key, err.Error())
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// ReadHead reads the head of the chain, which is empty before the
+// first event is added
+func (s *S3Store) ReadHead() (ChainHead, error) {
+	head := ChainHead{}
+
+	data, err := s.readObject(objectPrefix + getHeadPath())
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return head, nil
+		}
+		return head, err
+	}
+
+	err = json.Unmarshal(data, &head)
+	return head, err
+}
+
+// WriteHead replaces the head of the chain
+func (s *S3Store) WriteHead(head ChainHead) error {
+	return s.writeJSON(objectPrefix+getHeadPath(), &head)
+}
+
+// ReadAnchor reads the start of the chain, which is empty until events
+// first expire
+func (s *S3Store) ReadAnchor() (ChainAnchor, error) {
+	anchor := ChainAnchor{}
+
+	data, err := s.readObject(objectPrefix + getAnchorPath())
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return anchor, nil
+		}
+		return anchor, err
+	}
+
+	err = json.Unmarshal(data, &anchor)
+	return anchor, err
+}
+
+// WriteAnchor replaces the start of the chain
+func (s *S3Store) WriteAnchor(anchor ChainAnchor) error {
+	return s.writeJSON(objectPrefix+getAnchorPath(), &anchor)
+}
+
+// WriteCheckpoint writes an object for the checkpoint
+func (s *S3Store) WriteCheckpoint(checkpoint Checkpoint) error {
+	return s.writeJSON(objectPrefix+getCheckpointPath(&checkpoint), &checkpoint)
+}
+
+// ListCheckpoints reads every checkpoint in order of sequence
+func (s *S3Store) ListCheckpoints() ([]Checkpoint, error) {
+	checkpoints := []Checkpoint{}
+
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	for info := range s.Client.ListObjects(s.Bucket, objectPrefix+chainPath+"/checkpoints/", true, doneCh) {
+		if info.Err != nil {
+			return checkpoints, info.Err
+		}
+
+		data, err := s.readObject(info.Key)
+		if err != nil {
+			return checkpoints, err
+		}
+
+		checkpoint := Checkpoint{}
+		if err := json.Unmarshal(data, &checkpoint); err != nil {
+			return checkpoints, err
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, nil
+}
+
+func (s *S3Store) readObject(key string) ([]byte, error) {
+	obj, err := s.Client.GetObject(s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return ioutil.ReadAll(obj)
+}
+
+func (s *S3Store) writeJSON(key string, value interface{}) error {
+	bytesOut, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.Client.MakeBucket(s.Bucket, s.Region)
+
+	reader := bytes.NewReader(bytesOut)
+	_, err = s.Client.PutObject(s.Bucket,
+		key,
+		reader,
+		int64(reader.Len()),
+		minio.PutObjectOptions{ContentType: "application/json"})
+
+	return err
+}
+
+// Expire removes the objects for each day which ended before the given time
+func (s *S3Store) Expire(before time.Time) (int, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	removed := 0
+	for info := range s.Client.ListObjects(s.Bucket, objectPrefix, true, doneCh) {
+		if info.Err != nil {
+			return removed, info.Err
+		}
+
+		parts := strings.Split(strings.TrimPrefix(info.Key, objectPrefix), "/")
+		if len(parts) < 2 {
+			continue
+		}
+
+		day, ok := parseDay(parts[1:])
+		if !ok || !expired(day, before) {
+			continue
+		}
+
+		if err := s.Client.RemoveObject(s.Bucket, info.Key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
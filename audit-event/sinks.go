@@ -0,0 +1,268 @@
+package function
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/alexellis/hmac"
+	minio "github.com/minio/minio-go"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// Types of sink
+const (
+	SlackSink   = "slack"
+	WebhookSink = "webhook"
+	TeamsSink   = "teams"
+	DiscordSink = "discord"
+	FileSink    = "file"
+	S3Sink      = "s3"
+)
+
+// Sink sends an audit event to a destination
+type Sink interface {
+	Send(event sdk.AuditEvent) error
+}
+
+// SlackMessage encapsulates a message for the Slack
+// incoming webhook API
+type SlackMessage struct {
+	Text string `json:"text"`
+}
+
+// TeamsMessage is a Microsoft Teams connector card
+type TeamsMessage struct {
+	Type    string `json:"@type"`
+	Context string `json:"@context"`
+	Summary string `json:"summary"`
+	Text    string `json:"text"`
+}
+
+// DiscordMessage is a message for a Discord webhook
+type DiscordMessage struct {
+	Content string `json:"content"`
+}
+
+func newSink(config SinkConfig, client *http.Client) (Sink, error) {
+	switch config.Type {
+	case SlackSink, TeamsSink, DiscordSink:
+		if len(config.URL) == 0 {
+			return nil, fmt.Errorf("sink %s needs a url", config.Name)
+		}
+		return &chatSink{URL: config.URL, Type: config.Type, Client: client}, nil
+	case WebhookSink:
+		if len(config.URL) == 0 {
+			return nil, fmt.Errorf("sink %s needs a url", config.Name)
+		}
+		return &webhookSink{URL: config.URL, Secret: config.Secret, Client: client}, nil
+	case FileSink:
+		if len(config.Path) == 0 {
+			return nil, fmt.Errorf("sink %s needs a path", config.Name)
+		}
+		return &fileSink{Path: config.Path}, nil
+	case S3Sink:
+		return newS3Sink(config)
+	}
+
+	return nil, fmt.Errorf("sink %s has an unsupported type: %q", config.Name, config.Type)
+}
+
+// chatSink posts the text of an event to Slack, Teams or Discord
+type chatSink struct {
+	URL    string
+	Type   string
+	Client *http.Client
+}
+
+func (s *chatSink) Send(event sdk.AuditEvent) error {
+	text := event.Text()
+
+	var msg interface{}
+	switch s.Type {
+	case TeamsSink:
+		msg = TeamsMessage{
+			Type:    "MessageCard",
+			Context: "https://schema.org/extensions",
+			Summary: "OpenFaaS Cloud: " + event.Source,
+			Text:    text,
+		}
+	case DiscordSink:
+		msg = DiscordMessage{Content: text}
+	default:
+		msg = SlackMessage{Text: text}
+	}
+
+	bytesOut, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return post(s.Client, s.URL, bytesOut, map[string]string{})
+}
+
+// webhookSink posts the event as JSON
+type webhookSink struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (s *webhookSink) Send(event sdk.AuditEvent) error {
+	bytesOut, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	if len(s.Secret) > 0 {
+		digest := hmac.Sign(bytesOut, []byte(s.Secret))
+		headers[sdk.CloudSignatureHeader] = "sha1=" + hex.EncodeToString(digest)
+	}
+
+	return post(s.Client, s.URL, bytesOut, headers)
+}
+
+func post(c *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	ioutil.ReadAll(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// fileSink appends each event as a line of JSON
+type fileSink struct {
+	Path string
+}
+
+func (s *fileSink) Send(event sdk.AuditEvent) error {
+	bytesOut, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path.Dir(s.Path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(bytesOut, '\n'))
+	return err
+}
+
+// s3Sink writes one object per event, as objects cannot be appended to
+type s3Sink struct {
+	Client *minio.Client
+	Bucket string
+	Region string
+	Prefix string
+}
+
+func newS3Sink(config SinkConfig) (*s3Sink, error) {
+	region := regionName()
+
+	client, err := connectToMinio(region)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := config.Bucket
+	if len(bucket) == 0 {
+		bucket = bucketName()
+	}
+
+	prefix := config.Prefix
+	if len(prefix) == 0 {
+		prefix = "audit/"
+	}
+
+	return &s3Sink{Client: client, Bucket: bucket, Region: region, Prefix: prefix}, nil
+}
+
+func (s *s3Sink) Send(event sdk.AuditEvent) error {
+	bytesOut, err := json.Marshal(&event)
+	if err != nil {
+		return err
+	}
+
+	s.Client.MakeBucket(s.Bucket, s.Region)
+
+	reader := bytes.NewReader(bytesOut)
+	_, err = s.Client.PutObject(s.Bucket,
+		getObjectName(s.Prefix, event, time.Now().UTC()),
+		reader,
+		int64(reader.Len()),
+		minio.PutObjectOptions{ContentType: "application/json"})
+
+	return err
+}
+
+// getObjectName produces a name such as audit/2020/03/02/1583143200000000000-buildshiprun.json
+func getObjectName(prefix string, event sdk.AuditEvent, now time.Time) string {
+	source := event.Source
+	if len(source) == 0 {
+		source = "unknown"
+	}
+	return fmt.Sprintf("%s%s/%d-%s.json", prefix, now.Format("2006/01/02"), now.UnixNano(), source)
+}
+
+func connectToMinio(region string) (*minio.Client, error) {
+	endpoint := os.Getenv("s3_url")
+
+	tlsEnabled := false
+	if connection := os.Getenv("s3_tls"); connection == "true" || connection == "1" {
+		tlsEnabled = true
+	}
+
+	secretKey, _ := sdk.ReadSecret("s3-secret-key")
+	accessKey, _ := sdk.ReadSecret("s3-access-key")
+
+	return minio.New(endpoint, accessKey, secretKey, tlsEnabled)
+}
+
+func bucketName() string {
+	bucketName, exist := os.LookupEnv("s3_bucket")
+	if exist == false || len(bucketName) == 0 {
+		bucketName = "pipeline"
+		log.Printf("Bucket name not found, set to default: %v\n", bucketName)
+	}
+	return bucketName
+}
+
+func regionName() string {
+	regionName, exist := os.LookupEnv("s3_region")
+	if exist == false || len(regionName) == 0 {
+		regionName = "us-east-1"
+	}
+	return regionName
+}
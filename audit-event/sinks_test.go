@@ -0,0 +1,168 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_chatSink_Formats(t *testing.T) {
+	event := sdk.AuditEvent{Source: "git-tar", Owner: "alexellis", Repo: "fn", Message: "built"}
+
+	cases := []struct {
+		sinkType string
+		want     string
+	}{
+		{SlackSink, `{"text":"[git-tar] alexellis/fn: 'built'"}`},
+		{DiscordSink, `{"content":"[git-tar] alexellis/fn: 'built'"}`},
+		{TeamsSink, `"@type":"MessageCard"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.sinkType, func(t *testing.T) {
+			var body string
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				body = string(data)
+			}))
+			defer s.Close()
+
+			sink, _ := newSink(SinkConfig{Name: tc.sinkType, Type: tc.sinkType, URL: s.URL}, http.DefaultClient)
+			if err := sink.Send(event); err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			if !strings.Contains(body, tc.want) {
+				t.Errorf("want body to contain %s, got %s", tc.want, body)
+			}
+		})
+	}
+}
+
+func Test_webhookSink_Signs(t *testing.T) {
+	var signature string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(sdk.CloudSignatureHeader)
+	}))
+	defer s.Close()
+
+	sink, _ := newSink(SinkConfig{Name: "hook", Type: WebhookSink, URL: s.URL, Secret: "secret"}, http.DefaultClient)
+	if err := sink.Send(sdk.AuditEvent{Source: "git-tar"}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if !strings.HasPrefix(signature, "sha1=") {
+		t.Errorf("want a sha1 signature, got: %q", signature)
+	}
+}
+
+func Test_fileSink_Appends(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit-event")
+	defer os.RemoveAll(dir)
+
+	sink := &fileSink{Path: path.Join(dir, "audit", "events.jsonl")}
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(sdk.AuditEvent{Source: "git-tar", Message: fmt.Sprintf("event %d", i)}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	data, _ := ioutil.ReadFile(sink.Path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got %d", len(lines))
+	}
+
+	event := sdk.AuditEvent{}
+	json.Unmarshal([]byte(lines[1]), &event)
+	if event.Message != "event 1" {
+		t.Errorf("want event 1, got %s", event.Message)
+	}
+}
+
+func Test_newSink_UnknownType(t *testing.T) {
+	_, err := newSink(SinkConfig{Name: "x", Type: "pager"}, http.DefaultClient)
+	if err == nil {
+		t.Errorf("want an error for an unknown type")
+	}
+}
+
+func Test_getObjectName(t *testing.T) {
+	now := time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC)
+	got := getObjectName("audit/", sdk.AuditEvent{Source: "buildshiprun"}, now)
+	want := fmt.Sprintf("audit/2020/03/02/%d-buildshiprun.json", now.UnixNano())
+
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+type flakySink struct {
+	failures int
+	calls    int
+}
+
+func (f *flakySink) Send(event sdk.AuditEvent) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return fmt.Errorf("unavailable")
+	}
+	return nil
+}
+
+func Test_send_Retries(t *testing.T) {
+	sink := &flakySink{failures: 2}
+
+	result := send("flaky", sink, sdk.AuditEvent{}, RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	if result.Err != nil {
+		t.Fatalf("want success on the third attempt, got: %s", result.Err.Error())
+	}
+	if result.Attempts != 3 {
+		t.Errorf("want 3 attempts, got %d", result.Attempts)
+	}
+}
+
+func Test_send_GivesUp(t *testing.T) {
+	sink := &flakySink{failures: 5}
+
+	result := send("flaky", sink, sdk.AuditEvent{}, RetryPolicy{Attempts: 2, Backoff: time.Millisecond})
+	if result.Err == nil {
+		t.Fatalf("want an error")
+	}
+	if sink.calls != 2 {
+		t.Errorf("want 2 calls, got %d", sink.calls)
+	}
+}
+
+func Test_updateStats(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit-event")
+	defer os.RemoveAll(dir)
+
+	statsFile := path.Join(dir, "stats.json")
+	now := time.Now().UTC()
+
+	updateStats(statsFile, []SinkResult{{Sink: "ops", Attempts: 1}, {Sink: "hook", Attempts: 3, Err: fmt.Errorf("timeout")}}, now)
+	updateStats(statsFile, []SinkResult{{Sink: "ops", Attempts: 2}}, now)
+
+	stats, err := readStats(statsFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if stats["ops"].Sent != 2 || stats["ops"].Retried != 1 {
+		t.Errorf("want ops sent 2, retried 1, got %+v", stats["ops"])
+	}
+	if stats["hook"].Failed != 1 || stats["hook"].Retried != 2 || stats["hook"].LastError != "timeout" {
+		t.Errorf("want hook failed 1, retried 2, got %+v", stats["hook"])
+	}
+}
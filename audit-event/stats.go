@@ -0,0 +1,110 @@
+package function
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+)
+
+// SinkStats counts the deliveries made to a sink
+type SinkStats struct {
+	Sent      int64      `json:"sent"`
+	Failed    int64      `json:"failed"`
+	Retried   int64      `json:"retried"`
+	LastError string     `json:"lastError,omitempty"`
+	LastFail  *time.Time `json:"lastFail,omitempty"`
+}
+
+// SinkResult is the outcome of sending an event to one sink
+type SinkResult struct {
+	Sink     string
+	Attempts int
+	Err      error
+}
+
+func statsPath() string {
+	if val, ok := os.LookupEnv("sink_stats_path"); ok && len(val) > 0 {
+		return val
+	}
+	return "/tmp/audit-event-sinks.json"
+}
+
+// readStats reads the counters for each sink, a missing file means that
+// nothing has been sent yet
+func readStats(path string) (map[string]*SinkStats, error) {
+	stats := map[string]*SinkStats{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return stats, err
+	}
+
+	err = json.Unmarshal(data, &stats)
+	return stats, err
+}
+
+// updateStats adds the results to the counters, the file is locked whilst
+// it is updated since several events may be handled at once
+func updateStats(path string, results []SinkResult, now time.Time) error {
+	return withLock(path+".lock", func() error {
+		return writeStats(path, results, now)
+	})
+}
+
+// withLock runs fn whilst holding an exclusive lock on the file at
+// lockPath, so that only one event at a time can update shared state
+func withLock(lockPath string, fn func() error) error {
+	lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	return fn()
+}
+
+func writeStats(path string, results []SinkResult, now time.Time) error {
+	stats, err := readStats(path)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		sinkStats, ok := stats[result.Sink]
+		if !ok {
+			sinkStats = &SinkStats{}
+			stats[result.Sink] = sinkStats
+		}
+
+		if result.Attempts > 1 {
+			sinkStats.Retried += int64(result.Attempts - 1)
+		}
+
+		if result.Err != nil {
+			failedAt := now
+			sinkStats.Failed++
+			sinkStats.LastError = result.Err.Error()
+			sinkStats.LastFail = &failedAt
+		} else {
+			sinkStats.Sent++
+		}
+	}
+
+	data, _ := json.Marshal(stats)
+
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
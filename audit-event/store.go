@@ -0,0 +1,165 @@
+package function
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const (
+	// S3Storage keeps events in an S3 or Minio bucket
+	S3Storage = "s3"
+	// FilesystemStorage keeps events in a local or mounted directory
+	FilesystemStorage = "filesystem"
+
+	// systemOwner is used in the path of events without an owner, it
+	// cannot clash with a user since logins cannot start with "_"
+	systemOwner = "_system"
+)
+
+// Store persists audit events so that they can be queried
+type Store interface {
+	Append(event sdk.AuditEvent) (string, error)
+	List(query Query) ([]sdk.AuditEvent, error)
+
+	// Expire removes the events from days which ended before the given time
+	Expire(before time.Time) (int, error)
+
+	// ListAll reads the events for every owner to verify the chain
+	ListAll() ([]sdk.AuditEvent, error)
+
+	ReadHead() (ChainHead, error)
+	WriteHead(head ChainHead) error
+	ReadAnchor() (ChainAnchor, error)
+	WriteAnchor(anchor ChainAnchor) error
+	WriteCheckpoint(checkpoint Checkpoint) error
+	ListCheckpoints() ([]Checkpoint, error)
+}
+
+// newStore picks a backend from the storage env-var, events are
+// only sent to sinks when it is not set
+func newStore() (Store, error) {
+	storage := os.Getenv("storage")
+
+	switch storage {
+	case "":
+		return nil, nil
+	case S3Storage:
+		return newS3Store()
+	case FilesystemStorage:
+		return newFilesystemStore(storagePath())
+	}
+
+	return nil, fmt.Errorf("unsupported storage: %q, use %q or %q", storage, S3Storage, FilesystemStorage)
+}
+
+// ownerPath gives the directory of an owner's events. An owner must be a
+// valid name, so that it cannot hold a path separator or start with "_"
+// and reach the chain or the events without an owner.
+func ownerPath(owner string) (string, error) {
+	if len(owner) == 0 {
+		return systemOwner, nil
+	}
+	if !sdk.ValidName(owner) {
+		return "", fmt.Errorf("invalid owner: %q", owner)
+	}
+	return strings.ToLower(owner), nil
+}
+
+// getPath produces a string such as alexellis/2020/03/02/1583143200000000000-42-buildshiprun.json,
+// the sequence keeps two events from the same source at the same time apart
+func getPath(event *sdk.AuditEvent) (string, error) {
+	source := event.Source
+	if len(source) == 0 {
+		source = "unknown"
+	}
+	if !sdk.ValidName(source) {
+		return "", fmt.Errorf("invalid source: %q", source)
+	}
+
+	owner, err := ownerPath(event.Owner)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s/%d-%d-%s.json",
+		owner,
+		event.Timestamp.UTC().Format("2006/01/02"),
+		event.Timestamp.UnixNano(),
+		event.Sequence,
+		source), nil
+}
+
+// getCheckpointPath produces a string such as _chain/checkpoints/00000000000000000100.json
+// so that checkpoints are listed in order
+func getCheckpointPath(checkpoint *Checkpoint) string {
+	return fmt.Sprintf("%s/checkpoints/%020d.json", chainPath, checkpoint.Sequence)
+}
+
+func getHeadPath() string {
+	return chainPath + "/head.json"
+}
+
+func getAnchorPath() string {
+	return chainPath + "/anchor.json"
+}
+
+// parseDay reads the day from the yyyy/mm/dd part of a path
+func parseDay(parts []string) (time.Time, bool) {
+	if len(parts) < 3 {
+		return time.Time{}, false
+	}
+
+	day, err := time.Parse("2006/01/02", strings.Join(parts[:3], "/"))
+	return day, err == nil
+}
+
+// expired is true when the whole of the day is before the given time
+func expired(day, before time.Time) bool {
+	return !day.Add(24 * time.Hour).After(before)
+}
+
+func sortNewestFirst(events []sdk.AuditEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.After(events[j].Timestamp)
+	})
+}
+
+func storagePath() string {
+	val, exists := os.LookupEnv("storage_path")
+	if exists == false || len(val) == 0 {
+		val = "/tmp/audit-event"
+	}
+	return val
+}
+
+// retention is how long events are kept for, zero keeps them forever
+func retention() time.Duration {
+	if val, ok := os.LookupEnv("retention"); ok && len(val) > 0 {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return 0
+}
+
+// expireDue records when expiry last ran in the file at markerPath and
+// returns true when it has not run for the interval
+func expireDue(markerPath string, interval time.Duration, now time.Time) bool {
+	if data, err := ioutil.ReadFile(markerPath); err == nil {
+		if last, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			if now.Sub(time.Unix(last, 0)) < interval {
+				return false
+			}
+		}
+	}
+
+	ioutil.WriteFile(markerPath, []byte(strconv.FormatInt(now.Unix(), 10)), 0600)
+	return true
+}
@@ -0,0 +1,156 @@
+package function
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_getPath(t *testing.T) {
+	got, _ := getPath(&sdk.AuditEvent{
+		Owner:     "AlexEllis",
+		Source:    "buildshiprun",
+		Timestamp: time.Unix(1577836800, 0),
+		Sequence:  42,
+	})
+	want := "alexellis/2020/01/01/1577836800000000000-42-buildshiprun.json"
+	if got != want {
+		t.Errorf("got: %s, but want: %s", got, want)
+	}
+}
+
+func Test_getPath_WithoutOwner(t *testing.T) {
+	got, _ := getPath(&sdk.AuditEvent{
+		Source:    "github-event",
+		Timestamp: time.Unix(1577836800, 0),
+	})
+	want := "_system/2020/01/01/1577836800000000000-0-github-event.json"
+	if got != want {
+		t.Errorf("got: %s, but want: %s", got, want)
+	}
+}
+
+func Test_getPath_RejectsPaths(t *testing.T) {
+	events := []sdk.AuditEvent{
+		{Owner: "../alexellis", Source: "buildshiprun"},
+		{Owner: "alexellis/../rgee0", Source: "buildshiprun"},
+		{Owner: "_chain", Source: "buildshiprun"},
+		{Owner: "_system", Source: "buildshiprun"},
+		{Owner: "alexellis", Source: "../../_chain/head"},
+	}
+
+	for _, event := range events {
+		if got, err := getPath(&event); err == nil {
+			t.Errorf("owner %q source %q: want error, got: %s", event.Owner, event.Source, got)
+		}
+	}
+}
+
+func Test_FilesystemStore_AppendListExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newFilesystemStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	events := []sdk.AuditEvent{
+		{Owner: "alexellis", Repo: "fn", Source: "git-tar", Timestamp: now.Add(-72 * time.Hour)},
+		{Owner: "alexellis", Repo: "fn", Source: "buildshiprun", Timestamp: now},
+		{Owner: "openfaas", Repo: "fn", Source: "buildshiprun", Timestamp: now},
+	}
+
+	for _, event := range events {
+		if _, err := store.Append(event); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	listed, err := store.List(Query{Owner: "alexellis"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(listed) != 2 {
+		t.Fatalf("want 2 events for alexellis, got %d", len(listed))
+	}
+
+	removed, err := store.Expire(now.Add(-48 * time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if removed != 1 {
+		t.Errorf("want 1 day removed, got %d", removed)
+	}
+
+	listed, _ = store.List(Query{Owner: "alexellis"})
+	if len(listed) != 1 || listed[0].Source != "buildshiprun" {
+		t.Errorf("want only the recent event to be kept, got %v", listed)
+	}
+}
+
+func Test_FilesystemStore_AppendSameTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := newFilesystemStore(dir)
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	first := sdk.AuditEvent{Owner: "alexellis", Source: "git-tar", Timestamp: now, Sequence: 1}
+	second := sdk.AuditEvent{Owner: "alexellis", Source: "git-tar", Timestamp: now, Sequence: 2}
+
+	for _, event := range []sdk.AuditEvent{first, second} {
+		if _, err := store.Append(event); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	if _, err := store.Append(second); err == nil {
+		t.Errorf("want an error when an event would be written over another")
+	}
+
+	listed, _ := store.List(Query{Owner: "alexellis"})
+	if len(listed) != 2 {
+		t.Errorf("want both events to be kept, got %d", len(listed))
+	}
+}
+
+func Test_expired(t *testing.T) {
+	day := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	if expired(day, day.Add(23*time.Hour)) {
+		t.Errorf("want a day which has not ended to be kept")
+	}
+	if !expired(day, day.Add(24*time.Hour)) {
+		t.Errorf("want a day which has ended to expire")
+	}
+}
+
+func Test_expireDue(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit-event")
+	defer os.RemoveAll(dir)
+
+	marker := filepath.Join(dir, "expired")
+	now := time.Now()
+
+	if !expireDue(marker, time.Hour, now) {
+		t.Errorf("want expiry to be due the first time")
+	}
+	if expireDue(marker, time.Hour, now.Add(time.Minute)) {
+		t.Errorf("want expiry not to be due within the interval")
+	}
+	if !expireDue(marker, time.Hour, now.Add(2*time.Hour)) {
+		t.Errorf("want expiry to be due after the interval")
+	}
+}
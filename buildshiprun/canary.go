@@ -0,0 +1,82 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// getCanaryWeight reads the percentage of traffic requested for a canary,
+// a weight of 0 means the function is updated in place.
+func getCanaryWeight(annotations map[string]string) (int, error) {
+	val, ok := annotations[sdk.CanaryWeightAnnotation]
+	if !ok || len(val) == 0 {
+		return 0, nil
+	}
+
+	weight, err := strconv.Atoi(val)
+	if err != nil || weight < 1 || weight > 99 {
+		return 0, fmt.Errorf("annotation %s must be a percentage between 1 and 99, got: %q", sdk.CanaryWeightAnnotation, val)
+	}
+
+	return weight, nil
+}
+
+// applyCanary converts the spec of a stable function into the spec for
+// its canary. What is needed to promote it later is stored through the
+// Kubernetes API, the canary is only annotated with its hash so that the
+// environment and secrets are not shown with the function.
+func applyCanary(k *sdk.KubeClient, deploy *faasSDK.DeployFunctionSpec, namespace string, weight int) error {
+	spec := sdk.CanarySpec{
+		EnvVars:                deploy.EnvVars,
+		Secrets:                deploy.Secrets,
+		ReadOnlyRootFilesystem: deploy.ReadOnlyRootFilesystem,
+	}
+
+	if limits := deploy.FunctionResourceRequest.Limits; limits != nil {
+		spec.LimitsMemory = limits.Memory
+		spec.LimitsCPU = limits.CPU
+	}
+	if requests := deploy.FunctionResourceRequest.Requests; requests != nil {
+		spec.RequestsMemory = requests.Memory
+		spec.RequestsCPU = requests.CPU
+	}
+
+	canaryName := sdk.FormatCanaryName(deploy.FunctionName)
+
+	hash, err := sdk.WriteCanarySpec(k, canaryName, namespace, spec)
+	if err != nil {
+		return fmt.Errorf("unable to store the spec of %s: %s", canaryName, err.Error())
+	}
+
+	deploy.FunctionName = canaryName
+	deploy.Labels["faas_function"] = canaryName
+	deploy.Labels["app"] = canaryName
+	deploy.Labels[sdk.CanaryLabel] = "1"
+
+	if deploy.Annotations == nil {
+		deploy.Annotations = map[string]string{}
+	}
+	deploy.Annotations[sdk.CanaryWeightAnnotation] = strconv.Itoa(weight)
+	deploy.Annotations[sdk.CanarySpecAnnotation] = hash
+
+	return nil
+}
+
+// removeFailedCanary deletes a canary which never became ready so
+// that the edge-router stops sending traffic to it, along with its spec.
+func removeFailedCanary(ctx context.Context, client *faasSDK.Client, k *sdk.KubeClient, canaryName, namespace string) {
+	log.Printf("Removing canary %s which failed verification", canaryName)
+
+	if err := client.DeleteFunction(ctx, canaryName, namespace); err != nil {
+		log.Printf("unable to remove canary %s: %s", canaryName, err.Error())
+	}
+
+	if err := sdk.DeleteCanarySpec(k, canaryName, namespace); err != nil {
+		log.Printf("unable to remove the spec of canary %s: %s", canaryName, err.Error())
+	}
+}
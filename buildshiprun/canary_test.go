@@ -0,0 +1,111 @@
+package function
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/faas-cli/stack"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_getCanaryWeight(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		want        int
+		wantErr     bool
+	}{
+		{title: "No annotation", annotations: map[string]string{}, want: 0},
+		{title: "Valid weight", annotations: map[string]string{sdk.CanaryWeightAnnotation: "10"}, want: 10},
+		{title: "Zero weight", annotations: map[string]string{sdk.CanaryWeightAnnotation: "0"}, wantErr: true},
+		{title: "Full weight", annotations: map[string]string{sdk.CanaryWeightAnnotation: "100"}, wantErr: true},
+		{title: "Not a number", annotations: map[string]string{sdk.CanaryWeightAnnotation: "ten"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got, err := getCanaryWeight(test.annotations)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("want error: %v, got: %v", test.wantErr, err)
+			}
+			if got != test.want {
+				t.Errorf("want weight: %d, got: %d", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_applyCanary(t *testing.T) {
+	deploy := &faasSDK.DeployFunctionSpec{
+		FunctionName: "alexellis-fn1",
+		Image:        "registry/alexellis-fn1:abc",
+		EnvVars:      map[string]string{"mode": "test"},
+		Secrets:      []string{"alexellis-token"},
+		Labels: map[string]string{
+			"faas_function": "alexellis-fn1",
+			"app":           "alexellis-fn1",
+		},
+		FunctionResourceRequest: faasSDK.FunctionResourceRequest{
+			Limits: &stack.FunctionResources{Memory: "128Mi"},
+		},
+	}
+
+	var stored []byte
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+		case http.MethodPost:
+			if r.URL.Path != "/api/v1/namespaces/openfaas-canaries/secrets" {
+				t.Errorf("unexpected path: %s", r.URL.Path)
+			}
+			stored, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer api.Close()
+
+	k := &sdk.KubeClient{BaseURL: api.URL, Client: http.DefaultClient}
+
+	if err := applyCanary(k, deploy, "", 25); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if deploy.FunctionName != "alexellis-fn1-canary" {
+		t.Errorf("want name alexellis-fn1-canary, got: %s", deploy.FunctionName)
+	}
+	if deploy.Labels["faas_function"] != "alexellis-fn1-canary" {
+		t.Errorf("want faas_function label alexellis-fn1-canary, got: %s", deploy.Labels["faas_function"])
+	}
+	if !sdk.IsCanary(deploy.Labels) {
+		t.Errorf("want canary label to be set")
+	}
+	if deploy.Annotations[sdk.CanaryWeightAnnotation] != "25" {
+		t.Errorf("want weight 25, got: %s", deploy.Annotations[sdk.CanaryWeightAnnotation])
+	}
+
+	hash := deploy.Annotations[sdk.CanarySpecAnnotation]
+	if len(hash) != 64 || strings.Contains(hash, "alexellis-token") {
+		t.Errorf("want only the hash of the spec on the canary, got: %s", hash)
+	}
+
+	secret := struct {
+		Data map[string][]byte `json:"data"`
+	}{}
+	if err := json.Unmarshal(stored, &secret); err != nil {
+		t.Fatalf("unable to read stored secret: %s", err.Error())
+	}
+
+	spec, err := sdk.UnmarshalCanarySpec(string(secret.Data["spec"]))
+	if err != nil {
+		t.Fatalf("unable to read canary spec: %s", err.Error())
+	}
+	if spec.EnvVars["mode"] != "test" || spec.LimitsMemory != "128Mi" || len(spec.Secrets) != 1 {
+		t.Errorf("canary spec not preserved, got: %+v", spec)
+	}
+}
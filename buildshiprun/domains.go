@@ -0,0 +1,30 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// domainResolver looks up the TXT records for custom domains
+var domainResolver = sdk.NewTXTResolver()
+
+// checkCustomDomain gives a warning when the function claims a custom
+// domain which is not verified, the function is still deployed and the
+// edge-router starts serving the domain once the TXT record is found
+func checkCustomDomain(annotations map[string]string, owner string, resolver sdk.TXTResolver) string {
+	domain, ok := annotations[sdk.CustomDomainAnnotation]
+	if !ok {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := sdk.VerifyDomain(ctx, resolver, domain, owner); err != nil {
+		return fmt.Sprintf("custom domain %s is not verified: %s", domain, err.Error())
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := f[name]; ok {
+		return records, nil
+	}
+	return nil, fmt.Errorf("no such host")
+}
+
+func Test_checkCustomDomain(t *testing.T) {
+	resolver := fakeResolver{
+		"_openfaas-cloud.www.example.com": {"openfaas-cloud-owner=alexellis"},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		owner       string
+		wantWarning string
+	}{
+		{"no custom domain", map[string]string{}, "alexellis", ""},
+		{"verified", map[string]string{sdk.CustomDomainAnnotation: "www.example.com"}, "alexellis", ""},
+		{"another owner", map[string]string{sdk.CustomDomainAnnotation: "www.example.com"}, "rgee0", "custom domain www.example.com is not verified"},
+		{"no record", map[string]string{sdk.CustomDomainAnnotation: "api.example.com"}, "alexellis", "custom domain api.example.com is not verified"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := checkCustomDomain(test.annotations, test.owner, resolver)
+			if len(test.wantWarning) == 0 && len(got) > 0 {
+				t.Errorf("want no warning, got: %q", got)
+			}
+			if !strings.HasPrefix(got, test.wantWarning) {
+				t.Errorf("want warning %q, got: %q", test.wantWarning, got)
+			}
+		})
+	}
+}
@@ -43,22 +43,25 @@ type CPULimits struct {
 
 //FaaSAuth Authentication type for OpenFaaS
 type FaaSAuth struct {
+	// Target is the gateway to authenticate with, when empty
+	// the credentials of the local gateway are used
+	Target sdk.DeployTarget
 }
 
 //Set add basic authentication to the request
 func (auth *FaaSAuth) Set(req *http.Request) error {
-	return sdk.AddBasicAuth(req)
+	return auth.Target.AddBasicAuth(req)
 }
 
 var (
-	timeout   = 3 * time.Second
-	namespace = ""
+	timeout = 3 * time.Second
 )
 
 // Handle submits the tar to the of-builder then configures an OpenFaaS
 // deployment based upon stack.yml found in the Git repo. Finally starts
 // a rolling deployment of the function.
 func Handle(req []byte) string {
+	start := time.Now()
 
 	hmacErr := validateRequest(&req)
 	if hmacErr != nil {
@@ -80,17 +83,102 @@ func Handle(req []byte) string {
 		log.Panic(eventErr)
 	}
 
+	serviceValue := sdk.FormatServiceName(event.Owner, event.Service)
+
 	auditEvent := sdk.AuditEvent{
-		Owner:  event.Owner,
-		Repo:   event.Repository,
-		Source: "buildshiprun",
+		Owner:    event.Owner,
+		Repo:     event.Repository,
+		Source:   "buildshiprun",
+		SHA:      event.SHA,
+		Function: serviceValue,
+		BuildID:  event.BuildID,
 	}
-
-	serviceValue := sdk.FormatServiceName(event.Owner, event.Service)
 	log.Printf("%d env-vars for %s", len(event.Environment), serviceValue)
+	log.Printf("Build %s for %s", event.BuildID, serviceValue)
+
+	span := sdk.StartSpan("buildshiprun", "buildshiprun", event.BuildID)
+	span.SetAttribute("owner", event.Owner)
+	span.SetAttribute("repo", event.Repository)
+	span.SetAttribute("function", serviceValue)
+	defer span.Finish()
 
 	status := sdk.BuildStatus(event, sdk.EmptyAuthToken)
 
+	ctx := context.Background()
+
+	targets, targetsErr := getDeployTargets(event)
+	if targetsErr != nil {
+		log.Printf("Deploy target error for %s: %s", serviceValue, targetsErr.Error())
+
+		status.AddStatus(sdk.StatusFailure, targetsErr.Error(), sdk.BuildFunctionContext(event.Service))
+		statusErr := reportStatus(status, event.SCM)
+		if statusErr != nil {
+			log.Printf(statusErr.Error())
+		}
+
+		auditEvent.Type = sdk.AuditDeployFailed
+		auditEvent.Error = targetsErr.Error()
+		auditEvent.Message = fmt.Sprintf("buildshiprun failure: %s", targetsErr.Error())
+		sdk.PostAudit(auditEvent)
+
+		return auditEvent.Message
+	}
+
+	quota, quotaReadErr := getQuota(event.Owner)
+
+	for _, target := range targets {
+		client := newTargetClient(target)
+		namespace := target.FunctionNamespace(event.Owner)
+
+		// Namespaces can only be created on the cluster running OpenFaaS Cloud,
+		// other targets must already have the namespace and secrets
+		var nsErr error
+		if target.IsLocal() {
+			nsErr = prepareNamespace(namespace, event.Owner)
+		} else {
+			nsErr = checkRemoteTarget(ctx, client, namespace, event.Secrets)
+		}
+
+		if nsErr != nil {
+			log.Printf("Namespace error for %s: %s", serviceValue, nsErr.Error())
+
+			status.AddStatus(sdk.StatusFailure, nsErr.Error(), target.Context(event.Service))
+			statusErr := reportStatus(status, event.SCM)
+			if statusErr != nil {
+				log.Printf(statusErr.Error())
+			}
+
+			auditEvent.Type = sdk.AuditDeployFailed
+			auditEvent.Error = nsErr.Error()
+			auditEvent.Message = fmt.Sprintf("buildshiprun failure: %s", nsErr.Error())
+			sdk.PostAudit(auditEvent)
+
+			return auditEvent.Message
+		}
+
+		quotaErr := quotaReadErr
+		if quotaErr == nil {
+			quotaErr = checkFunctionQuota(ctx, client, event.Owner, namespace, serviceValue, quota)
+		}
+
+		if quotaErr != nil {
+			log.Printf("Rejecting %s: %s", serviceValue, quotaErr.Error())
+
+			status.AddStatus(sdk.StatusFailure, quotaErr.Error(), target.Context(event.Service))
+			statusErr := reportStatus(status, event.SCM)
+			if statusErr != nil {
+				log.Printf(statusErr.Error())
+			}
+
+			auditEvent.Type = sdk.AuditDeployRejected
+			auditEvent.Error = quotaErr.Error()
+			auditEvent.Message = fmt.Sprintf("buildshiprun rejected %s: %s", serviceValue, quotaErr.Error())
+			sdk.PostAudit(auditEvent)
+
+			return auditEvent.Message
+		}
+	}
+
 	reader := bytes.NewBuffer(req)
 
 	xCloudSignature := os.Getenv("Http_X_Cloud_Signature")
@@ -100,11 +188,20 @@ func Handle(req []byte) string {
 	r.Header.Set(sdk.CloudSignatureHeader, xCloudSignature)
 	r.Header.Set("Content-Type", "application/octet-stream")
 
+	buildSpan := span.StartChild("of-builder build")
+	buildSpan.Inject(r)
+
 	res, err := http.DefaultClient.Do(r)
 
+	buildSpan.SetError(err)
+	buildSpan.Finish()
+
 	if err != nil {
 		log.Printf("of-builder error: %s\n", err)
 
+		auditEvent.Type = sdk.AuditBuildFailed
+		auditEvent.Error = err.Error()
+		auditEvent.Duration = time.Since(start)
 		auditEvent.Message = fmt.Sprintf("buildshiprun failure: %s", err.Error())
 		sdk.PostAudit(auditEvent)
 
@@ -129,6 +226,9 @@ func Handle(req []byte) string {
 	if unmarshalErr != nil {
 		log.Printf("BuildResult unmarshalErr %s\n", unmarshalErr)
 
+		auditEvent.Type = sdk.AuditBuildFailed
+		auditEvent.Error = unmarshalErr.Error()
+		auditEvent.Duration = time.Since(start)
 		auditEvent.Message = fmt.Sprintf("buildshiprun failure reading response: %s, response: %s", unmarshalErr.Error(), string(buildBytes))
 		sdk.PostAudit(auditEvent)
 
@@ -178,152 +278,286 @@ func Handle(req []byte) string {
 			log.Printf(statusErr.Error())
 		}
 
+		auditEvent.Type = sdk.AuditBuildFailed
+		auditEvent.Error = msg
+		auditEvent.Duration = time.Since(start)
 		auditEvent.Message = fmt.Sprintf("Error with buildshiprun: %s", msg)
 		sdk.PostAudit(auditEvent)
 
+		recordDeploy(event, "", imageName, sdk.StatusFailure, msg, start, gatewayURL, payloadSecret)
+
 		log.Printf("of-builder result: %s, logs: %s\n", result.Status, strings.Join(result.Log, "\n"))
 
+		span.SetError(fmt.Errorf("%s", msg))
+		span.Finish()
+
 		log.Fatal(msg)
 		return msg
 	}
-	// Initializing the client and context
-	client := faasSDK.NewClient(&FaaSAuth{}, gatewayURL, nil, &timeout)
-	ctx := context.Background()
+	failures := []string{}
 
-	if len(imageName) > 0 {
-		// Replace image name for "localhost" for deployment
-		imageName = getImageName(repositoryURL, pushRepositoryURL, imageName)
+	for _, target := range targets {
+		deployedMessage := fmt.Sprintf("deployed: %s", serviceValue)
 
-		log.Printf("Deploying %s as %s", imageName, serviceValue)
+		if len(imageName) > 0 {
+			// Replace image name for "localhost" for deployment
+			targetImage := getImageName(getTargetRepositoryURL(target, repositoryURL), pushRepositoryURL, imageName)
 
-		defaultMemoryLimit := getMemoryLimit()
+			log.Printf("Deploying %s as %s to %s", targetImage, serviceValue, target.GatewayURL)
 
-		scalingMinLimit := getConfig("scaling_min_limit", "1")
-		scalingMaxLimit := getConfig("scaling_max_limit", "4")
+			message, deployResult, warnings, err := deployToTarget(ctx, newTargetClient(target), target, event, targetImage, quota)
 
-		scalingFactor := getConfig("scaling_factor", "20")
+			auditTarget := ""
+			if len(target.Name) > 0 {
+				auditTarget = " to " + target.Name
+			}
 
-		readOnlyRootFS := getReadOnlyRootFS()
+			if err != nil {
+				status.AddStatus(sdk.StatusFailure, err.Error(), target.Context(event.Service))
+
+				recordDeploy(event, target.Name, targetImage, sdk.StatusFailure, err.Error(), start, gatewayURL, payloadSecret)
+				auditEvent.Type = sdk.AuditDeployFailed
+				auditEvent.Error = err.Error()
+				auditEvent.Duration = time.Since(start)
+				auditEvent.Message = fmt.Sprintf("buildshiprun failure%s: %s", auditTarget, err.Error())
+				sdk.PostAudit(auditEvent)
+
+				failures = append(failures, err.Error())
+				span.SetError(err)
+				continue
+			}
 
-		registryAuth := getRegistryAuthSecret()
+			deployedMessage = message
 
-		private := 0
-		if event.Private {
-			private = 1
+			auditEvent.Type = sdk.AuditDeploySucceeded
+			auditEvent.Error = ""
+			auditEvent.Duration = time.Since(start)
+			auditEvent.Message = fmt.Sprintf("buildshiprun succeeded: deployed %s%s", targetImage, auditTarget)
+			auditEvent.Severity = ""
+			if len(warnings) > 0 {
+				auditEvent.Severity = sdk.SeverityWarning
+				auditEvent.Message = fmt.Sprintf("%s, warning: %s", auditEvent.Message, strings.Join(warnings, "; "))
+			}
+			sdk.PostAudit(auditEvent)
+
+			recordDeploy(event, target.Name, targetImage, sdk.StatusSuccess, deployResult, start, gatewayURL, payloadSecret)
 		}
 
-		scaleToZero := scaleToZeroDefault
+		status.AddStatus(sdk.StatusSuccess, deployedMessage, target.Context(event.Service))
+	}
 
-		if val, ok := event.Labels[zeroScaleLabel]; ok && len(val) > 0 {
-			boolVal, err := strconv.ParseBool(val)
-			if err != nil {
-				log.Printf("error parsing label %s : %s", zeroScaleLabel, err.Error())
-			} else {
-				scaleToZero = boolVal
-			}
+	statusErr := reportStatus(status, event.SCM)
+	if statusErr != nil {
+		log.Printf(statusErr.Error())
+	}
+
+	if len(failures) > 0 {
+		span.Finish()
+		log.Fatalf("buildshiprun failure: %s", strings.Join(failures, "; "))
+	}
+
+	return fmt.Sprintf("buildStatus %s %s", imageName, res.Status)
+}
+
+// deployToTarget configures and deploys the function to a target, returning
+// the message for the commit status, the deployment result and any warnings
+func deployToTarget(ctx context.Context, client *faasSDK.Client, target sdk.DeployTarget, event *sdk.Event, imageName string, quota sdk.Quota) (string, string, []string, error) {
+	serviceValue := sdk.FormatServiceName(event.Owner, event.Service)
+	namespace := target.FunctionNamespace(event.Owner)
+	deployedMessage := fmt.Sprintf("deployed: %s", serviceValue)
+
+	defaultMemoryLimit := getMemoryLimit()
+
+	scalingMinLimit := getConfig("scaling_min_limit", "1")
+	scalingMaxLimit := getConfig("scaling_max_limit", "4")
+
+	scalingFactor := getConfig("scaling_factor", "20")
+
+	readOnlyRootFS := getReadOnlyRootFS()
+
+	registryAuth := getRegistryAuthSecret()
+
+	private := 0
+	if event.Private {
+		private = 1
+	}
+
+	policy := getMetadataPolicy()
+
+	userLabels, ignoredLabels := policy.Labels(event.Labels)
+	userAnnotations, ignoredAnnotations := policy.Annotations(event.Annotations)
+	userAnnotations[sdk.FunctionLabelPrefix+"git-repo-url"] = event.RepoURL
+
+	profile, err := policy.Profile(event.Annotations)
+	if len(profile) > 0 {
+		userAnnotations[profileAnnotation] = profile
+	}
+
+	warnings := []string{}
+	for _, key := range ignoredLabels {
+		warnings = append(warnings, fmt.Sprintf("label %s is not allowed", key))
+	}
+	for _, key := range ignoredAnnotations {
+		warnings = append(warnings, fmt.Sprintf("annotation %s is not allowed", key))
+	}
+	if warning := checkCustomDomain(userAnnotations, event.Owner, domainResolver); len(warning) > 0 {
+		warnings = append(warnings, warning)
+	}
+
+	scaleToZero := scaleToZeroDefault
+
+	if val, ok := userLabels[zeroScaleLabel]; ok && len(val) > 0 {
+		boolVal, err := strconv.ParseBool(val)
+		if err != nil {
+			log.Printf("error parsing label %s : %s", zeroScaleLabel, err.Error())
+		} else {
+			scaleToZero = boolVal
 		}
+	}
 
-		annotationWhitelist := []string{
-			"topic",
-			"schedule",
-			"com.openfaas.health.http.path",
-			"com.openfaas.health.http.initialDelay",
+	deploy := &faasSDK.DeployFunctionSpec{
+		FunctionName: serviceValue,
+		Image:        imageName,
+		Network:      "func_functions",
+		Namespace:    namespace,
+		Labels: map[string]string{
+			"faas_function":             serviceValue,
+			"app":                       serviceValue,
+			"com.openfaas.scale.min":    scalingMinLimit,
+			"com.openfaas.scale.max":    scalingMaxLimit,
+			"com.openfaas.scale.factor": scalingFactor,
+			zeroScaleLabel:              strconv.FormatBool(scaleToZero),
+
+			sdk.FunctionLabelPrefix + "git-cloud":      "1",
+			sdk.FunctionLabelPrefix + "git-owner":      event.Owner,
+			sdk.FunctionLabelPrefix + "git-owner-id":   fmt.Sprintf("%d", event.OwnerID),
+			sdk.FunctionLabelPrefix + "git-repo":       event.Repository,
+			sdk.FunctionLabelPrefix + "git-deploytime": strconv.FormatInt(time.Now().Unix(), 10), //Unix Epoch string
+			sdk.FunctionLabelPrefix + "git-sha":        event.SHA,
+			sdk.FunctionLabelPrefix + "git-private":    fmt.Sprintf("%d", private),
+			sdk.FunctionLabelPrefix + "git-scm":        event.SCM,
+			sdk.FunctionLabelPrefix + "git-branch":     buildBranch(),
+		},
+		Annotations: userAnnotations,
+		FunctionResourceRequest: faasSDK.FunctionResourceRequest{
+			Limits:   &stack.FunctionResources{},
+			Requests: &stack.FunctionResources{},
+		},
+		EnvVars:                event.Environment,
+		Secrets:                event.Secrets,
+		ReadOnlyRootFilesystem: readOnlyRootFS,
+	}
+
+	// Labels set by OpenFaaS Cloud take precedence over the user's
+	for k, v := range userLabels {
+		if _, exists := deploy.Labels[k]; !exists {
+			deploy.Labels[k] = v
 		}
+	}
+
+	deploy.FunctionResourceRequest.Limits.Memory = defaultMemoryLimit
+
+	cpuLimit := getCPULimit()
+	if cpuLimit.Available {
 
-		userAnnotations := buildAnnotations(annotationWhitelist, event.Annotations)
-		userAnnotations[sdk.FunctionLabelPrefix+"git-repo-url"] = event.RepoURL
-
-		deploy := &faasSDK.DeployFunctionSpec{
-			FunctionName: serviceValue,
-			Image:        imageName,
-			Network:      "func_functions",
-			Labels: map[string]string{
-				"faas_function":             serviceValue,
-				"app":                       serviceValue,
-				"com.openfaas.scale.min":    scalingMinLimit,
-				"com.openfaas.scale.max":    scalingMaxLimit,
-				"com.openfaas.scale.factor": scalingFactor,
-				zeroScaleLabel:              strconv.FormatBool(scaleToZero),
-
-				sdk.FunctionLabelPrefix + "git-cloud":      "1",
-				sdk.FunctionLabelPrefix + "git-owner":      event.Owner,
-				sdk.FunctionLabelPrefix + "git-owner-id":   fmt.Sprintf("%d", event.OwnerID),
-				sdk.FunctionLabelPrefix + "git-repo":       event.Repository,
-				sdk.FunctionLabelPrefix + "git-deploytime": strconv.FormatInt(time.Now().Unix(), 10), //Unix Epoch string
-				sdk.FunctionLabelPrefix + "git-sha":        event.SHA,
-				sdk.FunctionLabelPrefix + "git-private":    fmt.Sprintf("%d", private),
-				sdk.FunctionLabelPrefix + "git-scm":        event.SCM,
-				sdk.FunctionLabelPrefix + "git-branch":     buildBranch(),
-			},
-			Annotations: userAnnotations,
-			FunctionResourceRequest: faasSDK.FunctionResourceRequest{
-				Limits:   &stack.FunctionResources{},
-				Requests: &stack.FunctionResources{},
-			},
-			EnvVars:                event.Environment,
-			Secrets:                event.Secrets,
-			ReadOnlyRootFilesystem: readOnlyRootFS,
+		if len(cpuLimit.Limit) > 0 {
+			deploy.FunctionResourceRequest.Limits.CPU = cpuLimit.Limit
 		}
 
-		deploy.FunctionResourceRequest.Limits.Memory = defaultMemoryLimit
+		if len(cpuLimit.Requests) > 0 {
+			deploy.FunctionResourceRequest.Requests.CPU = cpuLimit.Requests
+		}
+	}
 
-		cpuLimit := getCPULimit()
-		if cpuLimit.Available {
+	applyQuota(deploy, quota)
 
-			if len(cpuLimit.Limit) > 0 {
-				deploy.FunctionResourceRequest.Limits.CPU = cpuLimit.Limit
-			}
+	warnings = append(warnings, applyUserResources(deploy, event.Limits, event.Requests, getResourceBounds(quota))...)
+	for _, warning := range warnings {
+		log.Printf("%s: %s", serviceValue, warning)
+	}
+
+	gatewayURL := target.GatewayURL
+
+	if len(registryAuth) > 0 {
+		deploy.RegistryAuth = registryAuth
+	}
+
+	if err == nil {
+		err = validateSchedule(deploy.Annotations)
+	}
+
+	canaryWeight := 0
+	if err == nil {
+		canaryWeight, err = getCanaryWeight(event.Annotations)
+	}
 
-			if len(cpuLimit.Requests) > 0 {
-				deploy.FunctionResourceRequest.Requests.CPU = cpuLimit.Requests
+	canary := false
+	var canarySpecs *sdk.KubeClient
+	if err == nil && canaryWeight > 0 {
+		if stableExists, _ := functionExists(ctx, client, serviceValue, namespace); stableExists {
+			canarySpecs, err = sdk.NewInClusterClient(timeout)
+			if err != nil {
+				err = fmt.Errorf("canary deployments need Kubernetes: %s", err.Error())
+			} else {
+				err = applyCanary(canarySpecs, deploy, namespace, canaryWeight)
+				canary = err == nil
 			}
+		} else {
+			log.Printf("No stable version of %s found, deploying in place instead of as a canary", serviceValue)
 		}
+	}
 
-		gatewayURL := os.Getenv("gateway_url")
+	readiness := getReadinessConfig()
 
-		if len(registryAuth) > 0 {
-			deploy.RegistryAuth = registryAuth
+	// The rollout is read from the Deployment on the cluster running
+	// OpenFaaS Cloud, other targets are only checked through their gateway
+	var rollouts *deploymentRollouts
+	var previous *previousVersion
+	if err == nil && readiness.Enabled {
+		if target.IsLocal() {
+			rollouts = newDeploymentRollouts()
 		}
+		previous, rollouts = getPreviousDeployment(ctx, client, rollouts, deploy.FunctionName, namespace)
+	}
 
-		deployResult, err := deployFunction(ctx, client, deploy, gatewayURL)
+	var deployResult string
+	if err == nil {
+		deployResult, err = deployFunction(ctx, client, deploy, gatewayURL)
 		log.Println(deployResult)
+	}
 
-		if err != nil {
-			status.AddStatus(sdk.StatusFailure, err.Error(), sdk.BuildFunctionContext(event.Service))
-			statusErr := reportStatus(status, event.SCM)
-			if statusErr != nil {
-				log.Printf(statusErr.Error())
+	if err == nil && readiness.Enabled {
+		minReplicas := parseMinReplicas(deploy.Labels["com.openfaas.scale.min"])
+
+		var fetcher rolloutFetcher = gatewayRollouts{Fetcher: client}
+		if rollouts != nil {
+			fetcher = rollouts
+		}
+
+		readyErr := verifyDeployment(ctx, fetcher, http.DefaultClient, gatewayURL, deploy.FunctionName, namespace, minReplicas, deploy.Annotations, readiness)
+		if readyErr != nil {
+			log.Printf("Verification of %s failed: %s", deploy.FunctionName, readyErr.Error())
+			err = rollback(ctx, client, rollouts, deploy, previous, gatewayURL, readyErr)
+
+			if canary && !previous.exists() {
+				removeFailedCanary(ctx, client, canarySpecs, deploy.FunctionName, namespace)
 			}
-			log.Fatal(err.Error())
-			auditEvent.Message = fmt.Sprintf("buildshiprun failure: %s", err.Error())
-			sdk.PostAudit(auditEvent)
-			log.Fatalf("buildshiprun failure: %s", err.Error())
-		} else {
-			auditEvent.Message = fmt.Sprintf("buildshiprun succeeded: deployed %s", imageName)
-			sdk.PostAudit(auditEvent)
 		}
+	}
 
+	if err != nil {
+		return "", "", warnings, err
 	}
 
-	status.AddStatus(sdk.StatusSuccess, fmt.Sprintf("deployed: %s", serviceValue), sdk.BuildFunctionContext(event.Service))
-	statusErr := reportStatus(status, event.SCM)
-	if statusErr != nil {
-		log.Printf(statusErr.Error())
+	if canary {
+		deployedMessage = fmt.Sprintf("deployed canary: %s (%d%% of traffic)", deploy.FunctionName, canaryWeight)
 	}
-	return fmt.Sprintf("buildStatus %s %s", imageName, res.Status)
-}
 
-func buildAnnotations(whitelist []string, userValues map[string]string) map[string]string {
-	annotations := map[string]string{}
-	for k, v := range userValues {
-		for _, allowable := range whitelist {
-			if allowable == k {
-				annotations[k] = v
-			}
-		}
+	if len(warnings) > 0 {
+		deployedMessage = fmt.Sprintf("%s, warning: %s", deployedMessage, strings.Join(warnings, "; "))
 	}
 
-	return annotations
+	return deployedMessage, deployResult, warnings, nil
 }
 
 func validateRequest(req *[]byte) (err error) {
@@ -362,6 +596,7 @@ func createPipelineLog(result sdk.BuildResult, event *sdk.Event, gatewayURL stri
 		Function:  event.Service,
 		RepoPath:  event.Owner + "/" + event.Repository,
 		Data:      strings.Join(result.Log, "\n"),
+		BuildID:   event.BuildID,
 	}
 
 	bytesOut, _ := json.Marshal(&p)
@@ -386,6 +621,41 @@ func createPipelineLog(result sdk.BuildResult, event *sdk.Event, gatewayURL stri
 	return res.StatusCode, nil
 }
 
+// recordDeploy appends an entry to the deployment history and will only
+// log on failure. With deploy_webhooks the record is sent through
+// deploy-webhook, which notifies the owner's webhook first.
+func recordDeploy(event *sdk.Event, targetName, imageName, result, message string, start time.Time, gatewayURL, payloadSecret string) {
+	record := buildDeployRecord(event, imageName, result, message, start)
+	record.Target = targetName
+
+	recordURL := gatewayURL + "function/deploy-history"
+	if readBoolConfig("deploy_webhooks", false) {
+		recordURL = gatewayURL + "async-function/deploy-webhook"
+	}
+
+	recordStatus, recordErr := sdk.PostDeployRecord(record, recordURL, payloadSecret)
+	if recordErr != nil {
+		log.Printf("deploy-history: error: %s", recordErr.Error())
+	} else {
+		log.Printf("deploy-history: status: %d", recordStatus)
+	}
+}
+
+func buildDeployRecord(event *sdk.Event, imageName, result, message string, start time.Time) sdk.DeployRecord {
+	return sdk.DeployRecord{
+		Owner:     event.Owner,
+		Repo:      event.Repository,
+		Function:  event.Service,
+		SHA:       event.SHA,
+		Image:     imageName,
+		Result:    result,
+		Message:   message,
+		Duration:  time.Since(start).Seconds(),
+		Trigger:   fmt.Sprintf("%s push", event.SCM),
+		Timestamp: time.Now().UTC(),
+	}
+}
+
 // readOnlyRootFS defaults to true, override with env-var of readonly_root_filesystem=false
 func getReadOnlyRootFS() bool {
 	readOnly := true
@@ -415,6 +685,12 @@ func getEventFromEnv() (*sdk.Event, error) {
 	info.Private, _ = strconv.ParseBool(os.Getenv("Http_Private"))
 	info.RepoURL = os.Getenv("Http_Repo_Url")
 
+	// Older versions of git-tar did not pass the build ID
+	info.BuildID = sdk.BuildIDFromEnv()
+	if len(info.BuildID) == 0 {
+		info.BuildID = sdk.BuildID(info.Owner, info.Repository, info.SHA)
+	}
+
 	if len(os.Getenv("Http_Owner_Id")) > 0 {
 		info.OwnerID, _ = strconv.Atoi(os.Getenv("Http_Owner_Id"))
 	}
@@ -463,6 +739,9 @@ func getEventFromEnv() (*sdk.Event, error) {
 		}
 	}
 
+	info.Limits = parseFunctionResources("Http_Limits", info.Service)
+	info.Requests = parseFunctionResources("Http_Requests", info.Service)
+
 	secretVars := []string{}
 	secretsStr := os.Getenv("Http_Secrets")
 
@@ -486,8 +765,7 @@ func getEventFromEnv() (*sdk.Event, error) {
 	return &info, err
 }
 
-func functionExists(ctx context.Context, client *faasSDK.Client, functionName string, gatewayURL string) (bool, error) {
-	// client := faasSDK.NewClient(&FaaSAuth{}, gatewayURL, nil, &timeout)
+func functionExists(ctx context.Context, client *faasSDK.Client, functionName, namespace string) (bool, error) {
 	functions, err := client.ListFunctions(ctx, namespace)
 	if err != nil {
 		return false, err
@@ -506,7 +784,7 @@ func deployFunction(ctx context.Context, client *faasSDK.Client, deploySpec *faa
 	var (
 		err error
 	)
-	exists, err := functionExists(ctx, client, deploySpec.FunctionName, gatewayURL)
+	exists, err := functionExists(ctx, client, deploySpec.FunctionName, deploySpec.Namespace)
 	log.Println("Deploying: " + deploySpec.Image + " as " + deploySpec.FunctionName)
 	if exists {
 		deploySpec.Update = true
@@ -616,18 +894,8 @@ func getCPULimit() CPULimits {
 }
 
 func getMemoryLimit() string {
-	const swarmSuffix = "m"
-	const kubernetesSuffix = "Mi"
-
-	suffix := swarmSuffix
-
-	kubernetesPort := "KUBERNETES_SERVICE_PORT"
 	memoryLimit := os.Getenv("function_memory_limit_mb")
 
-	if _, exists := os.LookupEnv(kubernetesPort); exists {
-		suffix = kubernetesSuffix
-	}
-
 	const defaultMemoryLimit = "128"
 
 	unit := defaultMemoryLimit
@@ -635,9 +903,27 @@ func getMemoryLimit() string {
 		unit = memoryLimit
 	}
 
+	return formatMemoryLimit(unit)
+}
+
+// formatMemoryLimit adds the suffix for the orchestrator to a value in MB
+func formatMemoryLimit(unit string) string {
+	const swarmSuffix = "m"
+	const kubernetesSuffix = "Mi"
+
+	suffix := swarmSuffix
+	if isKubernetes() {
+		suffix = kubernetesSuffix
+	}
+
 	return fmt.Sprintf("%s%s", unit, suffix)
 }
 
+func isKubernetes() bool {
+	_, exists := os.LookupEnv("KUBERNETES_SERVICE_PORT")
+	return exists
+}
+
 func reportGitLabStatus(status *sdk.Status) {
 
 	payloadSecret, secretErr := sdk.ReadSecret("payload-secret")
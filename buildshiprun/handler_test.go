@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
 )
 
 func TestGetEvent_ReadLabels(t *testing.T) {
@@ -418,14 +421,14 @@ func Test_getConfig(t *testing.T) {
 	}
 }
 
-func Test_buildAnnotations_RemovesNonWhitelisted(t *testing.T) {
+func Test_filterMetadata_RemovesNonWhitelisted(t *testing.T) {
 	whitelist := []string{"topic"}
 
 	userValues := map[string]string{
 		"com.url": "value",
 	}
 
-	out := buildAnnotations(whitelist, userValues)
+	out, _ := filterMetadata(userValues, whitelist, []string{})
 
 	if _, ok := out["com.url"]; ok {
 		t.Fail()
@@ -433,7 +436,7 @@ func Test_buildAnnotations_RemovesNonWhitelisted(t *testing.T) {
 
 }
 
-func Test_buildAnnotations_AllowsWhitelisted(t *testing.T) {
+func Test_filterMetadata_AllowsWhitelisted(t *testing.T) {
 	whitelist := []string{
 		"topic",
 		"schedule",
@@ -444,7 +447,7 @@ func Test_buildAnnotations_AllowsWhitelisted(t *testing.T) {
 		"schedule": "has schedule",
 	}
 
-	out := buildAnnotations(whitelist, userValues)
+	out, _ := filterMetadata(userValues, whitelist, []string{})
 
 	topicVal, ok := out["topic"]
 	if !ok {
@@ -466,3 +469,33 @@ func Test_buildAnnotations_AllowsWhitelisted(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_buildDeployRecord(t *testing.T) {
+	event := &sdk.Event{
+		Owner:      "alexellis",
+		Repository: "super-pancake",
+		Service:    "fn1",
+		SHA:        "a3ef55c",
+		SCM:        "github",
+	}
+
+	record := buildDeployRecord(event, "registry:5000/alexellis/fn1:latest", sdk.StatusSuccess, "deployed", time.Now())
+
+	if record.Owner != event.Owner {
+		t.Errorf("Owner want: %s, got: %s", event.Owner, record.Owner)
+	}
+	if record.Function != event.Service {
+		t.Errorf("Function want: %s, got: %s", event.Service, record.Function)
+	}
+	if record.Result != sdk.StatusSuccess {
+		t.Errorf("Result want: %s, got: %s", sdk.StatusSuccess, record.Result)
+	}
+
+	wantTrigger := "github push"
+	if record.Trigger != wantTrigger {
+		t.Errorf("Trigger want: %s, got: %s", wantTrigger, record.Trigger)
+	}
+	if record.Timestamp.IsZero() {
+		t.Errorf("Timestamp want non-zero value")
+	}
+}
@@ -0,0 +1,183 @@
+package function
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// profileAnnotation selects OpenFaaS profiles for a function
+const profileAnnotation = "com.openfaas.profile"
+
+// MetadataPolicy decides which labels and annotations from a user's
+// stack.yml are applied to their functions. A rule ending in * matches
+// any key with that prefix.
+type MetadataPolicy struct {
+	AllowAnnotations []string
+	DenyAnnotations  []string
+	AllowLabels      []string
+	DenyLabels       []string
+
+	// Profiles are the OpenFaaS profiles published by the operator
+	Profiles []string
+}
+
+// defaultAnnotations are the annotations users can always set, each
+// feature which reads an annotation adds it here
+var defaultAnnotations = []string{
+	"topic",
+	sdk.ScheduleAnnotation,
+	"com.openfaas.health.http.path",
+	"com.openfaas.health.http.initialDelay",
+	sdk.CanaryWeightAnnotation,
+	sdk.TargetsAnnotation,
+	sdk.CustomDomainAnnotation,
+	sdk.RateLimitAnnotation,
+	sdk.RateLimitBurstAnnotation,
+	sdk.CORSOriginsAnnotation,
+	sdk.CORSMethodsAnnotation,
+	sdk.CORSHeadersAnnotation,
+	sdk.CORSCredentialsAnnotation,
+	sdk.CORSMaxAgeAnnotation,
+	sdk.IPAllowAnnotation,
+	sdk.MaxBodyBytesAnnotation,
+	sdk.PrivateAnnotation,
+	sdk.PrivateAllowAnnotation,
+}
+
+// defaultLabels are the labels users can always set
+var defaultLabels = []string{zeroScaleLabel}
+
+// getMetadataPolicy reads annotation_allow, annotation_deny, label_allow,
+// label_deny and profiles from the environment as comma-separated lists.
+// annotation_allow and label_allow add to the defaults, which can be
+// removed with annotation_deny and label_deny.
+func getMetadataPolicy() MetadataPolicy {
+	return MetadataPolicy{
+		AllowAnnotations: append(append([]string{}, defaultAnnotations...), readListConfig("annotation_allow", []string{})...),
+		DenyAnnotations:  readListConfig("annotation_deny", []string{}),
+		AllowLabels:      append(append([]string{}, defaultLabels...), readListConfig("label_allow", []string{})...),
+		DenyLabels:       readListConfig("label_deny", []string{}),
+		Profiles:         readListConfig("profiles", []string{}),
+	}
+}
+
+// Annotations returns the user's annotations which are allowed and
+// the keys which were ignored.
+func (p MetadataPolicy) Annotations(userValues map[string]string) (map[string]string, []string) {
+	values := map[string]string{}
+	for k, v := range userValues {
+		if k != profileAnnotation {
+			values[k] = v
+		}
+	}
+
+	return filterMetadata(values, p.AllowAnnotations, p.DenyAnnotations)
+}
+
+// Labels returns the user's labels which are allowed and the keys
+// which were ignored.
+func (p MetadataPolicy) Labels(userValues map[string]string) (map[string]string, []string) {
+	return filterMetadata(userValues, p.AllowLabels, p.DenyLabels)
+}
+
+// Profile validates the profiles requested by the user, returning the
+// value for the profile annotation or an empty string when none were given.
+func (p MetadataPolicy) Profile(userValues map[string]string) (string, error) {
+	requested, ok := userValues[profileAnnotation]
+	if !ok || len(strings.TrimSpace(requested)) == 0 {
+		return "", nil
+	}
+
+	profiles := []string{}
+	for _, profile := range strings.Split(requested, ",") {
+		profile = strings.TrimSpace(profile)
+		if len(profile) == 0 {
+			continue
+		}
+
+		if !contains(p.Profiles, profile) {
+			return "", fmt.Errorf("profile %q is not available, choose from: %s", profile, strings.Join(p.Profiles, ", "))
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return strings.Join(profiles, ","), nil
+}
+
+// filterMetadata keeps the keys matched by allow and not by deny. Keys
+// reserved for OpenFaaS Cloud are only kept when allowed by name.
+func filterMetadata(userValues map[string]string, allow, deny []string) (map[string]string, []string) {
+	values := map[string]string{}
+	ignored := []string{}
+
+	for k, v := range userValues {
+		allowed := matchesAny(k, allow) && !matchesAny(k, deny)
+
+		if allowed && strings.HasPrefix(k, sdk.FunctionLabelPrefix) {
+			allowed = contains(allow, k)
+		}
+
+		if allowed {
+			values[k] = v
+		} else {
+			ignored = append(ignored, k)
+		}
+	}
+
+	sort.Strings(ignored)
+
+	return values, ignored
+}
+
+func matchesAny(key string, rules []string) bool {
+	for _, rule := range rules {
+		if strings.HasSuffix(rule, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(rule, "*")) {
+				return true
+			}
+		} else if rule == key {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func readListConfig(key string, defaultValue []string) []string {
+	val, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	values := []string{}
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// validateSchedule checks the cron expression of the schedule annotation so
+// that an invalid one fails the deployment instead of never running
+func validateSchedule(annotations map[string]string) error {
+	expr, ok := annotations[sdk.ScheduleAnnotation]
+	if !ok {
+		return nil
+	}
+
+	_, err := sdk.ParseSchedule(expr)
+	return err
+}
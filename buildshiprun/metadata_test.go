@@ -0,0 +1,133 @@
+package function
+
+import (
+	"os"
+	"testing"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_filterMetadata_ReservedKeysNeedExactRule(t *testing.T) {
+	allow := []string{"com.openfaas.*", sdk.CanaryWeightAnnotation}
+
+	userValues := map[string]string{
+		"com.openfaas.health.http.path":          "/ready",
+		sdk.CanaryWeightAnnotation:               "10",
+		sdk.FunctionLabelPrefix + "git-owner":    "someone-else",
+		sdk.FunctionLabelPrefix + "git-repo-url": "https://example.com/",
+	}
+
+	out, ignored := filterMetadata(userValues, allow, []string{})
+
+	if len(out) != 2 {
+		t.Errorf("want 2 allowed keys, got: %v", out)
+	}
+	if _, ok := out[sdk.FunctionLabelPrefix+"git-owner"]; ok {
+		t.Errorf("want reserved key to be ignored")
+	}
+	if len(ignored) != 2 {
+		t.Errorf("want 2 ignored keys, got: %v", ignored)
+	}
+}
+
+func Test_filterMetadata_DenyOverridesAllow(t *testing.T) {
+	userValues := map[string]string{
+		"team":          "payments",
+		"team.internal": "true",
+	}
+
+	out, ignored := filterMetadata(userValues, []string{"team*"}, []string{"team.internal"})
+
+	if _, ok := out["team"]; !ok {
+		t.Errorf("want team label to be allowed")
+	}
+	if len(ignored) != 1 || ignored[0] != "team.internal" {
+		t.Errorf("want team.internal to be ignored, got: %v", ignored)
+	}
+}
+
+func Test_getMetadataPolicy_Defaults(t *testing.T) {
+	os.Unsetenv("annotation_allow")
+	os.Unsetenv("label_allow")
+
+	policy := getMetadataPolicy()
+
+	out, _ := policy.Annotations(map[string]string{"topic": "payments", "com.example": "x"})
+	if len(out) != 1 || out["topic"] != "payments" {
+		t.Errorf("want only topic, got: %v", out)
+	}
+
+	labels, _ := policy.Labels(map[string]string{zeroScaleLabel: "false", "team": "payments"})
+	if len(labels) != 1 || labels[zeroScaleLabel] != "false" {
+		t.Errorf("want only %s, got: %v", zeroScaleLabel, labels)
+	}
+}
+
+func Test_getMetadataPolicy_AllowExtendsDefaults(t *testing.T) {
+	os.Setenv("annotation_allow", "com.example.*")
+	os.Setenv("annotation_deny", "topic")
+	defer os.Unsetenv("annotation_allow")
+	defer os.Unsetenv("annotation_deny")
+
+	policy := getMetadataPolicy()
+
+	out, _ := policy.Annotations(map[string]string{
+		"com.example.team":    "payments",
+		sdk.PrivateAnnotation: "true",
+		"topic":               "payments",
+	})
+	if len(out) != 2 || out["com.example.team"] != "payments" || out[sdk.PrivateAnnotation] != "true" {
+		t.Errorf("want com.example.team and %s, got: %v", sdk.PrivateAnnotation, out)
+	}
+}
+
+func Test_MetadataPolicy_Profile(t *testing.T) {
+	policy := MetadataPolicy{Profiles: []string{"spot", "no-gpu"}}
+
+	tests := []struct {
+		title   string
+		value   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{title: "no profile", value: map[string]string{}, want: ""},
+		{title: "published profile", value: map[string]string{profileAnnotation: "spot"}, want: "spot"},
+		{title: "several profiles", value: map[string]string{profileAnnotation: "spot, no-gpu"}, want: "spot,no-gpu"},
+		{title: "unknown profile", value: map[string]string{profileAnnotation: "gpu"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got, err := policy.Profile(test.value)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("want error: %v, got: %v", test.wantErr, err)
+			}
+			if got != test.want {
+				t.Errorf("want %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_MetadataPolicy_ProfileNotPassedThrough(t *testing.T) {
+	policy := MetadataPolicy{AllowAnnotations: []string{"com.openfaas.*"}}
+
+	out, _ := policy.Annotations(map[string]string{profileAnnotation: "spot"})
+	if _, ok := out[profileAnnotation]; ok {
+		t.Errorf("want %s to be handled as a profile only", profileAnnotation)
+	}
+}
+
+func Test_validateSchedule(t *testing.T) {
+	if err := validateSchedule(map[string]string{}); err != nil {
+		t.Errorf("want no error without a schedule, got: %s", err.Error())
+	}
+
+	if err := validateSchedule(map[string]string{"schedule": "*/5 * * * *"}); err != nil {
+		t.Errorf("want no error for a valid schedule, got: %s", err.Error())
+	}
+
+	if err := validateSchedule(map[string]string{"schedule": "every minute"}); err == nil {
+		t.Errorf("want error for an invalid schedule")
+	}
+}
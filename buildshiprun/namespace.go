@@ -0,0 +1,232 @@
+package function
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// webhookReaderRole lets the deploy-webhook function read the secrets in
+// an owner's namespace, so that it never needs to read secrets elsewhere
+const (
+	webhookReaderRole           = "deploy-webhook-reader"
+	webhookReaderServiceAccount = "deploy-webhook"
+)
+
+// rolloutsRole lets buildshiprun read and roll back the Deployments of
+// the functions in an owner's namespace when verify_deployment is set
+const (
+	rolloutsRole           = "function-rollouts"
+	rolloutsServiceAccount = "user-namespaces-manager"
+)
+
+// NamespaceQuota is applied as a ResourceQuota to each owner's namespace,
+// values which are not set are not limited
+type NamespaceQuota struct {
+	Memory string
+	CPU    string
+	Pods   string
+}
+
+// getNamespaceQuota reads namespace_quota_memory, namespace_quota_cpu
+// and namespace_quota_pods from the environment.
+func getNamespaceQuota() NamespaceQuota {
+	return NamespaceQuota{
+		Memory: os.Getenv("namespace_quota_memory"),
+		CPU:    os.Getenv("namespace_quota_cpu"),
+		Pods:   os.Getenv("namespace_quota_pods"),
+	}
+}
+
+// ensureNamespace creates the owner's namespace on their first deployment,
+// along with a NetworkPolicy and a ResourceQuota. With verify_deployment
+// buildshiprun is allowed to roll back the owner's functions, and with
+// deploy_webhooks the deploy-webhook function may read their secrets.
+func ensureNamespace(k *sdk.KubeClient, namespace, owner string, quota NamespaceQuota) error {
+	log.Printf("Ensuring namespace %s for %s", namespace, owner)
+
+	if err := k.Create("/api/v1/namespaces", buildNamespace(namespace, owner)); err != nil {
+		return fmt.Errorf("unable to create namespace %s: %s", namespace, err.Error())
+	}
+
+	if err := checkNamespaceOwner(k, namespace, owner); err != nil {
+		return err
+	}
+
+	networkPolicies := fmt.Sprintf("/apis/networking.k8s.io/v1/namespaces/%s/networkpolicies", namespace)
+	if err := k.Create(networkPolicies, buildNetworkPolicy(namespace)); err != nil {
+		return fmt.Errorf("unable to create network policy in %s: %s", namespace, err.Error())
+	}
+
+	if resourceQuota := buildResourceQuota(namespace, quota); resourceQuota != nil {
+		resourceQuotas := fmt.Sprintf("/api/v1/namespaces/%s/resourcequotas", namespace)
+		if err := k.Create(resourceQuotas, resourceQuota); err != nil {
+			return fmt.Errorf("unable to create resource quota in %s: %s", namespace, err.Error())
+		}
+	}
+
+	roleBindings := fmt.Sprintf("/apis/rbac.authorization.k8s.io/v1/namespaces/%s/rolebindings", namespace)
+
+	if readBoolConfig("verify_deployment", true) {
+		if err := k.Create(roleBindings, buildRoleBinding(namespace, rolloutsRole, rolloutsServiceAccount, k.Namespace)); err != nil {
+			return fmt.Errorf("unable to allow buildshiprun to roll back deployments in %s: %s", namespace, err.Error())
+		}
+	}
+
+	if readBoolConfig("deploy_webhooks", false) {
+		if err := k.Create(roleBindings, buildRoleBinding(namespace, webhookReaderRole, webhookReaderServiceAccount, k.Namespace)); err != nil {
+			return fmt.Errorf("unable to allow deploy-webhook to read secrets in %s: %s", namespace, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// checkNamespaceOwner refuses a namespace created for another owner, as
+// sdk.FormatNamespace gives owners such as a.b and a_b the same name
+func checkNamespaceOwner(k *sdk.KubeClient, namespace, owner string) error {
+	existing := struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}{}
+
+	found, err := k.Get("/api/v1/namespaces/"+namespace, &existing)
+	if err != nil {
+		return fmt.Errorf("unable to read namespace %s: %s", namespace, err.Error())
+	}
+	if !found {
+		return fmt.Errorf("namespace %s was not found", namespace)
+	}
+
+	existingOwner := existing.Metadata.Annotations[sdk.FunctionLabelPrefix+"git-owner"]
+	if !strings.EqualFold(existingOwner, owner) {
+		return fmt.Errorf("namespace %s belongs to another owner", namespace)
+	}
+	return nil
+}
+
+func buildNamespace(namespace, owner string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[string]interface{}{
+			"name": namespace,
+			"labels": map[string]string{
+				"openfaas-cloud": "1",
+				"role":           "openfaas-fn",
+			},
+			"annotations": map[string]string{
+				// Required for faas-netes to deploy into the namespace
+				"openfaas": "1",
+
+				sdk.FunctionLabelPrefix + "git-owner": owner,
+			},
+		},
+	}
+}
+
+// buildNetworkPolicy matches the policy of the openfaas-fn namespace
+// so that functions can only be reached through the gateway
+func buildNetworkPolicy(namespace string) map[string]interface{} {
+	systemSelector := map[string]interface{}{
+		"matchLabels": map[string]string{"role": "openfaas-system"},
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata": map[string]interface{}{
+			"name":      namespace,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"policyTypes": []string{"Ingress"},
+			"podSelector": map[string]interface{}{},
+			"ingress": []interface{}{
+				map[string]interface{}{
+					"from": []interface{}{
+						map[string]interface{}{"namespaceSelector": systemSelector},
+						map[string]interface{}{"podSelector": systemSelector},
+					},
+				},
+			},
+		},
+	}
+}
+
+func buildResourceQuota(namespace string, quota NamespaceQuota) map[string]interface{} {
+	hard := map[string]string{}
+	if len(quota.Memory) > 0 {
+		hard["limits.memory"] = quota.Memory
+	}
+	if len(quota.CPU) > 0 {
+		hard["limits.cpu"] = quota.CPU
+	}
+	if len(quota.Pods) > 0 {
+		hard["pods"] = quota.Pods
+	}
+
+	if len(hard) == 0 {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ResourceQuota",
+		"metadata": map[string]interface{}{
+			"name":      namespace,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"hard": hard,
+		},
+	}
+}
+
+// buildRoleBinding binds a service account from the namespace of OpenFaaS
+// Cloud to a ClusterRole within the owner's namespace only
+func buildRoleBinding(namespace, role, serviceAccount, systemNamespace string) map[string]interface{} {
+	if len(systemNamespace) == 0 {
+		systemNamespace = "openfaas-fn"
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "RoleBinding",
+		"metadata": map[string]interface{}{
+			"name":      role,
+			"namespace": namespace,
+		},
+		"subjects": []interface{}{
+			map[string]string{
+				"kind":      "ServiceAccount",
+				"name":      serviceAccount,
+				"namespace": systemNamespace,
+			},
+		},
+		"roleRef": map[string]string{
+			"apiGroup": "rbac.authorization.k8s.io",
+			"kind":     "ClusterRole",
+			"name":     role,
+		},
+	}
+}
+
+// prepareNamespace makes sure the namespace exists before deploying,
+// nothing is done when functions use the gateway's default namespace.
+func prepareNamespace(namespace, owner string) error {
+	if len(namespace) == 0 {
+		return nil
+	}
+
+	k, err := sdk.NewInClusterClient(timeout)
+	if err != nil {
+		return fmt.Errorf("user namespaces need Kubernetes: %s", err.Error())
+	}
+
+	return ensureNamespace(k, namespace, owner, getNamespaceQuota())
+}
@@ -0,0 +1,119 @@
+package function
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_ensureNamespace(t *testing.T) {
+	created := map[string]string{}
+	bindings := []string{}
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			bytesOut, _ := json.Marshal(buildNamespace("openfaas-fn-alexellis", "AlexEllis"))
+			w.Write(bytesOut)
+			return
+		}
+
+		object := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&object)
+		created[r.URL.Path] = object["kind"].(string)
+		if object["kind"] == "RoleBinding" {
+			bindings = append(bindings, object["metadata"].(map[string]interface{})["name"].(string))
+		}
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// The namespace already exists
+		if object["kind"] == "Namespace" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer api.Close()
+
+	k := &sdk.KubeClient{BaseURL: api.URL, Token: "token", Client: http.DefaultClient}
+
+	os.Setenv("deploy_webhooks", "true")
+	defer os.Unsetenv("deploy_webhooks")
+
+	err := ensureNamespace(k, "openfaas-fn-alexellis", "alexellis", NamespaceQuota{Memory: "2Gi"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	want := map[string]string{
+		"/api/v1/namespaces": "Namespace",
+		"/apis/networking.k8s.io/v1/namespaces/openfaas-fn-alexellis/networkpolicies":      "NetworkPolicy",
+		"/api/v1/namespaces/openfaas-fn-alexellis/resourcequotas":                          "ResourceQuota",
+		"/apis/rbac.authorization.k8s.io/v1/namespaces/openfaas-fn-alexellis/rolebindings": "RoleBinding",
+	}
+
+	for path, kind := range want {
+		if created[path] != kind {
+			t.Errorf("want %s created at %s, got: %q", kind, path, created[path])
+		}
+	}
+
+	if len(bindings) != 2 || bindings[0] != rolloutsRole || bindings[1] != webhookReaderRole {
+		t.Errorf("want role bindings for %s and %s, got: %v", rolloutsRole, webhookReaderRole, bindings)
+	}
+}
+
+func Test_ensureNamespace_OtherOwner(t *testing.T) {
+	tests := []struct {
+		Scenario string
+		Owner    string
+		WantErr  bool
+	}{
+		{Scenario: "same owner", Owner: "a.b"},
+		{Scenario: "owner with the same namespace", Owner: "a_b", WantErr: true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			created := []string{}
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					bytesOut, _ := json.Marshal(buildNamespace("openfaas-fn-a-b", "a.b"))
+					w.Write(bytesOut)
+					return
+				}
+
+				if r.URL.Path == "/api/v1/namespaces" {
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				created = append(created, r.URL.Path)
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer api.Close()
+
+			k := &sdk.KubeClient{BaseURL: api.URL, Token: "token", Client: http.DefaultClient}
+
+			err := ensureNamespace(k, sdk.FormatNamespace("openfaas-fn-", testCase.Owner), testCase.Owner, NamespaceQuota{})
+			if (err != nil) != testCase.WantErr {
+				t.Fatalf("want error %t, got: %v", testCase.WantErr, err)
+			}
+			if testCase.WantErr && len(created) > 0 {
+				t.Errorf("want nothing created in another owner's namespace, got: %v", created)
+			}
+		})
+	}
+}
+
+func Test_buildResourceQuota_NoLimits(t *testing.T) {
+	if quota := buildResourceQuota("openfaas-fn-alexellis", NamespaceQuota{}); quota != nil {
+		t.Errorf("want no resource quota without limits, got: %v", quota)
+	}
+}
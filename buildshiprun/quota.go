@@ -0,0 +1,72 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// getQuota reads the quota for an owner, an error is returned when the
+// quotas file is set but cannot be read so that the deployment is
+// refused rather than made without limits.
+func getQuota(owner string) (sdk.Quota, error) {
+	quotas, err := sdk.ReadQuotas()
+	if err != nil {
+		return sdk.Quota{}, fmt.Errorf("unable to check quota: %s", err.Error())
+	}
+	return quotas.Get(owner), nil
+}
+
+// checkFunctionQuota returns an error when deploying a new function
+// would take the owner over their maximum number of functions.
+func checkFunctionQuota(ctx context.Context, client *faasSDK.Client, owner, namespace, functionName string, quota sdk.Quota) error {
+	if quota.MaxFunctions == 0 {
+		return nil
+	}
+
+	functions, err := client.ListFunctions(ctx, namespace)
+	if err != nil {
+		return fmt.Errorf("unable to check quota: %s", err.Error())
+	}
+
+	count := 0
+	for _, fn := range functions {
+		if fn.Name == functionName {
+			return nil
+		}
+
+		if fn.Labels == nil || sdk.IsCanary(*fn.Labels) {
+			continue
+		}
+
+		if strings.EqualFold((*fn.Labels)[sdk.FunctionLabelPrefix+"git-owner"], owner) {
+			count++
+		}
+	}
+
+	return quota.CheckFunctions(count + 1)
+}
+
+// applyQuota sets the owner's memory and CPU limits on the function
+// and caps its replicas.
+func applyQuota(deploy *faasSDK.DeployFunctionSpec, quota sdk.Quota) {
+	if quota.MemoryLimitMB > 0 {
+		deploy.FunctionResourceRequest.Limits.Memory = formatMemoryLimit(strconv.Itoa(quota.MemoryLimitMB))
+	}
+
+	if quota.CPULimitMilli > 0 && isKubernetes() {
+		deploy.FunctionResourceRequest.Limits.CPU = fmt.Sprintf("%dm", quota.CPULimitMilli)
+	}
+
+	if quota.MaxReplicas > 0 {
+		for _, label := range []string{"com.openfaas.scale.min", "com.openfaas.scale.max"} {
+			if replicas, err := strconv.Atoi(deploy.Labels[label]); err != nil || replicas > quota.MaxReplicas {
+				deploy.Labels[label] = strconv.Itoa(quota.MaxReplicas)
+			}
+		}
+	}
+}
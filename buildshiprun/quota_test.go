@@ -0,0 +1,102 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/openfaas/faas-provider/types"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/faas-cli/stack"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func newQuotaTestSpec() *faasSDK.DeployFunctionSpec {
+	return &faasSDK.DeployFunctionSpec{
+		FunctionName: "alexellis-fn1",
+		Labels: map[string]string{
+			"com.openfaas.scale.min": "1",
+			"com.openfaas.scale.max": "4",
+		},
+		FunctionResourceRequest: faasSDK.FunctionResourceRequest{
+			Limits:   &stack.FunctionResources{Memory: "128Mi", CPU: "500m"},
+			Requests: &stack.FunctionResources{},
+		},
+	}
+}
+
+func Test_applyQuota_NoLimits(t *testing.T) {
+	deploy := newQuotaTestSpec()
+
+	applyQuota(deploy, sdk.Quota{})
+
+	if deploy.FunctionResourceRequest.Limits.Memory != "128Mi" {
+		t.Errorf("want memory unchanged, got: %s", deploy.FunctionResourceRequest.Limits.Memory)
+	}
+	if deploy.Labels["com.openfaas.scale.max"] != "4" {
+		t.Errorf("want max replicas unchanged, got: %s", deploy.Labels["com.openfaas.scale.max"])
+	}
+}
+
+func Test_applyQuota_OwnerLimits(t *testing.T) {
+	os.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+
+	deploy := newQuotaTestSpec()
+
+	applyQuota(deploy, sdk.Quota{MemoryLimitMB: 256, CPULimitMilli: 250, MaxReplicas: 2})
+
+	if deploy.FunctionResourceRequest.Limits.Memory != "256Mi" {
+		t.Errorf("want memory 256Mi, got: %s", deploy.FunctionResourceRequest.Limits.Memory)
+	}
+	if deploy.FunctionResourceRequest.Limits.CPU != "250m" {
+		t.Errorf("want CPU 250m, got: %s", deploy.FunctionResourceRequest.Limits.CPU)
+	}
+	if deploy.Labels["com.openfaas.scale.max"] != "2" {
+		t.Errorf("want max replicas 2, got: %s", deploy.Labels["com.openfaas.scale.max"])
+	}
+	if deploy.Labels["com.openfaas.scale.min"] != "1" {
+		t.Errorf("want min replicas 1, got: %s", deploy.Labels["com.openfaas.scale.min"])
+	}
+}
+
+func Test_getQuota_UnreadableFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "buildshiprun")
+	defer os.RemoveAll(dir)
+
+	quotasPath := path.Join(dir, "quotas.json")
+	ioutil.WriteFile(quotasPath, []byte("{"), 0600)
+
+	os.Setenv("quotas_path", quotasPath)
+	defer os.Unsetenv("quotas_path")
+
+	if _, err := getQuota("alexellis"); err == nil {
+		t.Errorf("want error when the quotas cannot be parsed")
+	}
+}
+
+func Test_checkFunctionQuota_OwnerCase(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		functions := []types.FunctionStatus{}
+		for _, name := range []string{"alexellis-fn1", "alexellis-fn2"} {
+			labels := map[string]string{sdk.FunctionLabelPrefix + "git-owner": "AlexEllis"}
+			functions = append(functions, types.FunctionStatus{Name: name, Labels: &labels})
+		}
+		bytesOut, _ := json.Marshal(functions)
+		w.Write(bytesOut)
+	}))
+	defer gateway.Close()
+
+	client := faasSDK.NewClient(&FaaSAuth{}, gateway.URL, nil, &timeout)
+
+	err := checkFunctionQuota(context.Background(), client, "alexellis", "", "alexellis-fn3", sdk.Quota{MaxFunctions: 2})
+	if err == nil {
+		t.Errorf("want functions counted when the owner differs in case")
+	}
+}
@@ -0,0 +1,393 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const healthPathAnnotation = "com.openfaas.health.http.path"
+
+// ReadinessConfig controls how a deployment is verified
+// before reporting success
+type ReadinessConfig struct {
+	Enabled bool
+
+	// Timeout to wait for available replicas and the health path
+	Timeout time.Duration
+
+	// Interval between polls of the gateway
+	Interval time.Duration
+
+	// CheckHealthPath calls the path given in the
+	// com.openfaas.health.http.path annotation once replicas are ready
+	CheckHealthPath bool
+}
+
+// functionStatusFetcher is satisfied by the faas-cli proxy client
+type functionStatusFetcher interface {
+	GetFunctionInfo(ctx context.Context, functionName string, namespace string) (types.FunctionStatus, error)
+}
+
+// rolloutStatus is the progress of a rolling update of a function
+type rolloutStatus struct {
+	Generation         int64
+	ObservedGeneration int64
+
+	// Replicas includes the replicas of the previous version which are
+	// still running, UpdatedReplicas only those of the new version
+	Replicas          int64
+	UpdatedReplicas   int64
+	AvailableReplicas int64
+}
+
+// ready is true once the new version has been rolled out to every
+// replica and at least minReplicas are available
+func (s rolloutStatus) ready(minReplicas uint64) bool {
+	return s.ObservedGeneration >= s.Generation &&
+		s.UpdatedReplicas == s.Replicas &&
+		s.AvailableReplicas >= int64(minReplicas)
+}
+
+// rolloutFetcher gives the rollout status of a function
+type rolloutFetcher interface {
+	GetRollout(ctx context.Context, functionName, namespace string) (rolloutStatus, error)
+}
+
+// gatewayRollouts reads the available replicas from the gateway, which
+// cannot tell replicas of the previous version from those of the new one.
+// It is used when the Deployment cannot be read, i.e. for remote targets.
+type gatewayRollouts struct {
+	Fetcher functionStatusFetcher
+}
+
+func (g gatewayRollouts) GetRollout(ctx context.Context, functionName, namespace string) (rolloutStatus, error) {
+	fn, err := g.Fetcher.GetFunctionInfo(ctx, functionName, namespace)
+	if err != nil {
+		return rolloutStatus{}, err
+	}
+
+	available := int64(fn.AvailableReplicas)
+	return rolloutStatus{Replicas: available, UpdatedReplicas: available, AvailableReplicas: available}, nil
+}
+
+// deploymentRollouts reads the Deployment of a function from Kubernetes,
+// it needs the function-rollouts role from rbac-buildshiprun-rollouts.yml
+type deploymentRollouts struct {
+	Kube *sdk.KubeClient
+}
+
+// newDeploymentRollouts gives nil when buildshiprun is not running on
+// Kubernetes
+func newDeploymentRollouts() *deploymentRollouts {
+	k, err := sdk.NewInClusterClient(timeout)
+	if err != nil {
+		return nil
+	}
+	return &deploymentRollouts{Kube: k}
+}
+
+func (d *deploymentRollouts) path(functionName, namespace string) string {
+	if len(namespace) == 0 {
+		namespace = d.Kube.Namespace
+	}
+	return fmt.Sprintf("/apis/apps/v1/namespaces/%s/deployments/%s", namespace, functionName)
+}
+
+// Snapshot reads the Deployment as it is before an update, found is false
+// when the function does not exist yet
+func (d *deploymentRollouts) Snapshot(functionName, namespace string) (map[string]interface{}, bool, error) {
+	deployment := map[string]interface{}{}
+	found, err := d.Kube.Get(d.path(functionName, namespace), &deployment)
+	return deployment, found, err
+}
+
+func (d *deploymentRollouts) GetRollout(ctx context.Context, functionName, namespace string) (rolloutStatus, error) {
+	deployment := struct {
+		Metadata struct {
+			Generation int64 `json:"generation"`
+		} `json:"metadata"`
+		Status struct {
+			ObservedGeneration int64 `json:"observedGeneration"`
+			Replicas           int64 `json:"replicas"`
+			UpdatedReplicas    int64 `json:"updatedReplicas"`
+			AvailableReplicas  int64 `json:"availableReplicas"`
+		} `json:"status"`
+	}{}
+
+	found, err := d.Kube.Get(d.path(functionName, namespace), &deployment)
+	if err != nil {
+		return rolloutStatus{}, err
+	}
+	if !found {
+		return rolloutStatus{}, fmt.Errorf("deployment %s not found", functionName)
+	}
+
+	return rolloutStatus{
+		Generation:         deployment.Metadata.Generation,
+		ObservedGeneration: deployment.Status.ObservedGeneration,
+		Replicas:           deployment.Status.Replicas,
+		UpdatedReplicas:    deployment.Status.UpdatedReplicas,
+		AvailableReplicas:  deployment.Status.AvailableReplicas,
+	}, nil
+}
+
+// Restore puts the pod template, labels and annotations of the previous
+// Deployment back, so that its image, environment, secrets and resources
+// are all rolled back together
+func (d *deploymentRollouts) Restore(functionName, namespace string, previous map[string]interface{}) error {
+	current, found, err := d.Snapshot(functionName, namespace)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("deployment %s not found", functionName)
+	}
+
+	previousSpec, _ := previous["spec"].(map[string]interface{})
+	currentSpec, _ := current["spec"].(map[string]interface{})
+	if previousSpec == nil || currentSpec == nil {
+		return fmt.Errorf("deployment %s has no spec", functionName)
+	}
+	currentSpec["template"] = previousSpec["template"]
+
+	previousMetadata, _ := previous["metadata"].(map[string]interface{})
+	currentMetadata, _ := current["metadata"].(map[string]interface{})
+	if previousMetadata != nil && currentMetadata != nil {
+		currentMetadata["labels"] = previousMetadata["labels"]
+		currentMetadata["annotations"] = previousMetadata["annotations"]
+	}
+
+	return d.Kube.Update(d.path(functionName, namespace), current)
+}
+
+// getReadinessConfig reads verify_deployment, readiness_timeout,
+// readiness_interval and verify_health_path from the environment.
+func getReadinessConfig() ReadinessConfig {
+	return ReadinessConfig{
+		Enabled:         readBoolConfig("verify_deployment", true),
+		Timeout:         parseDurationConfig("readiness_timeout", time.Second*60),
+		Interval:        parseDurationConfig("readiness_interval", time.Second*2),
+		CheckHealthPath: readBoolConfig("verify_health_path", true),
+	}
+}
+
+// waitForReady polls the rollout of the function until every replica runs
+// the new version and at least minReplicas are available, or until the
+// timeout expires or ctx is cancelled.
+func waitForReady(ctx context.Context, fetcher rolloutFetcher, functionName, namespace string, minReplicas uint64, cfg ReadinessConfig) error {
+	if minReplicas < 1 {
+		minReplicas = 1
+	}
+
+	deadline := time.Now().Add(cfg.Timeout)
+	var lastErr error
+	var status rolloutStatus
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s not ready: %s", functionName, err.Error())
+		}
+
+		current, err := fetcher.GetRollout(ctx, functionName, namespace)
+		if err != nil {
+			lastErr = err
+		} else {
+			status = current
+			if status.ready(minReplicas) {
+				return nil
+			}
+		}
+
+		if time.Now().Add(cfg.Interval).After(deadline) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s not ready: %s", functionName, ctx.Err().Error())
+		case <-time.After(cfg.Interval):
+		}
+	}
+
+	if lastErr != nil && status.AvailableReplicas == 0 {
+		return fmt.Errorf("%s not ready after %s: %s", functionName, cfg.Timeout, lastErr.Error())
+	}
+
+	if status.UpdatedReplicas != status.Replicas || status.ObservedGeneration < status.Generation {
+		return fmt.Errorf("%s not ready after %s: %d/%d replicas updated", functionName, cfg.Timeout, status.UpdatedReplicas, status.Replicas)
+	}
+
+	return fmt.Errorf("%s not ready after %s: %d/%d replicas available", functionName, cfg.Timeout, status.AvailableReplicas, minReplicas)
+}
+
+// checkHealthPath invokes the function's health path through the gateway
+// and expects a 2xx status code.
+func checkHealthPath(c *http.Client, gatewayURL, functionName, namespace, healthPath string) error {
+	healthURL := fmt.Sprintf("%sfunction/%s/%s", gatewayURL, sdk.FunctionRef(functionName, namespace), strings.TrimLeft(healthPath, "/"))
+
+	req, _ := http.NewRequest(http.MethodGet, healthURL, nil)
+
+	res, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check %s failed: %s", healthPath, err.Error())
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("health check %s failed: status code %d", healthPath, res.StatusCode)
+	}
+
+	return nil
+}
+
+// verifyDeployment waits for the function to become ready and then
+// optionally calls its health path.
+func verifyDeployment(ctx context.Context, fetcher rolloutFetcher, c *http.Client, gatewayURL, functionName, namespace string, minReplicas uint64, annotations map[string]string, cfg ReadinessConfig) error {
+	if err := waitForReady(ctx, fetcher, functionName, namespace, minReplicas, cfg); err != nil {
+		return err
+	}
+
+	if healthPath, ok := annotations[healthPathAnnotation]; ok && cfg.CheckHealthPath && len(healthPath) > 0 {
+		return checkHealthPath(c, gatewayURL, functionName, namespace, healthPath)
+	}
+
+	return nil
+}
+
+// previousVersion is a function as it was before a deployment, the
+// Deployment is kept when it can be read from Kubernetes, otherwise the
+// status from the gateway
+type previousVersion struct {
+	Deployment map[string]interface{}
+	Function   *types.FunctionStatus
+}
+
+func (p *previousVersion) exists() bool {
+	return p != nil && (p.Deployment != nil || (p.Function != nil && len(p.Function.Image) > 0))
+}
+
+// getPreviousDeployment returns the function as currently deployed, or
+// nil when it does not exist yet. The Deployment is read with rollouts
+// when it is set, if that is not allowed the gateway is asked instead
+// and the rollouts returned are nil.
+func getPreviousDeployment(ctx context.Context, fetcher functionStatusFetcher, rollouts *deploymentRollouts, functionName, namespace string) (*previousVersion, *deploymentRollouts) {
+	if rollouts != nil {
+		deployment, found, err := rollouts.Snapshot(functionName, namespace)
+		if err == nil && !found {
+			return nil, rollouts
+		}
+		if err == nil {
+			return &previousVersion{Deployment: deployment}, rollouts
+		}
+
+		log.Printf("unable to read the deployment of %s, checking available replicas through the gateway: %s", functionName, err.Error())
+	}
+
+	fn, err := fetcher.GetFunctionInfo(ctx, functionName, namespace)
+	if err != nil {
+		log.Printf("no previous deployment found for %s: %s", functionName, err.Error())
+		return nil, nil
+	}
+	return &previousVersion{Function: &fn}, nil
+}
+
+// buildRollbackSpec restores what the gateway gives of the previous
+// version onto a copy of the spec which failed verification. The gateway
+// does not give the environment, secrets or resources of a function, so
+// these are only rolled back from the Deployment.
+func buildRollbackSpec(spec *faasSDK.DeployFunctionSpec, previous *types.FunctionStatus) *faasSDK.DeployFunctionSpec {
+	rollbackSpec := *spec
+	rollbackSpec.Image = previous.Image
+	rollbackSpec.Update = true
+
+	if len(previous.EnvProcess) > 0 {
+		rollbackSpec.FProcess = previous.EnvProcess
+	}
+
+	if previous.Labels != nil {
+		labels := map[string]string{}
+		for k, v := range *previous.Labels {
+			labels[k] = v
+		}
+		rollbackSpec.Labels = labels
+	}
+
+	if previous.Annotations != nil {
+		annotations := map[string]string{}
+		for k, v := range *previous.Annotations {
+			annotations[k] = v
+		}
+		rollbackSpec.Annotations = annotations
+	}
+
+	return &rollbackSpec
+}
+
+// rollback re-deploys the previous version of a function after a failed
+// verification, the returned error always describes why the deployment failed.
+func rollback(ctx context.Context, client *faasSDK.Client, rollouts *deploymentRollouts, spec *faasSDK.DeployFunctionSpec, previous *previousVersion, gatewayURL string, reason error) error {
+	if !previous.exists() {
+		return fmt.Errorf("readiness check failed: %s, no previous version to roll back to", reason.Error())
+	}
+
+	log.Printf("Rolling back %s to the previous version", spec.FunctionName)
+
+	var err error
+	if previous.Deployment != nil && rollouts != nil {
+		err = rollouts.Restore(spec.FunctionName, spec.Namespace, previous.Deployment)
+	} else {
+		_, err = deployFunction(ctx, client, buildRollbackSpec(spec, previous.Function), gatewayURL)
+	}
+
+	if err != nil {
+		return fmt.Errorf("readiness check failed: %s, rollback failed: %s", reason.Error(), err.Error())
+	}
+
+	return fmt.Errorf("readiness check failed: %s, rolled back to the previous version", reason.Error())
+}
+
+func parseMinReplicas(val string) uint64 {
+	minReplicas, err := strconv.ParseUint(val, 10, 64)
+	if err != nil || minReplicas < 1 {
+		return 1
+	}
+	return minReplicas
+}
+
+func readBoolConfig(key string, defaultValue bool) bool {
+	if val, exists := os.LookupEnv(key); exists && len(val) > 0 {
+		return val != "false" && val != "0"
+	}
+	return defaultValue
+}
+
+func parseDurationConfig(key string, fallback time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if len(val) == 0 {
+		return fallback
+	}
+
+	if seconds, err := strconv.Atoi(val); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	duration, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("unable to parse %s=%q as a duration, using %s", key, val, fallback)
+		return fallback
+	}
+	return duration
+}
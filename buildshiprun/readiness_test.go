@@ -0,0 +1,306 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+type fakeStatusFetcher struct {
+	statuses []types.FunctionStatus
+	err      error
+	calls    int
+}
+
+func (f *fakeStatusFetcher) GetFunctionInfo(ctx context.Context, functionName string, namespace string) (types.FunctionStatus, error) {
+	if f.err != nil {
+		return types.FunctionStatus{}, f.err
+	}
+
+	i := f.calls
+	if i >= len(f.statuses) {
+		i = len(f.statuses) - 1
+	}
+	f.calls++
+	return f.statuses[i], nil
+}
+
+type fakeRolloutFetcher struct {
+	statuses []rolloutStatus
+	err      error
+	calls    int
+}
+
+func (f *fakeRolloutFetcher) GetRollout(ctx context.Context, functionName, namespace string) (rolloutStatus, error) {
+	if f.err != nil {
+		return rolloutStatus{}, f.err
+	}
+
+	i := f.calls
+	if i >= len(f.statuses) {
+		i = len(f.statuses) - 1
+	}
+	f.calls++
+	return f.statuses[i], nil
+}
+
+func Test_waitForReady(t *testing.T) {
+	cfg := ReadinessConfig{
+		Enabled:  true,
+		Timeout:  time.Millisecond * 50,
+		Interval: time.Millisecond * 5,
+	}
+
+	tests := []struct {
+		title   string
+		fetcher *fakeRolloutFetcher
+		min     uint64
+		wantErr bool
+	}{
+		{
+			title: "ready after replicas become available",
+			fetcher: &fakeRolloutFetcher{statuses: []rolloutStatus{
+				{Generation: 2, ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 0},
+				{Generation: 2, ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+			}},
+			min: 1,
+		},
+		{
+			title: "never ready, i.e. crash-looping",
+			fetcher: &fakeRolloutFetcher{statuses: []rolloutStatus{
+				{Generation: 2, ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 0},
+			}},
+			min:     1,
+			wantErr: true,
+		},
+		{
+			title: "previous version still available while the new one crash-loops",
+			fetcher: &fakeRolloutFetcher{statuses: []rolloutStatus{
+				{Generation: 2, ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 1},
+			}},
+			min:     1,
+			wantErr: true,
+		},
+		{
+			title: "update not yet observed",
+			fetcher: &fakeRolloutFetcher{statuses: []rolloutStatus{
+				{Generation: 2, ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+			}},
+			min:     1,
+			wantErr: true,
+		},
+		{
+			title: "below the minimum",
+			fetcher: &fakeRolloutFetcher{statuses: []rolloutStatus{
+				{Generation: 1, ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+			}},
+			min:     2,
+			wantErr: true,
+		},
+		{
+			title:   "gateway error",
+			fetcher: &fakeRolloutFetcher{err: fmt.Errorf("No such function")},
+			min:     1,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			err := waitForReady(context.Background(), test.fetcher, "alexellis-fn1", "", test.min, cfg)
+			if test.wantErr && err == nil {
+				t.Errorf("want error, got nil")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("want no error, got: %s", err)
+			}
+		})
+	}
+}
+
+func Test_waitForReady_Cancelled(t *testing.T) {
+	cfg := ReadinessConfig{
+		Enabled:  true,
+		Timeout:  time.Minute,
+		Interval: time.Second,
+	}
+	fetcher := &fakeRolloutFetcher{statuses: []rolloutStatus{{Replicas: 1}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	started := time.Now()
+	if err := waitForReady(ctx, fetcher, "alexellis-fn1", "", 1, cfg); err == nil {
+		t.Errorf("want error when cancelled")
+	}
+	if time.Since(started) > time.Second/2 {
+		t.Errorf("want to return once cancelled, took: %s", time.Since(started))
+	}
+}
+
+func Test_deploymentRollouts(t *testing.T) {
+	deployment := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":            "alexellis-fn1",
+			"generation":      3,
+			"resourceVersion": "20",
+			"labels":          map[string]interface{}{"com.openfaas.cloud.git-sha": "new"},
+		},
+		"spec": map[string]interface{}{
+			"replicas": 1,
+			"template": map[string]interface{}{"image": "new"},
+		},
+		"status": map[string]interface{}{
+			"observedGeneration": 3,
+			"replicas":           2,
+			"updatedReplicas":    1,
+			"availableReplicas":  1,
+		},
+	}
+
+	var updated map[string]interface{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/apps/v1/namespaces/openfaas-fn/deployments/alexellis-fn1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPut {
+			json.NewDecoder(r.Body).Decode(&updated)
+		}
+		json.NewEncoder(w).Encode(deployment)
+	}))
+	defer api.Close()
+
+	rollouts := &deploymentRollouts{
+		Kube: &sdk.KubeClient{BaseURL: api.URL, Namespace: "openfaas-fn", Client: http.DefaultClient},
+	}
+
+	status, err := rollouts.GetRollout(context.Background(), "alexellis-fn1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ready(1) {
+		t.Errorf("want not ready with a replica of the previous version, got: %+v", status)
+	}
+
+	previous := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"com.openfaas.cloud.git-sha": "old"},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{"image": "old"},
+		},
+	}
+	if err := rollouts.Restore("alexellis-fn1", "", previous); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := updated["spec"].(map[string]interface{})
+	metadata := updated["metadata"].(map[string]interface{})
+	if spec["template"].(map[string]interface{})["image"] != "old" {
+		t.Errorf("want previous template restored, got: %v", spec["template"])
+	}
+	if metadata["labels"].(map[string]interface{})["com.openfaas.cloud.git-sha"] != "old" {
+		t.Errorf("want previous labels restored, got: %v", metadata["labels"])
+	}
+	if metadata["resourceVersion"] != "20" {
+		t.Errorf("want the current resourceVersion kept, got: %v", metadata["resourceVersion"])
+	}
+}
+
+func Test_verifyDeployment_HealthPath(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/function/alexellis-fn1/healthz" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer gateway.Close()
+
+	cfg := ReadinessConfig{
+		Enabled:         true,
+		Timeout:         time.Millisecond * 10,
+		Interval:        time.Millisecond * 5,
+		CheckHealthPath: true,
+	}
+	fetcher := gatewayRollouts{Fetcher: &fakeStatusFetcher{statuses: []types.FunctionStatus{{AvailableReplicas: 1}}}}
+
+	err := verifyDeployment(context.Background(), fetcher, http.DefaultClient, gateway.URL+"/", "alexellis-fn1", "", 1,
+		map[string]string{healthPathAnnotation: "/healthz"}, cfg)
+	if err != nil {
+		t.Errorf("want healthy, got: %s", err)
+	}
+
+	err = verifyDeployment(context.Background(), fetcher, http.DefaultClient, gateway.URL+"/", "alexellis-fn1", "", 1,
+		map[string]string{healthPathAnnotation: "/broken"}, cfg)
+	if err == nil {
+		t.Errorf("want health check error, got nil")
+	}
+
+	cfg.CheckHealthPath = false
+	err = verifyDeployment(context.Background(), fetcher, http.DefaultClient, gateway.URL+"/", "alexellis-fn1", "", 1,
+		map[string]string{healthPathAnnotation: "/broken"}, cfg)
+	if err != nil {
+		t.Errorf("want health path to be skipped, got: %s", err)
+	}
+}
+
+func Test_buildRollbackSpec(t *testing.T) {
+	labels := map[string]string{"com.openfaas.cloud.git-sha": "old"}
+	annotations := map[string]string{"topic": "old"}
+	previous := &types.FunctionStatus{
+		Image:       "registry:5000/alexellis/fn1:old",
+		EnvProcess:  "./handler --old",
+		Labels:      &labels,
+		Annotations: &annotations,
+	}
+	spec := &faasSDK.DeployFunctionSpec{
+		FunctionName: "alexellis-fn1",
+		Image:        "registry:5000/alexellis/fn1:new",
+		FProcess:     "./handler",
+		Labels:       map[string]string{"com.openfaas.cloud.git-sha": "new"},
+		Annotations:  map[string]string{"topic": "new"},
+	}
+
+	got := buildRollbackSpec(spec, previous)
+
+	if got.Image != previous.Image {
+		t.Errorf("Image want: %s, got: %s", previous.Image, got.Image)
+	}
+	if got.FProcess != previous.EnvProcess || got.Annotations["topic"] != "old" {
+		t.Errorf("want fprocess and annotations of the previous version, got: %q %v", got.FProcess, got.Annotations)
+	}
+	if got.Labels["com.openfaas.cloud.git-sha"] != "old" {
+		t.Errorf("git-sha label want: old, got: %s", got.Labels["com.openfaas.cloud.git-sha"])
+	}
+	if !got.Update {
+		t.Errorf("want rollback to be an update")
+	}
+	if spec.Image != "registry:5000/alexellis/fn1:new" {
+		t.Errorf("original spec should not be modified, got image: %s", spec.Image)
+	}
+}
+
+func Test_parseMinReplicas(t *testing.T) {
+	values := map[string]uint64{
+		"":    1,
+		"0":   1,
+		"3":   3,
+		"abc": 1,
+	}
+
+	for val, want := range values {
+		if got := parseMinReplicas(val); got != want {
+			t.Errorf("parseMinReplicas(%q) want: %d, got: %d", val, want, got)
+		}
+	}
+}
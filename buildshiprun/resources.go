@@ -0,0 +1,228 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// ResourceBounds are the operator's minimum and maximum values for
+// the limits and requests given by users, 0 means no bound
+type ResourceBounds struct {
+	MinMemoryMB int
+	MaxMemoryMB int
+	MinCPUMilli int
+	MaxCPUMilli int
+}
+
+// getResourceBounds reads function_memory_min_mb, function_memory_max_mb,
+// function_cpu_min_milli and function_cpu_max_milli from the environment,
+// an owner's quota replaces the maximum values.
+func getResourceBounds(quota sdk.Quota) ResourceBounds {
+	bounds := ResourceBounds{
+		MinMemoryMB: readIntConfig("function_memory_min_mb"),
+		MaxMemoryMB: readIntConfig("function_memory_max_mb"),
+		MinCPUMilli: readIntConfig("function_cpu_min_milli"),
+		MaxCPUMilli: readIntConfig("function_cpu_max_milli"),
+	}
+
+	if quota.MemoryLimitMB > 0 {
+		bounds.MaxMemoryMB = quota.MemoryLimitMB
+	}
+	if quota.CPULimitMilli > 0 {
+		bounds.MaxCPUMilli = quota.CPULimitMilli
+	}
+
+	return bounds
+}
+
+// applyUserResources sets the limits and requests from the user's stack.yml
+// on the function once clamped to the bounds, a warning is returned for each
+// value which could not be used as given.
+func applyUserResources(deploy *faasSDK.DeployFunctionSpec, limits, requests *sdk.FunctionResources, bounds ResourceBounds) []string {
+	warnings := []string{}
+	if limits == nil {
+		limits = &sdk.FunctionResources{}
+	}
+	if requests == nil {
+		requests = &sdk.FunctionResources{}
+	}
+
+	memoryLimit, warning := resolveResource("memory limit", limits.Memory, parseMemoryMB, bounds.MinMemoryMB, bounds.MaxMemoryMB)
+	warnings = appendWarning(warnings, warning)
+
+	memoryRequest, warning := resolveResource("memory request", requests.Memory, parseMemoryMB, bounds.MinMemoryMB, bounds.MaxMemoryMB)
+	warnings = appendWarning(warnings, warning)
+
+	if memoryLimit > 0 {
+		deploy.FunctionResourceRequest.Limits.Memory = formatMemoryLimit(strconv.Itoa(memoryLimit))
+	}
+	if memoryRequest > 0 {
+		deploy.FunctionResourceRequest.Requests.Memory = formatMemoryLimit(strconv.Itoa(memoryRequest))
+	}
+
+	warnings = appendWarning(warnings, capRequest("memory request", &deploy.FunctionResourceRequest.Requests.Memory, deploy.FunctionResourceRequest.Limits.Memory, parseMemoryMB))
+
+	if len(limits.CPU) > 0 || len(requests.CPU) > 0 {
+		if !isKubernetes() {
+			return append(warnings, "cpu limits and requests are only available on Kubernetes")
+		}
+	}
+
+	cpuLimit, warning := resolveResource("cpu limit", limits.CPU, parseCPUMilli, bounds.MinCPUMilli, bounds.MaxCPUMilli)
+	warnings = appendWarning(warnings, warning)
+
+	cpuRequest, warning := resolveResource("cpu request", requests.CPU, parseCPUMilli, bounds.MinCPUMilli, bounds.MaxCPUMilli)
+	warnings = appendWarning(warnings, warning)
+
+	if cpuLimit > 0 {
+		deploy.FunctionResourceRequest.Limits.CPU = fmt.Sprintf("%dm", cpuLimit)
+	}
+	if cpuRequest > 0 {
+		deploy.FunctionResourceRequest.Requests.CPU = fmt.Sprintf("%dm", cpuRequest)
+	}
+
+	return appendWarning(warnings, capRequest("cpu request", &deploy.FunctionResourceRequest.Requests.CPU, deploy.FunctionResourceRequest.Limits.CPU, parseCPUMilli))
+}
+
+// capRequest lowers a request to its limit, as a request above the limit
+// is refused. Either may be the user's value or the default, so the
+// values set on the function are compared.
+func capRequest(name string, request *string, limit string, parse func(string) (int, error)) string {
+	if len(*request) == 0 || len(limit) == 0 {
+		return ""
+	}
+
+	requestValue, err := parse(*request)
+	if err != nil {
+		return ""
+	}
+	limitValue, err := parse(limit)
+	if err != nil || requestValue <= limitValue {
+		return ""
+	}
+
+	warning := fmt.Sprintf("%s %s is above the limit, using %s", name, *request, formatResource(name, limitValue))
+	*request = formatResource(name, limitValue)
+	return warning
+}
+
+// resolveResource parses a value and clamps it between min and max,
+// 0 is returned when the value is not set or is invalid.
+func resolveResource(name, value string, parse func(string) (int, error), min, max int) (int, string) {
+	if len(value) == 0 {
+		return 0, ""
+	}
+
+	parsed, err := parse(value)
+	if err != nil {
+		return 0, fmt.Sprintf("%s %q is invalid, using the default", name, value)
+	}
+
+	if min > 0 && parsed < min {
+		return min, fmt.Sprintf("%s %s is below the minimum, using %s", name, value, formatResource(name, min))
+	}
+
+	if max > 0 && parsed > max {
+		return max, fmt.Sprintf("%s %s is above the maximum, using %s", name, value, formatResource(name, max))
+	}
+
+	return parsed, ""
+}
+
+func formatResource(name string, value int) string {
+	if strings.HasPrefix(name, "cpu") {
+		return fmt.Sprintf("%dm", value)
+	}
+	return formatMemoryLimit(strconv.Itoa(value))
+}
+
+// parseMemoryMB parses a memory value from stack.yml into MB, both the
+// Kubernetes (128Mi, 1Gi) and Swarm (128m, 1g) formats are accepted.
+func parseMemoryMB(value string) (int, error) {
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"Ki", 1.0 / 1024}, {"Mi", 1}, {"Gi", 1024},
+		{"K", 1.0 / 1024}, {"M", 1}, {"G", 1024},
+		{"k", 1.0 / 1024}, {"m", 1}, {"g", 1024},
+	}
+
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+			if err != nil || number <= 0 {
+				return 0, fmt.Errorf("invalid memory value: %s", value)
+			}
+			return toMB(value, number*unit.factor)
+		}
+	}
+
+	// Without a unit the value is in bytes
+	bytes, err := strconv.ParseFloat(value, 64)
+	if err != nil || bytes <= 0 {
+		return 0, fmt.Errorf("invalid memory value: %s", value)
+	}
+	return toMB(value, bytes/(1024*1024))
+}
+
+func toMB(value string, mb float64) (int, error) {
+	if mb < 1 {
+		return 0, fmt.Errorf("memory value %s is less than 1MB", value)
+	}
+	return int(mb), nil
+}
+
+// parseCPUMilli parses a CPU value such as 100m or 0.5 into milliCPU
+func parseCPUMilli(value string) (int, error) {
+	if strings.HasSuffix(value, "m") {
+		milli, err := strconv.Atoi(strings.TrimSuffix(value, "m"))
+		if err != nil || milli <= 0 {
+			return 0, fmt.Errorf("invalid cpu value: %s", value)
+		}
+		return milli, nil
+	}
+
+	cores, err := strconv.ParseFloat(value, 64)
+	if err != nil || cores <= 0 {
+		return 0, fmt.Errorf("invalid cpu value: %s", value)
+	}
+	return int(cores * 1000), nil
+}
+
+func parseFunctionResources(envKey, service string) *sdk.FunctionResources {
+	val := os.Getenv(envKey)
+	if len(val) == 0 {
+		return nil
+	}
+
+	resources := sdk.FunctionResources{}
+	if err := json.Unmarshal([]byte(val), &resources); err != nil {
+		log.Printf("Error un-marshaling %s for function %s, %s", envKey, service, err)
+		return nil
+	}
+
+	return &resources
+}
+
+func appendWarning(warnings []string, warning string) []string {
+	if len(warning) > 0 {
+		return append(warnings, warning)
+	}
+	return warnings
+}
+
+func readIntConfig(key string) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || val < 0 {
+		return 0
+	}
+	return val
+}
@@ -0,0 +1,154 @@
+package function
+
+import (
+	"os"
+	"testing"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_parseMemoryMB(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "128Mi", want: 128},
+		{value: "1Gi", want: 1024},
+		{value: "128m", want: 128},
+		{value: "2g", want: 2048},
+		{value: "262144Ki", want: 256},
+		{value: "134217728", want: 128},
+		{value: "100", wantErr: true},
+		{value: "lots", wantErr: true},
+		{value: "-1Mi", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseMemoryMB(test.value)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("want error: %v, got: %v", test.wantErr, err)
+			}
+			if got != test.want {
+				t.Errorf("want %d, got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_parseCPUMilli(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "100m", want: 100},
+		{value: "0.5", want: 500},
+		{value: "2", want: 2000},
+		{value: "fast", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseCPUMilli(test.value)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("want error: %v, got: %v", test.wantErr, err)
+			}
+			if got != test.want {
+				t.Errorf("want %d, got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_applyUserResources_WithinBounds(t *testing.T) {
+	os.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+
+	deploy := newQuotaTestSpec()
+	bounds := ResourceBounds{MinMemoryMB: 64, MaxMemoryMB: 512, MaxCPUMilli: 1000}
+
+	warnings := applyUserResources(deploy,
+		&sdk.FunctionResources{Memory: "256Mi", CPU: "200m"},
+		&sdk.FunctionResources{Memory: "128Mi", CPU: "100m"},
+		bounds)
+
+	if len(warnings) > 0 {
+		t.Errorf("want no warnings, got: %v", warnings)
+	}
+
+	limits := deploy.FunctionResourceRequest.Limits
+	requests := deploy.FunctionResourceRequest.Requests
+	if limits.Memory != "256Mi" || limits.CPU != "200m" || requests.Memory != "128Mi" || requests.CPU != "100m" {
+		t.Errorf("unexpected resources, limits: %+v, requests: %+v", limits, requests)
+	}
+}
+
+func Test_applyUserResources_Clamped(t *testing.T) {
+	os.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+
+	deploy := newQuotaTestSpec()
+	bounds := ResourceBounds{MinMemoryMB: 64, MaxMemoryMB: 512, MaxCPUMilli: 1000}
+
+	warnings := applyUserResources(deploy,
+		&sdk.FunctionResources{Memory: "2Gi", CPU: "4"},
+		&sdk.FunctionResources{Memory: "32Mi"},
+		bounds)
+
+	if len(warnings) != 3 {
+		t.Errorf("want 3 warnings, got: %v", warnings)
+	}
+
+	limits := deploy.FunctionResourceRequest.Limits
+	requests := deploy.FunctionResourceRequest.Requests
+	if limits.Memory != "512Mi" || limits.CPU != "1000m" || requests.Memory != "64Mi" {
+		t.Errorf("unexpected resources, limits: %+v, requests: %+v", limits, requests)
+	}
+}
+
+func Test_applyUserResources_RequestCappedAtDefaultLimit(t *testing.T) {
+	os.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+
+	deploy := newQuotaTestSpec()
+	bounds := ResourceBounds{MinMemoryMB: 64, MaxMemoryMB: 512, MaxCPUMilli: 1000}
+
+	warnings := applyUserResources(deploy, nil,
+		&sdk.FunctionResources{Memory: "256Mi", CPU: "800m"},
+		bounds)
+
+	if len(warnings) != 2 {
+		t.Errorf("want 2 warnings, got: %v", warnings)
+	}
+
+	limits := deploy.FunctionResourceRequest.Limits
+	requests := deploy.FunctionResourceRequest.Requests
+	if limits.Memory != "128Mi" || limits.CPU != "500m" || requests.Memory != "128Mi" || requests.CPU != "500m" {
+		t.Errorf("want requests capped at the default limits, limits: %+v, requests: %+v", limits, requests)
+	}
+}
+
+func Test_applyUserResources_InvalidKeepsDefault(t *testing.T) {
+	deploy := newQuotaTestSpec()
+
+	warnings := applyUserResources(deploy, &sdk.FunctionResources{Memory: "lots"}, nil, ResourceBounds{})
+
+	if len(warnings) != 1 {
+		t.Errorf("want 1 warning, got: %v", warnings)
+	}
+	if deploy.FunctionResourceRequest.Limits.Memory != "128Mi" {
+		t.Errorf("want default memory limit, got: %s", deploy.FunctionResourceRequest.Limits.Memory)
+	}
+}
+
+func Test_getResourceBounds_QuotaReplacesMaximum(t *testing.T) {
+	os.Setenv("function_memory_max_mb", "256")
+	defer os.Unsetenv("function_memory_max_mb")
+
+	bounds := getResourceBounds(sdk.Quota{MemoryLimitMB: 1024})
+	if bounds.MaxMemoryMB != 1024 {
+		t.Errorf("want max memory 1024, got: %d", bounds.MaxMemoryMB)
+	}
+}
@@ -0,0 +1,84 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// getDeployTargets gives the gateways which the function in the event is
+// deployed to, see sdk.DeployTargets for how they are selected
+func getDeployTargets(event *sdk.Event) ([]sdk.DeployTarget, error) {
+	targets, err := sdk.ReadDeployTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	return targets.Select(event.Owner, event.Annotations)
+}
+
+// newTargetClient creates a client for the gateway of a target
+func newTargetClient(target sdk.DeployTarget) *faasSDK.Client {
+	return faasSDK.NewClient(&FaaSAuth{Target: target}, target.GatewayURL, nil, &timeout)
+}
+
+// getTargetRepositoryURL gives the registry the target pulls images from
+func getTargetRepositoryURL(target sdk.DeployTarget, repositoryURL string) string {
+	if len(target.RepositoryURL) > 0 {
+		return target.RepositoryURL
+	}
+	return repositoryURL
+}
+
+// checkRemoteTarget makes sure that a target other than the local cluster
+// has the namespace and secrets of the function, as buildshiprun can only
+// create these on the cluster it runs in
+func checkRemoteTarget(ctx context.Context, client *faasSDK.Client, namespace string, secrets []string) error {
+	if len(namespace) > 0 {
+		namespaces, err := client.ListNamespaces(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to list namespaces on %s: %s", client.GatewayURL.String(), err.Error())
+		}
+		if !containsString(namespaces, namespace) {
+			return fmt.Errorf("namespace %s must be created on %s before deploying", namespace, client.GatewayURL.String())
+		}
+	}
+
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	found, err := client.GetSecretList(ctx, namespace)
+	if err != nil {
+		return fmt.Errorf("unable to list secrets on %s: %s", client.GatewayURL.String(), err.Error())
+	}
+
+	names := []string{}
+	for _, secret := range found {
+		names = append(names, secret.Name)
+	}
+
+	missing := []string{}
+	for _, secret := range secrets {
+		if !containsString(names, secret) {
+			missing = append(missing, secret)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("secrets %s must be created on %s before deploying", strings.Join(missing, ", "), client.GatewayURL.String())
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
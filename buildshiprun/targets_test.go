@@ -0,0 +1,96 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/openfaas/faas-provider/types"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_getDeployTargets_Annotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	targetsPath := path.Join(dir, "targets.json")
+	ioutil.WriteFile(targetsPath, []byte(`{"targets": [
+  {"name": "eu-west", "gatewayURL": "https://gateway.eu-west.example.com/"},
+  {"name": "us-east", "gatewayURL": "https://gateway.us-east.example.com/", "repositoryURL": "registry.us-east.example.com/"}
+]}`), 0600)
+
+	os.Setenv("deploy_targets_path", targetsPath)
+	defer os.Setenv("deploy_targets_path", "")
+
+	event := &sdk.Event{
+		Owner:       "alexellis",
+		Annotations: map[string]string{sdk.TargetsAnnotation: "us-east"},
+	}
+
+	targets, err := getDeployTargets(event)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if len(targets) != 1 || targets[0].Name != "us-east" {
+		t.Fatalf("want us-east only, got: %+v", targets)
+	}
+
+	got := getTargetRepositoryURL(targets[0], "docker.io/ofcommunity/")
+	if got != "registry.us-east.example.com/" {
+		t.Errorf("want target repository URL, got: %s", got)
+	}
+}
+
+func Test_getTargetRepositoryURL_Default(t *testing.T) {
+	got := getTargetRepositoryURL(sdk.DeployTarget{}, "docker.io/ofcommunity/")
+	if got != "docker.io/ofcommunity/" {
+		t.Errorf("want default repository URL, got: %s", got)
+	}
+}
+
+func Test_checkRemoteTarget(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var bytesOut []byte
+		switch r.URL.Path {
+		case "/system/namespaces":
+			bytesOut, _ = json.Marshal([]string{"openfaas-fn", "openfaas-fn-alexellis"})
+		case "/system/secrets":
+			bytesOut, _ = json.Marshal([]types.Secret{{Name: "alexellis-api-key"}})
+		}
+		w.Write(bytesOut)
+	}))
+	defer gateway.Close()
+
+	tests := []struct {
+		Scenario  string
+		Namespace string
+		Secrets   []string
+		WantErr   bool
+	}{
+		{Scenario: "namespace and secrets found", Namespace: "openfaas-fn-alexellis", Secrets: []string{"alexellis-api-key"}},
+		{Scenario: "no namespace given", Namespace: ""},
+		{Scenario: "namespace missing", Namespace: "openfaas-fn-rgee0", WantErr: true},
+		{Scenario: "secret missing", Namespace: "openfaas-fn-alexellis", Secrets: []string{"alexellis-api-key", "alexellis-token"}, WantErr: true},
+	}
+
+	client := newTargetClient(sdk.DeployTarget{Name: "eu-west", GatewayURL: gateway.URL + "/"})
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			err := checkRemoteTarget(context.Background(), client, testCase.Namespace, testCase.Secrets)
+			if (err != nil) != testCase.WantErr {
+				t.Errorf("want error %t, got: %v", testCase.WantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package function
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// sessionCookie is set by edge-auth once a user has logged in, the
+// dashboard forwards it along with each request for a canary
+const sessionCookie = "openfaas_cloud_token"
+
+// SessionClaims are the parts of the session issued by edge-auth which
+// are needed to check who may promote or abort a canary
+type SessionClaims struct {
+	// Organizations of the user separated with commas
+	Organizations string `json:"organizations"`
+
+	jwt.StandardClaims
+}
+
+// CanActFor is true when the session belongs to the owner or to a member
+// of the owner's organization
+func (c *SessionClaims) CanActFor(owner string) bool {
+	identities := append([]string{c.Subject}, strings.Split(c.Organizations, ",")...)
+
+	for _, identity := range identities {
+		identity = strings.TrimSpace(identity)
+		if len(identity) > 0 && strings.EqualFold(identity, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// readPublicKey reads the public key of edge-auth from the jwt-public-key
+// secret
+func readPublicKey() (*ecdsa.PublicKey, error) {
+	key, err := sdk.ReadSecret("jwt-public-key")
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.ParseECPublicKeyFromPEM([]byte(key))
+}
+
+// readSession verifies the session cookie in the Cookie header with the
+// public key of edge-auth
+func readSession(cookieHeader string, publicKey *ecdsa.PublicKey) (*SessionClaims, error) {
+	req := http.Request{Header: http.Header{"Cookie": []string{cookieHeader}}}
+
+	cookie, err := req.Cookie(sessionCookie)
+	if err != nil || len(cookie.Value) == 0 {
+		return nil, fmt.Errorf("no session was given, log in through the dashboard")
+	}
+
+	claims := SessionClaims{}
+	_, err = jwt.ParseWithClaims(cookie.Value, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return publicKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid session: %s", err.Error())
+	}
+
+	return &claims, nil
+}
+
+// checkOwner refuses a canary which does not belong to the owner in the
+// request, the same error is given as for a missing canary
+func checkOwner(canary string, labels *map[string]string, owner string) error {
+	if labels == nil || !strings.EqualFold((*labels)[sdk.FunctionLabelPrefix+"git-owner"], owner) {
+		return fmt.Errorf("no canary found for %s", canary)
+	}
+	return nil
+}
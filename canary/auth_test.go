@@ -0,0 +1,96 @@
+package function
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func signSession(t *testing.T, key *ecdsa.PrivateKey, claims SessionClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessionCookie + "=" + token
+}
+
+func Test_readSession(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	claims := SessionClaims{
+		Organizations: "openfaas",
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "alexellis",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}
+	expired := claims
+	expired.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+
+	tests := []struct {
+		title   string
+		cookie  string
+		wantErr bool
+	}{
+		{title: "valid session", cookie: "other=1; " + signSession(t, key, claims)},
+		{title: "no session", cookie: "other=1", wantErr: true},
+		{title: "signed by another key", cookie: signSession(t, otherKey, claims), wantErr: true},
+		{title: "expired session", cookie: signSession(t, key, expired), wantErr: true},
+		{title: "signed with HMAC", cookie: sessionCookie + "=" + hmacToken, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got, err := readSession(test.cookie, &key.PublicKey)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("want error: %v, got: %v", test.wantErr, err)
+			}
+			if err == nil && got.Subject != "alexellis" {
+				t.Errorf("want subject alexellis, got: %s", got.Subject)
+			}
+		})
+	}
+}
+
+func Test_SessionClaims_CanActFor(t *testing.T) {
+	claims := SessionClaims{Organizations: "openfaas, acme", StandardClaims: jwt.StandardClaims{Subject: "alexellis"}}
+
+	tests := []struct {
+		owner string
+		want  bool
+	}{
+		{owner: "alexellis", want: true},
+		{owner: "AlexEllis", want: true},
+		{owner: "acme", want: true},
+		{owner: "rgee0", want: false},
+		{owner: "", want: false},
+	}
+
+	for _, test := range tests {
+		if got := claims.CanActFor(test.owner); got != test.want {
+			t.Errorf("owner %q: want %v, got %v", test.owner, test.want, got)
+		}
+	}
+}
+
+func Test_checkOwner(t *testing.T) {
+	labels := &map[string]string{sdk.FunctionLabelPrefix + "git-owner": "alexellis"}
+
+	if err := checkOwner("alexellis-fn1", labels, "alexellis"); err != nil {
+		t.Errorf("want the owner's canary allowed, got: %s", err.Error())
+	}
+	if err := checkOwner("alexellis-fn1", labels, "rgee0"); err == nil {
+		t.Errorf("want another owner's canary refused")
+	}
+	if err := checkOwner("alexellis-fn1", nil, "alexellis"); err == nil {
+		t.Errorf("want a canary without labels refused")
+	}
+}
@@ -0,0 +1,221 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const (
+	Source = "canary"
+
+	actionPromote = "promote"
+	actionAbort   = "abort"
+)
+
+var timeout = 10 * time.Second
+
+//FaaSAuth Authentication type for OpenFaaS
+type FaaSAuth struct {
+}
+
+//Set add basic authentication to the request
+func (auth *FaaSAuth) Set(req *http.Request) error {
+	return sdk.AddBasicAuth(req)
+}
+
+// CanaryRequest promotes or aborts the canary of a function by hand
+type CanaryRequest struct {
+	// Action is either "promote" or "abort"
+	Action string `json:"action"`
+
+	// Function is the name of the stable function i.e. alexellis-fn1
+	Function string `json:"function"`
+
+	// Owner of the function, the session must belong to the owner or to
+	// a member of the owner's organization
+	Owner string `json:"owner"`
+}
+
+// Handle evaluates every canary against its metrics when called with an
+// empty body, such as from a schedule, or promotes or aborts a single
+// canary when given a CanaryRequest through the dashboard. The session
+// of edge-auth must belong to the owner or to a member of their
+// organization.
+func Handle(req []byte) string {
+	gatewayURL := os.Getenv("gateway_url")
+	client := faasSDK.NewClient(&FaaSAuth{}, gatewayURL, nil, &timeout)
+	ctx := context.Background()
+
+	// The specs of canaries are stored by buildshiprun through the
+	// Kubernetes API, without it canaries can be aborted but not promoted
+	k, kubeErr := sdk.NewInClusterClient(timeout)
+	if kubeErr != nil {
+		log.Printf("unable to read canary specs: %s", kubeErr.Error())
+	}
+
+	if len(bytes.TrimSpace(req)) > 0 {
+		canaryReq := CanaryRequest{}
+		if err := json.Unmarshal(req, &canaryReq); err != nil {
+			log.Fatalf("unable to parse canary request: %s", err.Error())
+		}
+
+		if err := validateRequest(canaryReq); err != nil {
+			log.Fatal(err)
+		}
+
+		publicKey, err := readPublicKey()
+		if err != nil {
+			log.Fatalf("unable to read the public key of edge-auth: %s", err.Error())
+		}
+
+		claims, err := readSession(os.Getenv("Http_Cookie"), publicKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if !claims.CanActFor(canaryReq.Owner) {
+			log.Fatalf("%s may not %s the canaries of %s", claims.Subject, canaryReq.Action, canaryReq.Owner)
+		}
+
+		namespace := sdk.FunctionNamespace(canaryReq.Owner)
+
+		canary, err := client.GetFunctionInfo(ctx, sdk.FormatCanaryName(canaryReq.Function), namespace)
+		if err != nil {
+			log.Fatalf("no canary found for %s: %s", canaryReq.Function, err.Error())
+		}
+		if err := checkOwner(canaryReq.Function, canary.Labels, canaryReq.Owner); err != nil {
+			log.Fatal(err)
+		}
+		canary.Namespace = namespace
+
+		message, err := apply(ctx, client, k, canaryReq.Action, canary, "requested manually")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return message
+	}
+
+	policy := getPolicy()
+
+	canaries, err := listCanaries(ctx, client)
+	if err != nil {
+		log.Fatalf("unable to list functions: %s", err.Error())
+	}
+
+	for _, fn := range canaries {
+		metrics, err := getMetrics(http.DefaultClient, gatewayURL, sdk.FunctionRef(fn.Name, fn.Namespace), policy.Window)
+		if err != nil {
+			log.Printf("unable to get metrics for %s: %s", fn.Name, err.Error())
+			continue
+		}
+
+		action, reason := decide(metrics, policy)
+		log.Printf("Canary %s - success: %d, failure: %d, decision: %s (%s)", fn.Name, metrics.Success, metrics.Failure, action, reason)
+
+		if action == actionWait {
+			continue
+		}
+
+		if _, err := apply(ctx, client, k, action, fn, reason); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return fmt.Sprintf("Evaluated %d canaries", len(canaries))
+}
+
+// listCanaries finds the canaries in the default namespace, or in
+// every namespace when user namespaces are enabled
+func listCanaries(ctx context.Context, client *faasSDK.Client) ([]types.FunctionStatus, error) {
+	namespaces := []string{""}
+	if sdk.UserNamespaces() {
+		var err error
+		if namespaces, err = client.ListNamespaces(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	canaries := []types.FunctionStatus{}
+	for _, namespace := range namespaces {
+		functions, err := client.ListFunctions(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fn := range functions {
+			if fn.Labels != nil && sdk.IsCanary(*fn.Labels) {
+				fn.Namespace = namespace
+				canaries = append(canaries, fn)
+			}
+		}
+	}
+
+	return canaries, nil
+}
+
+func validateRequest(canaryReq CanaryRequest) error {
+	if canaryReq.Action != actionPromote && canaryReq.Action != actionAbort {
+		return fmt.Errorf("action must be %q or %q, got: %q", actionPromote, actionAbort, canaryReq.Action)
+	}
+
+	if len(canaryReq.Function) == 0 || strings.HasSuffix(canaryReq.Function, sdk.CanarySuffix) {
+		return fmt.Errorf("function must be the name of the stable function i.e. alexellis-fn1, got: %q", canaryReq.Function)
+	}
+
+	if len(canaryReq.Owner) == 0 {
+		return fmt.Errorf("owner is required")
+	}
+
+	return nil
+}
+
+// apply promotes or aborts a canary and posts the outcome to the audit log
+func apply(ctx context.Context, client *faasSDK.Client, k *sdk.KubeClient, action string, canary types.FunctionStatus, reason string) (string, error) {
+	var err error
+	switch action {
+	case actionPromote:
+		err = promote(ctx, client, k, canary)
+	case actionAbort:
+		err = abort(ctx, client, k, canary)
+	default:
+		err = fmt.Errorf("unknown action: %s", action)
+	}
+
+	var message string
+	if err != nil {
+		message = fmt.Sprintf("Unable to %s canary `%s`: %s", action, canary.Name, err.Error())
+	} else if action == actionPromote {
+		message = fmt.Sprintf("Canary `%s` promoted to `%s` - %s", canary.Name, sdk.StableName(canary.Name), reason)
+	} else {
+		message = fmt.Sprintf("Canary `%s` aborted - %s", canary.Name, reason)
+	}
+
+	auditEvent := sdk.AuditEvent{
+		Message: message,
+		Source:  Source,
+	}
+	if canary.Labels != nil {
+		auditEvent.Owner = (*canary.Labels)[sdk.FunctionLabelPrefix+"git-owner"]
+		auditEvent.Repo = (*canary.Labels)[sdk.FunctionLabelPrefix+"git-repo"]
+	}
+	sdk.PostAudit(auditEvent)
+
+	if err != nil {
+		return "", errors.New(message)
+	}
+
+	return message, nil
+}
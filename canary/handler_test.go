@@ -0,0 +1,177 @@
+package function
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_decide(t *testing.T) {
+	policy := Policy{Window: "10m", MinInvocations: 20, MaxFailureRatio: 0.05}
+
+	tests := []struct {
+		title   string
+		metrics Metrics
+		want    string
+	}{
+		{title: "too few invocations", metrics: Metrics{Success: 10, Failure: 0}, want: actionWait},
+		{title: "no failures", metrics: Metrics{Success: 100, Failure: 0}, want: actionPromote},
+		{title: "failures within ratio", metrics: Metrics{Success: 95, Failure: 5}, want: actionPromote},
+		{title: "failures above ratio", metrics: Metrics{Success: 90, Failure: 10}, want: actionAbort},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got, reason := decide(test.metrics, policy)
+			if got != test.want {
+				t.Errorf("want %s, got %s (%s)", test.want, got, reason)
+			}
+		})
+	}
+}
+
+func Test_validateRequest(t *testing.T) {
+	tests := []struct {
+		title   string
+		req     CanaryRequest
+		wantErr bool
+	}{
+		{title: "promote", req: CanaryRequest{Action: actionPromote, Function: "alexellis-fn1", Owner: "alexellis"}},
+		{title: "abort", req: CanaryRequest{Action: actionAbort, Function: "alexellis-fn1", Owner: "alexellis"}},
+		{title: "unknown action", req: CanaryRequest{Action: "rollout", Function: "alexellis-fn1", Owner: "alexellis"}, wantErr: true},
+		{title: "canary name given", req: CanaryRequest{Action: actionPromote, Function: "alexellis-fn1-canary", Owner: "alexellis"}, wantErr: true},
+		{title: "no function", req: CanaryRequest{Action: actionPromote, Owner: "alexellis"}, wantErr: true},
+		{title: "no owner", req: CanaryRequest{Action: actionPromote, Function: "alexellis-fn1"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			err := validateRequest(test.req)
+			if test.wantErr != (err != nil) {
+				t.Errorf("want error: %v, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_buildPromoteSpec(t *testing.T) {
+	spec := sdk.CanarySpec{
+		EnvVars:      map[string]string{"mode": "test"},
+		Secrets:      []string{"alexellis-token"},
+		LimitsMemory: "128Mi",
+	}
+
+	canary := types.FunctionStatus{
+		Name:  "alexellis-fn1-canary",
+		Image: "registry/alexellis-fn1:def",
+		Labels: &map[string]string{
+			"faas_function":                     "alexellis-fn1-canary",
+			"app":                               "alexellis-fn1-canary",
+			sdk.CanaryLabel:                     "1",
+			sdk.FunctionLabelPrefix + "git-sha": "def",
+		},
+		Annotations: &map[string]string{
+			sdk.CanaryWeightAnnotation: "10",
+			sdk.CanarySpecAnnotation:   "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			"topic":                    "payments",
+		},
+	}
+
+	deploy := buildPromoteSpec(canary, spec)
+
+	if deploy.FunctionName != "alexellis-fn1" {
+		t.Errorf("want function alexellis-fn1, got: %s", deploy.FunctionName)
+	}
+	if deploy.Image != canary.Image {
+		t.Errorf("want image %s, got: %s", canary.Image, deploy.Image)
+	}
+	if !deploy.Update {
+		t.Errorf("want the stable function to be updated")
+	}
+	if deploy.Labels["faas_function"] != "alexellis-fn1" || sdk.IsCanary(deploy.Labels) {
+		t.Errorf("want stable labels, got: %v", deploy.Labels)
+	}
+	_, weightKept := deploy.Annotations[sdk.CanaryWeightAnnotation]
+	_, specKept := deploy.Annotations[sdk.CanarySpecAnnotation]
+	if weightKept || specKept {
+		t.Errorf("want canary annotations removed, got: %v", deploy.Annotations)
+	}
+	if deploy.Annotations["topic"] != "payments" {
+		t.Errorf("want user annotations kept, got: %v", deploy.Annotations)
+	}
+	if deploy.EnvVars["mode"] != "test" || len(deploy.Secrets) != 1 || deploy.FunctionResourceRequest.Limits.Memory != "128Mi" {
+		t.Errorf("want canary spec restored, got: %+v", deploy)
+	}
+}
+
+func Test_readCanarySpec(t *testing.T) {
+	secrets := map[string][]byte{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			body, ok := secrets[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		case http.MethodPost:
+			body, _ := ioutil.ReadAll(r.Body)
+			secrets[r.URL.Path+"/canary-spec-alexellis-fn1-canary"] = body
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer api.Close()
+
+	k := &sdk.KubeClient{BaseURL: api.URL, Client: http.DefaultClient}
+
+	hash, err := sdk.WriteCanarySpec(k, "alexellis-fn1-canary", "", sdk.CanarySpec{EnvVars: map[string]string{"mode": "test"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	canary := types.FunctionStatus{
+		Name:        "alexellis-fn1-canary",
+		Annotations: &map[string]string{sdk.CanarySpecAnnotation: hash},
+	}
+
+	spec, err := readCanarySpec(k, canary)
+	if err != nil || spec.EnvVars["mode"] != "test" {
+		t.Errorf("want the stored spec, got: %+v %v", spec, err)
+	}
+
+	canary.Annotations = &map[string]string{sdk.CanarySpecAnnotation: "another-hash"}
+	if _, err := readCanarySpec(k, canary); err == nil {
+		t.Errorf("want an error when the hash does not match")
+	}
+
+	if _, err := readCanarySpec(nil, canary); err == nil {
+		t.Errorf("want an error without Kubernetes")
+	}
+}
+
+func Test_getMetrics(t *testing.T) {
+	var gotQuery string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`{"success": 42, "failure": 3}`))
+	}))
+	defer gateway.Close()
+
+	metrics, err := getMetrics(http.DefaultClient, gateway.URL+"/", "alexellis-fn1-canary", "10m")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if metrics.Success != 42 || metrics.Failure != 3 {
+		t.Errorf("want 42/3, got: %d/%d", metrics.Success, metrics.Failure)
+	}
+
+	if gotQuery != "function=alexellis-fn1-canary&metrics_window=10m" {
+		t.Errorf("unexpected query: %s", gotQuery)
+	}
+}
@@ -0,0 +1,98 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+const actionWait = "wait"
+
+// Metrics as returned by the metrics function
+type Metrics struct {
+	Success int `json:"success"`
+	Failure int `json:"failure"`
+}
+
+// Policy decides when a canary is promoted or aborted
+type Policy struct {
+	// Window of metrics to consider i.e. 10m
+	Window string
+
+	// MinInvocations before a decision is made
+	MinInvocations int
+
+	// MaxFailureRatio above which the canary is aborted
+	MaxFailureRatio float64
+}
+
+// getPolicy reads canary_window, canary_min_invocations and
+// canary_max_failure_ratio from the environment.
+func getPolicy() Policy {
+	policy := Policy{
+		Window:          "10m",
+		MinInvocations:  20,
+		MaxFailureRatio: 0.05,
+	}
+
+	if val := os.Getenv("canary_window"); len(val) > 0 {
+		policy.Window = val
+	}
+
+	if val, err := strconv.Atoi(os.Getenv("canary_min_invocations")); err == nil && val > 0 {
+		policy.MinInvocations = val
+	}
+
+	if val, err := strconv.ParseFloat(os.Getenv("canary_max_failure_ratio"), 64); err == nil && val >= 0 {
+		policy.MaxFailureRatio = val
+	}
+
+	return policy
+}
+
+// decide returns promote, abort or wait along with the reason
+func decide(metrics Metrics, policy Policy) (string, string) {
+	total := metrics.Success + metrics.Failure
+	if total < policy.MinInvocations {
+		return actionWait, fmt.Sprintf("%d/%d invocations in %s", total, policy.MinInvocations, policy.Window)
+	}
+
+	ratio := float64(metrics.Failure) / float64(total)
+	if ratio > policy.MaxFailureRatio {
+		return actionAbort, fmt.Sprintf("failure ratio %.2f is above %.2f over %s", ratio, policy.MaxFailureRatio, policy.Window)
+	}
+
+	return actionPromote, fmt.Sprintf("failure ratio %.2f is within %.2f over %s", ratio, policy.MaxFailureRatio, policy.Window)
+}
+
+// getMetrics queries the metrics function for the invocations of a function
+func getMetrics(c *http.Client, gatewayURL, functionName, window string) (Metrics, error) {
+	metrics := Metrics{}
+
+	query := url.Values{}
+	query.Set("function", functionName)
+	query.Set("metrics_window", window)
+
+	req, _ := http.NewRequest(http.MethodGet, gatewayURL+"function/metrics?"+query.Encode(), nil)
+
+	res, err := c.Do(req)
+	if err != nil {
+		return metrics, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return metrics, fmt.Errorf("unexpected status code from metrics: %d, body: %s", res.StatusCode, string(body))
+	}
+
+	err = json.Unmarshal(body, &metrics)
+	return metrics, err
+}
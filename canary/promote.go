@@ -0,0 +1,123 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	faasSDK "github.com/openfaas/faas-cli/proxy"
+	"github.com/openfaas/faas-cli/stack"
+	"github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// readCanarySpec reads the spec stored by buildshiprun for the canary
+func readCanarySpec(k *sdk.KubeClient, canary types.FunctionStatus) (sdk.CanarySpec, error) {
+	if k == nil {
+		return sdk.CanarySpec{}, fmt.Errorf("promoting a canary needs Kubernetes to read its spec")
+	}
+
+	hash := ""
+	if canary.Annotations != nil {
+		hash = (*canary.Annotations)[sdk.CanarySpecAnnotation]
+	}
+
+	spec, err := sdk.ReadCanarySpec(k, canary.Name, canary.Namespace, hash)
+	if err != nil {
+		return spec, fmt.Errorf("unable to read the spec of %s: %s", canary.Name, err.Error())
+	}
+	return spec, nil
+}
+
+// buildPromoteSpec creates the spec to update the stable function
+// with the image of its canary and the configuration in its spec.
+func buildPromoteSpec(canary types.FunctionStatus, spec sdk.CanarySpec) *faasSDK.DeployFunctionSpec {
+	stableName := sdk.StableName(canary.Name)
+
+	annotations := map[string]string{}
+	if canary.Annotations != nil {
+		for k, v := range *canary.Annotations {
+			annotations[k] = v
+		}
+	}
+
+	delete(annotations, sdk.CanarySpecAnnotation)
+	delete(annotations, sdk.CanaryWeightAnnotation)
+
+	labels := map[string]string{}
+	if canary.Labels != nil {
+		for k, v := range *canary.Labels {
+			labels[k] = v
+		}
+	}
+
+	delete(labels, sdk.CanaryLabel)
+	labels["faas_function"] = stableName
+	labels["app"] = stableName
+
+	deploy := &faasSDK.DeployFunctionSpec{
+		FunctionName:           stableName,
+		Image:                  canary.Image,
+		Network:                "func_functions",
+		Namespace:              canary.Namespace,
+		Update:                 true,
+		EnvVars:                spec.EnvVars,
+		Secrets:                spec.Secrets,
+		Labels:                 labels,
+		Annotations:            annotations,
+		ReadOnlyRootFilesystem: spec.ReadOnlyRootFilesystem,
+		FunctionResourceRequest: faasSDK.FunctionResourceRequest{
+			Limits: &stack.FunctionResources{
+				Memory: spec.LimitsMemory,
+				CPU:    spec.LimitsCPU,
+			},
+			Requests: &stack.FunctionResources{
+				Memory: spec.RequestsMemory,
+				CPU:    spec.RequestsCPU,
+			},
+		},
+	}
+
+	return deploy
+}
+
+// promote updates the stable function to the canary's version and then
+// removes the canary.
+func promote(ctx context.Context, client *faasSDK.Client, k *sdk.KubeClient, canary types.FunctionStatus) error {
+	spec, err := readCanarySpec(k, canary)
+	if err != nil {
+		return err
+	}
+
+	deploy := buildPromoteSpec(canary, spec)
+
+	log.Printf("Promoting %s to %s with image %s", canary.Name, deploy.FunctionName, deploy.Image)
+
+	resStatus := client.DeployFunction(ctx, deploy)
+	if resStatus < 200 || resStatus > 299 {
+		return fmt.Errorf("deploying %s gave http status code %d", deploy.FunctionName, resStatus)
+	}
+
+	return removeCanary(ctx, client, k, canary)
+}
+
+// abort removes the canary leaving the stable function in place
+func abort(ctx context.Context, client *faasSDK.Client, k *sdk.KubeClient, canary types.FunctionStatus) error {
+	log.Printf("Aborting %s", canary.Name)
+
+	return removeCanary(ctx, client, k, canary)
+}
+
+// removeCanary deletes the canary and then its spec
+func removeCanary(ctx context.Context, client *faasSDK.Client, k *sdk.KubeClient, canary types.FunctionStatus) error {
+	if err := client.DeleteFunction(ctx, canary.Name, canary.Namespace); err != nil {
+		return err
+	}
+
+	if k != nil {
+		if err := sdk.DeleteCanarySpec(k, canary.Name, canary.Namespace); err != nil {
+			log.Printf("unable to remove the spec of %s: %s", canary.Name, err.Error())
+		}
+	}
+	return nil
+}
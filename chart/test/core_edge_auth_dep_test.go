@@ -95,6 +95,9 @@ func makeEdgeAuthDep(httpProbe, customersSecret, secureCookie bool) YamlSpec {
 						Ports: []ContainerPort{{
 							Port:     8080,
 							Protocol: "TCP",
+						}, {
+							Port:     8081,
+							Protocol: "TCP",
 						}},
 						Volumes: containerVolumes,
 					}},
@@ -140,6 +143,7 @@ func makeContainerEnv(customersSecret, secureCookie bool) []Environment {
 	var environ []Environment
 
 	environ = append(environ, Environment{Name: "port", Value: "8080"})
+	environ = append(environ, Environment{Name: "metrics_port", Value: "8081"})
 	environ = append(environ, Environment{Name: "oauth_client_secret_path", Value: "/var/secrets/of-client-secret/of-client-secret"})
 	environ = append(environ, Environment{Name: "public_key_path", Value: "/var/secrets/public/key.pub"})
 	environ = append(environ, Environment{Name: "private_key_path", Value: "/var/secrets/private/key"})
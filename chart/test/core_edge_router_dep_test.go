@@ -102,6 +102,9 @@ func makeEdgeRouterDep(httpProbe, oauthEnabled bool) YamlSpec {
 						Ports: []ContainerPort{{
 							Port:     8080,
 							Protocol: "TCP",
+						}, {
+							Port:     8081,
+							Protocol: "TCP",
 						}},
 					}},
 				},
@@ -114,7 +117,20 @@ func makeRouterContainerEnv(oauthEnabled bool) []Environment {
 	var environ []Environment
 	environ = append(environ, Environment{Name: "upstream_url", Value: "http://gateway.openfaas:8080"})
 	environ = append(environ, Environment{Name: "port", Value: "8080"})
+	environ = append(environ, Environment{Name: "metrics_port", Value: "8081"})
 	environ = append(environ, Environment{Name: "timeout", Value: "60s"})
+	environ = append(environ, Environment{Name: "function_cache_expiry", Value: "5s"})
+	environ = append(environ, Environment{Name: "user_namespaces", Value: "false"})
+	environ = append(environ, Environment{Name: "upgrade_idle_timeout", Value: "5m"})
+	environ = append(environ, Environment{Name: "max_upgrade_connections", Value: "100"})
+	environ = append(environ, Environment{Name: "custom_domains", Value: "false"})
+	environ = append(environ, Environment{Name: "domain_reload_interval", Value: "60s"})
+	environ = append(environ, Environment{Name: "tls", Value: "false"})
+	environ = append(environ, Environment{Name: "tls_redirect", Value: "false"})
+	environ = append(environ, Environment{Name: "rate_limits", Value: "false"})
+	environ = append(environ, Environment{Name: "auth_cache_ttl", Value: "5s"})
+	environ = append(environ, Environment{Name: "routing_mode", Value: "subdomain"})
+	environ = append(environ, Environment{Name: "function_policies", Value: "true"})
 
 	if oauthEnabled {
 		environ = append(environ, Environment{Name: "auth_url", Value: "http://edge-auth.openfaas:8080"})
@@ -183,6 +183,20 @@ class FunctionsApi {
     });
   }
 
+  fetchActivity({
+    user,
+    page = 1,
+    pageSize = 10,
+  }) {
+    const url = `${
+      this.apiBaseUrl
+    }/audit-event?user=${user}&page=${page}&page_size=${pageSize}`;
+
+    return axios.get(url).then(res => {
+      return res.data;
+    });
+  }
+
   fetchFunctionLog({
                   longFnName,
                   user
@@ -0,0 +1,68 @@
+import React, { Component } from 'react';
+import moment from 'moment';
+import { Badge, CardBody, ListGroup, ListGroupItem } from 'reactstrap';
+
+import { functionsApi } from '../../api/functionsApi';
+
+const severityColors = {
+  error: 'danger',
+  warning: 'warning',
+  info: 'secondary',
+};
+
+class ActivityFeed extends Component {
+  constructor(props) {
+    super(props);
+
+    this.state = {
+      isLoading: true,
+      events: [],
+    };
+  }
+
+  componentDidMount() {
+    const { user } = this.props;
+
+    functionsApi.fetchActivity({ user })
+      .then(data => {
+        const events = (data && data.events) || [];
+        this.setState({ isLoading: false, events });
+      })
+      .catch(() => {
+        // The feed is optional, audit-event may not have storage configured
+        this.setState({ isLoading: false, events: [] });
+      });
+  }
+
+  render() {
+    const { isLoading, events } = this.state;
+
+    if (isLoading || events.length === 0) {
+      return null;
+    }
+
+    return (
+      <CardBody>
+        <h5>Recent activity</h5>
+        <ListGroup flush>
+          { events.map(event => (
+            <ListGroupItem key={`${event.Timestamp}-${event.Source}`}>
+              <Badge color={severityColors[event.Severity] || 'secondary'} className="mr-2">
+                { event.Type || event.Source }
+              </Badge>
+              { event.Repo ? <span className="is-bold mr-2">{ event.Repo }</span> : null }
+              { event.Message }
+              <small className="text-muted float-right">
+                { moment(event.Timestamp).fromNow() }
+              </small>
+            </ListGroupItem>
+          ))}
+        </ListGroup>
+      </CardBody>
+    );
+  }
+}
+
+export {
+  ActivityFeed,
+}
@@ -1,6 +1,7 @@
 import React, { Component } from 'react';
 import { FunctionTable } from '../components/FunctionTable';
 import { FunctionEmptyState } from "../components/FunctionEmptyState";
+import { ActivityFeed } from '../components/ActivityFeed';
 import { functionsApi } from '../api/functionsApi';
 import {
   Card,
@@ -91,6 +92,8 @@ export class FunctionsOverviewPage extends Component {
         </CardHeader>
 
         { this.renderContentView() }
+
+        { this.state.authError ? null : <ActivityFeed user={user} /> }
       </Card>
     );
   }
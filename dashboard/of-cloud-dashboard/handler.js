@@ -8,10 +8,18 @@ var qs = require('qs');
 module.exports = async (event, context) => {
   const { method, path , query} = event;
 
-  if (method !== 'GET') {
+  // Canaries are promoted or aborted with a POST, which is not allowed
+  // for anything else
+  const isCanaryRequest = /^\/api\/canary\/?$/.test(path);
+  if (method !== (isCanaryRequest ? 'POST' : 'GET')) {
     return context.status(405).fail('Method not allowed');
   }
 
+  // The canary function evaluates every canary when given an empty body
+  if (isCanaryRequest && (!event.body || Object.keys(event.body).length === 0)) {
+    return context.status(400).fail('Bad request');
+  }
+
   if (/^\/logout\/?$/.test(path)) {
     return handleLogout(context);
   }
@@ -20,7 +28,7 @@ module.exports = async (event, context) => {
   let decodedCookie = decodeCookie(cookie);
   let organizations = parseOrganizations(decodedCookie);
 
-  if (/^\/api\/(list-functions|metrics|pipeline-log|function-logs).*/.test(path)) {
+  if (/^\/api\/(list-functions|metrics|pipeline-log|function-logs|deploy-history|audit-event).*/.test(path) || isCanaryRequest) {
 
     // See if a user is trying to query functions they do not have permissions to view
     if (!isResourceInTokenClaims(path, query, decodedCookie, organizations)) {
@@ -46,6 +54,9 @@ module.exports = async (event, context) => {
         method: method,
         headers: reqHeaders,
       };
+      if (isCanaryRequest) {
+        opts.data = event.body;
+      }
   
       let res = await axios(opts)
       let ctx = context;
@@ -0,0 +1,75 @@
+package function
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// FilesystemStore writes one JSON file per record under BasePath
+type FilesystemStore struct {
+	BasePath string
+}
+
+func newFilesystemStore(basePath string) (*FilesystemStore, error) {
+	if err := os.MkdirAll(basePath, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FilesystemStore{BasePath: basePath}, nil
+}
+
+// Append writes the record to disk and returns its path
+func (s *FilesystemStore) Append(record sdk.DeployRecord) (string, error) {
+	fullPath := filepath.Join(s.BasePath, filepath.FromSlash(getPath(&record)))
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return fullPath, err
+	}
+
+	bytesOut, err := json.Marshal(&record)
+	if err != nil {
+		return fullPath, err
+	}
+
+	return fullPath, ioutil.WriteFile(fullPath, bytesOut, 0600)
+}
+
+// List reads every record found under the query's prefix
+func (s *FilesystemStore) List(query Query) ([]sdk.DeployRecord, error) {
+	records := []sdk.DeployRecord{}
+	root := filepath.Join(s.BasePath, filepath.FromSlash(query.prefix()))
+
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return records, nil
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		record := sdk.DeployRecord{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+
+		records = append(records, record)
+		return nil
+	})
+
+	return records, err
+}
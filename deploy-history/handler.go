@@ -0,0 +1,206 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// RecordPage is a page of deploy records, newest first
+type RecordPage struct {
+	Records  []sdk.DeployRecord `json:"records"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"pageSize"`
+	Total    int                `json:"total"`
+}
+
+// Handle appends a deploy record to the history (POST) or
+// lists records for a user, repo or function (GET)
+func Handle(req []byte) string {
+	method := os.Getenv("Http_Method")
+
+	if method == http.MethodPost {
+		hmacErr := sdk.ValidHMAC(&req, "payload-secret", os.Getenv("Http_X_Cloud_Signature"))
+		if hmacErr != nil {
+			log.Printf("hmac error %s\n", hmacErr.Error())
+			os.Exit(1)
+		}
+	}
+
+	store, storeErr := newStore()
+	if storeErr != nil {
+		log.Printf("deploy-history store error %s\n", storeErr.Error())
+		os.Exit(1)
+	}
+
+	switch method {
+	case http.MethodPost:
+		record := sdk.DeployRecord{}
+		if err := json.Unmarshal(req, &record); err != nil {
+			log.Printf("unable to parse deploy record: %s", err.Error())
+			os.Exit(1)
+		}
+
+		if len(record.Owner) == 0 || len(record.Repo) == 0 || len(record.Function) == 0 {
+			log.Printf("deploy record requires an owner, repo and function")
+			os.Exit(1)
+		}
+
+		if !sdk.ValidName(record.Owner) || !sdk.ValidName(record.Repo) || !sdk.ValidName(record.Function) {
+			log.Printf("invalid owner, repo or function in deploy record: %q %q %q", record.Owner, record.Repo, record.Function)
+			os.Exit(1)
+		}
+
+		fullPath, err := store.Append(record)
+		if err != nil {
+			log.Printf("error writing: %s, error: %s", fullPath, err.Error())
+			os.Exit(1)
+		}
+
+		return fmt.Sprintf("Wrote deploy record to %s\n", fullPath)
+
+	case http.MethodGet:
+		query, parseErr := parseQuery(os.Getenv("Http_Query"))
+		if parseErr != nil {
+			return parseErr.Error()
+		}
+
+		records, err := store.List(query)
+		if err != nil {
+			log.Printf("error listing records for %s, error: %s", query.prefix(), err.Error())
+			os.Exit(1)
+		}
+
+		page := paginate(filterRecords(records, query), query.Page, query.PageSize)
+
+		bytesOut, _ := json.Marshal(page)
+		return string(bytesOut)
+	}
+
+	return fmt.Sprintf("deploy-history, unknown request")
+}
+
+// Query selects deploy records for a user and optionally a
+// repo or function
+type Query struct {
+	Owner    string
+	Repo     string
+	Function string
+	Page     int
+	PageSize int
+}
+
+// prefix gives the narrowest path which contains every
+// record matched by the query
+func (q Query) prefix() string {
+	prefix := strings.ToLower(q.Owner) + "/"
+	if len(q.Repo) > 0 {
+		prefix = prefix + q.Repo + "/"
+		if len(q.Function) > 0 {
+			prefix = prefix + q.Function + "/"
+		}
+	}
+	return prefix
+}
+
+func parseQuery(queryRaw string) (Query, error) {
+	vals, err := url.ParseQuery(queryRaw)
+	if err != nil {
+		return Query{}, err
+	}
+
+	q := Query{
+		Owner:    vals.Get("user"),
+		Repo:     vals.Get("repo"),
+		Function: vals.Get("function"),
+		Page:     1,
+		PageSize: defaultPageSize,
+	}
+
+	if len(q.Owner) == 0 {
+		return q, fmt.Errorf("user is required in the querystring i.e. ?user=alexellis")
+	}
+
+	// The query is turned into a path, so each part is checked before it
+	// can be used to read outside of the owner's records
+	for key, val := range map[string]string{"user": q.Owner, "repo": q.Repo, "function": q.Function} {
+		if len(val) > 0 && !sdk.ValidName(val) {
+			return q, fmt.Errorf("invalid %s: %q", key, val)
+		}
+	}
+
+	if val := vals.Get("page"); len(val) > 0 {
+		page, err := strconv.Atoi(val)
+		if err != nil || page < 1 {
+			return q, fmt.Errorf("page must be a positive integer, got: %q", val)
+		}
+		q.Page = page
+	}
+
+	if val := vals.Get("page_size"); len(val) > 0 {
+		pageSize, err := strconv.Atoi(val)
+		if err != nil || pageSize < 1 {
+			return q, fmt.Errorf("page_size must be a positive integer, got: %q", val)
+		}
+		if pageSize > maxPageSize {
+			pageSize = maxPageSize
+		}
+		q.PageSize = pageSize
+	}
+
+	return q, nil
+}
+
+func filterRecords(records []sdk.DeployRecord, q Query) []sdk.DeployRecord {
+	filtered := []sdk.DeployRecord{}
+	for _, record := range records {
+		if !strings.EqualFold(record.Owner, q.Owner) {
+			continue
+		}
+		if len(q.Repo) > 0 && record.Repo != q.Repo {
+			continue
+		}
+		if len(q.Function) > 0 && record.Function != q.Function {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+	return filtered
+}
+
+// paginate sorts records newest first and returns the requested page
+func paginate(records []sdk.DeployRecord, page, pageSize int) RecordPage {
+	sortNewestFirst(records)
+
+	result := RecordPage{
+		Records:  []sdk.DeployRecord{},
+		Page:     page,
+		PageSize: pageSize,
+		Total:    len(records),
+	}
+
+	start := (page - 1) * pageSize
+	if start >= len(records) {
+		return result
+	}
+
+	end := start + pageSize
+	if end > len(records) {
+		end = len(records)
+	}
+
+	result.Records = records[start:end]
+	return result
+}
@@ -0,0 +1,213 @@
+package function
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_getPath(t *testing.T) {
+	got := getPath(&sdk.DeployRecord{
+		Owner:     "AlexEllis",
+		Repo:      "super-cake",
+		Function:  "slack-fn",
+		SHA:       "af6db0a1e2c3",
+		Timestamp: time.Unix(1577836800, 0),
+	})
+	want := "alexellis/super-cake/slack-fn/1577836800000000000-af6db0a.json"
+	if got != want {
+		t.Errorf("got: %s, but want: %s", got, want)
+	}
+}
+
+func Test_parseQuery(t *testing.T) {
+	tests := []struct {
+		title        string
+		query        string
+		wantErr      bool
+		wantPage     int
+		wantPageSize int
+		wantPrefix   string
+	}{
+		{
+			title:        "user only uses defaults",
+			query:        "user=alexellis",
+			wantPage:     1,
+			wantPageSize: defaultPageSize,
+			wantPrefix:   "alexellis/",
+		},
+		{
+			title:        "repo and function narrow the prefix",
+			query:        "user=alexellis&repo=super-cake&function=fn1&page=2&page_size=5",
+			wantPage:     2,
+			wantPageSize: 5,
+			wantPrefix:   "alexellis/super-cake/fn1/",
+		},
+		{
+			title:        "function without repo searches all of the user's repos",
+			query:        "user=alexellis&function=fn1",
+			wantPage:     1,
+			wantPageSize: defaultPageSize,
+			wantPrefix:   "alexellis/",
+		},
+		{
+			title:        "page size is capped",
+			query:        "user=alexellis&page_size=1000",
+			wantPage:     1,
+			wantPageSize: maxPageSize,
+			wantPrefix:   "alexellis/",
+		},
+		{
+			title:   "missing user",
+			query:   "repo=super-cake",
+			wantErr: true,
+		},
+		{
+			title:   "invalid page",
+			query:   "user=alexellis&page=0",
+			wantErr: true,
+		},
+		{
+			title:   "repo outside of the user",
+			query:   "user=alexellis&repo=..%2F..%2Frgee0",
+			wantErr: true,
+		},
+		{
+			title:   "function outside of the repo",
+			query:   "user=alexellis&repo=super-cake&function=..",
+			wantErr: true,
+		},
+		{
+			title:   "user with a path",
+			query:   "user=..%2Fsecrets",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			q, err := parseQuery(test.query)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error, got: %s", err)
+			}
+			if q.Page != test.wantPage {
+				t.Errorf("page want: %d, got: %d", test.wantPage, q.Page)
+			}
+			if q.PageSize != test.wantPageSize {
+				t.Errorf("page_size want: %d, got: %d", test.wantPageSize, q.PageSize)
+			}
+			if q.prefix() != test.wantPrefix {
+				t.Errorf("prefix want: %s, got: %s", test.wantPrefix, q.prefix())
+			}
+		})
+	}
+}
+
+func Test_paginate(t *testing.T) {
+	now := time.Now()
+	records := []sdk.DeployRecord{
+		{SHA: "1", Timestamp: now.Add(-3 * time.Minute)},
+		{SHA: "2", Timestamp: now.Add(-1 * time.Minute)},
+		{SHA: "3", Timestamp: now.Add(-2 * time.Minute)},
+	}
+
+	page := paginate(records, 1, 2)
+	if page.Total != 3 {
+		t.Errorf("total want: 3, got: %d", page.Total)
+	}
+	if len(page.Records) != 2 {
+		t.Fatalf("records want: 2, got: %d", len(page.Records))
+	}
+	if page.Records[0].SHA != "2" || page.Records[1].SHA != "3" {
+		t.Errorf("want newest first, got: %s, %s", page.Records[0].SHA, page.Records[1].SHA)
+	}
+
+	page = paginate(records, 2, 2)
+	if len(page.Records) != 1 || page.Records[0].SHA != "1" {
+		t.Errorf("want last record on page 2, got: %v", page.Records)
+	}
+
+	page = paginate(records, 3, 2)
+	if len(page.Records) != 0 {
+		t.Errorf("want empty page, got: %d records", len(page.Records))
+	}
+}
+
+func Test_filterRecords(t *testing.T) {
+	records := []sdk.DeployRecord{
+		{Owner: "alexellis", Repo: "cake", Function: "fn1"},
+		{Owner: "alexellis", Repo: "cake", Function: "fn2"},
+		{Owner: "alexellis", Repo: "pie", Function: "fn1"},
+		{Owner: "rgee0", Repo: "cake", Function: "fn1"},
+	}
+
+	got := filterRecords(records, Query{Owner: "AlexEllis", Function: "fn1"})
+	if len(got) != 2 {
+		t.Errorf("want 2 records, got: %d", len(got))
+	}
+
+	got = filterRecords(records, Query{Owner: "alexellis", Repo: "cake"})
+	if len(got) != 2 {
+		t.Errorf("want 2 records, got: %d", len(got))
+	}
+}
+
+func Test_FilesystemStore_AppendAndList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploy-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := newFilesystemStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fn := range []string{"fn1", "fn2"} {
+		_, err := store.Append(sdk.DeployRecord{
+			Owner:     "alexellis",
+			Repo:      "cake",
+			Function:  fn,
+			SHA:       "a3ef55c",
+			Result:    sdk.StatusSuccess,
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := store.List(Query{Owner: "alexellis", Repo: "cake", Function: "fn2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Function != "fn2" {
+		t.Errorf("want a single record for fn2, got: %v", records)
+	}
+
+	records, err = store.List(Query{Owner: "alexellis"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("want 2 records, got: %d", len(records))
+	}
+
+	records, err = store.List(Query{Owner: "nobody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("want 0 records, got: %d", len(records))
+	}
+}
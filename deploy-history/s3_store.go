@@ -0,0 +1,128 @@
+package function
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+
+	minio "github.com/minio/minio-go"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const objectPrefix = "deploys/"
+
+// S3Store writes one JSON object per record to an S3 or Minio bucket
+type S3Store struct {
+	Client *minio.Client
+	Bucket string
+	Region string
+}
+
+func newS3Store() (*S3Store, error) {
+	region := regionName()
+
+	minioClient, connectErr := connectToMinio(region)
+	if connectErr != nil {
+		return nil, connectErr
+	}
+
+	return &S3Store{
+		Client: minioClient,
+		Bucket: bucketName(),
+		Region: region,
+	}, nil
+}
+
+// Append writes the record to the bucket and returns its object name
+func (s *S3Store) Append(record sdk.DeployRecord) (string, error) {
+	fullPath := objectPrefix + getPath(&record)
+
+	bytesOut, err := json.Marshal(&record)
+	if err != nil {
+		return fullPath, err
+	}
+
+	s.Client.MakeBucket(s.Bucket, s.Region)
+
+	reader := bytes.NewReader(bytesOut)
+	_, err = s.Client.PutObject(s.Bucket,
+		fullPath,
+		reader,
+		int64(reader.Len()),
+		minio.PutObjectOptions{ContentType: "application/json"})
+
+	return fullPath, err
+}
+
+// List reads every object found under the query's prefix
+func (s *S3Store) List(query Query) ([]sdk.DeployRecord, error) {
+	records := []sdk.DeployRecord{}
+
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	for info := range s.Client.ListObjects(s.Bucket, objectPrefix+query.prefix(), true, doneCh) {
+		if info.Err != nil {
+			return records, info.Err
+		}
+
+		obj, err := s.Client.GetObject(s.Bucket, info.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return records, err
+		}
+
+		data, err := ioutil.ReadAll(obj)
+		obj.Close()
+		if err != nil {
+			return records, err
+		}
+
+		record := sdk.DeployRecord{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			log.Printf("skipping unreadable record %s, error: %s", info.Key, err.Error())
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func connectToMinio(region string) (*minio.Client, error) {
+
+	endpoint := os.Getenv("s3_url")
+
+	tlsEnabled := tlsEnabled()
+
+	secretKey, _ := sdk.ReadSecret("s3-secret-key")
+	accessKey, _ := sdk.ReadSecret("s3-access-key")
+
+	return minio.New(endpoint, accessKey, secretKey, tlsEnabled)
+}
+
+func tlsEnabled() bool {
+	if connection := os.Getenv("s3_tls"); connection == "true" || connection == "1" {
+		return true
+	}
+	return false
+}
+
+func bucketName() string {
+	bucketName, exist := os.LookupEnv("s3_bucket")
+	if exist == false || len(bucketName) == 0 {
+		bucketName = "pipeline"
+		log.Printf("Bucket name not found, set to default: %v\n", bucketName)
+	}
+	return bucketName
+}
+
+func regionName() string {
+	regionName, exist := os.LookupEnv("s3_region")
+	if exist == false || len(regionName) == 0 {
+		regionName = "us-east-1"
+	}
+	return regionName
+}
@@ -0,0 +1,65 @@
+package function
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const (
+	// S3Storage keeps records in an S3 or Minio bucket
+	S3Storage = "s3"
+	// FilesystemStorage keeps records in a local or mounted directory
+	FilesystemStorage = "filesystem"
+)
+
+// Store persists deploy records and lists them back by prefix
+type Store interface {
+	Append(record sdk.DeployRecord) (string, error)
+	List(query Query) ([]sdk.DeployRecord, error)
+}
+
+// newStore picks a backend from the storage env-var, S3 is the
+// default to match pipeline-log
+func newStore() (Store, error) {
+	storage := os.Getenv("storage")
+	if len(storage) == 0 {
+		storage = S3Storage
+	}
+
+	switch storage {
+	case S3Storage:
+		return newS3Store()
+	case FilesystemStorage:
+		return newFilesystemStore(storagePath())
+	}
+
+	return nil, fmt.Errorf("unsupported storage: %q, use %q or %q", storage, S3Storage, FilesystemStorage)
+}
+
+// getPath produces a string such as alexellis/super-pancake/fn1/1577836800000000000-a3ef55c.json
+func getPath(record *sdk.DeployRecord) string {
+	return fmt.Sprintf("%s/%s/%s/%d-%s.json",
+		strings.ToLower(record.Owner),
+		record.Repo,
+		record.Function,
+		record.Timestamp.UnixNano(),
+		sdk.FormatShortSHA(record.SHA))
+}
+
+func sortNewestFirst(records []sdk.DeployRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.After(records[j].Timestamp)
+	})
+}
+
+func storagePath() string {
+	val, exists := os.LookupEnv("storage_path")
+	if exists == false || len(val) == 0 {
+		val = "/tmp/deploy-history"
+	}
+	return val
+}
@@ -0,0 +1,9 @@
+module github.com/openfaas/openfaas-cloud/deploy-webhook
+
+go 1.13
+
+require (
+	github.com/alexellis/hmac v0.0.0-20180624211220-5c52ab81c0de
+	github.com/openfaas/faas-provider v0.0.0-20191011092439-98c25c3919da // indirect
+	github.com/openfaas/openfaas-cloud v0.0.0-20200303103051-6c3e056a6ac4
+)
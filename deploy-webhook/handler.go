@@ -0,0 +1,43 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// Handle delivers a deploy record from buildshiprun to the owner's webhook,
+// then appends the record with the delivery to deploy-history. It is
+// invoked asynchronously so that a slow webhook does not hold up a build.
+func Handle(req []byte) string {
+	hmacErr := sdk.ValidHMAC(&req, "payload-secret", os.Getenv("Http_X_Cloud_Signature"))
+	if hmacErr != nil {
+		log.Printf("hmac error %s\n", hmacErr.Error())
+		os.Exit(1)
+	}
+
+	payloadSecret, keyErr := sdk.ReadSecret("payload-secret")
+	if keyErr != nil {
+		log.Printf("failed to load hmac key, error %s\n", keyErr.Error())
+		os.Exit(1)
+	}
+
+	record := sdk.DeployRecord{}
+	if err := json.Unmarshal(req, &record); err != nil {
+		log.Printf("unable to parse deploy record: %s", err.Error())
+		os.Exit(1)
+	}
+
+	record.Webhook = notifyWebhook(record)
+
+	status, err := sdk.PostDeployRecord(record, os.Getenv("gateway_url")+"function/deploy-history", payloadSecret)
+	if err != nil {
+		log.Printf("deploy-history: error: %s", err.Error())
+		os.Exit(1)
+	}
+
+	return fmt.Sprintf("deploy-history status: %d, webhook delivered: %t\n", status, record.Webhook != nil && record.Webhook.Delivered)
+}
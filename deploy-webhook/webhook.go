@@ -0,0 +1,318 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alexellis/hmac"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const (
+	webhookEventHeader    = "X-Cloud-Event"
+	webhookDeliveryHeader = "X-Cloud-Delivery"
+
+	// webhookSecretSuffix names the secret an owner can create with
+	// their webhook i.e. alexellis-deploy-webhook
+	webhookSecretSuffix = "-deploy-webhook"
+)
+
+// Webhook is an owner's endpoint for deploy events, the payload is
+// signed with Secret in the X-Cloud-Signature header
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+
+	// operator is true for a webhook from webhooks_path, which may be on
+	// an internal network unlike one configured by a user
+	operator bool
+}
+
+// WebhookPolicy controls how a deploy event is delivered
+type WebhookPolicy struct {
+	// Attempts is the number of tries before giving up
+	Attempts int
+
+	// Backoff is the wait before the first retry, doubled each time
+	Backoff time.Duration
+
+	// Timeout for each attempt
+	Timeout time.Duration
+}
+
+// getWebhookPolicy reads webhook_attempts, webhook_backoff and
+// webhook_timeout from the environment.
+func getWebhookPolicy() WebhookPolicy {
+	attempts, _ := strconv.Atoi(os.Getenv("webhook_attempts"))
+	if attempts < 1 {
+		attempts = 3
+	}
+
+	return WebhookPolicy{
+		Attempts: attempts,
+		Backoff:  parseDurationConfig("webhook_backoff", time.Second),
+		Timeout:  parseDurationConfig("webhook_timeout", time.Second*5),
+	}
+}
+
+// getWebhook finds the owner's webhook in the file at webhooks_path, then in
+// their sealed secret when webhook_secrets is enabled. No webhook is not an error.
+func getWebhook(owner string) (*Webhook, error) {
+	if webhooksPath := os.Getenv("webhooks_path"); len(webhooksPath) > 0 {
+		data, err := ioutil.ReadFile(webhooksPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read webhooks from %s: %s", webhooksPath, err.Error())
+		}
+
+		webhooks := map[string]Webhook{}
+		if err := json.Unmarshal(data, &webhooks); err != nil {
+			return nil, fmt.Errorf("unable to parse webhooks from %s: %s", webhooksPath, err.Error())
+		}
+
+		for name, webhook := range webhooks {
+			if strings.EqualFold(name, owner) {
+				webhook.operator = true
+				return &webhook, nil
+			}
+		}
+	}
+
+	if os.Getenv("webhook_secrets") != "true" {
+		return nil, nil
+	}
+
+	// The service account can only read secrets in the namespaces of
+	// owners, openfaas-fn also holds the secrets of OpenFaaS Cloud
+	if !sdk.UserNamespaces() {
+		return nil, fmt.Errorf("webhook_secrets needs user_namespaces")
+	}
+
+	k, err := sdk.NewInClusterClient(time.Second * 3)
+	if err != nil {
+		return nil, err
+	}
+
+	return getWebhookSecret(k, sdk.FunctionNamespace(owner), owner)
+}
+
+// getWebhookSecret reads the url and secret keys of the owner's secret
+func getWebhookSecret(k *sdk.KubeClient, namespace, owner string) (*Webhook, error) {
+	name := strings.ToLower(owner) + webhookSecretSuffix
+
+	secret := struct {
+		Data map[string][]byte `json:"data"`
+	}{}
+
+	found, err := k.Get(fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", namespace, name), &secret)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	webhook := &Webhook{
+		URL:    strings.TrimSpace(string(secret.Data["url"])),
+		Secret: strings.TrimSpace(string(secret.Data["secret"])),
+	}
+
+	if len(webhook.URL) == 0 {
+		return nil, fmt.Errorf("secret %s has no url", name)
+	}
+
+	return webhook, nil
+}
+
+// notifyWebhook delivers a deploy record to the owner's webhook and
+// returns the delivery, or nil when the owner has no webhook
+func notifyWebhook(record sdk.DeployRecord) *sdk.WebhookDelivery {
+	webhook, err := getWebhook(record.Owner)
+	if err != nil {
+		log.Printf("webhook: error: %s", err.Error())
+		return nil
+	}
+
+	if webhook == nil {
+		return nil
+	}
+
+	policy := getWebhookPolicy()
+
+	c := &http.Client{Timeout: policy.Timeout}
+	if !webhook.operator {
+		c = newWebhookClient(policy.Timeout)
+	}
+	delivery := deliverWebhook(c, *webhook, record, policy)
+
+	log.Printf("webhook: delivery %s to %s, delivered: %t, attempts: %d", delivery.ID, delivery.URL, delivery.Delivered, delivery.Attempts)
+
+	return &delivery
+}
+
+// deliverWebhook posts the signed record, retrying with a backoff after an
+// error, a 5xx or a 429 response
+func deliverWebhook(c *http.Client, webhook Webhook, record sdk.DeployRecord, policy WebhookPolicy) sdk.WebhookDelivery {
+	delivery := sdk.WebhookDelivery{
+		ID:  newDeliveryID(),
+		URL: redactURL(webhook.URL),
+	}
+
+	if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		delivery.Error = "webhook url must be http or https"
+		return delivery
+	}
+
+	bytesOut, _ := json.Marshal(&record)
+	digest := hmac.Sign(bytesOut, []byte(webhook.Secret))
+
+	backoff := policy.Backoff
+	for delivery.Attempts < policy.Attempts {
+		if delivery.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff = backoff * 2
+		}
+		delivery.Attempts++
+
+		req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(bytesOut))
+		if err != nil {
+			delivery.Error = err.Error()
+			return delivery
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(webhookEventHeader, "deploy")
+		req.Header.Set(webhookDeliveryHeader, delivery.ID)
+		req.Header.Set(sdk.CloudSignatureHeader, "sha1="+hex.EncodeToString(digest))
+
+		res, err := c.Do(req)
+		if err != nil {
+			delivery.Error = err.Error()
+			continue
+		}
+
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		delivery.StatusCode = res.StatusCode
+		if res.StatusCode >= 200 && res.StatusCode < 300 {
+			delivery.Error = ""
+			delivery.Delivered = true
+			return delivery
+		}
+
+		delivery.Error = fmt.Sprintf("unexpected status code: %d", res.StatusCode)
+		if res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			return delivery
+		}
+	}
+
+	return delivery
+}
+
+// internalNetworks cannot be reached by a webhook, so that a user cannot
+// use one to call the gateway, the Kubernetes API or cloud metadata
+var internalNetworks = parseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func internalIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// refuseInternal is checked for the address of every connection, after
+// the name is resolved and for each redirect
+func refuseInternal(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+// newWebhookClient can only connect to public addresses
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: refuseInternal,
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
+
+func newDeliveryID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// redactURL removes credentials and the query-string which may hold a token
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+func parseDurationConfig(key string, fallback time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if len(val) == 0 {
+		return fallback
+	}
+
+	if seconds, err := strconv.Atoi(val); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	duration, err := time.ParseDuration(val)
+	if err != nil {
+		log.Printf("unable to parse %s=%q as a duration, using %s", key, val, fallback)
+		return fallback
+	}
+	return duration
+}
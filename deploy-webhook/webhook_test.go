@@ -0,0 +1,191 @@
+package function
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/alexellis/hmac"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_deliverWebhook_SignsAndRetries(t *testing.T) {
+	calls := 0
+	var body []byte
+	var header http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	record := sdk.DeployRecord{Owner: "alexellis", Repo: "repo1", Function: "fn1", Result: sdk.StatusSuccess}
+	webhook := Webhook{URL: server.URL + "/hook?token=abc", Secret: "secret"}
+
+	delivery := deliverWebhook(http.DefaultClient, webhook, record, WebhookPolicy{Attempts: 3, Backoff: time.Millisecond})
+
+	if !delivery.Delivered || delivery.Attempts != 2 || delivery.StatusCode != http.StatusAccepted {
+		t.Fatalf("want delivery on the second attempt, got: %+v", delivery)
+	}
+
+	if delivery.URL != server.URL+"/hook" {
+		t.Errorf("want query-string removed from the logged URL, got: %s", delivery.URL)
+	}
+
+	got := sdk.DeployRecord{}
+	if err := json.Unmarshal(body, &got); err != nil || got.Function != "fn1" {
+		t.Errorf("want the deploy record as the body, got: %s", string(body))
+	}
+
+	digest := hmac.Sign(body, []byte("secret"))
+	if header.Get(sdk.CloudSignatureHeader) != "sha1="+hex.EncodeToString(digest) {
+		t.Errorf("want a signed body, got: %s", header.Get(sdk.CloudSignatureHeader))
+	}
+
+	if header.Get(webhookDeliveryHeader) != delivery.ID || header.Get(webhookEventHeader) != "deploy" {
+		t.Errorf("want delivery headers, got: %v", header)
+	}
+}
+
+func Test_deliverWebhook_NoRetryOnClientError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	delivery := deliverWebhook(http.DefaultClient, Webhook{URL: server.URL}, sdk.DeployRecord{}, WebhookPolicy{Attempts: 3, Backoff: time.Millisecond})
+
+	if delivery.Delivered || calls != 1 || len(delivery.Error) == 0 {
+		t.Errorf("want a single failed attempt, got %d calls and: %+v", calls, delivery)
+	}
+}
+
+func Test_deliverWebhook_GivesUpAfterAttempts(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	delivery := deliverWebhook(http.DefaultClient, Webhook{URL: server.URL}, sdk.DeployRecord{}, WebhookPolicy{Attempts: 3, Backoff: time.Millisecond})
+
+	if delivery.Delivered || calls != 3 || delivery.Attempts != 3 {
+		t.Errorf("want 3 attempts, got %d calls and: %+v", calls, delivery)
+	}
+}
+
+func Test_getWebhook_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	webhooksPath := path.Join(dir, "webhooks.json")
+	ioutil.WriteFile(webhooksPath, []byte(`{"AlexEllis": {"url": "https://example.com/hook", "secret": "s3cr3t"}}`), 0600)
+
+	os.Setenv("webhooks_path", webhooksPath)
+	defer os.Setenv("webhooks_path", "")
+
+	webhook, err := getWebhook("alexellis")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if webhook == nil || webhook.URL != "https://example.com/hook" || !webhook.operator {
+		t.Fatalf("want the owner's webhook from the operator, got: %+v", webhook)
+	}
+
+	webhook, err = getWebhook("rgee0")
+	if err != nil || webhook != nil {
+		t.Errorf("want no webhook for another owner, got: %+v, %v", webhook, err)
+	}
+}
+
+func Test_getWebhookSecret(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/openfaas-fn-alexellis/secrets/alexellis-deploy-webhook" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// base64 of https://example.com/hook and s3cr3t
+		w.Write([]byte(`{"data": {"url": "aHR0cHM6Ly9leGFtcGxlLmNvbS9ob29r", "secret": "czNjcjN0"}}`))
+	}))
+	defer api.Close()
+
+	k := &sdk.KubeClient{BaseURL: api.URL, Client: http.DefaultClient}
+
+	webhook, err := getWebhookSecret(k, "openfaas-fn-alexellis", "AlexEllis")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if webhook == nil || webhook.URL != "https://example.com/hook" || webhook.Secret != "s3cr3t" || webhook.operator {
+		t.Fatalf("want webhook from secret, got: %+v", webhook)
+	}
+
+	webhook, err = getWebhookSecret(k, "openfaas-fn-alexellis", "rgee0")
+	if err != nil || webhook != nil {
+		t.Errorf("want no webhook without a secret, got: %+v, %v", webhook, err)
+	}
+}
+
+func Test_newWebhookClient_RefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	delivery := deliverWebhook(newWebhookClient(time.Second), Webhook{URL: server.URL}, sdk.DeployRecord{}, WebhookPolicy{Attempts: 1})
+	if delivery.Delivered || len(delivery.Error) == 0 {
+		t.Errorf("want a webhook on the loopback address refused, got: %+v", delivery)
+	}
+}
+
+func Test_internalIP(t *testing.T) {
+	tests := []struct {
+		IP   string
+		Want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.62.0.1", true},
+		{"172.20.1.1", true},
+		{"192.168.1.10", true},
+		{"169.254.169.254", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+	}
+
+	for _, test := range tests {
+		if got := internalIP(net.ParseIP(test.IP)); got != test.Want {
+			t.Errorf("%s: want %t, got %t", test.IP, test.Want, got)
+		}
+	}
+}
+
+func Test_deliverWebhook_RefusesOtherSchemes(t *testing.T) {
+	delivery := deliverWebhook(http.DefaultClient, Webhook{URL: "file:///etc/passwd"}, sdk.DeployRecord{}, WebhookPolicy{Attempts: 3})
+
+	if delivery.Attempts != 0 || len(delivery.Error) == 0 {
+		t.Errorf("want no attempt for a file url, got: %+v", delivery)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -77,6 +78,16 @@ func combineURL(a, b string) string {
 	return a + b
 }
 
+// forwardedPrefix is the path edge-auth is served at when the edge-router
+// routes by path i.e. /system/auth, it is empty on the auth sub-domain
+func forwardedPrefix(r *http.Request) string {
+	prefix := strings.TrimSuffix(r.Header.Get("X-Forwarded-Prefix"), "/")
+	if !strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "//") {
+		return ""
+	}
+	return prefix
+}
+
 func (c *OpenFaaSCloudClaims) GetOrganizations() []string {
 	return strings.Split(c.Organizations, ",")
 }
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 )
@@ -93,3 +95,25 @@ func Test_GetOrganizations(t *testing.T) {
 		})
 	}
 }
+
+func Test_forwardedPrefix(t *testing.T) {
+	tests := []struct {
+		Header string
+		Want   string
+	}{
+		{"/system/auth", "/system/auth"},
+		{"/system/auth/", "/system/auth"},
+		{"", ""},
+		{"//evil.com", ""},
+		{"https://evil.com", ""},
+	}
+
+	for _, testCase := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Forwarded-Prefix", testCase.Header)
+
+		if got := forwardedPrefix(r); got != testCase.Want {
+			t.Errorf("%q: want %q, got %q", testCase.Header, testCase.Want, got)
+		}
+	}
+}
@@ -17,4 +17,7 @@ type Config struct {
 	PublicKeyPath          string
 	PrivateKeyPath         string
 	Debug                  bool // Debug enables verbose logging of claims / cookies
+
+	// Metrics counts the decisions of the query handler when set
+	Metrics *Metrics
 }
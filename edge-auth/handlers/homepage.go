@@ -32,7 +32,8 @@ func MakeHomepageHandler(config *Config) func(http.ResponseWriter, *http.Request
 		cookie, err := r.Cookie(cookieName)
 		if err != nil {
 			log.Println("No cookie found.")
-			http.Redirect(w, r, "/login/?r="+r.URL.Path, http.StatusTemporaryRedirect)
+			prefix := forwardedPrefix(r)
+			http.Redirect(w, r, prefix+"/login/?r="+prefix+r.URL.Path, http.StatusTemporaryRedirect)
 			return
 		}
 
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"crypto"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// UserHeader, OrganizationsHeader and IdentityHeader are returned with
+	// the decision for a private function, the edge-router forwards them
+	// to the function and removes any sent by the client
+	UserHeader          = "X-Cloud-User"
+	OrganizationsHeader = "X-Cloud-Organizations"
+	IdentityHeader      = "X-Cloud-Identity"
+
+	// identityExpiry is how long the token in IdentityHeader is valid for
+	identityExpiry = time.Minute * 5
+)
+
+// IdentityClaims are signed into IdentityHeader so that a function can
+// verify who called it with the public key of edge-auth. The audience is
+// the name of the function, so a token cannot be replayed to another.
+type IdentityClaims struct {
+	Name          string `json:"name,omitempty"`
+	Organizations string `json:"organizations"`
+
+	jwt.StandardClaims
+}
+
+// allowedPrivate is true when the session belongs to the owner of a
+// private function, to one of its organizations, or to a user or
+// organization in the allow list
+func allowedPrivate(claims *OpenFaaSCloudClaims, owner string, allow []string) bool {
+	identities := append([]string{claims.Subject}, claims.GetOrganizations()...)
+
+	for _, identity := range identities {
+		if len(identity) == 0 {
+			continue
+		}
+
+		if strings.EqualFold(identity, owner) {
+			return true
+		}
+		for _, allowed := range allow {
+			if strings.EqualFold(identity, strings.TrimSpace(allowed)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// resourceFunction gives the name of the function in a resource such as
+// /function/alexellis-blog.openfaas-fn-alexellis/posts
+func resourceFunction(resource string) string {
+	name := strings.TrimPrefix(resource, "/function/")
+	if i := strings.IndexAny(name, "/?"); i > -1 {
+		name = name[:i]
+	}
+	if i := strings.Index(name, "."); i > -1 {
+		name = name[:i]
+	}
+	return name
+}
+
+// setIdentityHeaders adds the identity of the session to a decision, the
+// token is only signed when a private key is given
+func setIdentityHeaders(header http.Header, claims *OpenFaaSCloudClaims, functionName string, privateKey crypto.PrivateKey, provider string) error {
+	header.Set(UserHeader, claims.Subject)
+	header.Set(OrganizationsHeader, claims.Organizations)
+
+	if privateKey == nil {
+		return nil
+	}
+
+	now := time.Now()
+	identity := IdentityClaims{
+		Name:          claims.Name,
+		Organizations: claims.Organizations,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    fmt.Sprintf("openfaas-cloud@%s", provider),
+			Subject:   claims.Subject,
+			Audience:  functionName,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(identityExpiry).Unix(),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, identity).SignedString(privateKey)
+	if err != nil {
+		return err
+	}
+
+	header.Set(IdentityHeader, token)
+	return nil
+}
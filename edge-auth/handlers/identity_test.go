@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func Test_allowedPrivate(t *testing.T) {
+	tests := []struct {
+		Scenario string
+		Claims   OpenFaaSCloudClaims
+		Allow    []string
+		Want     bool
+	}{
+		{"owner", OpenFaaSCloudClaims{StandardClaims: jwt.StandardClaims{Subject: "AlexEllis"}}, nil, true},
+		{"allowed user", OpenFaaSCloudClaims{StandardClaims: jwt.StandardClaims{Subject: "rgee0"}}, []string{"martindekov", " rgee0"}, true},
+		{"member of an allowed organization", OpenFaaSCloudClaims{Organizations: "acme", StandardClaims: jwt.StandardClaims{Subject: "rgee0"}}, []string{"acme"}, true},
+		{"other user", OpenFaaSCloudClaims{Organizations: "acme", StandardClaims: jwt.StandardClaims{Subject: "rgee0"}}, []string{""}, false},
+	}
+
+	for _, test := range tests {
+		if got := allowedPrivate(&test.Claims, "alexellis", test.Allow); got != test.Want {
+			t.Errorf("%s: want %t, got %t", test.Scenario, test.Want, got)
+		}
+	}
+}
+
+func Test_allowedPrivate_OrganizationOwner(t *testing.T) {
+	claims := &OpenFaaSCloudClaims{Organizations: "openfaas", StandardClaims: jwt.StandardClaims{Subject: "rgee0"}}
+
+	if !allowedPrivate(claims, "openfaas", nil) {
+		t.Errorf("want members allowed to the functions of their organization")
+	}
+}
+
+func Test_resourceFunction(t *testing.T) {
+	tests := []struct {
+		Resource string
+		Want     string
+	}{
+		{"/function/alexellis-blog", "alexellis-blog"},
+		{"/function/alexellis-blog/posts?page=1", "alexellis-blog"},
+		{"/function/alexellis-blog?page=1", "alexellis-blog"},
+		{"/function/alexellis-blog.openfaas-fn-alexellis/posts", "alexellis-blog"},
+		{"/function/alexellis-blog.openfaas-fn-alexellis?page=1", "alexellis-blog"},
+	}
+
+	for _, test := range tests {
+		if got := resourceFunction(test.Resource); got != test.Want {
+			t.Errorf("%s: want %s, got %s", test.Resource, test.Want, got)
+		}
+	}
+}
+
+func writeKeyPair(t *testing.T, dir string) (*ecdsa.PrivateKey, string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	publicKey, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	publicKeyPath := path.Join(dir, "key.pub")
+	if err := ioutil.WriteFile(publicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, _ := x509.MarshalECPrivateKey(key)
+	privateKeyPath := path.Join(dir, "key")
+	if err := ioutil.WriteFile(privateKeyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return key, publicKeyPath, privateKeyPath
+}
+
+func Test_MakeQueryHandler_Private(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edge-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, publicKeyPath, privateKeyPath := writeKeyPair(t, dir)
+
+	customersPath := path.Join(dir, "customers")
+	ioutil.WriteFile(customersPath, []byte("alexellis\n"), 0600)
+	os.Setenv("customers_path", customersPath)
+	defer os.Unsetenv("customers_path")
+
+	config := &Config{
+		OAuthProvider:          githubName,
+		ExternalRedirectDomain: "https://auth.system.example.com",
+		PublicKeyPath:          publicKeyPath,
+		PrivateKeyPath:         privateKeyPath,
+	}
+
+	handler := MakeQueryHandler(config, []string{"/function/system-dashboard"}, []string{"/function/git-tar"})
+
+	session := func(subject, organizations string) string {
+		claims := OpenFaaSCloudClaims{
+			Organizations: organizations,
+			AccessToken:   "secret",
+			StandardClaims: jwt.StandardClaims{
+				Subject:   subject,
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+		}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+		return token
+	}
+
+	private := "r=/function/alexellis-blog/posts&private=true&owner=alexellis&allow=acme"
+
+	tests := []struct {
+		Scenario string
+		Query    string
+		Session  string
+		Want     int
+		WantUser string
+	}{
+		{"public function", "r=/function/alexellis-blog", "", http.StatusOK, ""},
+		{"private function asks for a login", private, "", http.StatusTemporaryRedirect, ""},
+		{"private function for the owner", private, session("alexellis", ""), http.StatusOK, "alexellis"},
+		{"private function for an allowed organization", private, session("rgee0", "acme"), http.StatusOK, "rgee0"},
+		{"private function for another user", private, session("rgee0", "openfaas"), http.StatusUnauthorized, ""},
+		{"private function with an invalid session", private, "not-a-token", http.StatusUnauthorized, ""},
+		{"private function via custom domain", private + "&domain=www.example.com", session("alexellis", ""), http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Scenario, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/q/?"+test.Query, nil)
+			if len(test.Session) > 0 {
+				req.AddCookie(&http.Cookie{Name: cookieName, Value: test.Session})
+			}
+			rr := httptest.NewRecorder()
+
+			handler(rr, req)
+
+			if rr.Code != test.Want {
+				t.Errorf("status want: %d, got: %d", test.Want, rr.Code)
+			}
+			if got := rr.Header().Get(UserHeader); got != test.WantUser {
+				t.Errorf("%s want: %q, got: %q", UserHeader, test.WantUser, got)
+			}
+			if len(test.WantUser) == 0 {
+				return
+			}
+
+			claims := IdentityClaims{}
+			_, err := jwt.ParseWithClaims(rr.Header().Get(IdentityHeader), &claims, func(token *jwt.Token) (interface{}, error) {
+				return &key.PublicKey, nil
+			})
+			if err != nil {
+				t.Fatalf("want identity signed by edge-auth, got: %s", err)
+			}
+			if claims.Subject != test.WantUser || claims.Audience != "alexellis-blog" {
+				t.Errorf("identity want: %s for alexellis-blog, got: %s for %s", test.WantUser, claims.Subject, claims.Audience)
+			}
+		})
+	}
+}
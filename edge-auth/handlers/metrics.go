@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// durationBuckets are the upper bounds in seconds of the buckets
+// of a histogram of request durations
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics are served for Prometheus on the metrics port
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	Requests  *prometheus.CounterVec
+	Duration  *prometheus.HistogramVec
+	InFlight  prometheus.Gauge
+	Decisions *prometheus.CounterVec
+}
+
+// NewMetrics registers the metrics of edge-auth
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "edge_auth_requests_total",
+			Help: "Requests served by handler and status code.",
+		}, []string{"handler", "code"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "edge_auth_request_duration_seconds",
+			Help:    "Time to serve requests by handler and status code.",
+			Buckets: durationBuckets,
+		}, []string{"handler", "code"}),
+		InFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "edge_auth_requests_in_flight",
+			Help: "Requests being served.",
+		}),
+		Decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "edge_auth_decisions_total",
+			Help: "Decisions for resources by outcome: ok, redirect, unauthorized or bad_request.",
+		}, []string{"outcome"}),
+	}
+
+	m.Registry.MustRegister(m.Requests, m.Duration, m.InFlight, m.Decisions)
+
+	return m
+}
+
+// Handler serves the metrics for Prometheus to scrape
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// decisionOutcome names the decision of the query handler for a status code
+func decisionOutcome(status int) string {
+	switch status {
+	case http.StatusOK:
+		return "ok"
+	case http.StatusTemporaryRedirect:
+		return "redirect"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusBadRequest:
+		return "bad_request"
+	}
+	return strconv.Itoa(status)
+}
+
+// countDecision is safe to call when metrics are turned off
+func (m *Metrics) countDecision(status int) {
+	if m != nil {
+		m.Decisions.WithLabelValues(decisionOutcome(status)).Inc()
+	}
+}
+
+// Instrument counts the requests served by next under the handler name
+func (m *Metrics) Instrument(handler string, next http.HandlerFunc) http.HandlerFunc {
+	if m == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, Status: http.StatusOK}
+
+		m.InFlight.Inc()
+		defer m.InFlight.Dec()
+
+		next(recorder, r)
+
+		code := strconv.Itoa(recorder.Status)
+		m.Requests.WithLabelValues(handler, code).Inc()
+		m.Duration.WithLabelValues(handler, code).Observe(time.Since(started).Seconds())
+	}
+}
+
+// statusRecorder keeps the status code written to the client
+type statusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.Status = status
+	s.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Metrics_Instrument(t *testing.T) {
+	metrics := NewMetrics()
+
+	handler := metrics.Instrument("query", func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		if r.URL.Query().Get("r") == "/function/git-tar" {
+			status = http.StatusUnauthorized
+		}
+
+		metrics.countDecision(status)
+		w.WriteHeader(status)
+	})
+
+	for _, resource := range []string{"/function/alexellis-blog", "/function/git-tar", "/function/alexellis-blog"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/q/?r="+resource, nil))
+	}
+
+	out := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(out, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, want := range []string{
+		`edge_auth_requests_total{code="200",handler="query"} 2`,
+		`edge_auth_requests_total{code="401",handler="query"} 1`,
+		`edge_auth_request_duration_seconds_count{code="200",handler="query"} 2`,
+		`edge_auth_decisions_total{outcome="ok"} 2`,
+		`edge_auth_decisions_total{outcome="unauthorized"} 1`,
+		`edge_auth_requests_in_flight 0`,
+	} {
+		if !strings.Contains(out.Body.String(), want+"\n") {
+			t.Errorf("want metric: %s, got:\n%s", want, out.Body.String())
+		}
+	}
+}
+
+func Test_Metrics_NilIsDisabled(t *testing.T) {
+	var metrics *Metrics
+
+	called := false
+	handler := metrics.Instrument("query", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	metrics.countDecision(http.StatusOK)
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/q/", nil))
+
+	if !called {
+		t.Errorf("want handler called when metrics are turned off")
+	}
+}
+
+func Test_decisionOutcome(t *testing.T) {
+	tests := map[int]string{
+		http.StatusOK:                "ok",
+		http.StatusTemporaryRedirect: "redirect",
+		http.StatusUnauthorized:      "unauthorized",
+		http.StatusBadRequest:        "bad_request",
+	}
+
+	for status, want := range tests {
+		if got := decisionOutcome(status); got != want {
+			t.Errorf("%d: want %s, got %s", status, want, got)
+		}
+	}
+}
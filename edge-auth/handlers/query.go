@@ -14,6 +14,34 @@ import (
 	"github.com/openfaas/openfaas-cloud/sdk"
 )
 
+// RestrictedPrefixes are the functions which make up the pipeline and
+// which should not be exposed via public ingress.
+var RestrictedPrefixes = []string{
+	"/function/ofc-",
+	"/function/github-push",
+	"/function/git-tar",
+	"/function/buildshiprun",
+	"/function/garbage-collect",
+	"/function/canary",
+	"/function/github-status",
+	"/function/import-secrets",
+	"/function/pipeline-log",
+	"/function/deploy-history",
+	"/function/deploy-webhook",
+	"/function/list-functions",
+	"/function/audit-event",
+	"/function/echo",
+	"/function/metrics",
+	"/function/function-logs",
+
+	//AWS
+	"/function/register-image",
+
+	// GitLab
+	"/function/gitlab-status",
+	"/function/gitlab-push",
+}
+
 // MakeQueryHandler returns whether a client can access a resource
 func MakeQueryHandler(config *Config, protected []string, restrictedPrefix []string) func(http.ResponseWriter, *http.Request) {
 	keydata, err := ioutil.ReadFile(config.PublicKeyPath)
@@ -29,6 +57,20 @@ func MakeQueryHandler(config *Config, protected []string, restrictedPrefix []str
 	customersPath := os.Getenv("customers_path")
 	customersURL := os.Getenv("customers_url")
 
+	// The private key signs the identity forwarded to private functions
+	var privateKey crypto.PrivateKey
+	if len(config.PrivateKeyPath) > 0 {
+		privateKeydata, err := ioutil.ReadFile(config.PrivateKeyPath)
+		if err != nil {
+			log.Fatalf("private key, unable to read path: %s, error: %s", config.PrivateKeyPath, err.Error())
+		}
+
+		privateKey, err = jwt.ParseECPrivateKeyFromPEM(privateKeydata)
+		if err != nil {
+			log.Fatalf("unable to parse private key: %s", err.Error())
+		}
+	}
+
 	customers := sdk.NewCustomers(customersPath, customersURL)
 	if err := customers.Fetch(); err != nil {
 		log.Printf("Unable to fetch customers from configured source: %s", err)
@@ -42,11 +84,50 @@ func MakeQueryHandler(config *Config, protected []string, restrictedPrefix []str
 
 		resource := query.Get("r")
 
+		// The edge-router sets the custom domain when the resource was
+		// requested through one
+		customDomain := query.Get("domain")
+
+		// The edge-router sets private, along with the owner and the
+		// allow list, for functions with the private annotation
+		private := query.Get("private") == "true"
+		owner := query.Get("owner")
+
 		status := http.StatusOK
 		if len(resource) == 0 {
 			status = http.StatusBadRequest
+		} else if repeated := repeatedParam(query, "r", "domain", "private", "owner", "allow"); len(repeated) > 0 {
+			// A second value could be read differently by the edge-router
+			log.Printf("Parameter %s repeated for resource %s\n", repeated, resource)
+			status = http.StatusBadRequest
 		} else if isProtected(resource, restrictedPrefix) {
 			status = http.StatusUnauthorized
+		} else if len(customDomain) > 0 && isProtected(resource, protected) {
+			// The cookie is scoped to the cookie_root_domain so is never
+			// sent to a custom domain, and a login could not complete
+			log.Printf("Protected resource %s requested via custom domain %s\n", resource, customDomain)
+			status = http.StatusUnauthorized
+		} else if private && len(customDomain) > 0 {
+			log.Printf("Private resource %s requested via custom domain %s\n", resource, customDomain)
+			status = http.StatusUnauthorized
+		} else if private {
+			claims, cookieStatus := parseSession(r, cookieName, publicKey, config.Debug)
+
+			switch {
+			case cookieStatus == http.StatusNetworkAuthenticationRequired:
+				status = http.StatusTemporaryRedirect
+				log.Printf("No cookie or an invalid cookie was found.\n")
+			case cookieStatus != http.StatusOK:
+				status = http.StatusUnauthorized
+			case len(owner) == 0 || !allowedPrivate(claims, owner, strings.Split(query.Get("allow"), ",")):
+				log.Printf("User %s is not allowed to access private resource %s\n", claims.Subject, resource)
+				status = http.StatusUnauthorized
+			default:
+				if err := setIdentityHeaders(w.Header(), claims, resourceFunction(resource), privateKey, config.OAuthProvider); err != nil {
+					log.Printf("Unable to sign identity for %s: %s\n", claims.Subject, err.Error())
+					status = http.StatusInternalServerError
+				}
+			}
 		} else if isProtected(resource, protected) {
 			started := time.Now()
 			cookieStatus := validCookie(r, cookieName, publicKey, customers, config.Debug)
@@ -69,6 +150,7 @@ func MakeQueryHandler(config *Config, protected []string, restrictedPrefix []str
 		}
 
 		log.Printf("Validate %s => %d\n", resource, status)
+		config.Metrics.countDecision(status)
 
 		if status == http.StatusTemporaryRedirect {
 			var redirect *url.URL
@@ -92,6 +174,16 @@ func MakeQueryHandler(config *Config, protected []string, restrictedPrefix []str
 	}
 }
 
+// repeatedParam gives the first of names which has more than one value
+func repeatedParam(query url.Values, names ...string) string {
+	for _, name := range names {
+		if len(query[name]) > 1 {
+			return name
+		}
+	}
+	return ""
+}
+
 func isProtected(resource string, protected []string) bool {
 	for _, prefix := range protected {
 		if strings.HasPrefix(resource, prefix) {
@@ -102,10 +194,30 @@ func isProtected(resource string, protected []string) bool {
 }
 
 func validCookie(r *http.Request, cookieName string, publicKey crypto.PublicKey, customers *sdk.Customers, debug bool) int {
+	claims, status := parseSession(r, cookieName, publicKey, debug)
+	if status != http.StatusOK {
+		return status
+	}
+
+	if found, _ := customers.Get(claims.Subject); found == false {
+		log.Printf("user [%s] was not a valid customer", claims.Subject)
+		return http.StatusUnauthorized
+	}
+
+	if debug {
+		log.Printf("valid customer [%s]", claims.Subject)
+	}
+
+	return http.StatusOK
+}
+
+// parseSession verifies the session cookie and gives its claims, the
+// status is StatusNetworkAuthenticationRequired when there is no cookie
+func parseSession(r *http.Request, cookieName string, publicKey crypto.PublicKey, debug bool) (*OpenFaaSCloudClaims, int) {
 
 	cookie, err := r.Cookie(cookieName)
 	if err != nil {
-		return http.StatusNetworkAuthenticationRequired
+		return nil, http.StatusNetworkAuthenticationRequired
 	}
 
 	claims := OpenFaaSCloudClaims{}
@@ -120,7 +232,7 @@ func validCookie(r *http.Request, cookieName string, publicKey crypto.PublicKey,
 
 		if parseErr != nil {
 			log.Println(parseErr)
-			return http.StatusUnauthorized
+			return nil, http.StatusUnauthorized
 		}
 
 		if parsed.Valid {
@@ -128,19 +240,11 @@ func validCookie(r *http.Request, cookieName string, publicKey crypto.PublicKey,
 				log.Println("Claims", claims)
 				log.Printf("Validated JWT for (%s) %s", claims.Subject, claims.Name)
 			}
-			if found, _ := customers.Get(claims.Subject); found == false {
-				log.Printf("user [%s] was not a valid customer", claims.Subject)
-				return http.StatusUnauthorized
-			}
-
-			if debug {
-				log.Printf("valid customer [%s]", claims.Subject)
-			}
 
-			return http.StatusOK
+			return &claims, http.StatusOK
 		}
 
 	}
 
-	return http.StatusUnauthorized
+	return nil, http.StatusUnauthorized
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_MakeQueryHandler_CustomDomain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edge-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicKey, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	publicKeyPath := path.Join(dir, "key.pub")
+	ioutil.WriteFile(publicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600)
+
+	customersPath := path.Join(dir, "customers")
+	ioutil.WriteFile(customersPath, []byte("alexellis\n"), 0600)
+	os.Setenv("customers_path", customersPath)
+	defer os.Unsetenv("customers_path")
+
+	config := &Config{
+		OAuthProvider:          githubName,
+		ExternalRedirectDomain: "https://auth.system.example.com",
+		PublicKeyPath:          publicKeyPath,
+	}
+
+	handler := MakeQueryHandler(config, []string{"/function/system-dashboard"}, RestrictedPrefixes)
+
+	tests := []struct {
+		Scenario string
+		Query    string
+		Want     int
+	}{
+		{"function via custom domain", "r=/function/alexellis-blog/&domain=www.example.com", http.StatusOK},
+		{"restricted via custom domain", "r=/function/git-tar&domain=www.example.com", http.StatusUnauthorized},
+		{"restricted via sub-domain", "r=/function/git-tar", http.StatusUnauthorized},
+		{"deploy-webhook is restricted", "r=/function/deploy-webhook", http.StatusUnauthorized},
+		{"protected via custom domain", "r=/function/system-dashboard&domain=www.example.com", http.StatusUnauthorized},
+		{"protected via sub-domain asks for a login", "r=/function/system-dashboard", http.StatusTemporaryRedirect},
+		{"repeated resource", "r=/function/alexellis-blog/&r=/function/system-dashboard", http.StatusBadRequest},
+		{"repeated private", "r=/function/alexellis-admin&private=true&private=false", http.StatusBadRequest},
+		{"repeated owner", "r=/function/alexellis-admin&private=true&owner=alexellis&owner=rgee0", http.StatusBadRequest},
+		{"repeated allow", "r=/function/alexellis-admin&private=true&owner=alexellis&allow=&allow=rgee0", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Scenario, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/q/?"+test.Query, nil)
+			rr := httptest.NewRecorder()
+
+			handler(rr, req)
+
+			if rr.Code != test.Want {
+				t.Errorf("status want: %d, got: %d", test.Want, rr.Code)
+			}
+		})
+	}
+}
@@ -97,33 +97,26 @@ func main() {
 		Debug:                  writeDebug,
 	}
 
-	protected := []string{
-		"/function/system-dashboard",
+	metricsPort := 8081
+	if v, exists := os.LookupEnv("metrics_port"); exists {
+		val, _ := strconv.Atoi(v)
+		metricsPort = val
 	}
 
-	// Functions which make up the pipeline and which should not
-	// be exposed via public ingress.
-	restrictedPrefix := []string{
-		"/function/ofc-",
-		"/function/github-push",
-		"/function/git-tar",
-		"/function/buildshiprun",
-		"/function/garbage-collect",
-		"/function/github-status",
-		"/function/import-secrets",
-		"/function/pipeline-log",
-		"/function/list-functions",
-		"/function/audit-event",
-		"/function/echo",
-		"/function/metrics",
-		"/function/function-logs",
+	if val, exists := os.LookupEnv("metrics"); !exists || (val != "false" && val != "0") {
+		config.Metrics = handlers.NewMetrics()
 
-		//AWS
-		"/function/register-image",
+		metricsRouter := http.NewServeMux()
+		metricsRouter.Handle("/metrics", config.Metrics.Handler())
 
-		// GitLab
-		"/function/gitlab-status",
-		"/function/gitlab-push",
+		log.Printf("Serving metrics on port: %d\n", metricsPort)
+		go func() {
+			log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", metricsPort), metricsRouter))
+		}()
+	}
+
+	protected := []string{
+		"/function/system-dashboard",
 	}
 
 	fs := http.FileServer(http.Dir("static"))
@@ -131,11 +124,11 @@ func main() {
 	router := http.NewServeMux()
 	router.Handle("/static/", http.StripPrefix("/static/", fs))
 
-	router.HandleFunc("/", handlers.MakeHomepageHandler(config))
+	router.HandleFunc("/", config.Metrics.Instrument("homepage", handlers.MakeHomepageHandler(config)))
 
-	router.HandleFunc("/q/", handlers.MakeQueryHandler(config, protected, restrictedPrefix))
-	router.HandleFunc("/login/", handlers.MakeLoginHandler(config))
-	router.HandleFunc("/oauth2/", handlers.MakeOAuth2Handler(config))
+	router.HandleFunc("/q/", config.Metrics.Instrument("query", handlers.MakeQueryHandler(config, protected, handlers.RestrictedPrefixes)))
+	router.HandleFunc("/login/", config.Metrics.Instrument("login", handlers.MakeLoginHandler(config)))
+	router.HandleFunc("/oauth2/", config.Metrics.Instrument("oauth2", handlers.MakeOAuth2Handler(config)))
 	router.HandleFunc("/healthz/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK."))
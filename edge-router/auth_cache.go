@@ -0,0 +1,210 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionCookie is the cookie issued by edge-auth after a login
+const sessionCookie = "openfaas_cloud_token"
+
+type authDecision struct {
+	Status   int
+	Location string
+
+	// Identity holds the headers edge-auth gives for a private function
+	Identity http.Header
+}
+
+type authCacheEntry struct {
+	Key      string
+	Session  string
+	Decision authDecision
+	Expires  time.Time
+}
+
+// authCache keeps the decisions of edge-auth for a short time so that
+// each request, such as one for a static asset of the dashboard, does
+// not wait for edge-auth. The least recently used decision is evicted
+// once Size decisions are held.
+type authCache struct {
+	TTL  time.Duration
+	Size int
+
+	// Metrics counts hits, misses and evictions when set
+	Metrics *routerMetrics
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+
+	now func() time.Time
+}
+
+func newAuthCache(ttl time.Duration, size int) *authCache {
+	return &authCache{
+		TTL:     ttl,
+		Size:    size,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get gives the decision for key unless it has expired
+func (c *authCache) Get(key string) (authDecision, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if ok {
+		entry := element.Value.(*authCacheEntry)
+		if c.now().Before(entry.Expires) {
+			c.order.MoveToFront(element)
+			c.count("hit")
+			return entry.Decision, true
+		}
+
+		c.remove(element)
+	}
+
+	c.count("miss")
+	return authDecision{}, false
+}
+
+// Set keeps the decision for the TTL, or until expires if that is sooner
+func (c *authCache) Set(key, session string, decision authDecision, expires time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ttlExpires := c.now().Add(c.TTL)
+	if expires.IsZero() || ttlExpires.Before(expires) {
+		expires = ttlExpires
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	entry := &authCacheEntry{Key: key, Session: session, Decision: decision, Expires: expires}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.Size {
+		c.remove(c.order.Back())
+		if c.Metrics != nil {
+			c.Metrics.AuthCacheEvictions.Inc()
+		}
+	}
+
+	c.setEntries()
+}
+
+// Purge removes every decision for a session, i.e. on logout
+func (c *authCache) Purge(session string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*authCacheEntry).Session == session {
+			c.remove(element)
+		}
+		element = next
+	}
+
+	c.setEntries()
+}
+
+func (c *authCache) remove(element *list.Element) {
+	delete(c.entries, element.Value.(*authCacheEntry).Key)
+	c.order.Remove(element)
+}
+
+func (c *authCache) count(result string) {
+	if c.Metrics != nil {
+		c.Metrics.AuthCache.WithLabelValues(result).Inc()
+	}
+}
+
+func (c *authCache) setEntries() {
+	if c.Metrics != nil {
+		c.Metrics.AuthCacheEntries.Set(float64(c.order.Len()))
+	}
+}
+
+// cacheableDecision is true for decisions which only depend upon the
+// session and the resource, redirects and errors are never cached
+func cacheableDecision(status int) bool {
+	return status == http.StatusOK || status == http.StatusUnauthorized
+}
+
+// sessionHash identifies the session of the request without keeping
+// the token itself in memory, it is empty when there is no session
+func sessionHash(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || len(cookie.Value) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(cookie.Value))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionExpiry reads the exp claim of the session token so that a
+// decision is never cached beyond the expiry of the session. The
+// signature is checked by edge-auth, not here.
+func sessionExpiry(r *http.Request) time.Time {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return tokenExpiry(cookie.Value)
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it, the
+// zero time is given when there is none
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	claims := struct {
+		ExpiresAt int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.ExpiresAt, 0)
+}
+
+// resourcePrefix gives the function of an upstream path such as
+// /function/system-dashboard/static/app.js, decisions of edge-auth
+// only depend upon this part of the path
+func resourcePrefix(upstreamPath string) string {
+	parts := strings.SplitN(strings.TrimPrefix(upstreamPath, "/"), "/", 3)
+	if len(parts) < 2 {
+		return upstreamPath
+	}
+	return "/" + parts[0] + "/" + parts[1]
+}
+
+// isLogout is true for requests which end a session, these are never
+// served from the cache
+func isLogout(r *http.Request) bool {
+	return strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/logout")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_authCache_ExpiresAfterTTL(t *testing.T) {
+	cache := newAuthCache(time.Second*5, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("key", "session", authDecision{Status: http.StatusOK}, time.Time{})
+
+	if decision, ok := cache.Get("key"); !ok || decision.Status != http.StatusOK {
+		t.Fatalf("want cached decision, got: %v %t", decision, ok)
+	}
+
+	now = now.Add(time.Second * 5)
+	if _, ok := cache.Get("key"); ok {
+		t.Errorf("want decision expired after the TTL")
+	}
+}
+
+func Test_authCache_ExpiresWithSession(t *testing.T) {
+	cache := newAuthCache(time.Minute, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("key", "session", authDecision{Status: http.StatusOK}, now.Add(time.Second))
+
+	now = now.Add(time.Second * 2)
+	if _, ok := cache.Get("key"); ok {
+		t.Errorf("want decision expired with the session")
+	}
+}
+
+func Test_authCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newAuthCache(time.Minute, 2)
+
+	cache.Set("a", "", authDecision{Status: http.StatusOK}, time.Time{})
+	cache.Set("b", "", authDecision{Status: http.StatusOK}, time.Time{})
+	cache.Get("a")
+	cache.Set("c", "", authDecision{Status: http.StatusOK}, time.Time{})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("want least recently used decision evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("want %s kept", key)
+		}
+	}
+}
+
+func Test_authCache_Purge(t *testing.T) {
+	cache := newAuthCache(time.Minute, 10)
+
+	cache.Set("alex dashboard", "alex", authDecision{Status: http.StatusOK}, time.Time{})
+	cache.Set("alex blog", "alex", authDecision{Status: http.StatusOK}, time.Time{})
+	cache.Set("rgee0 dashboard", "rgee0", authDecision{Status: http.StatusOK}, time.Time{})
+
+	cache.Purge("alex")
+
+	if _, ok := cache.Get("alex dashboard"); ok {
+		t.Errorf("want decisions for the session purged")
+	}
+	if _, ok := cache.Get("rgee0 dashboard"); !ok {
+		t.Errorf("want decisions for other sessions kept")
+	}
+}
+
+func Test_resourcePrefix(t *testing.T) {
+	tests := []struct {
+		Path string
+		Want string
+	}{
+		{"/function/system-dashboard/static/app.js", "/function/system-dashboard"},
+		{"/function/system-dashboard", "/function/system-dashboard"},
+		{"/function/alexellis-fn1.openfaas-fn-alex/", "/function/alexellis-fn1.openfaas-fn-alex"},
+		{"/healthz", "/healthz"},
+	}
+
+	for _, testCase := range tests {
+		if got := resourcePrefix(testCase.Path); got != testCase.Want {
+			t.Errorf("%s: want %s, got %s", testCase.Path, testCase.Want, got)
+		}
+	}
+}
+
+func makeSessionToken(expires time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JWT"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"alexellis","exp":%d}`, expires.Unix())))
+	return header + "." + claims + ".signature"
+}
+
+func Test_sessionExpiry(t *testing.T) {
+	expires := time.Unix(1600000000, 0)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: makeSessionToken(expires)})
+	if got := sessionExpiry(r); !got.Equal(expires) {
+		t.Errorf("want: %s, got: %s", expires, got)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: "not-a-token"})
+	if got := sessionExpiry(r); !got.IsZero() {
+		t.Errorf("want zero time for an invalid token, got: %s", got)
+	}
+}
+
+func Test_authProxy_ValidateCachesDecisions(t *testing.T) {
+	calls := 0
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if _, err := r.Cookie(sessionCookie); err != nil {
+			http.Redirect(w, r, "https://github.com/login/oauth/authorize", http.StatusTemporaryRedirect)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	auth := &authProxy{URL: authServer.URL + "/", Client: client, Cache: newAuthCache(time.Minute, 10)}
+	token := makeSessionToken(time.Now().Add(time.Hour))
+
+	validate := func(path, token string) int {
+		r := httptest.NewRequest(http.MethodGet, "http://system.example.com"+path, nil)
+		if len(token) > 0 {
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+		}
+		return auth.Validate("/function/system-dashboard"+path, "", "system", "dashboard", r).Status
+	}
+
+	validate("/", token)
+	validate("/static/app.js", token)
+	if calls != 1 {
+		t.Errorf("want one call to edge-auth for the same session and function, got: %d", calls)
+	}
+
+	validate("/", makeSessionToken(time.Now().Add(time.Minute)))
+	if calls != 2 {
+		t.Errorf("want another call for another session, got: %d", calls)
+	}
+
+	// Redirects to log in are never cached
+	for i := 0; i < 2; i++ {
+		if status := validate("/", ""); status != http.StatusTemporaryRedirect {
+			t.Fatalf("status want: %d, got: %d", http.StatusTemporaryRedirect, status)
+		}
+	}
+	if calls != 4 {
+		t.Errorf("want each redirect from edge-auth, got: %d calls", calls)
+	}
+
+	// Logging out forgets the decisions for the session
+	logout := httptest.NewRequest(http.MethodGet, "http://system.example.com/logout", nil)
+	logout.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	auth.Forget(logout)
+
+	validate("/", token)
+	if calls != 5 {
+		t.Errorf("want call to edge-auth after logout, got: %d", calls)
+	}
+}
+
+func Test_isLogout(t *testing.T) {
+	tests := map[string]bool{
+		"/logout":                           true,
+		"/logout/":                          true,
+		"/dashboard/logout":                 true,
+		"/function/alexellis-logout-helper": false,
+		"/blog":                             false,
+	}
+
+	for path, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if got := isLogout(r); got != want {
+			t.Errorf("%s: want %t, got %t", path, want, got)
+		}
+	}
+}
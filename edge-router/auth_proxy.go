@@ -4,15 +4,100 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// privateAnnotation marks a function which only its owner, and the users
+// and organizations in privateAllowAnnotation, may invoke
+const (
+	privateAnnotation      = "com.openfaas.cloud.private"
+	privateAllowAnnotation = "com.openfaas.cloud.private.allow"
+)
+
+// identityHeaders are set by edge-auth on decisions for private functions
+// and forwarded to the function, they are always removed from requests
+// so that a client cannot claim an identity
+var identityHeaders = []string{
+	"X-Cloud-User",
+	"X-Cloud-Organizations",
+	"X-Cloud-Identity",
+}
+
+// identityTokenHeader carries the identity signed by edge-auth
+const identityTokenHeader = "X-Cloud-Identity"
+
 type authProxy struct {
 	URL    string
 	Client *http.Client
+
+	// Cache keeps decisions for a short time when set
+	Cache *authCache
+
+	// Functions gives the private annotations of functions when set
+	Functions *functionCache
+}
+
+// Validate asks edge-auth whether the request may access the upstream,
+// customDomain is set when the request was made to a custom domain. The
+// owner and name of the function are used to look up whether it is
+// private.
+func (a *authProxy) Validate(upstreamURL, customDomain, owner, name string, r *http.Request) authDecision {
+	if a.Cache == nil || isLogout(r) {
+		return a.validate(upstreamURL, customDomain, owner, name, r)
+	}
+
+	session := sessionHash(r)
+	key := session + " " + customDomain + " " + resourcePrefix(upstreamURL)
+
+	if decision, ok := a.Cache.Get(key); ok {
+		return decision
+	}
+
+	decision := a.validate(upstreamURL, customDomain, owner, name, r)
+	if cacheableDecision(decision.Status) {
+		// A cached identity must not be forwarded once it has expired,
+		// so it is dropped a minute early
+		expires := sessionExpiry(r)
+		if identityExpires := tokenExpiry(decision.Identity.Get(identityTokenHeader)); !identityExpires.IsZero() {
+			identityExpires = identityExpires.Add(-time.Minute)
+			if expires.IsZero() || identityExpires.Before(expires) {
+				expires = identityExpires
+			}
+		}
+
+		a.Cache.Set(key, session, decision, expires)
+	}
+
+	return decision
 }
 
-func (a *authProxy) Validate(upstreamURL string, r *http.Request) (int, string) {
-	validateURL := a.URL + "q/?r=" + upstreamURL
+// Forget removes the cached decisions for the session of the request
+func (a *authProxy) Forget(r *http.Request) {
+	if a.Cache == nil {
+		return
+	}
+
+	if session := sessionHash(r); len(session) > 0 {
+		a.Cache.Purge(session)
+	}
+}
+
+func (a *authProxy) validate(upstreamURL, customDomain, owner, name string, r *http.Request) authDecision {
+	private, allow, err := a.privateFunction(owner, name)
+	if err != nil {
+		log.Printf("Unable to find whether %s-%s is private: %s", owner, name, err.Error())
+		return authDecision{Status: http.StatusServiceUnavailable}
+	}
+
+	validateURL := a.URL + "q/?r=" + url.QueryEscape(upstreamURL)
+	if len(customDomain) > 0 {
+		validateURL += "&domain=" + url.QueryEscape(customDomain)
+	}
+	if private {
+		validateURL += "&private=true&owner=" + url.QueryEscape(owner) + "&allow=" + url.QueryEscape(allow)
+	}
 
 	req, _ := http.NewRequest(http.MethodGet, validateURL, nil)
 
@@ -33,7 +118,7 @@ func (a *authProxy) Validate(upstreamURL string, r *http.Request) (int, string)
 
 	if err != nil {
 		log.Printf("Unable to reach auth service: %s", err.Error())
-		return http.StatusBadGateway, ""
+		return authDecision{Status: http.StatusBadGateway}
 	}
 
 	fmt.Println("Res:", res.Status)
@@ -50,5 +135,57 @@ func (a *authProxy) Validate(upstreamURL string, r *http.Request) (int, string)
 
 	log.Printf("Validating (%s) status: %d, location: %s\n", validateURL, res.StatusCode, location)
 
-	return res.StatusCode, location
+	decision := authDecision{Status: res.StatusCode, Location: location}
+	if res.StatusCode == http.StatusOK {
+		for _, name := range identityHeaders {
+			if value := res.Header.Get(name); len(value) > 0 {
+				if decision.Identity == nil {
+					decision.Identity = http.Header{}
+				}
+				decision.Identity.Set(name, value)
+			}
+		}
+	}
+
+	return decision
+}
+
+// privateFunction gives whether a function is private and the users and
+// organizations allowed to invoke it as well as its owner. An error is
+// given when the owner's functions cannot be listed, the request must
+// then be denied as the function may be private.
+func (a *authProxy) privateFunction(owner, name string) (bool, string, error) {
+	if a.Functions == nil || len(owner) == 0 || len(name) == 0 {
+		return false, "", nil
+	}
+
+	owner = strings.ToLower(owner)
+	function, err := a.Functions.Lookup(owner, owner+"-"+strings.ToLower(name))
+	if err != nil || function == nil || function.Annotations[privateAnnotation] != "true" {
+		return false, "", err
+	}
+
+	return true, function.Annotations[privateAllowAnnotation], nil
+}
+
+// forwardIdentity replaces any identity sent by the client with the one
+// given by edge-auth
+func forwardIdentity(r *http.Request, identity http.Header) {
+	for _, name := range identityHeaders {
+		r.Header.Del(name)
+	}
+
+	for name, values := range identity {
+		r.Header[name] = values
+	}
+}
+
+// isAuthQuery is true for the decisions of edge-auth, which are only asked
+// for by the router so that a client cannot obtain a signed identity
+func isAuthQuery(requestURI string) bool {
+	name, _ := splitRequestURI(requestURI)
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name == "q"
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func Test_makeHandler_PrivateFunctionIdentity(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		functions := []cachedFunction{
+			{
+				Name: "alexellis-admin",
+				Annotations: map[string]string{
+					privateAnnotation:      "true",
+					privateAllowAnnotation: "rgee0,acme",
+				},
+			},
+			{Name: "alexellis-blog"},
+		}
+		bytesOut, _ := json.Marshal(functions)
+		w.Write(bytesOut)
+	}))
+	defer listFunctions.Close()
+
+	var query url.Values
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if query.Get("private") == "true" {
+			w.Header().Set("X-Cloud-User", "rgee0")
+			w.Header().Set("X-Cloud-Organizations", "acme")
+			w.Header().Set("X-Cloud-Identity", makeSessionToken(time.Now().Add(time.Minute*5)))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	auth := &authProxy{
+		URL:       authServer.URL + "/",
+		Client:    http.DefaultClient,
+		Functions: newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 100),
+	}
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, auth, routerOptions{}),
+	})
+	defer router.Close()
+
+	tests := []struct {
+		Scenario  string
+		Path      string
+		WantQuery url.Values
+		WantUser  string
+	}{
+		{
+			Scenario:  "private function",
+			Path:      "/admin",
+			WantQuery: url.Values{"private": {"true"}, "owner": {"alexellis"}, "allow": {"rgee0,acme"}},
+			WantUser:  "rgee0",
+		},
+		{
+			Scenario:  "public function",
+			Path:      "/blog",
+			WantQuery: url.Values{"private": {""}, "owner": {""}, "allow": {""}},
+			WantUser:  "",
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, router.URL+testCase.Path, nil)
+			req.Host = "alexellis.example.xyz"
+			req.Header.Set("X-Cloud-User", "alexellis")
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			for key := range testCase.WantQuery {
+				if got := query.Get(key); got != testCase.WantQuery.Get(key) {
+					t.Errorf("edge-auth query %s want: %q, got: %q", key, testCase.WantQuery.Get(key), got)
+				}
+			}
+
+			if got := gatewayHandler.Header.Get("X-Cloud-User"); got != testCase.WantUser {
+				t.Errorf("X-Cloud-User want: %q, got: %q", testCase.WantUser, got)
+			}
+			if len(testCase.WantUser) > 0 && len(gatewayHandler.Header.Get("X-Cloud-Identity")) == 0 {
+				t.Errorf("want signed identity forwarded")
+			}
+		})
+	}
+}
+
+func Test_authProxy_ValidateCachesIdentityUntilExpiry(t *testing.T) {
+	calls := 0
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Cloud-User", "alexellis")
+		w.Header().Set("X-Cloud-Identity", makeSessionToken(time.Now().Add(time.Minute*5)))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	cache := newAuthCache(time.Hour, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	auth := &authProxy{URL: authServer.URL + "/", Client: http.DefaultClient, Cache: cache}
+
+	validate := func() authDecision {
+		r := httptest.NewRequest(http.MethodGet, "http://alexellis.example.xyz/admin", nil)
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: makeSessionToken(now.Add(time.Hour * 48))})
+		return auth.Validate("/function/alexellis-admin", "", "alexellis", "admin", r)
+	}
+
+	if decision := validate(); decision.Identity.Get("X-Cloud-User") != "alexellis" {
+		t.Fatalf("want identity from edge-auth, got: %v", decision.Identity)
+	}
+	if decision := validate(); calls != 1 || decision.Identity.Get("X-Cloud-User") != "alexellis" {
+		t.Errorf("want identity served from the cache, calls: %d", calls)
+	}
+
+	now = now.Add(time.Minute * 4)
+	validate()
+	if calls != 2 {
+		t.Errorf("want decision refreshed before the identity expires, calls: %d", calls)
+	}
+}
+
+func Test_isAuthQuery(t *testing.T) {
+	tests := []struct {
+		RequestURI string
+		Want       bool
+	}{
+		{"q/?r=/function/alexellis-admin", true},
+		{"q?r=/function/alexellis-admin", true},
+		{"%71/?r=/function/alexellis-admin", true},
+		{"login/?r=/", false},
+		{"", false},
+	}
+
+	for _, testCase := range tests {
+		if got := isAuthQuery(testCase.RequestURI); got != testCase.Want {
+			t.Errorf("%s: want %t, got %t", testCase.RequestURI, testCase.Want, got)
+		}
+	}
+}
+
+func Test_authProxy_ValidateEscapesResource(t *testing.T) {
+	var query url.Values
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	auth := &authProxy{URL: authServer.URL + "/", Client: http.DefaultClient}
+
+	r := httptest.NewRequest(http.MethodGet, "http://alexellis.example.xyz/admin", nil)
+	auth.Validate("/function/alexellis-admin&private=false&owner=rgee0", "", "alexellis", "admin", r)
+
+	if got := query.Get("r"); got != "/function/alexellis-admin&private=false&owner=rgee0" {
+		t.Errorf("want the whole resource in r, got: %q", got)
+	}
+	if _, ok := query["owner"]; ok {
+		t.Errorf("want no owner from the resource, got: %q", query.Get("owner"))
+	}
+}
+
+func Test_authProxy_ValidateDeniesWhenFunctionsUnknown(t *testing.T) {
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer listFunctions.Close()
+
+	calls := 0
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	auth := &authProxy{
+		URL:       authServer.URL + "/",
+		Client:    http.DefaultClient,
+		Functions: newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 100),
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "http://alexellis.example.xyz/admin", nil)
+	decision := auth.Validate("/function/alexellis-admin", "", "alexellis", "admin", r)
+
+	if decision.Status != http.StatusServiceUnavailable {
+		t.Errorf("want: %d, got: %d", http.StatusServiceUnavailable, decision.Status)
+	}
+	if calls != 0 {
+		t.Errorf("want edge-auth not asked, calls: %d", calls)
+	}
+}
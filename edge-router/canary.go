@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	canarySuffix           = "-canary"
+	canaryWeightAnnotation = "com.openfaas.cloud.canary.weight"
+)
+
+// canaryRouter sends a share of the traffic for a function to its
+// canary when one has been deployed by buildshiprun.
+type canaryRouter struct {
+	Functions *functionCache
+
+	// roll returns a number in [0,100)
+	roll func() int
+}
+
+func newCanaryRouter(functions *functionCache) *canaryRouter {
+	return &canaryRouter{
+		Functions: functions,
+		roll: func() int {
+			return rand.Intn(100)
+		},
+	}
+}
+
+// Route gives the name of the function which should serve the request
+func (c *canaryRouter) Route(owner, functionName string) string {
+	if strings.HasSuffix(functionName, canarySuffix) {
+		return functionName
+	}
+
+	canaryName := functionName + canarySuffix
+	canary, ok := c.Functions.Get(owner, canaryName)
+	if !ok {
+		return functionName
+	}
+
+	weight, err := strconv.Atoi(canary.Annotations[canaryWeightAnnotation])
+	if err != nil || weight < 1 {
+		return functionName
+	}
+
+	if c.roll() < weight {
+		return canaryName
+	}
+
+	return functionName
+}
+
+// getFunctionName returns the function in a request URI of the
+// form function/name/path?query
+func getFunctionName(requestURI string) string {
+	name := strings.TrimPrefix(requestURI, "function/")
+	if i := strings.IndexAny(name, "/?"); i > -1 {
+		name = name[:i]
+	}
+	return name
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_getFunctionName(t *testing.T) {
+	tests := map[string]string{
+		"dashboard":             "dashboard",
+		"dashboard/":            "dashboard",
+		"dashboard/static/a.js": "dashboard",
+		"dashboard?user=alex":   "dashboard",
+	}
+
+	for requestURI, want := range tests {
+		if got := getFunctionName(requestURI); got != want {
+			t.Errorf("%s: want %s, got %s", requestURI, want, got)
+		}
+	}
+}
+
+func Test_canaryRouter_Route(t *testing.T) {
+	listCalls := 0
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listCalls++
+		functions := []cachedFunction{
+			{Name: "alexellis-fn1"},
+			{
+				Name:        "alexellis-fn1-canary",
+				Annotations: map[string]string{canaryWeightAnnotation: "20"},
+			},
+			{Name: "alexellis-fn2"},
+		}
+		bytesOut, _ := json.Marshal(functions)
+		w.Write(bytesOut)
+	}))
+	defer listFunctions.Close()
+
+	router := newCanaryRouter(newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 100))
+
+	tests := []struct {
+		title    string
+		function string
+		roll     int
+		want     string
+	}{
+		{title: "roll under weight goes to canary", function: "alexellis-fn1", roll: 19, want: "alexellis-fn1-canary"},
+		{title: "roll over weight goes to stable", function: "alexellis-fn1", roll: 20, want: "alexellis-fn1"},
+		{title: "no canary goes to stable", function: "alexellis-fn2", roll: 0, want: "alexellis-fn2"},
+		{title: "canary can be called directly", function: "alexellis-fn1-canary", roll: 99, want: "alexellis-fn1-canary"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			roll := test.roll
+			router.roll = func() int { return roll }
+
+			if got := router.Route("alexellis", test.function); got != test.want {
+				t.Errorf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+
+	if listCalls != 1 {
+		t.Errorf("want functions to be listed once within the expiry, got: %d", listCalls)
+	}
+}
@@ -13,6 +13,91 @@ type RouterConfig struct {
 	UpstreamURL string
 	AuthURL     string
 	Timeout     time.Duration
+
+	// CanaryRouting sends a share of traffic to canaries
+	// deployed by buildshiprun
+	CanaryRouting bool
+
+	// FunctionCacheExpiry is how long the functions of an
+	// owner are cached for before calling list-functions again, and
+	// FunctionCacheSize is how many owners are held
+	FunctionCacheExpiry time.Duration
+	FunctionCacheSize   int
+
+	// NamespacePrefix is prepended to the owner to give the namespace
+	// of their functions, empty unless user_namespaces is enabled
+	NamespacePrefix string
+
+	// UpgradeIdleTimeout closes a tunnel for an upgraded connection
+	// such as a WebSocket when no data is sent for this long
+	UpgradeIdleTimeout time.Duration
+
+	// MaxUpgradeConnections is the number of upgraded connections each
+	// owner may have open at once, 0 is unlimited
+	MaxUpgradeConnections int
+
+	// CustomDomains serves functions at the verified domains claimed
+	// with the custom-domain annotation
+	CustomDomains bool
+
+	// DomainReloadInterval is how often the custom domains are read
+	// from list-functions
+	DomainReloadInterval time.Duration
+
+	// TLS serves HTTPS on TLSPort with the certificates in TLSCertPath
+	// as well as HTTP on Port
+	TLS               bool
+	TLSPort           string
+	TLSCertPath       string
+	TLSReloadInterval time.Duration
+
+	// TLSRedirect sends requests made over HTTP to HTTPS on
+	// TLSRedirectPort, which is the port used by clients
+	TLSRedirect     bool
+	TLSRedirectPort string
+
+	// HSTSMaxAge sets the Strict-Transport-Security header on HTTPS
+	// responses when greater than zero
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+
+	// RateLimits applies a token bucket to each owner and function, with
+	// limits read from RateLimitPath and from function annotations
+	RateLimits              bool
+	RateLimitPath           string
+	RateLimitReloadInterval time.Duration
+
+	// RateLimitRedisAddr shares the buckets between replicas of the
+	// router with Redis, when empty each replica keeps its own
+	RateLimitRedisAddr         string
+	RateLimitRedisPasswordFile string
+
+	// Metrics serves /metrics for Prometheus on MetricsPort, which is
+	// kept apart from Port so that it is not exposed by the ingress
+	Metrics     bool
+	MetricsPort string
+
+	// AuthCacheTTL is how long a decision from edge-auth is cached for
+	// and AuthCacheSize is how many are held, either as 0 turns it off
+	AuthCacheTTL  time.Duration
+	AuthCacheSize int
+
+	// RoutingMode reads the owner from the sub-domain, or from the first
+	// part of the path to serve every owner from a single host
+	RoutingMode routingMode
+
+	// SystemHost serves the dashboard and edge-auth in path routing, it
+	// must not be the host of functions nor one of its parent domains
+	SystemHost string
+
+	// FunctionPolicies enforces the CORS, IP allowlist and body size
+	// annotations of functions
+	FunctionPolicies bool
+
+	// TrustedProxies is a comma-separated list of the CIDRs of proxies in
+	// front of the router, ClientIPHeader is only read from these
+	TrustedProxies string
+	ClientIPHeader string
 }
 
 // NewRouterConfig create a new RouterConfig by loading
@@ -44,9 +129,92 @@ func NewRouterConfig() RouterConfig {
 
 	cfg.Timeout = parseIntOrDurationValue(os.Getenv("timeout"), time.Second*60)
 
+	cfg.CanaryRouting = true
+	if val, exists := os.LookupEnv("canary_routing"); exists && len(val) > 0 {
+		cfg.CanaryRouting = val != "false" && val != "0"
+	}
+
+	cfg.FunctionCacheExpiry = parseIntOrDurationValue(os.Getenv("function_cache_expiry"), time.Second*5)
+	cfg.FunctionCacheSize = 10000
+	if val, exists := os.LookupEnv("function_cache_size"); exists && len(val) > 0 {
+		if size, err := strconv.Atoi(val); err == nil && size > 0 {
+			cfg.FunctionCacheSize = size
+		}
+	}
+
+	if val := os.Getenv("user_namespaces"); val == "true" || val == "1" {
+		cfg.NamespacePrefix = "openfaas-fn-"
+		if prefix, exists := os.LookupEnv("namespace_prefix"); exists && len(prefix) > 0 {
+			cfg.NamespacePrefix = prefix
+		}
+	}
+
+	cfg.UpgradeIdleTimeout = parseIntOrDurationValue(os.Getenv("upgrade_idle_timeout"), time.Minute*5)
+
+	cfg.MaxUpgradeConnections = 100
+	if val, exists := os.LookupEnv("max_upgrade_connections"); exists && len(val) > 0 {
+		if max, err := strconv.Atoi(val); err == nil && max >= 0 {
+			cfg.MaxUpgradeConnections = max
+		}
+	}
+
+	cfg.CustomDomains = parseBoolValue(os.Getenv("custom_domains"))
+
+	cfg.DomainReloadInterval = parseIntOrDurationValue(os.Getenv("domain_reload_interval"), time.Minute)
+
+	cfg.TLS = parseBoolValue(os.Getenv("tls"))
+	cfg.TLSPort = getValue("tls_port", "8443")
+	cfg.TLSCertPath = getValue("tls_cert_path", "/var/openfaas/certs")
+	cfg.TLSReloadInterval = parseIntOrDurationValue(os.Getenv("tls_reload_interval"), time.Second*30)
+	cfg.TLSRedirect = parseBoolValue(os.Getenv("tls_redirect"))
+	cfg.TLSRedirectPort = getValue("tls_redirect_port", "443")
+	cfg.HSTSMaxAge = parseIntOrDurationValue(os.Getenv("hsts_max_age"), 0)
+	cfg.HSTSIncludeSubdomains = parseBoolValue(os.Getenv("hsts_include_subdomains"))
+
+	cfg.RateLimits = parseBoolValue(os.Getenv("rate_limits"))
+	cfg.RateLimitPath = os.Getenv("rate_limit_path")
+	cfg.RateLimitReloadInterval = parseIntOrDurationValue(os.Getenv("rate_limit_reload_interval"), time.Second*30)
+	cfg.RateLimitRedisAddr = os.Getenv("rate_limit_redis_addr")
+	cfg.RateLimitRedisPasswordFile = os.Getenv("rate_limit_redis_password_file")
+
+	cfg.Metrics = true
+	if val, exists := os.LookupEnv("metrics"); exists && len(val) > 0 {
+		cfg.Metrics = val != "false" && val != "0"
+	}
+	cfg.MetricsPort = getValue("metrics_port", "8081")
+
+	cfg.AuthCacheTTL = parseIntOrDurationValue(os.Getenv("auth_cache_ttl"), time.Second*5)
+	cfg.AuthCacheSize = 10000
+	if val, exists := os.LookupEnv("auth_cache_size"); exists && len(val) > 0 {
+		if size, err := strconv.Atoi(val); err == nil && size >= 0 {
+			cfg.AuthCacheSize = size
+		}
+	}
+
+	cfg.RoutingMode = parseRoutingMode(os.Getenv("routing_mode"))
+	cfg.SystemHost = strings.ToLower(os.Getenv("system_host"))
+
+	cfg.FunctionPolicies = true
+	if val, exists := os.LookupEnv("function_policies"); exists && len(val) > 0 {
+		cfg.FunctionPolicies = val != "false" && val != "0"
+	}
+	cfg.TrustedProxies = os.Getenv("trusted_proxies")
+	cfg.ClientIPHeader = getValue("client_ip_header", "X-Forwarded-For")
+
 	return cfg
 }
 
+func parseBoolValue(val string) bool {
+	return val == "true" || val == "1"
+}
+
+func getValue(key, fallback string) string {
+	if val, exists := os.LookupEnv(key); exists && len(val) > 0 {
+		return val
+	}
+	return fallback
+}
+
 func parseIntOrDurationValue(val string, fallback time.Duration) time.Duration {
 	if len(val) > 0 {
 		parsedVal, parseErr := strconv.Atoi(val)
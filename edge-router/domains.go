@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// customDomain is a hostname verified by list-functions for one of an
+// owner's functions
+type customDomain sdk.CustomDomain
+
+// Name gives the function's name without the owner prefix
+func (d customDomain) Name() string {
+	return strings.TrimPrefix(d.Function, d.Owner+"-")
+}
+
+// domainTable maps the Host header of custom domains to functions, it
+// is reloaded from list-functions so that domains are added and removed
+// as functions are deployed and TXT records change.
+type domainTable struct {
+	UpstreamURL string
+	Client      *http.Client
+
+	lock    sync.RWMutex
+	domains map[string]customDomain
+}
+
+func newDomainTable(upstreamURL string, c *http.Client) *domainTable {
+	return &domainTable{
+		UpstreamURL: upstreamURL,
+		Client:      c,
+		domains:     map[string]customDomain{},
+	}
+}
+
+// Lookup gives the custom domain for a Host header, which may include
+// a port
+func (d *domainTable) Lookup(host string) (customDomain, bool) {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	domain, ok := d.domains[host]
+	return domain, ok
+}
+
+// Reload replaces the table, the previous table is kept when
+// list-functions cannot be reached
+func (d *domainTable) Reload() error {
+	domains, err := d.fetch()
+	if err != nil {
+		return err
+	}
+
+	table := map[string]customDomain{}
+	for _, domain := range domains {
+		table[strings.ToLower(domain.Domain)] = domain
+	}
+
+	d.lock.Lock()
+	changed := len(table) != len(d.domains)
+	d.domains = table
+	d.lock.Unlock()
+
+	if changed {
+		log.Printf("Custom domains: %d\n", len(table))
+	}
+	return nil
+}
+
+// Start reloads the table every interval
+func (d *domainTable) Start(interval time.Duration) {
+	if err := d.Reload(); err != nil {
+		log.Printf("Unable to load custom domains: %s\n", err.Error())
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := d.Reload(); err != nil {
+				log.Printf("Unable to reload custom domains: %s\n", err.Error())
+			}
+		}
+	}()
+}
+
+func (d *domainTable) fetch() ([]customDomain, error) {
+	req, _ := http.NewRequest(http.MethodGet, d.UpstreamURL+"function/list-functions?domains=true", nil)
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from list-functions: %d", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []customDomain{}
+	if err := json.Unmarshal(body, &domains); err != nil {
+		return nil, err
+	}
+
+	return domains, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestDomainTable(t *testing.T, body string) (*domainTable, *httptest.Server) {
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/function/list-functions" || r.URL.Query().Get("domains") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+
+	domains := newDomainTable(listFunctions.URL+"/", http.DefaultClient)
+	if err := domains.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return domains, listFunctions
+}
+
+func Test_domainTable_Lookup(t *testing.T) {
+	domains, listFunctions := newTestDomainTable(t, `[{"domain":"www.example.com","owner":"alexellis","function":"alexellis-blog"}]`)
+	defer listFunctions.Close()
+
+	tests := []struct {
+		Host  string
+		Found bool
+	}{
+		{"www.example.com", true},
+		{"WWW.Example.com:8080", true},
+		{"www.example.com.", true},
+		{"api.example.com", false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Host, func(t *testing.T) {
+			domain, found := domains.Lookup(testCase.Host)
+			if found != testCase.Found {
+				t.Fatalf("want found: %t, got: %t", testCase.Found, found)
+			}
+			if found && domain.Name() != "blog" {
+				t.Errorf("want function name blog, got: %s", domain.Name())
+			}
+		})
+	}
+}
+
+func Test_domainTable_ReloadKeepsTableOnError(t *testing.T) {
+	domains, listFunctions := newTestDomainTable(t, `[{"domain":"www.example.com","owner":"alexellis","function":"alexellis-blog"}]`)
+	defer listFunctions.Close()
+
+	domains.UpstreamURL = "http://127.0.0.1:1/"
+	if err := domains.Reload(); err == nil {
+		t.Fatalf("want error when list-functions cannot be reached")
+	}
+
+	if _, found := domains.Lookup("www.example.com"); !found {
+		t.Errorf("want previous table kept")
+	}
+}
+
+func Test_makeHandler_CustomDomain(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	domains, listFunctions := newTestDomainTable(t, `[
+		{"domain":"www.example.com","owner":"alexellis","function":"alexellis-blog"},
+		{"domain":"auth.system.example.com","owner":"alexellis","function":"alexellis-auth"}
+	]`)
+	defer listFunctions.Close()
+
+	tests := []struct {
+		Scenario    string
+		Host        string
+		Path        string
+		UpstreamURL string
+	}{
+		{
+			Scenario:    "root of the domain",
+			Host:        "www.example.com",
+			Path:        "/",
+			UpstreamURL: "/function/alexellis-blog/",
+		},
+		{
+			Scenario:    "path is passed to the function",
+			Host:        "www.example.com",
+			Path:        "/posts/1?draft=true",
+			UpstreamURL: "/function/alexellis-blog/posts/1?draft=true",
+		},
+		{
+			Scenario:    "custom domain is never the auth host",
+			Host:        "auth.system.example.com",
+			Path:        "/login",
+			UpstreamURL: "/function/alexellis-auth/login",
+		},
+		{
+			Scenario:    "sub-domains are still routed",
+			Host:        "alexellis.example.xyz",
+			Path:        "/blog/posts/1",
+			UpstreamURL: "/function/alexellis-blog/posts/1",
+		},
+	}
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{Domains: domains}),
+	})
+	defer router.Close()
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			gatewayHandler.RequestURI = ""
+
+			req, _ := http.NewRequest(http.MethodGet, router.URL+testCase.Path, nil)
+			req.Host = testCase.Host
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("status want: %d, got: %d", http.StatusOK, res.StatusCode)
+			}
+			if gatewayHandler.RequestURI != testCase.UpstreamURL {
+				t.Errorf("RequestURI want: %s, got: %s", testCase.UpstreamURL, gatewayHandler.RequestURI)
+			}
+		})
+	}
+}
+
+func Test_makeHandler_CustomDomainValidatesWithAuth(t *testing.T) {
+	gateway := httptest.NewServer(&gateway{})
+	defer gateway.Close()
+
+	var resource, domain string
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource = r.URL.Query().Get("r")
+		domain = r.URL.Query().Get("domain")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer authServer.Close()
+
+	domains, listFunctions := newTestDomainTable(t, `[{"domain":"www.example.com","owner":"alexellis","function":"alexellis-blog"}]`)
+	defer listFunctions.Close()
+
+	auth := &authProxy{URL: authServer.URL + "/", Client: http.DefaultClient}
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, auth, routerOptions{Domains: domains}),
+	})
+	defer router.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, router.URL+"/posts", nil)
+	req.Host = "www.example.com"
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status want: %d, got: %d", http.StatusUnauthorized, res.StatusCode)
+	}
+	if resource != "/function/alexellis-blog/posts" {
+		t.Errorf("resource want: %s, got: %s", "/function/alexellis-blog/posts", resource)
+	}
+	if domain != "www.example.com" {
+		t.Errorf("domain want: %s, got: %s", "www.example.com", domain)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedFunction is the subset of a function's status
+// returned by list-functions which the router needs
+type cachedFunction struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type ownerFunctions struct {
+	Functions []cachedFunction
+	Fetched   time.Time
+
+	// Err is set when the functions have never been listed
+	Err error
+}
+
+type functionCacheEntry struct {
+	Owner string
+	ownerFunctions
+}
+
+// functionFetch is a call to list-functions which is in progress,
+// other requests for the same owner wait for it instead of calling
+// list-functions again
+type functionFetch struct {
+	done      chan struct{}
+	functions []cachedFunction
+	err       error
+}
+
+// functionCache holds the functions of each owner for a short
+// time so that the list-functions function is not called on
+// every request. Owners without functions and failed listings are
+// cached too, and the least recently used owner is evicted once
+// Size owners are held.
+type functionCache struct {
+	UpstreamURL string
+	Client      *http.Client
+	Expiry      time.Duration
+	Size        int
+
+	lock    sync.Mutex
+	owners  map[string]*list.Element
+	order   *list.List
+	fetches map[string]*functionFetch
+
+	now func() time.Time
+}
+
+func newFunctionCache(upstreamURL string, c *http.Client, expiry time.Duration, size int) *functionCache {
+	return &functionCache{
+		UpstreamURL: upstreamURL,
+		Client:      c,
+		Expiry:      expiry,
+		Size:        size,
+		owners:      map[string]*list.Element{},
+		order:       list.New(),
+		fetches:     map[string]*functionFetch{},
+		now:         time.Now,
+	}
+}
+
+// Get returns the function by name for an owner, a stale value is
+// returned when list-functions cannot be reached.
+func (f *functionCache) Get(owner, functionName string) (*cachedFunction, bool) {
+	function, _ := f.Lookup(owner, functionName)
+	return function, function != nil
+}
+
+// Lookup is like Get, but gives an error when the owner's functions are
+// not known because list-functions has never been reached, so that a
+// caller enforcing a policy can deny the request.
+func (f *functionCache) Lookup(owner, functionName string) (*cachedFunction, error) {
+	functions, err := f.list(strings.ToLower(owner))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range functions {
+		if functions[i].Name == functionName {
+			return &functions[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *functionCache) list(owner string) ([]cachedFunction, error) {
+	f.lock.Lock()
+
+	element, ok := f.owners[owner]
+	var entry ownerFunctions
+	if ok {
+		entry = element.Value.(*functionCacheEntry).ownerFunctions
+		f.order.MoveToFront(element)
+
+		if f.now().Sub(entry.Fetched) < f.Expiry {
+			f.lock.Unlock()
+			return entry.Functions, entry.Err
+		}
+	}
+
+	if fetch, inProgress := f.fetches[owner]; inProgress {
+		f.lock.Unlock()
+
+		<-fetch.done
+		return fetch.functions, fetch.err
+	}
+
+	fetch := &functionFetch{done: make(chan struct{})}
+	f.fetches[owner] = fetch
+	f.lock.Unlock()
+
+	functions, err := f.fetch(owner)
+	if err != nil {
+		log.Printf("Unable to refresh functions for %s: %s", owner, err.Error())
+
+		// Back-off until the next expiry rather than retrying on each request,
+		// the error is kept until the functions have been listed once
+		functions = entry.Functions
+		if ok && entry.Err == nil {
+			err = nil
+		}
+	}
+
+	f.lock.Lock()
+	f.set(owner, ownerFunctions{Functions: functions, Fetched: f.now(), Err: err})
+	delete(f.fetches, owner)
+	f.lock.Unlock()
+
+	fetch.functions, fetch.err = functions, err
+	close(fetch.done)
+
+	return functions, err
+}
+
+// set must be called with the lock held
+func (f *functionCache) set(owner string, functions ownerFunctions) {
+	if element, ok := f.owners[owner]; ok {
+		element.Value.(*functionCacheEntry).ownerFunctions = functions
+		f.order.MoveToFront(element)
+		return
+	}
+
+	f.owners[owner] = f.order.PushFront(&functionCacheEntry{Owner: owner, ownerFunctions: functions})
+
+	for f.order.Len() > f.Size {
+		back := f.order.Back()
+		delete(f.owners, back.Value.(*functionCacheEntry).Owner)
+		f.order.Remove(back)
+	}
+}
+
+func (f *functionCache) fetch(owner string) ([]cachedFunction, error) {
+	listURL := fmt.Sprintf("%sfunction/list-functions?user=%s", f.UpstreamURL, url.QueryEscape(owner))
+
+	req, _ := http.NewRequest(http.MethodGet, listURL, nil)
+
+	res, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from list-functions: %d", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	functions := []cachedFunction{}
+	if err := json.Unmarshal(body, &functions); err != nil {
+		return nil, err
+	}
+
+	return functions, nil
+}
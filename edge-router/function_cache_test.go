@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_functionCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	calls := map[string]int{}
+	var lock sync.Mutex
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		calls[r.URL.Query().Get("user")]++
+		lock.Unlock()
+
+		bytesOut, _ := json.Marshal([]cachedFunction{{Name: r.URL.Query().Get("user") + "-fn1"}})
+		w.Write(bytesOut)
+	}))
+	defer listFunctions.Close()
+
+	cache := newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 2)
+
+	cache.Get("alexellis", "alexellis-fn1")
+	cache.Get("rgee0", "rgee0-fn1")
+	cache.Get("alexellis", "alexellis-fn1")
+	cache.Get("acme", "acme-fn1")
+
+	if _, ok := cache.Get("alexellis", "alexellis-fn1"); !ok || calls["alexellis"] != 1 {
+		t.Errorf("want alexellis kept as recently used, calls: %d", calls["alexellis"])
+	}
+	if _, ok := cache.Get("rgee0", "rgee0-fn1"); !ok || calls["rgee0"] != 2 {
+		t.Errorf("want rgee0 evicted and listed again, calls: %d", calls["rgee0"])
+	}
+}
+
+func Test_functionCache_CachesMisses(t *testing.T) {
+	tests := []struct {
+		Scenario string
+		Status   int
+		WantErr  bool
+	}{
+		{Scenario: "owner without functions", Status: http.StatusOK, WantErr: false},
+		{Scenario: "list-functions failing", Status: http.StatusInternalServerError, WantErr: true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			calls := 0
+			listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(testCase.Status)
+				w.Write([]byte("[]"))
+			}))
+			defer listFunctions.Close()
+
+			cache := newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 10)
+			now := time.Now()
+			cache.now = func() time.Time { return now }
+
+			for i := 0; i < 3; i++ {
+				function, err := cache.Lookup("alexellis", "alexellis-fn1")
+				if function != nil || (err != nil) != testCase.WantErr {
+					t.Errorf("want no function and error %t, got: %v %v", testCase.WantErr, function, err)
+				}
+			}
+			if calls != 1 {
+				t.Errorf("want list-functions called once, calls: %d", calls)
+			}
+
+			now = now.Add(time.Minute)
+			cache.Lookup("alexellis", "alexellis-fn1")
+			if calls != 2 {
+				t.Errorf("want list-functions called again after the expiry, calls: %d", calls)
+			}
+		})
+	}
+}
+
+func Test_functionCache_CoalescesFetches(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		bytesOut, _ := json.Marshal([]cachedFunction{{Name: "alexellis-fn1"}})
+		w.Write(bytesOut)
+	}))
+	defer listFunctions.Close()
+
+	cache := newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 10)
+
+	var wg sync.WaitGroup
+	found := int32(0)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := cache.Get("alexellis", "alexellis-fn1"); ok {
+				atomic.AddInt32(&found, 1)
+			}
+		}()
+	}
+
+	// Give each goroutine time to wait for the call in progress
+	time.Sleep(time.Millisecond * 100)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("want list-functions called once, calls: %d", got)
+	}
+	if found != 10 {
+		t.Errorf("want function found by every request, found: %d", found)
+	}
+}
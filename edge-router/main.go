@@ -1,19 +1,26 @@
 package main
 
 import (
-	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
 )
 
 const authHost = "auth.system"
 
+// schedulerHeader is only trusted on requests from the scheduler inside
+// the cluster so is removed from requests coming through the router
+const schedulerHeader = "X-Cloud-Scheduler"
+
 func main() {
 	cfg := NewRouterConfig()
 
@@ -32,68 +39,306 @@ func main() {
 
 	log.Printf("Timeout set to: %s\n", cfg.Timeout)
 	log.Printf("Upstream URL: %s\n", cfg.UpstreamURL)
+	if len(cfg.NamespacePrefix) > 0 {
+		log.Printf("User namespaces enabled, prefix: %s\n", cfg.NamespacePrefix)
+	}
 
 	authProxy1 := authProxy{
 		URL:    cfg.AuthURL,
 		Client: proxyClient,
 	}
 
+	// The functions of each owner are cached for private functions, canary
+	// routing, rate limits and function policies
+	functions := newFunctionCache(cfg.UpstreamURL, proxyClient, cfg.FunctionCacheExpiry, cfg.FunctionCacheSize)
+	authProxy1.Functions = functions
+
+	var canaries *canaryRouter
+	if cfg.CanaryRouting {
+		rand.Seed(time.Now().UnixNano())
+
+		log.Printf("Canary routing enabled, function cache expiry: %s\n", cfg.FunctionCacheExpiry)
+		canaries = newCanaryRouter(functions)
+	}
+
+	var limits *rateLimiter
+	if cfg.RateLimits {
+		var store limitStore = newMemoryStore()
+		if len(cfg.RateLimitRedisAddr) > 0 {
+			password := ""
+			if len(cfg.RateLimitRedisPasswordFile) > 0 {
+				data, err := ioutil.ReadFile(cfg.RateLimitRedisPasswordFile)
+				if err != nil {
+					log.Panicf("unable to read redis password: %s", err.Error())
+				}
+				password = strings.TrimSpace(string(data))
+			}
+
+			log.Printf("Rate limits shared via redis: %s\n", cfg.RateLimitRedisAddr)
+			store = newRedisStore(cfg.RateLimitRedisAddr, password, time.Second)
+		}
+
+		limits = newRateLimiter(cfg.RateLimitPath, functions, store)
+		if err := limits.Reload(); err != nil {
+			log.Panicf("unable to read rate limits: %s", err.Error())
+		}
+		limits.Start(cfg.RateLimitReloadInterval)
+
+		log.Printf("Rate limits enabled, file: %q, reload interval: %s\n", cfg.RateLimitPath, cfg.RateLimitReloadInterval)
+	}
+
+	trustedProxies, err := parseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		log.Panicf("unable to read trusted_proxies: %s", err.Error())
+	}
+
+	var policies *policyStore
+	if cfg.FunctionPolicies {
+		log.Printf("Function policies enabled, trusted proxies: %q, client IP header: %s\n", cfg.TrustedProxies, cfg.ClientIPHeader)
+		policies = newPolicyStore(functions, trustedProxies, cfg.ClientIPHeader)
+	}
+
+	log.Printf("Upgrade idle timeout: %s, max connections per owner: %d\n", cfg.UpgradeIdleTimeout, cfg.MaxUpgradeConnections)
+	upgrades := newUpgradeProxy(cfg.UpgradeIdleTimeout, cfg.Timeout, cfg.MaxUpgradeConnections)
+	upgrades.TrustedProxies = trustedProxies
+
+	var domains *domainTable
+	if cfg.CustomDomains {
+		log.Printf("Custom domains enabled, reload interval: %s\n", cfg.DomainReloadInterval)
+		domains = newDomainTable(cfg.UpstreamURL, proxyClient)
+		domains.Start(cfg.DomainReloadInterval)
+	}
+
+	var metrics *routerMetrics
+	if cfg.Metrics {
+		metrics = newRouterMetrics()
+
+		metricsRouter := http.NewServeMux()
+		metricsRouter.Handle("/metrics", metrics.Handler())
+
+		log.Printf("Serving metrics on port %s\n", cfg.MetricsPort)
+		go func() {
+			log.Fatal(http.ListenAndServe(":"+cfg.MetricsPort, metricsRouter))
+		}()
+	}
+
+	if cfg.AuthCacheTTL > 0 && cfg.AuthCacheSize > 0 {
+		log.Printf("Caching auth decisions for %s, size: %d\n", cfg.AuthCacheTTL, cfg.AuthCacheSize)
+
+		authProxy1.Cache = newAuthCache(cfg.AuthCacheTTL, cfg.AuthCacheSize)
+		authProxy1.Cache.Metrics = metrics
+	}
+
+	log.Printf("Routing mode: %s\n", cfg.RoutingMode)
+	if cfg.RoutingMode == pathRouting && len(cfg.SystemHost) == 0 {
+		log.Panicln("give a system_host as an env-var for path routing")
+	}
+
 	router := http.NewServeMux()
-	router.HandleFunc("/", makeHandler(proxyClient, cfg.Timeout, cfg.UpstreamURL, &authProxy1))
+	router.HandleFunc("/", makeHandler(proxyClient, cfg.Timeout, cfg.UpstreamURL, &authProxy1, routerOptions{
+		NamespacePrefix: cfg.NamespacePrefix,
+		Mode:            cfg.RoutingMode,
+		SystemHost:      cfg.SystemHost,
+		Canaries:        canaries,
+		Upgrades:        upgrades,
+		Domains:         domains,
+		Limits:          limits,
+		Metrics:         metrics,
+		Policies:        policies,
+		TrustedProxies:  trustedProxies,
+	}))
 	router.HandleFunc("/healthz", makeHealthzHandler())
 
 	log.Printf("Using port %s\n", cfg.Port)
 
+	// Responses are streamed, so only the headers of requests have a
+	// deadline, the timeout for the upstream is applied by makeHandler
 	s := &http.Server{
-		Addr:           ":" + cfg.Port,
-		Handler:        router,
-		ReadTimeout:    cfg.Timeout,
-		WriteTimeout:   cfg.Timeout,
-		MaxHeaderBytes: 1 << 20,
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Timeout,
+		IdleTimeout:       cfg.Timeout,
+		MaxHeaderBytes:    1 << 20,
+	}
+
+	if cfg.TLS {
+		certs := newCertStore(cfg.TLSCertPath)
+		if err := certs.Load(); err != nil {
+			log.Panicf("unable to load certificates from %s: %s", cfg.TLSCertPath, err.Error())
+		}
+		go certs.Watch(cfg.TLSReloadInterval)
+
+		var tlsHandler http.Handler = router
+		if cfg.HSTSMaxAge > 0 {
+			tlsHandler = makeHSTSHandler(router, cfg.HSTSMaxAge, cfg.HSTSIncludeSubdomains)
+		}
+
+		tlsServer := &http.Server{
+			Addr:              ":" + cfg.TLSPort,
+			Handler:           tlsHandler,
+			ReadHeaderTimeout: cfg.Timeout,
+			IdleTimeout:       cfg.Timeout,
+			MaxHeaderBytes:    1 << 20,
+			TLSConfig: &tls.Config{
+				GetCertificate: certs.GetCertificate,
+				MinVersion:     tls.VersionTLS12,
+			},
+		}
+
+		if cfg.TLSRedirect {
+			s.Handler = makeRedirectHandler(router, cfg.TLSRedirectPort)
+		}
+
+		log.Printf("Using TLS port %s, certificates: %s, redirect: %t\n", cfg.TLSPort, cfg.TLSCertPath, cfg.TLSRedirect)
+		go func() {
+			log.Fatal(tlsServer.ListenAndServeTLS("", ""))
+		}()
 	}
 
 	log.Fatal(s.ListenAndServe())
 }
 
+// routerOptions turn on the optional parts of the router, each is off
+// while it is left empty
+type routerOptions struct {
+	// NamespacePrefix invokes each owner's functions in their own
+	// namespace i.e. gateway:8080/function/alexellis-fn1.openfaas-fn-alexellis
+	NamespacePrefix string
+
+	// Mode of pathRouting reads the owner from the first part of the path
+	// instead of the sub-domain, i.e. cloud.o6s.io/alexellis/fn1
+	Mode routingMode
+
+	// SystemHost serves the system owner in pathRouting, which is the
+	// only owner served from it, i.e. system.o6s.io/system/dashboard/
+	SystemHost string
+
+	// Canaries sends a share of requests to a function's canary
+	Canaries *canaryRouter
+
+	// Upgrades tunnels requests to upgrade the connection such as
+	// WebSockets to the function
+	Upgrades *upgradeProxy
+
+	// Domains serves a custom domain such as www.example.com with the
+	// function which claimed it
+	Domains *domainTable
+
+	// Limits refuses requests over the rate limit of the owner or the
+	// function with a 429 before they are checked by auth
+	Limits *rateLimiter
+
+	// Metrics counts each request by owner, function and status code
+	Metrics *routerMetrics
+
+	// Policies enforces the IP allowlist, body size and CORS annotations
+	// of the function, and answers CORS preflights
+	Policies *policyStore
+
+	// TrustedProxies are the networks of proxies in front of the router
+	// whose X-Forwarded-Proto is passed on to the function
+	TrustedProxies []*net.IPNet
+}
+
 // makeHandler builds a router to convert sub-domains into OpenFaaS gateway URLs with
 // a username prefix and suffix of the destination function.
 // i.e. system.o6s.io/dashboard
 //      becomes: gateway:8080/function/system-dashboard, where gateway:8080
 //      is specified in upstreamURL
-func makeHandler(c *http.Client, timeout time.Duration, upstreamURL string, auth *authProxy) func(w http.ResponseWriter, r *http.Request) {
+// Bodies are streamed in both directions, timeout only applies until the
+// upstream sends the headers of its response.
+// The identity given by auth for a private function is forwarded to it,
+// and any identity sent by the client is removed.
+func makeHandler(c *http.Client, timeout time.Duration, upstreamURL string, auth *authProxy, options routerOptions) func(w http.ResponseWriter, r *http.Request) {
 
 	if strings.HasSuffix(upstreamURL, "/") == false {
 		upstreamURL = upstreamURL + "/"
 	}
 
+	namespacePrefix, mode, systemHost := options.NamespacePrefix, options.Mode, options.SystemHost
+	canaries, upgrades, domains := options.Canaries, options.Upgrades, options.Domains
+	limits, metrics, policies := options.Limits, options.Metrics, options.Policies
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Body != nil {
 			defer r.Body.Close()
 		}
 
 		var host string
+		var name, rest string
+
+		if metrics != nil {
+			started := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			w = recorder
+
+			metrics.InFlight.Inc()
+			defer func() {
+				metrics.InFlight.Dec()
+				metrics.Observe(host, name, recorder.Status, started)
+			}()
+		}
 
-		tldSepCount := 1
-		tldSep := "."
-		if len(r.Host) == 0 || strings.Count(r.Host, tldSep) <= tldSepCount {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("invalid sub-domain in Host header"))
-			return
+		var domain customDomain
+		isCustomDomain := false
+		if domains != nil {
+			domain, isCustomDomain = domains.Lookup(r.Host)
 		}
 
-		host = r.Host[0:strings.Index(r.Host, tldSep)]
-		fmt.Printf("Router host: %s (%s)\n", host, r.Host)
+		requestURI := strings.TrimLeft(r.RequestURI, "/")
+		isAuthHost := false
+		isAuthPath := false
+
+		if isCustomDomain {
+			host = domain.Owner
+			fmt.Printf("Router custom domain: %s (%s)\n", host, r.Host)
+		} else if mode == pathRouting {
+			host, requestURI = splitOwner(requestURI)
+			if len(host) == 0 {
+				host = systemOwner
+			}
+
+			// edge-auth is mounted under the system owner, its homepage
+			// is served at the root of the prefix
+			// The dashboard and edge-auth must not share an origin with
+			// the functions of users, which could otherwise read the
+			// dashboard's API and the session from the browser
+			if (host == systemOwner) != sameHost(r.Host, systemHost) && !(host == systemOwner && len(requestURI) == 0) {
+				log.Printf("Owner %s not served from host %s\n", host, r.Host)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			if authName, authRest := splitRequestURI(requestURI); host == systemOwner && authName == authFunctionName {
+				isAuthHost, isAuthPath = true, true
+				requestURI = strings.TrimLeft(authRest, "/")
+			}
+			fmt.Printf("Router path owner: %s (%s)\n", host, r.Host)
+		} else {
+			tldSepCount := 1
+			tldSep := "."
+			if len(r.Host) == 0 || strings.Count(r.Host, tldSep) <= tldSepCount {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("invalid sub-domain in Host header"))
+				return
+			}
 
-		requestURI := r.RequestURI
-		requestURI = strings.TrimLeft(requestURI, "/")
+			host = r.Host[0:strings.Index(r.Host, tldSep)]
+			isAuthHost = strings.HasPrefix(r.Host, authHost)
+			fmt.Printf("Router host: %s (%s)\n", host, r.Host)
+		}
 
-		if len(requestURI) == 0 {
-			if host == "system" {
+		if len(requestURI) == 0 && !isCustomDomain && !isAuthPath {
+			if host == systemOwner {
 				scheme := "http"
 				if r.TLS != nil {
 					scheme = "https"
 				}
-				redirectUrl, urlErr := url.Parse(fmt.Sprintf("%s://%s/dashboard/", scheme, r.Host))
+				dashboardHost, dashboardPath := r.Host, "/dashboard/"
+				if mode == pathRouting {
+					dashboardHost, dashboardPath = systemHost, "/"+systemOwner+dashboardPath
+				}
+				redirectUrl, urlErr := url.Parse(fmt.Sprintf("%s://%s%s", scheme, dashboardHost, dashboardPath))
 
 				if urlErr != nil {
 					http.Error(w, urlErr.Error(), http.StatusInternalServerError)
@@ -111,8 +356,23 @@ func makeHandler(c *http.Client, timeout time.Duration, upstreamURL string, auth
 
 		var upstreamFullURL *url.URL
 
-		isAuthHost := strings.HasPrefix(r.Host, authHost)
+		r.Header.Del(forwardedPrefixHeader)
+		if isAuthPath {
+			r.Header.Set(forwardedPrefixHeader, authPathPrefix)
+		}
+
+		if auth != nil && isLogout(r) {
+			auth.Forget(r)
+		}
+
 		if isAuthHost {
+			host, name = authSystemOwner, authFunction
+
+			if isAuthQuery(requestURI) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
 			var err error
 			upstreamFullURL, err = url.Parse(fmt.Sprintf("%s%s", auth.URL, requestURI))
 			if err != nil {
@@ -121,13 +381,91 @@ func makeHandler(c *http.Client, timeout time.Duration, upstreamURL string, auth
 				log.Printf("Auth URL transparent %s\n", upstreamFullURL.String())
 			}
 		} else {
-			upstreamFullURL, _ = url.Parse(fmt.Sprintf("%sfunction/%s-%s", upstreamURL, host, requestURI))
+			// A custom domain serves a single function from its root
+			if isCustomDomain {
+				name, rest = domain.Name(), "/"+requestURI
+			} else {
+				name, rest = splitRequestURI(requestURI)
+			}
+			functionName := sdk.FunctionRef(host+"-"+name, functionNamespace(namespacePrefix, host))
+			upstreamFullURL, _ = url.Parse(fmt.Sprintf("%sfunction/%s%s", upstreamURL, functionName, rest))
+		}
+
+		var policy functionPolicy
+		var body *limitedBody
+		// The functions of the system owner are not listed and have no policies
+		if policies != nil && !isAuthHost && host != systemOwner {
+			var policyErr error
+			policy, policyErr = policies.Get(host, name)
+			if policyErr == errPolicyNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Function not found"))
+				return
+			} else if policyErr != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(policyErr.Error()))
+				return
+			}
+
+			if !policies.Allowed(policy, r) {
+				log.Printf("Client IP not allowed: %s-%s\n", host, name)
+
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte("Forbidden"))
+				return
+			}
+
+			if policy.CORS != nil && isPreflight(r) {
+				policy.CORS.servePreflight(w, r)
+				return
+			}
+
+			if policy.MaxBodyBytes > 0 {
+				if r.ContentLength > policy.MaxBodyBytes {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					w.Write([]byte("Request body too large"))
+					return
+				}
+
+				// The length of a chunked body is only known once it is read
+				if r.ContentLength < 0 && r.Body != nil {
+					body = &limitedBody{ReadCloser: r.Body, Remaining: policy.MaxBodyBytes}
+					r.Body = body
+				}
+			}
+		}
+
+		if limits != nil && !isAuthHost {
+			if allowed, wait := limits.Allow(host, name); !allowed {
+				log.Printf("Rate limited: %s-%s\n", host, name)
+
+				w.Header().Set("Retry-After", retryAfter(wait))
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte("Too many requests"))
+				return
+			}
 		}
 
+		var identity http.Header
 		if auth != nil && !isAuthHost {
-			authStatus, location := auth.Validate(upstreamFullURL.Path, r)
+			// The session cookie is not sent to a custom domain, nor to the
+			// shared host of path routing, so edge-auth refuses private
+			// functions on either
+			validateDomain := ""
+			if isCustomDomain {
+				validateDomain = domain.Domain
+			} else if mode == pathRouting && host != systemOwner {
+				validateDomain = hostname(r.Host)
+			}
+
+			decision := auth.Validate(upstreamFullURL.Path, validateDomain, host, name, r)
+			authStatus, location := decision.Status, decision.Location
 			fmt.Println(authStatus, location)
 
+			if metrics != nil {
+				metrics.AuthDecisions.WithLabelValues(authOutcome(authStatus)).Inc()
+			}
+
 			responseWritten := false
 			switch authStatus {
 			case http.StatusUnauthorized:
@@ -141,7 +479,11 @@ func makeHandler(c *http.Client, timeout time.Duration, upstreamURL string, auth
 				directTo, _ := url.Parse(location)
 				q := directTo.Query()
 
-				returnTo := "http://" + r.Host + "" + r.RequestURI
+				scheme := "http://"
+				if r.TLS != nil {
+					scheme = "https://"
+				}
+				returnTo := scheme + r.Host + "" + r.RequestURI
 
 				redirectURI, _ := url.Parse(q.Get("redirect_uri"))
 				log.Printf(`Redirect URL: "%s"\n`, redirectURI)
@@ -167,8 +509,14 @@ func makeHandler(c *http.Client, timeout time.Duration, upstreamURL string, auth
 				w.Write([]byte("bad gateway reaching auth server"))
 				responseWritten = true
 				break
+			case http.StatusServiceUnavailable:
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("unable to find whether the function is private"))
+				responseWritten = true
+				break
 			case http.StatusOK:
 				log.Printf("Auth cleared. OK.\n")
+				identity = decision.Identity
 				break
 			}
 
@@ -177,34 +525,63 @@ func makeHandler(c *http.Client, timeout time.Duration, upstreamURL string, auth
 			}
 		}
 
-		req, _ := http.NewRequest(r.Method, upstreamFullURL.String(), r.Body)
+		if canaries != nil && !isAuthHost {
+			functionName := host + "-" + name
 
-		timeoutContext, cancel := context.WithTimeout(context.Background(), timeout)
-		defer cancel()
+			if routed := canaries.Route(host, functionName); routed != functionName {
+				routedName := sdk.FunctionRef(routed, functionNamespace(namespacePrefix, host))
+				upstreamFullURL, _ = url.Parse(fmt.Sprintf("%sfunction/%s%s", upstreamURL, routedName, rest))
+				log.Printf("Routing to canary: %s\n", routed)
+			}
+		}
+
+		r.Header.Del(schedulerHeader)
+		forwardIdentity(r, identity)
+
+		if mode == pathRouting && !isAuthHost && host != systemOwner {
+			removeCookie(r, sessionCookie)
+		}
 
-		copyHeaders(req.Header, &r.Header)
+		if upgrades != nil && !isAuthHost && isUpgradeRequest(r) {
+			log.Printf("Upgrading to %s: %s\n", r.Header.Get("Upgrade"), upstreamFullURL.String())
+			upgrades.Serve(w, r, upstreamFullURL, host)
+			return
+		}
 
-		log.Printf("Serving: %s\n", req.URL.String())
+		log.Printf("Serving: %s\n", upstreamFullURL.String())
+
+		res, cancel, resErr := doUpstream(c, r, upstreamFullURL.String(), timeout, options.TrustedProxies)
+		if resErr != nil && body != nil && body.Exceeded {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte("Request body too large"))
+			return
+		}
 
-		res, resErr := c.Do(req.WithContext(timeoutContext))
 		if resErr != nil {
+			if metrics != nil {
+				metrics.UpstreamError(host, name)
+			}
+
 			w.WriteHeader(http.StatusServiceUnavailable)
 			w.Write([]byte(resErr.Error()))
 
 			fmt.Printf("Upstream %s status: %d\n", upstreamFullURL, http.StatusBadGateway)
 			return
 		}
+		defer cancel()
+		defer res.Body.Close()
 
 		copyHeaders(w.Header(), &res.Header)
+		removeHopHeaders(w.Header())
+		if policy.CORS != nil {
+			policy.CORS.setHeaders(w.Header(), r.Header.Get("Origin"))
+		}
 		fmt.Printf("Upstream %s status: %d\n", upstreamFullURL, res.StatusCode)
 
 		w.WriteHeader(res.StatusCode)
 
-		if res.Body != nil {
-			defer res.Body.Close()
-
-			bytesOut, _ := ioutil.ReadAll(res.Body)
-			w.Write(bytesOut)
+		if err := copyResponse(w, res.Body); err != nil {
+			log.Printf("Upstream %s body error: %s\n", upstreamFullURL, err.Error())
 		}
 	}
 }
@@ -4,19 +4,40 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 	"testing"
 	"time"
 )
 
 type gateway struct {
 	RequestURI string
+	Header     http.Header
+
+	lock sync.Mutex
 }
 
 func (h *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
 	h.RequestURI = r.URL.String()
+	h.Header = r.Header
+	h.lock.Unlock()
 	w.Write([]byte("\n"))
 }
 
+// requestURI is read with the lock held for tests in which the gateway
+// may still be called after the router has responded
+func (h *gateway) requestURI() string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.RequestURI
+}
+
+func (h *gateway) reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.RequestURI = ""
+}
+
 type passHandler struct {
 	Next http.HandlerFunc
 }
@@ -67,7 +88,7 @@ func Test_makeHandler(t *testing.T) {
 	}
 
 	router := httptest.NewServer(passHandler{
-		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil),
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{}),
 	})
 
 	defer router.Close()
@@ -102,3 +123,28 @@ func Test_makeHandler(t *testing.T) {
 		})
 	}
 }
+
+func Test_makeHandler_RemovesSchedulerHeader(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{}),
+	})
+	defer router.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, router.URL+"/cron", nil)
+	req.Host = "alexellis.example.xyz"
+	req.Header.Set(schedulerHeader, "1")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got := gatewayHandler.Header.Get(schedulerHeader); len(got) > 0 {
+		t.Errorf("want %s removed, got: %s", schedulerHeader, got)
+	}
+}
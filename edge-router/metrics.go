@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// authSystemOwner and authFunction label requests for the auth host,
+// which are sent to edge-auth rather than to a function
+const (
+	authSystemOwner = "system"
+	authFunction    = "edge-auth"
+)
+
+// maxMetricSeries caps the owner and function pairs counted, further
+// pairs are counted as "other" so that requests for made-up functions
+// cannot grow the metrics without bound
+const maxMetricSeries = 10000
+
+// durationBuckets are the upper bounds in seconds of the buckets
+// of a histogram of request durations
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// routerMetrics are served for Prometheus on the metrics port
+type routerMetrics struct {
+	Registry *prometheus.Registry
+
+	Requests       *prometheus.CounterVec
+	Duration       *prometheus.HistogramVec
+	InFlight       prometheus.Gauge
+	UpstreamErrors *prometheus.CounterVec
+	AuthDecisions  *prometheus.CounterVec
+
+	AuthCache          *prometheus.CounterVec
+	AuthCacheEntries   prometheus.Gauge
+	AuthCacheEvictions prometheus.Counter
+
+	functions *seriesLimit
+}
+
+func newRouterMetrics() *routerMetrics {
+	m := &routerMetrics{
+		Registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "edge_router_requests_total",
+			Help: "Requests served by owner, function and status code.",
+		}, []string{"owner", "function", "code"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "edge_router_request_duration_seconds",
+			Help:    "Time to serve requests by owner, function and status code.",
+			Buckets: durationBuckets,
+		}, []string{"owner", "function", "code"}),
+		InFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "edge_router_requests_in_flight",
+			Help: "Requests being served.",
+		}),
+		UpstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "edge_router_upstream_errors_total",
+			Help: "Requests which could not be sent to the gateway by owner and function.",
+		}, []string{"owner", "function"}),
+		AuthDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "edge_router_auth_decisions_total",
+			Help: "Decisions from edge-auth by outcome: ok, redirect, unauthorized or bad_gateway.",
+		}, []string{"outcome"}),
+		AuthCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "edge_router_auth_cache_requests_total",
+			Help: "Lookups of cached auth decisions by result: hit or miss.",
+		}, []string{"result"}),
+		AuthCacheEntries: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "edge_router_auth_cache_entries",
+			Help: "Auth decisions held in the cache.",
+		}),
+		AuthCacheEvictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "edge_router_auth_cache_evictions_total",
+			Help: "Auth decisions evicted to keep the cache within its size.",
+		}),
+		functions: newSeriesLimit(maxMetricSeries),
+	}
+
+	m.Registry.MustRegister(m.Requests, m.Duration, m.InFlight, m.UpstreamErrors, m.AuthDecisions,
+		m.AuthCache, m.AuthCacheEntries, m.AuthCacheEvictions)
+
+	return m
+}
+
+// Handler serves the metrics for Prometheus to scrape
+func (m *routerMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// authOutcome names the decision of edge-auth for a status code
+func authOutcome(status int) string {
+	switch status {
+	case http.StatusOK:
+		return "ok"
+	case http.StatusTemporaryRedirect:
+		return "redirect"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusBadGateway:
+		return "bad_gateway"
+	}
+	return strconv.Itoa(status)
+}
+
+// statusRecorder keeps the status code written to the client, it can
+// still be flushed for streaming and hijacked for upgrades
+type statusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.Status == 0 {
+		s.Status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.Status == 0 {
+		s.Status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer cannot be hijacked")
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err == nil && s.Status == 0 {
+		s.Status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
+// Observe records a request once it has been served
+func (m *routerMetrics) Observe(owner, function string, status int, started time.Time) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	code := strconv.Itoa(status)
+
+	owner, function = m.functions.Labels(owner, function)
+	m.Requests.WithLabelValues(owner, function, code).Inc()
+	m.Duration.WithLabelValues(owner, function, code).Observe(time.Since(started).Seconds())
+}
+
+// UpstreamError records a request which could not be sent to the gateway
+func (m *routerMetrics) UpstreamError(owner, function string) {
+	owner, function = m.functions.Labels(owner, function)
+	m.UpstreamErrors.WithLabelValues(owner, function).Inc()
+}
+
+// seriesLimit keeps the owner and function pairs seen up to its size
+type seriesLimit struct {
+	Size int
+
+	lock sync.Mutex
+	seen map[string]bool
+}
+
+func newSeriesLimit(size int) *seriesLimit {
+	return &seriesLimit{Size: size, seen: map[string]bool{}}
+}
+
+// Labels gives the owner and function to count a request under, which
+// are "other" once Size pairs have been seen
+func (s *seriesLimit) Labels(owner, function string) (string, string) {
+	key := owner + "/" + function
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.seen[key] {
+		if len(s.seen) >= s.Size {
+			return "other", "other"
+		}
+		s.seen[key] = true
+	}
+	return owner, function
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, metrics *routerMetrics) string {
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	return rr.Body.String()
+}
+
+func Test_makeHandler_Metrics(t *testing.T) {
+	gateway := httptest.NewServer(&gateway{})
+	defer gateway.Close()
+
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Query().Get("r"), "/function/alexellis-private") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	metrics := newRouterMetrics()
+	auth := &authProxy{URL: authServer.URL + "/", Client: http.DefaultClient}
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, auth, routerOptions{Metrics: metrics}),
+	})
+	defer router.Close()
+
+	for _, path := range []string{"/blog", "/blog/posts", "/private"} {
+		req, _ := http.NewRequest(http.MethodGet, router.URL+path, nil)
+		req.Host = "alexellis.example.xyz"
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	got := scrape(t, metrics)
+
+	for _, want := range []string{
+		`edge_router_requests_total{code="200",function="blog",owner="alexellis"} 2`,
+		`edge_router_requests_total{code="401",function="private",owner="alexellis"} 1`,
+		`edge_router_request_duration_seconds_count{code="200",function="blog",owner="alexellis"} 2`,
+		`edge_router_auth_decisions_total{outcome="ok"} 2`,
+		`edge_router_auth_decisions_total{outcome="unauthorized"} 1`,
+		`edge_router_requests_in_flight 0`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("want metric: %s, got:\n%s", want, got)
+		}
+	}
+}
+
+func Test_makeHandler_MetricsUpstreamError(t *testing.T) {
+	metrics := newRouterMetrics()
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, "http://127.0.0.1:1", nil, routerOptions{Metrics: metrics}),
+	})
+	defer router.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, router.URL+"/blog", nil)
+	req.Host = "alexellis.example.xyz"
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	got := scrape(t, metrics)
+
+	for _, want := range []string{
+		`edge_router_upstream_errors_total{function="blog",owner="alexellis"} 1`,
+		`edge_router_requests_total{code="503",function="blog",owner="alexellis"} 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("want metric: %s, got:\n%s", want, got)
+		}
+	}
+}
+
+func Test_makeHandler_MetricsUpgrade(t *testing.T) {
+	gateway := httptest.NewServer(&echoUpgrade{})
+	defer gateway.Close()
+
+	metrics := newRouterMetrics()
+	upgrades := newUpgradeProxy(time.Second*5, time.Second*5, 10)
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*5, gateway.URL, nil, routerOptions{Upgrades: upgrades, Metrics: metrics}),
+	})
+	defer router.Close()
+
+	conn, _, res := dialUpgrade(t, router.URL, "echo")
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status want: %d, got: %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	if got := scrape(t, metrics); !strings.Contains(got, "edge_router_requests_in_flight 1\n") {
+		t.Errorf("want the open tunnel counted as in flight, got:\n%s", got)
+	}
+
+	conn.Close()
+
+	want := `edge_router_requests_total{code="101",function="chat",owner="alexellis"} 1`
+	for i := 0; i < 50; i++ {
+		if strings.Contains(scrape(t, metrics), want+"\n") {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Errorf("want metric: %s, got:\n%s", want, scrape(t, metrics))
+}
+
+func Test_authOutcome(t *testing.T) {
+	tests := map[int]string{
+		http.StatusOK:                  "ok",
+		http.StatusTemporaryRedirect:   "redirect",
+		http.StatusUnauthorized:        "unauthorized",
+		http.StatusBadGateway:          "bad_gateway",
+		http.StatusInternalServerError: "500",
+	}
+
+	for status, want := range tests {
+		if got := authOutcome(status); got != want {
+			t.Errorf("%d: want %s, got %s", status, want, got)
+		}
+	}
+}
+
+func Test_seriesLimit(t *testing.T) {
+	limit := newSeriesLimit(2)
+
+	tests := []struct {
+		Owner    string
+		Function string
+		Want     string
+	}{
+		{"alexellis", "blog", "alexellis/blog"},
+		{"alexellis", "chat", "alexellis/chat"},
+		{"alexellis", "made-up", "other/other"},
+		{"alexellis", "blog", "alexellis/blog"},
+	}
+
+	for _, testCase := range tests {
+		owner, function := limit.Labels(testCase.Owner, testCase.Function)
+		if got := owner + "/" + function; got != testCase.Want {
+			t.Errorf("%s/%s: want %s, got %s", testCase.Owner, testCase.Function, testCase.Want, got)
+		}
+	}
+}
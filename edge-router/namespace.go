@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// systemOwner's functions are always deployed to the default namespace
+const systemOwner = "system"
+
+// functionNamespace gives the namespace of an owner's functions when
+// user namespaces are enabled with prefix, named as by buildshiprun
+func functionNamespace(prefix, owner string) string {
+	if len(prefix) == 0 || owner == systemOwner {
+		return ""
+	}
+
+	return sdk.FormatNamespace(prefix, owner)
+}
+
+// splitRequestURI separates the function name from the rest of a
+// request URI of the form name/path?query
+func splitRequestURI(requestURI string) (string, string) {
+	if i := strings.IndexAny(requestURI, "/?"); i > -1 {
+		return requestURI[:i], requestURI[i:]
+	}
+	return requestURI, ""
+}
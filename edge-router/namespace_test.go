@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_functionNamespace(t *testing.T) {
+	tests := []struct {
+		title  string
+		prefix string
+		owner  string
+		want   string
+	}{
+		{"disabled", "", "alexellis", ""},
+		{"owner namespace", "openfaas-fn-", "alexellis", "openfaas-fn-alexellis"},
+		{"lower-cased and sanitised", "openfaas-fn-", "Alex_Ellis", "openfaas-fn-alex-ellis"},
+		{"system functions use the default", "openfaas-fn-", "system", ""},
+		{"truncated", "openfaas-fn-", "a-very-long-owner-name-which-goes-over-the-limit-for-a-namespace", "openfaas-fn-a-very-long-owner-name-which-goes-over-the-limit-fo"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			got := functionNamespace(test.prefix, test.owner)
+			if got != test.want {
+				t.Errorf("want: %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_splitRequestURI(t *testing.T) {
+	tests := []struct {
+		requestURI string
+		name       string
+		rest       string
+	}{
+		{"fn1", "fn1", ""},
+		{"fn1/path", "fn1", "/path"},
+		{"fn1?q=1", "fn1", "?q=1"},
+		{"function/fn1", "function", "/fn1"},
+	}
+
+	for _, test := range tests {
+		name, rest := splitRequestURI(test.requestURI)
+		if name != test.name || rest != test.rest {
+			t.Errorf("%s want: %q %q, got: %q %q", test.requestURI, test.name, test.rest, name, rest)
+		}
+	}
+}
+
+func Test_makeHandler_UserNamespaces(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{NamespacePrefix: "openfaas-fn-"}),
+	})
+	defer router.Close()
+
+	tests := []struct {
+		host        string
+		path        string
+		upstreamURL string
+	}{
+		{"alexellis.example.xyz", "/fn1/path", "/function/alexellis-fn1.openfaas-fn-alexellis/path"},
+		{"system.example.xyz", "/dashboard", "/function/system-dashboard"},
+	}
+
+	for _, test := range tests {
+		gatewayHandler.RequestURI = ""
+
+		req, _ := http.NewRequest(http.MethodGet, router.URL+test.path, nil)
+		req.Host = test.host
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if gatewayHandler.RequestURI != test.upstreamURL {
+			t.Errorf("RequestURI want: %s, got: %s", test.upstreamURL, gatewayHandler.RequestURI)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// routingMode is how the owner of a function is read from a request
+type routingMode string
+
+const (
+	// subdomainRouting reads the owner from the sub-domain, i.e.
+	// alexellis.example.com/fn1
+	subdomainRouting routingMode = "subdomain"
+
+	// pathRouting reads the owner from the first part of the path so
+	// that a single host and certificate serve every owner, i.e.
+	// cloud.example.com/alexellis/fn1
+	pathRouting routingMode = "path"
+)
+
+// authFunctionName is reserved under the system owner in path routing,
+// where edge-auth is mounted at authPathPrefix instead of the auth.system
+// sub-domain
+const (
+	authFunctionName = "auth"
+	authPathPrefix   = "/" + systemOwner + "/" + authFunctionName
+)
+
+// forwardedPrefixHeader tells edge-auth the path it is mounted at so
+// that its own links and redirects keep the prefix
+const forwardedPrefixHeader = "X-Forwarded-Prefix"
+
+func parseRoutingMode(val string) routingMode {
+	if routingMode(val) == pathRouting {
+		return pathRouting
+	}
+	return subdomainRouting
+}
+
+// splitOwner separates the owner from a request URI of the form
+// owner/name/path?query, the rest has no leading slash. A query without
+// a function name is dropped.
+func splitOwner(requestURI string) (string, string) {
+	i := strings.IndexAny(requestURI, "/?")
+	if i == -1 {
+		return requestURI, ""
+	}
+
+	owner, rest := requestURI[:i], requestURI[i:]
+	if strings.HasPrefix(rest, "?") {
+		return owner, ""
+	}
+	return owner, strings.TrimLeft(rest, "/")
+}
+
+// hostname gives the host of a Host header without its port
+func hostname(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// sameHost is true when a Host header is for systemHost, which may
+// include a port
+func sameHost(host, systemHost string) bool {
+	return len(systemHost) > 0 && hostname(host) == hostname(systemHost)
+}
+
+// removeCookie drops a cookie from a request. In path routing every
+// function shares the host of the session cookie, so it would otherwise
+// be sent to each user's functions.
+func removeCookie(r *http.Request, name string) {
+	if _, err := r.Cookie(name); err != nil {
+		return
+	}
+
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			r.AddCookie(cookie)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_splitOwner(t *testing.T) {
+	tests := []struct {
+		RequestURI string
+		Owner      string
+		Rest       string
+	}{
+		{"alexellis/fn1/path?q=1", "alexellis", "fn1/path?q=1"},
+		{"alexellis//fn1", "alexellis", "fn1"},
+		{"alexellis/", "alexellis", ""},
+		{"alexellis", "alexellis", ""},
+		{"alexellis?q=1", "alexellis", ""},
+		{"", "", ""},
+	}
+
+	for _, testCase := range tests {
+		owner, rest := splitOwner(testCase.RequestURI)
+		if owner != testCase.Owner || rest != testCase.Rest {
+			t.Errorf("%s: want %q %q, got %q %q", testCase.RequestURI, testCase.Owner, testCase.Rest, owner, rest)
+		}
+	}
+}
+
+func Test_parseRoutingMode(t *testing.T) {
+	tests := []struct {
+		Value string
+		Want  routingMode
+	}{
+		{"path", pathRouting},
+		{"subdomain", subdomainRouting},
+		{"", subdomainRouting},
+		{"unknown", subdomainRouting},
+	}
+
+	for _, testCase := range tests {
+		if got := parseRoutingMode(testCase.Value); got != testCase.Want {
+			t.Errorf("%q: want %s, got %s", testCase.Value, testCase.Want, got)
+		}
+	}
+}
+
+func Test_makeHandler_PathRouting(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	http.DefaultClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	tests := []struct {
+		Scenario           string
+		Host               string
+		Path               string
+		UpstreamURL        string
+		Location           string
+		ExpectedStatusCode int
+	}{
+		{
+			Scenario:           "owner and function from the path",
+			Host:               "cloud.example.xyz",
+			Path:               "/alexellis/fn1/path?q=1",
+			UpstreamURL:        "/function/alexellis-fn1/path?q=1",
+			ExpectedStatusCode: http.StatusOK,
+		},
+		{
+			Scenario:           "dashboard under the system owner",
+			Host:               "system.example.xyz",
+			Path:               "/system/dashboard/",
+			UpstreamURL:        "/function/system-dashboard/",
+			ExpectedStatusCode: http.StatusOK,
+		},
+		{
+			Scenario:           "root redirects to the dashboard",
+			Host:               "cloud.example.xyz",
+			Path:               "/",
+			Location:           "http://system.example.xyz/system/dashboard/",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+		},
+		{
+			Scenario:           "system owner redirects to the dashboard",
+			Host:               "system.example.xyz:8080",
+			Path:               "/system",
+			Location:           "http://system.example.xyz/system/dashboard/",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+		},
+		{
+			Scenario:           "owner without a function",
+			Host:               "cloud.example.xyz",
+			Path:               "/alexellis/",
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Scenario:           "dashboard is not served with the functions of users",
+			Host:               "cloud.example.xyz",
+			Path:               "/system/dashboard/api/list-functions",
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Scenario:           "functions of users are not served with the dashboard",
+			Host:               "system.example.xyz",
+			Path:               "/alexellis/fn1",
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{Mode: pathRouting, SystemHost: "system.example.xyz"}),
+	})
+	defer router.Close()
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			gatewayHandler.RequestURI = ""
+
+			req, _ := http.NewRequest(http.MethodGet, router.URL+testCase.Path, nil)
+			req.Host = testCase.Host
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != testCase.ExpectedStatusCode {
+				t.Errorf("status want: %d, got: %d", testCase.ExpectedStatusCode, res.StatusCode)
+			}
+			if gatewayHandler.RequestURI != testCase.UpstreamURL {
+				t.Errorf("RequestURI want: %s, got: %s", testCase.UpstreamURL, gatewayHandler.RequestURI)
+			}
+			if got := res.Header.Get("Location"); got != testCase.Location {
+				t.Errorf("Location want: %s, got: %s", testCase.Location, got)
+			}
+		})
+	}
+}
+
+func Test_makeHandler_PathRoutingRefusesPrivateFunctions(t *testing.T) {
+	gateway := httptest.NewServer(&gateway{})
+	defer gateway.Close()
+
+	var domain string
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain = r.URL.Query().Get("domain")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authServer.Close()
+
+	auth := &authProxy{URL: authServer.URL + "/", Client: http.DefaultClient}
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, auth, routerOptions{Mode: pathRouting, SystemHost: "system.example.xyz"}),
+	})
+	defer router.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, router.URL+"/alexellis/fn1", nil)
+	req.Host = "cloud.example.xyz:8080"
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	// edge-auth refuses private functions on a domain the session cookie is not sent to
+	if domain != "cloud.example.xyz" {
+		t.Errorf("want the shared host given to edge-auth as the domain, got: %q", domain)
+	}
+}
+
+func Test_makeHandler_PathRoutingServesAuth(t *testing.T) {
+	authHandler := &gateway{}
+	authServer := httptest.NewServer(authHandler)
+	defer authServer.Close()
+
+	gateway := httptest.NewServer(&gateway{})
+	defer gateway.Close()
+
+	auth := &authProxy{URL: authServer.URL + "/", Client: http.DefaultClient}
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, auth, routerOptions{Mode: pathRouting, SystemHost: "system.example.xyz"}),
+	})
+	defer router.Close()
+
+	tests := []struct {
+		Path        string
+		UpstreamURL string
+	}{
+		{"/system/auth/login/?r=/system/dashboard/", "/login/?r=/system/dashboard/"},
+		{"/system/auth", "/"},
+	}
+
+	for _, testCase := range tests {
+		authHandler.RequestURI = ""
+
+		req, _ := http.NewRequest(http.MethodGet, router.URL+testCase.Path, nil)
+		req.Host = "system.example.xyz"
+		req.Header.Set(forwardedPrefixHeader, "/evil")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if authHandler.RequestURI != testCase.UpstreamURL {
+			t.Errorf("%s: auth RequestURI want: %s, got: %s", testCase.Path, testCase.UpstreamURL, authHandler.RequestURI)
+		}
+		if got := authHandler.Header.Get(forwardedPrefixHeader); got != authPathPrefix {
+			t.Errorf("%s: %s want: %s, got: %s", testCase.Path, forwardedPrefixHeader, authPathPrefix, got)
+		}
+	}
+}
+
+func Test_makeHandler_PathRoutingRemovesSessionCookie(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{Mode: pathRouting, SystemHost: "system.example.xyz"}),
+	})
+	defer router.Close()
+
+	tests := []struct {
+		Host        string
+		Path        string
+		WantSession bool
+	}{
+		{"cloud.example.xyz", "/alexellis/fn1", false},
+		{"system.example.xyz", "/system/dashboard/", true},
+	}
+
+	for _, testCase := range tests {
+		req, _ := http.NewRequest(http.MethodGet, router.URL+testCase.Path, nil)
+		req.Host = testCase.Host
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: "token"})
+		req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		forwarded := &http.Request{Header: gatewayHandler.Header}
+		if _, err := forwarded.Cookie(sessionCookie); (err == nil) != testCase.WantSession {
+			t.Errorf("%s: want session cookie sent: %t", testCase.Path, testCase.WantSession)
+		}
+		if _, err := forwarded.Cookie("theme"); err != nil {
+			t.Errorf("%s: want other cookies kept", testCase.Path)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	corsOriginsAnnotation     = "com.openfaas.cloud.cors.origins"
+	corsMethodsAnnotation     = "com.openfaas.cloud.cors.methods"
+	corsHeadersAnnotation     = "com.openfaas.cloud.cors.headers"
+	corsCredentialsAnnotation = "com.openfaas.cloud.cors.credentials"
+	corsMaxAgeAnnotation      = "com.openfaas.cloud.cors.max-age"
+	ipAllowAnnotation         = "com.openfaas.cloud.ip-allow"
+	maxBodyBytesAnnotation    = "com.openfaas.cloud.max-body-bytes"
+)
+
+// defaultCORSMethods are allowed in a preflight when the function does
+// not list its own methods
+const defaultCORSMethods = "GET, HEAD, POST"
+
+// corsPolicy is read from the cors.* annotations of a function
+type corsPolicy struct {
+	Origins     []string
+	Methods     string
+	Headers     string
+	Credentials bool
+	MaxAge      int
+}
+
+// functionPolicy is what the router enforces for a function before a
+// request is sent to the gateway
+type functionPolicy struct {
+	// CORS is nil unless the function allows cross-origin requests
+	CORS *corsPolicy
+
+	// IPAllow is nil unless the function is restricted to some
+	// networks, a list with no valid entries refuses every client
+	IPAllow []*net.IPNet
+
+	// MaxBodyBytes is 0 unless the function limits its request bodies
+	MaxBodyBytes int64
+}
+
+// parseFunctionPolicy reads the policy annotations of a function, invalid
+// values are logged and ignored apart from ip-allow which fails closed. A
+// wildcard origin with credentials would let any site call the function
+// as the user, so no cross-origin requests are allowed for it.
+func parseFunctionPolicy(functionName string, annotations map[string]string) functionPolicy {
+	policy := functionPolicy{}
+
+	origins := splitList(annotations[corsOriginsAnnotation])
+	credentials := annotations[corsCredentialsAnnotation] == "true"
+	if credentials && containsString(origins, "*") {
+		log.Printf("Ignoring CORS for %s: origin * is not allowed with credentials\n", functionName)
+		origins = nil
+	}
+
+	if len(origins) > 0 {
+		policy.CORS = &corsPolicy{
+			Origins:     origins,
+			Methods:     strings.Join(splitList(annotations[corsMethodsAnnotation]), ", "),
+			Headers:     strings.Join(splitList(annotations[corsHeadersAnnotation]), ", "),
+			Credentials: credentials,
+		}
+
+		if value, ok := annotations[corsMaxAgeAnnotation]; ok {
+			if maxAge, err := strconv.Atoi(value); err == nil && maxAge >= 0 {
+				policy.CORS.MaxAge = maxAge
+			} else {
+				log.Printf("Ignoring CORS max-age for %s: %q\n", functionName, value)
+			}
+		}
+	}
+
+	if value, ok := annotations[ipAllowAnnotation]; ok {
+		networks, err := parseNetworks(value)
+		if err != nil {
+			log.Printf("Invalid IP allowlist for %s: %s\n", functionName, err.Error())
+		}
+		policy.IPAllow = networks
+		if policy.IPAllow == nil {
+			policy.IPAllow = []*net.IPNet{}
+		}
+	}
+
+	if value, ok := annotations[maxBodyBytesAnnotation]; ok {
+		if maxBytes, err := strconv.ParseInt(value, 10, 64); err == nil && maxBytes > 0 {
+			policy.MaxBodyBytes = maxBytes
+		} else {
+			log.Printf("Ignoring max-body-bytes for %s: %q\n", functionName, value)
+		}
+	}
+
+	return policy
+}
+
+// splitList reads a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); len(part) > 0 {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks reads a comma-separated list of CIDRs and IP addresses,
+// an address is read as a network of one. Valid entries are returned
+// along with an error for the first invalid one.
+func parseNetworks(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	var firstErr error
+
+	for _, entry := range splitList(value) {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				if firstErr == nil {
+					firstErr = errors.New("invalid IP address: " + entry)
+				}
+				continue
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, firstErr
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP gives the address connecting to the router
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// policyStore reads the policies of functions from the function cache
+type policyStore struct {
+	Functions *functionCache
+
+	// TrustedProxies are the networks of proxies in front of the router,
+	// such as an IngressController, whose ClientIPHeader is believed
+	TrustedProxies []*net.IPNet
+	ClientIPHeader string
+}
+
+func newPolicyStore(functions *functionCache, trustedProxies []*net.IPNet, clientIPHeader string) *policyStore {
+	return &policyStore{
+		Functions:      functions,
+		TrustedProxies: trustedProxies,
+		ClientIPHeader: clientIPHeader,
+	}
+}
+
+var (
+	errPolicyUnknown  = errors.New("unable to find the policy of the function")
+	errPolicyNotFound = errors.New("function not found")
+)
+
+// Get gives the policy of a function. An error is given when the function
+// is not listed, or when list-functions cannot be reached, so that the
+// request is denied rather than sent without its policy.
+func (p *policyStore) Get(owner, name string) (functionPolicy, error) {
+	owner = strings.ToLower(owner)
+	functionName := owner + "-" + strings.ToLower(name)
+
+	function, err := p.Functions.Lookup(owner, functionName)
+	if err != nil {
+		log.Printf("Unable to find the policy of %s: %s\n", functionName, err.Error())
+		return functionPolicy{}, errPolicyUnknown
+	}
+	if function == nil {
+		return functionPolicy{}, errPolicyNotFound
+	}
+
+	return parseFunctionPolicy(functionName, function.Annotations), nil
+}
+
+// ClientIP gives the address of the client. The ClientIPHeader is only
+// read when the request comes from a trusted proxy, then the addresses
+// are walked from the right, skipping trusted proxies, so that a client
+// cannot choose its address by sending the header itself.
+func (p *policyStore) ClientIP(r *http.Request) net.IP {
+	ip := remoteIP(r)
+	if ip == nil || len(p.ClientIPHeader) == 0 || !containsIP(p.TrustedProxies, ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header[http.CanonicalHeaderKey(p.ClientIPHeader)], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+		if !containsIP(p.TrustedProxies, hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// Allowed is true when the client may invoke the function
+func (p *policyStore) Allowed(policy functionPolicy, r *http.Request) bool {
+	if policy.IPAllow == nil {
+		return true
+	}
+
+	ip := p.ClientIP(r)
+	return ip != nil && containsIP(policy.IPAllow, ip)
+}
+
+// isPreflight is true for the OPTIONS request a browser sends before a
+// cross-origin request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		len(r.Header.Get("Origin")) > 0 &&
+		len(r.Header.Get("Access-Control-Request-Method")) > 0
+}
+
+// allowOrigin gives the value of Access-Control-Allow-Origin for the
+// origin of the request, or an empty string when it is not allowed.
+func (c *corsPolicy) allowOrigin(origin string) string {
+	if len(origin) == 0 {
+		return ""
+	}
+
+	for _, allowed := range c.Origins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// setHeaders adds the CORS headers to a response for an allowed origin,
+// it is false when the origin is not allowed. Any set by the function
+// are replaced so that the annotations decide.
+func (c *corsPolicy) setHeaders(header http.Header, origin string) bool {
+	header.Del("Access-Control-Allow-Origin")
+	header.Del("Access-Control-Allow-Credentials")
+	header.Add("Vary", "Origin")
+
+	allowOrigin := c.allowOrigin(origin)
+	if len(allowOrigin) == 0 {
+		return false
+	}
+
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	if c.Credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// servePreflight answers a CORS preflight without calling the function
+func (c *corsPolicy) servePreflight(w http.ResponseWriter, r *http.Request) {
+	if !c.setHeaders(w.Header(), r.Header.Get("Origin")) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Origin not allowed"))
+		return
+	}
+
+	methods := c.Methods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+
+	// Without a list of headers, those asked for by the browser are
+	// allowed as the origin has already been checked
+	headers := c.Headers
+	if len(headers) == 0 {
+		headers = r.Header.Get("Access-Control-Request-Headers")
+	}
+	if len(headers) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+
+	if c.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedBody fails a request body which is longer than its limit, it
+// is used when the length is not known before the body is streamed
+type limitedBody struct {
+	io.ReadCloser
+	Remaining int64
+	Exceeded  bool
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.Remaining < 0 {
+		l.Exceeded = true
+		return 0, errBodyTooLarge
+	}
+
+	// Read one byte past the limit to tell a body of exactly the limit
+	// from a longer one
+	if int64(len(p)) > l.Remaining+1 {
+		p = p[:l.Remaining+1]
+	}
+
+	n, err := l.ReadCloser.Read(p)
+	l.Remaining -= int64(n)
+	if l.Remaining < 0 {
+		l.Exceeded = true
+		return 0, errBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseFunctionPolicy(t *testing.T) {
+	policy := parseFunctionPolicy("alexellis-api", map[string]string{
+		corsOriginsAnnotation:     "https://www.example.com, https://app.example.com",
+		corsMethodsAnnotation:     "GET,POST",
+		corsCredentialsAnnotation: "true",
+		corsMaxAgeAnnotation:      "600",
+		ipAllowAnnotation:         "10.0.0.0/8, 192.168.1.10",
+		maxBodyBytesAnnotation:    "1024",
+	})
+
+	if policy.CORS == nil {
+		t.Fatalf("want CORS policy")
+	}
+	if len(policy.CORS.Origins) != 2 || policy.CORS.Origins[1] != "https://app.example.com" {
+		t.Errorf("origins want two, got: %v", policy.CORS.Origins)
+	}
+	if policy.CORS.Methods != "GET, POST" {
+		t.Errorf("methods want: %s, got: %s", "GET, POST", policy.CORS.Methods)
+	}
+	if !policy.CORS.Credentials || policy.CORS.MaxAge != 600 {
+		t.Errorf("want credentials and max-age 600, got: %t %d", policy.CORS.Credentials, policy.CORS.MaxAge)
+	}
+	if len(policy.IPAllow) != 2 {
+		t.Errorf("want two networks, got: %v", policy.IPAllow)
+	}
+	if policy.MaxBodyBytes != 1024 {
+		t.Errorf("max body bytes want: %d, got: %d", 1024, policy.MaxBodyBytes)
+	}
+}
+
+func Test_parseFunctionPolicy_Empty(t *testing.T) {
+	policy := parseFunctionPolicy("alexellis-api", map[string]string{
+		maxBodyBytesAnnotation: "lots",
+	})
+
+	if policy.CORS != nil || policy.IPAllow != nil || policy.MaxBodyBytes != 0 {
+		t.Errorf("want no policy, got: %v", policy)
+	}
+}
+
+func Test_parseFunctionPolicy_WildcardWithCredentials(t *testing.T) {
+	policy := parseFunctionPolicy("alexellis-api", map[string]string{
+		corsOriginsAnnotation:     "https://www.example.com, *",
+		corsCredentialsAnnotation: "true",
+	})
+
+	if policy.CORS != nil {
+		t.Errorf("want no CORS policy for * with credentials, got: %v", policy.CORS)
+	}
+}
+
+func Test_parseFunctionPolicy_InvalidIPAllowRefusesAll(t *testing.T) {
+	policy := parseFunctionPolicy("alexellis-api", map[string]string{
+		ipAllowAnnotation: "office",
+	})
+
+	if policy.IPAllow == nil || len(policy.IPAllow) != 0 {
+		t.Errorf("want an empty allowlist, got: %v", policy.IPAllow)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if (&policyStore{}).Allowed(policy, r) {
+		t.Errorf("want every client refused")
+	}
+}
+
+func Test_parseNetworks(t *testing.T) {
+	networks, err := parseNetworks("10.0.0.0/8, 192.168.1.10, 2001:db8::/32, nope, 300.1.1.1/8")
+	if err == nil {
+		t.Errorf("want error for invalid entries")
+	}
+	if len(networks) != 3 {
+		t.Fatalf("want three valid networks, got: %v", networks)
+	}
+
+	tests := []struct {
+		IP   string
+		Want bool
+	}{
+		{"10.1.2.3", true},
+		{"192.168.1.10", true},
+		{"192.168.1.11", false},
+		{"2001:db8::1", true},
+		{"8.8.8.8", false},
+	}
+
+	for _, testCase := range tests {
+		if got := containsIP(networks, net.ParseIP(testCase.IP)); got != testCase.Want {
+			t.Errorf("%s: want %t, got %t", testCase.IP, testCase.Want, got)
+		}
+	}
+}
+
+func Test_policyStore_ClientIP(t *testing.T) {
+	trusted, _ := parseNetworks("10.0.0.0/8")
+	policies := newPolicyStore(nil, trusted, "X-Forwarded-For")
+
+	tests := []struct {
+		Scenario   string
+		RemoteAddr string
+		Forwarded  string
+		Want       string
+	}{
+		{"direct client", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"header ignored from untrusted client", "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"header read from trusted proxy", "10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		{"spoofed address before the real one", "10.0.0.2:1234", "192.168.1.10, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:1234", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.2:1234", "", "10.0.0.2"},
+	}
+
+	for _, testCase := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = testCase.RemoteAddr
+		if len(testCase.Forwarded) > 0 {
+			r.Header.Set("X-Forwarded-For", testCase.Forwarded)
+		}
+
+		if got := policies.ClientIP(r); got.String() != testCase.Want {
+			t.Errorf("%s: want %s, got %s", testCase.Scenario, testCase.Want, got)
+		}
+	}
+}
+
+func Test_corsPolicy_allowOrigin(t *testing.T) {
+	tests := []struct {
+		Scenario string
+		Policy   corsPolicy
+		Origin   string
+		Want     string
+	}{
+		{"listed origin", corsPolicy{Origins: []string{"https://www.example.com"}}, "https://www.example.com", "https://www.example.com"},
+		{"other origin", corsPolicy{Origins: []string{"https://www.example.com"}}, "https://evil.com", ""},
+		{"wildcard", corsPolicy{Origins: []string{"*"}}, "https://evil.com", "*"},
+		{"no origin", corsPolicy{Origins: []string{"*"}}, "", ""},
+	}
+
+	for _, testCase := range tests {
+		if got := testCase.Policy.allowOrigin(testCase.Origin); got != testCase.Want {
+			t.Errorf("%s: want %q, got %q", testCase.Scenario, testCase.Want, got)
+		}
+	}
+}
+
+func Test_limitedBody(t *testing.T) {
+	tests := []struct {
+		Body     string
+		Exceeded bool
+	}{
+		{"1234", false},
+		{"12345", true},
+	}
+
+	for _, testCase := range tests {
+		body := &limitedBody{ReadCloser: ioutil.NopCloser(strings.NewReader(testCase.Body)), Remaining: 4}
+
+		_, err := ioutil.ReadAll(body)
+		if body.Exceeded != testCase.Exceeded {
+			t.Errorf("%q: exceeded want %t, got %t", testCase.Body, testCase.Exceeded, body.Exceeded)
+		}
+		if testCase.Exceeded && err != errBodyTooLarge {
+			t.Errorf("%q: want error %s, got %v", testCase.Body, errBodyTooLarge, err)
+		}
+	}
+}
+
+func newTestPolicyStore(annotations map[string]string) (*policyStore, *httptest.Server) {
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		functions := []cachedFunction{
+			{Name: "alexellis-api", Annotations: annotations},
+			{Name: "alexellis-blog"},
+		}
+		bytesOut, _ := json.Marshal(functions)
+		w.Write(bytesOut)
+	}))
+
+	trusted, _ := parseNetworks("127.0.0.1")
+	functions := newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 100)
+	return newPolicyStore(functions, trusted, "X-Forwarded-For"), listFunctions
+}
+
+func Test_makeHandler_Policies(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	policies, listFunctions := newTestPolicyStore(map[string]string{
+		corsOriginsAnnotation:  "https://www.example.com",
+		corsHeadersAnnotation:  "Content-Type",
+		ipAllowAnnotation:      "198.51.100.0/24",
+		maxBodyBytesAnnotation: "4",
+	})
+	defer listFunctions.Close()
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{Policies: policies}),
+	})
+	defer router.Close()
+
+	tests := []struct {
+		Scenario      string
+		Method        string
+		Path          string
+		ClientIP      string
+		Origin        string
+		Body          io.Reader
+		Chunked       bool
+		WantStatus    int
+		WantUpstream  bool
+		AnyUpstream   bool
+		WantAllowFrom string
+	}{
+		{
+			Scenario:      "allowed client and origin",
+			Method:        http.MethodGet,
+			Path:          "/api",
+			ClientIP:      "198.51.100.7",
+			Origin:        "https://www.example.com",
+			WantStatus:    http.StatusOK,
+			WantUpstream:  true,
+			WantAllowFrom: "https://www.example.com",
+		},
+		{
+			Scenario:   "client outside the allowlist",
+			Method:     http.MethodGet,
+			Path:       "/api",
+			ClientIP:   "203.0.113.5",
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Scenario:      "preflight answered by the router",
+			Method:        http.MethodOptions,
+			Path:          "/api",
+			ClientIP:      "198.51.100.7",
+			Origin:        "https://www.example.com",
+			WantStatus:    http.StatusNoContent,
+			WantAllowFrom: "https://www.example.com",
+		},
+		{
+			Scenario:   "preflight from another origin",
+			Method:     http.MethodOptions,
+			Path:       "/api",
+			ClientIP:   "198.51.100.7",
+			Origin:     "https://evil.com",
+			WantStatus: http.StatusForbidden,
+		},
+		{
+			Scenario:   "body over the limit",
+			Method:     http.MethodPost,
+			Path:       "/api",
+			ClientIP:   "198.51.100.7",
+			Body:       strings.NewReader("12345"),
+			WantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			// A chunked body is streamed to the gateway until it passes the
+			// limit, so the gateway may or may not have been called
+			Scenario:    "chunked body over the limit",
+			Method:      http.MethodPost,
+			Path:        "/api",
+			ClientIP:    "198.51.100.7",
+			Body:        strings.NewReader("12345"),
+			Chunked:     true,
+			WantStatus:  http.StatusRequestEntityTooLarge,
+			AnyUpstream: true,
+		},
+		{
+			Scenario:     "chunked body within the limit",
+			Method:       http.MethodPost,
+			Path:         "/api",
+			ClientIP:     "198.51.100.7",
+			Body:         strings.NewReader("1234"),
+			Chunked:      true,
+			WantStatus:   http.StatusOK,
+			WantUpstream: true,
+		},
+		{
+			Scenario:   "function which is not listed",
+			Method:     http.MethodGet,
+			Path:       "/unknown",
+			ClientIP:   "198.51.100.7",
+			WantStatus: http.StatusNotFound,
+		},
+		{
+			Scenario:     "function without a policy",
+			Method:       http.MethodOptions,
+			Path:         "/blog",
+			ClientIP:     "203.0.113.5",
+			Origin:       "https://evil.com",
+			WantStatus:   http.StatusOK,
+			WantUpstream: true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			gatewayHandler.reset()
+
+			req, _ := http.NewRequest(testCase.Method, router.URL+testCase.Path, testCase.Body)
+			req.Host = "alexellis.example.xyz"
+			req.Header.Set("X-Forwarded-For", testCase.ClientIP)
+			if len(testCase.Origin) > 0 {
+				req.Header.Set("Origin", testCase.Origin)
+			}
+			if testCase.Method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			if testCase.Chunked {
+				req.ContentLength = -1
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != testCase.WantStatus {
+				t.Errorf("status want: %d, got: %d", testCase.WantStatus, res.StatusCode)
+			}
+			if sent := len(gatewayHandler.requestURI()) > 0; sent != testCase.WantUpstream && !testCase.AnyUpstream {
+				t.Errorf("sent to the gateway want: %t, got: %t", testCase.WantUpstream, sent)
+			}
+			if got := res.Header.Get("Access-Control-Allow-Origin"); got != testCase.WantAllowFrom {
+				t.Errorf("Access-Control-Allow-Origin want: %q, got: %q", testCase.WantAllowFrom, got)
+			}
+		})
+	}
+}
+
+func Test_makeHandler_PoliciesUnknown(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer listFunctions.Close()
+
+	functions := newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 100)
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{Policies: newPolicyStore(functions, nil, "")}),
+	})
+	defer router.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, router.URL+"/api", nil)
+	req.Host = "alexellis.example.xyz"
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status want: %d, got: %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	if len(gatewayHandler.requestURI()) > 0 {
+		t.Errorf("want request denied before the gateway, got: %s", gatewayHandler.requestURI())
+	}
+}
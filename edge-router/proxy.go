@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// hopHeaders only apply to a single connection so are not passed on
+// by a proxy, see RFC 7230 section 6.1
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders removes the hop-by-hop headers and any headers named
+// in the Connection header
+func removeHopHeaders(header http.Header) {
+	for _, value := range header["Connection"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				header.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// setForwardedHeaders tells the upstream about the original request,
+// the client address is appended to any X-Forwarded-For from a proxy
+// in front of the router
+func setForwardedHeaders(header http.Header, r *http.Request, trustedProxies []*net.IPNet) {
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); len(prior) > 0 {
+			clientIP = prior + ", " + clientIP
+		}
+		header.Set("X-Forwarded-For", clientIP)
+	}
+
+	header.Set("X-Forwarded-Host", r.Host)
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	// Keep the scheme given by a load-balancer which terminates TLS, a
+	// client could otherwise claim to have connected with https
+	if prior := r.Header.Get("X-Forwarded-Proto"); len(prior) > 0 && containsIP(trustedProxies, remoteIP(r)) {
+		proto = prior
+	}
+	header.Set("X-Forwarded-Proto", proto)
+}
+
+// newUpstreamRequest gives a request for the upstream which streams the
+// body of the original request
+func newUpstreamRequest(ctx context.Context, r *http.Request, upstreamURL string, trustedProxies []*net.IPNet) (*http.Request, error) {
+	body := r.Body
+	if r.ContentLength == 0 {
+		body = nil
+	}
+
+	req, err := http.NewRequest(r.Method, upstreamURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = r.ContentLength
+
+	copyHeaders(req.Header, &r.Header)
+	removeHopHeaders(req.Header)
+	setForwardedHeaders(req.Header, r, trustedProxies)
+
+	return req.WithContext(ctx), nil
+}
+
+// doUpstream sends the request and only applies the timeout until the
+// response headers are received, so that long-lived responses such as
+// server-sent events can be streamed. The returned cancel func must
+// be called once the body has been read.
+func doUpstream(c *http.Client, r *http.Request, upstreamURL string, timeout time.Duration, trustedProxies []*net.IPNet) (*http.Response, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(r.Context())
+
+	req, err := newUpstreamRequest(ctx, r, upstreamURL, trustedProxies)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	timer := time.AfterFunc(timeout, cancel)
+
+	res, err := c.Do(req)
+	if !timer.Stop() && err == nil {
+		res.Body.Close()
+		err = context.DeadlineExceeded
+	}
+
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	return res, cancel, nil
+}
+
+// copyResponse writes the body to the client as it is read, flushing
+// after each read
+func copyResponse(w http.ResponseWriter, body io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
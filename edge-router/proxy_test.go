@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_removeHopHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Connection", "keep-alive, X-Session")
+	header.Set("Keep-Alive", "timeout=5")
+	header.Set("Transfer-Encoding", "chunked")
+	header.Set("X-Session", "1")
+	header.Set("Content-Type", "text/plain")
+
+	removeHopHeaders(header)
+
+	for _, name := range []string{"Connection", "Keep-Alive", "Transfer-Encoding", "X-Session"} {
+		if got := header.Get(name); len(got) > 0 {
+			t.Errorf("want %s removed, got: %s", name, got)
+		}
+	}
+
+	if got := header.Get("Content-Type"); got != "text/plain" {
+		t.Errorf("want Content-Type kept, got: %q", got)
+	}
+}
+
+func Test_setForwardedHeaders(t *testing.T) {
+	trusted, _ := parseNetworks("192.168.0.0/24")
+
+	tests := []struct {
+		Scenario      string
+		RemoteAddr    string
+		TLS           bool
+		PriorFor      string
+		PriorProto    string
+		ExpectedFor   string
+		ExpectedProto string
+	}{
+		{
+			Scenario:      "direct request",
+			RemoteAddr:    "203.0.113.1:41234",
+			ExpectedFor:   "203.0.113.1",
+			ExpectedProto: "http",
+		},
+		{
+			Scenario:      "direct request with TLS",
+			RemoteAddr:    "203.0.113.1:41234",
+			TLS:           true,
+			ExpectedFor:   "203.0.113.1",
+			ExpectedProto: "https",
+		},
+		{
+			Scenario:      "behind a trusted load-balancer",
+			RemoteAddr:    "192.168.0.10:41234",
+			PriorFor:      "203.0.113.1",
+			PriorProto:    "https",
+			ExpectedFor:   "203.0.113.1, 192.168.0.10",
+			ExpectedProto: "https",
+		},
+		{
+			Scenario:      "scheme sent by a client",
+			RemoteAddr:    "203.0.113.1:41234",
+			PriorProto:    "https",
+			ExpectedFor:   "203.0.113.1",
+			ExpectedProto: "http",
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://alexellis.example.xyz/fn1", nil)
+			r.RemoteAddr = testCase.RemoteAddr
+			if testCase.TLS {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if len(testCase.PriorFor) > 0 {
+				r.Header.Set("X-Forwarded-For", testCase.PriorFor)
+			}
+			if len(testCase.PriorProto) > 0 {
+				r.Header.Set("X-Forwarded-Proto", testCase.PriorProto)
+			}
+
+			header := http.Header{}
+			copyHeaders(header, &r.Header)
+			setForwardedHeaders(header, r, trusted)
+
+			if got := header.Get("X-Forwarded-For"); got != testCase.ExpectedFor {
+				t.Errorf("X-Forwarded-For want: %q, got: %q", testCase.ExpectedFor, got)
+			}
+			if got := header.Get("X-Forwarded-Proto"); got != testCase.ExpectedProto {
+				t.Errorf("X-Forwarded-Proto want: %q, got: %q", testCase.ExpectedProto, got)
+			}
+			if got := header.Get("X-Forwarded-Host"); got != "alexellis.example.xyz" {
+				t.Errorf("X-Forwarded-Host want: %q, got: %q", "alexellis.example.xyz", got)
+			}
+		})
+	}
+}
+
+func Test_makeHandler_StreamsResponse(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+
+		// The second event is sent after the timeout of the router
+		time.Sleep(time.Millisecond * 150)
+		w.Write([]byte("data: second\n\n"))
+	}))
+	defer gateway.Close()
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Millisecond*50, gateway.URL, nil, routerOptions{}),
+	})
+	defer router.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, router.URL+"/events", nil)
+	req.Host = "alexellis.example.xyz"
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	reader := bufio.NewReader(res.Body)
+
+	// The first event can only be read before the upstream finishes if
+	// it was flushed
+	line := make(chan string)
+	go func() {
+		got, _ := reader.ReadString('\n')
+		line <- got
+	}()
+
+	select {
+	case got := <-line:
+		if strings.TrimSpace(got) != "data: first" {
+			t.Errorf("want first event, got: %q", got)
+		}
+	case <-time.After(time.Millisecond * 100):
+		t.Fatalf("first event was not flushed to the client")
+	}
+
+	rest, _ := ioutil.ReadAll(reader)
+	if strings.TrimSpace(string(rest)) != "data: second" {
+		t.Errorf("want second event, got: %q", string(rest))
+	}
+}
+
+func Test_makeHandler_TimeoutBeforeHeaders(t *testing.T) {
+	release := make(chan struct{})
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer gateway.Close()
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Millisecond*50, gateway.URL, nil, routerOptions{}),
+	})
+	defer router.Close()
+	defer close(release)
+
+	req, _ := http.NewRequest(http.MethodGet, router.URL+"/slow", nil)
+	req.Host = "alexellis.example.xyz"
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status want: %d, got: %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+}
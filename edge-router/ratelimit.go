@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitAnnotation      = "com.openfaas.cloud.rate-limit"
+	rateLimitBurstAnnotation = "com.openfaas.cloud.rate-limit.burst"
+
+	// defaultLimitKey and defaultFunctionLimitKey give the limits for
+	// owners and functions which are not listed in the limits file
+	defaultLimitKey         = "*"
+	defaultFunctionLimitKey = "*/*"
+)
+
+// rateLimit allows Rate requests per second on average, and up to
+// Burst requests at once
+type rateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// parseRateLimit reads a limit such as 10/s, 600/m or 1000/h, burst
+// defaults to the count of requests when empty
+func parseRateLimit(value, burst string) (rateLimit, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), "/", 2)
+	if len(parts) != 2 {
+		return rateLimit{}, fmt.Errorf("rate limit %q should be a count per s, m or h, i.e. 10/s", value)
+	}
+
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 {
+		return rateLimit{}, fmt.Errorf("rate limit %q should have a count of at least 1", value)
+	}
+
+	var period time.Duration
+	switch parts[1] {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return rateLimit{}, fmt.Errorf("rate limit %q should be per s, m or h", value)
+	}
+
+	limit := rateLimit{
+		Rate:  float64(count) / period.Seconds(),
+		Burst: count,
+	}
+
+	if len(burst) > 0 {
+		limit.Burst, err = strconv.Atoi(strings.TrimSpace(burst))
+		if err != nil || limit.Burst < 1 {
+			return rateLimit{}, fmt.Errorf("rate limit burst %q should be at least 1", burst)
+		}
+	}
+
+	return limit, nil
+}
+
+// parseLimitsFile reads a limit for each owner or function, one per
+// line as a key, a rate and an optional burst:
+//
+//	# key          rate    burst
+//	*              100/s   200
+//	*/*            20/s
+//	alexellis      50/s
+//	alexellis/blog 5/s     10
+//
+// "*" is the limit for each owner not listed and "*/*" is the limit for
+// each function not listed or annotated.
+func parseLimitsFile(data []byte) (map[string]rateLimit, error) {
+	limits := map[string]rateLimit{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i > -1 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: want a key, rate and optional burst", line)
+		}
+
+		burst := ""
+		if len(fields) == 3 {
+			burst = fields[2]
+		}
+
+		limit, err := parseRateLimit(fields[1], burst)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+
+		limits[strings.ToLower(fields[0])] = limit
+	}
+
+	return limits, scanner.Err()
+}
+
+// limitBucket is the token bucket at Key which is refilled at Limit
+type limitBucket struct {
+	Key   string
+	Limit rateLimit
+}
+
+// limitStore takes a token from every bucket, or from none of them when
+// any is empty so that a refused request uses none of its limits, then it
+// gives how long until each bucket has a token
+type limitStore interface {
+	Take(buckets []limitBucket, now time.Time) (bool, time.Duration, error)
+}
+
+// rateLimiter applies a token bucket to the requests of each owner and
+// to each of their functions. Limits are read from Path and from the
+// annotations of each function in Functions when it is set.
+type rateLimiter struct {
+	Path      string
+	Functions *functionCache
+	Store     limitStore
+
+	lock   sync.RWMutex
+	limits map[string]rateLimit
+}
+
+func newRateLimiter(path string, functions *functionCache, store limitStore) *rateLimiter {
+	return &rateLimiter{
+		Path:      path,
+		Functions: functions,
+		Store:     store,
+		limits:    map[string]rateLimit{},
+	}
+}
+
+// Reload reads the limits file, the previous limits are kept when it
+// cannot be read or parsed
+func (l *rateLimiter) Reload() error {
+	if len(l.Path) == 0 {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(l.Path)
+	if err != nil {
+		return err
+	}
+
+	limits, err := parseLimitsFile(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", l.Path, err.Error())
+	}
+
+	l.lock.Lock()
+	l.limits = limits
+	l.lock.Unlock()
+
+	return nil
+}
+
+// Start reloads the limits file every interval
+func (l *rateLimiter) Start(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := l.Reload(); err != nil {
+				log.Printf("Unable to reload rate limits: %s\n", err.Error())
+			}
+		}
+	}()
+}
+
+func (l *rateLimiter) lookup(keys ...string) (rateLimit, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	for _, key := range keys {
+		if limit, ok := l.limits[key]; ok {
+			return limit, true
+		}
+	}
+	return rateLimit{}, false
+}
+
+// functionLimit prefers the annotations of the function to the limits file
+func (l *rateLimiter) functionLimit(owner, name, functionName string) (rateLimit, bool) {
+	if l.Functions != nil {
+		if function, ok := l.Functions.Get(owner, functionName); ok {
+			if value, ok := function.Annotations[rateLimitAnnotation]; ok {
+				limit, err := parseRateLimit(value, function.Annotations[rateLimitBurstAnnotation])
+				if err == nil {
+					return limit, true
+				}
+				log.Printf("Ignoring rate limit for %s: %s\n", functionName, err.Error())
+			}
+		}
+	}
+
+	return l.lookup(owner+"/"+name, defaultFunctionLimitKey)
+}
+
+// Allow takes a token for the function and one for its owner, when
+// either is limited it gives how long the client should wait and neither
+// token is taken. Requests are allowed when the store cannot be reached.
+func (l *rateLimiter) Allow(owner, name string) (bool, time.Duration) {
+	owner = strings.ToLower(owner)
+	name = strings.ToLower(name)
+
+	var buckets []limitBucket
+	if limit, ok := l.functionLimit(owner, name, owner+"-"+name); ok {
+		buckets = append(buckets, limitBucket{Key: "function:" + owner + "/" + name, Limit: limit})
+	}
+	if limit, ok := l.lookup(owner, defaultLimitKey); ok {
+		buckets = append(buckets, limitBucket{Key: "owner:" + owner, Limit: limit})
+	}
+
+	if len(buckets) == 0 {
+		return true, 0
+	}
+
+	allowed, wait, err := l.Store.Take(buckets, time.Now())
+	if err != nil {
+		log.Printf("Unable to apply rate limit for %s/%s: %s\n", owner, name, err.Error())
+		return true, 0
+	}
+	return allowed, wait
+}
+
+// retryAfter gives the value of the Retry-After header in whole seconds
+func retryAfter(wait time.Duration) string {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+type tokenBucket struct {
+	Tokens float64
+	Last   time.Time
+
+	// Full is when the bucket will have refilled if no more tokens are taken
+	Full time.Time
+}
+
+// memoryStore keeps the buckets in memory, so limits are applied by
+// each replica of the router separately
+type memoryStore struct {
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *memoryStore) Take(buckets []limitBucket, now time.Time) (bool, time.Duration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if now.Sub(m.lastSweep) > time.Minute {
+		m.sweep(now)
+	}
+
+	var wait time.Duration
+	for _, b := range buckets {
+		bucket := m.refill(b, now)
+		if bucket.Tokens < 1 {
+			if bucketWait := time.Duration((1 - bucket.Tokens) / b.Limit.Rate * float64(time.Second)); bucketWait > wait {
+				wait = bucketWait
+			}
+		}
+	}
+
+	if wait > 0 {
+		return false, wait, nil
+	}
+
+	for _, b := range buckets {
+		bucket := m.buckets[b.Key]
+		bucket.Tokens--
+		bucket.Full = now.Add(time.Duration((float64(b.Limit.Burst) - bucket.Tokens) / b.Limit.Rate * float64(time.Second)))
+	}
+	return true, 0, nil
+}
+
+// refill adds the tokens for the time since the bucket was last used,
+// a new bucket starts full
+func (m *memoryStore) refill(b limitBucket, now time.Time) *tokenBucket {
+	bucket, ok := m.buckets[b.Key]
+	if !ok {
+		bucket = &tokenBucket{Tokens: float64(b.Limit.Burst), Last: now}
+		m.buckets[b.Key] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.Last).Seconds(); elapsed > 0 {
+		bucket.Tokens = math.Min(float64(b.Limit.Burst), bucket.Tokens+elapsed*b.Limit.Rate)
+		bucket.Last = now
+	}
+	return bucket
+}
+
+// sweep removes buckets which have refilled, as they are no different
+// from a new bucket
+func (m *memoryStore) sweep(now time.Time) {
+	for key, bucket := range m.buckets {
+		if now.After(bucket.Full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// takeScript refills each bucket in KEYS at the rate and up to the burst
+// given for it in ARGV, then takes a token from every bucket when all of
+// them have one. It returns 1 when the tokens were taken otherwise 0 and
+// the milliseconds until every bucket has a token. The time is read from
+// Redis so that the clocks of the replicas of the router do not matter.
+const takeScript = `
+redis.replicate_commands()
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local buckets = {}
+local wait = 0
+for i, key in ipairs(KEYS) do
+  local rate = tonumber(ARGV[i * 2 - 1])
+  local burst = tonumber(ARGV[i * 2])
+  local state = redis.call("HMGET", key, "tokens", "last")
+  local tokens = tonumber(state[1])
+  local last = tonumber(state[2])
+  if tokens == nil or last == nil then
+    tokens = burst
+    last = now
+  end
+  if now > last then
+    tokens = math.min(burst, tokens + (now - last) / 1000 * rate)
+    last = now
+  end
+  if tokens < 1 then
+    wait = math.max(wait, math.ceil((1 - tokens) / rate * 1000))
+  end
+  buckets[i] = {key = key, rate = rate, burst = burst, tokens = tokens, last = last}
+end
+local allowed = 0
+if wait == 0 then
+  allowed = 1
+end
+for _, bucket in ipairs(buckets) do
+  if allowed == 1 then
+    bucket.tokens = bucket.tokens - 1
+  end
+  redis.call("HMSET", bucket.key, "tokens", tostring(bucket.tokens), "last", tostring(bucket.last))
+  redis.call("PEXPIRE", bucket.key, math.ceil((bucket.burst - bucket.tokens) / bucket.rate * 1000) + 1000)
+end
+return {allowed, wait}
+`
+
+// redisStore keeps the buckets in Redis so that limits are shared by
+// all replicas of the router. The buckets of a request are refilled and
+// taken from in a single script so that replicas do not race.
+type redisStore struct {
+	Addr     string
+	Password string
+	Timeout  time.Duration
+
+	// KeyPrefix is prepended to the key of each bucket
+	KeyPrefix string
+
+	conns chan *redisConn
+}
+
+func newRedisStore(addr, password string, timeout time.Duration) *redisStore {
+	return &redisStore{
+		Addr:      addr,
+		Password:  password,
+		Timeout:   timeout,
+		KeyPrefix: "edge-router:rate-limit:",
+		conns:     make(chan *redisConn, 16),
+	}
+}
+
+// Take ignores now as the buckets are refilled with the time of Redis
+func (s *redisStore) Take(buckets []limitBucket, now time.Time) (bool, time.Duration, error) {
+	conn, err := s.get()
+	if err != nil {
+		return false, 0, err
+	}
+
+	args := []string{"EVAL", takeScript, strconv.Itoa(len(buckets))}
+	for _, b := range buckets {
+		args = append(args, s.KeyPrefix+b.Key)
+	}
+	for _, b := range buckets {
+		args = append(args, strconv.FormatFloat(b.Limit.Rate, 'f', -1, 64), strconv.Itoa(b.Limit.Burst))
+	}
+
+	reply, err := conn.Do(args...)
+	if err != nil {
+		conn.Close()
+		return false, 0, err
+	}
+	s.put(conn)
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("unexpected reply from redis: %v", reply)
+	}
+
+	allowed, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
+
+// get re-uses an idle connection or dials a new one
+func (s *redisStore) get() (*redisConn, error) {
+	select {
+	case conn := <-s.conns:
+		return conn, nil
+	default:
+	}
+
+	netConn, err := net.DialTimeout("tcp", s.Addr, s.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{Conn: netConn, Timeout: s.Timeout, reader: bufio.NewReader(netConn)}
+
+	if len(s.Password) > 0 {
+		if _, err := conn.Do("AUTH", s.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// put keeps the connection for re-use unless enough are idle already
+func (s *redisStore) put(conn *redisConn) {
+	select {
+	case s.conns <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// redisConn speaks enough of the Redis protocol (RESP) to run a command
+// and read its reply
+type redisConn struct {
+	net.Conn
+	Timeout time.Duration
+
+	reader *bufio.Reader
+}
+
+// Do sends a command and reads the reply, which is a string, an int64,
+// nil or a []interface{} of these. An error reply is returned as an error.
+func (c *redisConn) Do(args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(c.Timeout))
+
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := io.WriteString(c.Conn, command.String()); err != nil {
+		return nil, err
+	}
+
+	return readReply(c.reader)
+}
+
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty reply from redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+
+		values := make([]interface{}, count)
+		for i := range values {
+			if values[i], err = readReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("unknown reply from redis: %q", line)
+}
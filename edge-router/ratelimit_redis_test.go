@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRedis reads each command and writes back the next reply
+type fakeRedis struct {
+	Listener net.Listener
+	Replies  []string
+	Commands chan []string
+}
+
+func newFakeRedis(t *testing.T, replies ...string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{Listener: listener, Replies: replies, Commands: make(chan []string, len(replies))}
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	conn, err := f.Listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for _, reply := range f.Replies {
+		command, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		f.Commands <- command
+		io.WriteString(conn, reply)
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, count)
+	for i := range args {
+		size, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		length, _ := strconv.Atoi(strings.TrimSpace(size[1:]))
+		arg := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:length])
+	}
+	return args, nil
+}
+
+func Test_readReply(t *testing.T) {
+	tests := []struct {
+		Reply string
+		Want  interface{}
+	}{
+		{"+OK\r\n", "OK"},
+		{":42\r\n", int64(42)},
+		{"$5\r\nhello\r\n", "hello"},
+		{"$-1\r\n", nil},
+		{"*2\r\n:1\r\n$2\r\nok\r\n", []interface{}{int64(1), "ok"}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(strings.TrimSpace(testCase.Reply), func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(testCase.Reply)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, testCase.Want) {
+				t.Errorf("want: %#v, got: %#v", testCase.Want, got)
+			}
+		})
+	}
+
+	if _, err := readReply(bufio.NewReader(strings.NewReader("-NOSCRIPT missing\r\n"))); err == nil {
+		t.Errorf("want error reply returned as an error")
+	}
+}
+
+func Test_redisStore_Take(t *testing.T) {
+	redis := newFakeRedis(t, "+OK\r\n", "*2\r\n:0\r\n:1500\r\n", "*2\r\n:1\r\n:0\r\n")
+	defer redis.Listener.Close()
+
+	store := newRedisStore(redis.Listener.Addr().String(), "secret", time.Second)
+	buckets := []limitBucket{
+		{Key: "function:alexellis/blog", Limit: rateLimit{Rate: 2, Burst: 5}},
+		{Key: "owner:alexellis", Limit: rateLimit{Rate: 0.5, Burst: 10}},
+	}
+
+	allowed, wait, err := store.Take(buckets, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed || wait != time.Millisecond*1500 {
+		t.Errorf("want refused with a wait of 1.5s, got: %t %s", allowed, wait)
+	}
+
+	if auth := <-redis.Commands; !reflect.DeepEqual(auth, []string{"AUTH", "secret"}) {
+		t.Errorf("want AUTH with the password, got: %v", auth)
+	}
+
+	eval := <-redis.Commands
+	if eval[0] != "EVAL" || eval[1] != takeScript {
+		t.Fatalf("want EVAL of the take script, got: %v", eval[0])
+	}
+	want := []string{"2", "edge-router:rate-limit:function:alexellis/blog", "edge-router:rate-limit:owner:alexellis", "2", "5", "0.5", "10"}
+	if !reflect.DeepEqual(eval[2:], want) {
+		t.Errorf("EVAL args want: %v, got: %v", want, eval[2:])
+	}
+
+	// The connection is re-used without authenticating again
+	allowed, _, err = store.Take(buckets, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed {
+		t.Errorf("want allowed")
+	}
+	if eval := <-redis.Commands; eval[0] != "EVAL" {
+		t.Errorf("want EVAL on the second call, got: %v", eval[0])
+	}
+}
+
+func Test_redisStore_TakeUnreachable(t *testing.T) {
+	store := newRedisStore("127.0.0.1:1", "", time.Millisecond*100)
+
+	if _, _, err := store.Take([]limitBucket{{Key: "owner:alexellis", Limit: rateLimit{Rate: 1, Burst: 1}}}, time.Now()); err == nil {
+		t.Errorf("want error when redis cannot be reached")
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_parseRateLimit(t *testing.T) {
+	tests := []struct {
+		Value string
+		Burst string
+		Want  rateLimit
+		Err   bool
+	}{
+		{Value: "10/s", Want: rateLimit{Rate: 10, Burst: 10}},
+		{Value: "60/m", Burst: "5", Want: rateLimit{Rate: 1, Burst: 5}},
+		{Value: "3600/h", Want: rateLimit{Rate: 1, Burst: 3600}},
+		{Value: "10", Err: true},
+		{Value: "0/s", Err: true},
+		{Value: "10/d", Err: true},
+		{Value: "10/s", Burst: "0", Err: true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Value+" "+testCase.Burst, func(t *testing.T) {
+			got, err := parseRateLimit(testCase.Value, testCase.Burst)
+			if testCase.Err {
+				if err == nil {
+					t.Fatalf("want error, got: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != testCase.Want {
+				t.Errorf("want: %v, got: %v", testCase.Want, got)
+			}
+		})
+	}
+}
+
+func Test_parseLimitsFile(t *testing.T) {
+	limits, err := parseLimitsFile([]byte(`
+# key          rate    burst
+*              100/s   200
+AlexEllis      50/s
+alexellis/blog 5/s     10 # the blog is slow
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]rateLimit{
+		"*":              {Rate: 100, Burst: 200},
+		"alexellis":      {Rate: 50, Burst: 50},
+		"alexellis/blog": {Rate: 5, Burst: 10},
+	}
+
+	if len(limits) != len(want) {
+		t.Fatalf("want %d limits, got: %v", len(want), limits)
+	}
+	for key, limit := range want {
+		if limits[key] != limit {
+			t.Errorf("%s want: %v, got: %v", key, limit, limits[key])
+		}
+	}
+
+	if _, err := parseLimitsFile([]byte("alexellis\n")); err == nil {
+		t.Errorf("want error for a key without a rate")
+	}
+	if _, err := parseLimitsFile([]byte("alexellis 10/x\n")); err == nil {
+		t.Errorf("want error for an invalid rate")
+	}
+}
+
+func Test_memoryStore_Take(t *testing.T) {
+	store := newMemoryStore()
+	limit := rateLimit{Rate: 2, Burst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := store.Take([]limitBucket{{Key: "owner:alexellis", Limit: limit}}, now); !allowed {
+			t.Fatalf("want request %d allowed by the burst", i+1)
+		}
+	}
+
+	allowed, wait, _ := store.Take([]limitBucket{{Key: "owner:alexellis", Limit: limit}}, now)
+	if allowed {
+		t.Fatalf("want request over the burst refused")
+	}
+	if wait != time.Millisecond*500 {
+		t.Errorf("wait want: %s, got: %s", time.Millisecond*500, wait)
+	}
+
+	if allowed, _, _ := store.Take([]limitBucket{{Key: "owner:rgee0", Limit: limit}}, now); !allowed {
+		t.Errorf("want request for another key allowed")
+	}
+
+	if allowed, _, _ := store.Take([]limitBucket{{Key: "owner:alexellis", Limit: limit}}, now.Add(time.Millisecond*500)); !allowed {
+		t.Errorf("want request allowed once a token is added")
+	}
+}
+
+func Test_memoryStore_TakesFromNoBucketWhenOneIsEmpty(t *testing.T) {
+	store := newMemoryStore()
+	now := time.Now()
+
+	owner := limitBucket{Key: "owner:alexellis", Limit: rateLimit{Rate: 1, Burst: 1}}
+	function := limitBucket{Key: "function:alexellis/blog", Limit: rateLimit{Rate: 0.5, Burst: 2}}
+
+	if allowed, _, _ := store.Take([]limitBucket{function, owner}, now); !allowed {
+		t.Fatalf("want first request allowed")
+	}
+
+	allowed, wait, _ := store.Take([]limitBucket{function, owner}, now)
+	if allowed || wait != time.Second {
+		t.Fatalf("want request refused by the owner with a wait of 1s, got: %t %s", allowed, wait)
+	}
+	if tokens := store.buckets[function.Key].Tokens; tokens != 1 {
+		t.Errorf("want the function's token kept when the owner is limited, tokens: %v", tokens)
+	}
+}
+
+func Test_memoryStore_SweepsFullBuckets(t *testing.T) {
+	store := newMemoryStore()
+	now := time.Now()
+
+	store.Take([]limitBucket{{Key: "owner:alexellis", Limit: rateLimit{Rate: 1, Burst: 1}}}, now)
+	store.Take([]limitBucket{{Key: "owner:rgee0", Limit: rateLimit{Rate: 1.0 / 3600, Burst: 1}}}, now)
+
+	store.Take([]limitBucket{{Key: "owner:other", Limit: rateLimit{Rate: 1, Burst: 1}}}, now.Add(time.Minute*2))
+
+	if _, ok := store.buckets["owner:alexellis"]; ok {
+		t.Errorf("want refilled bucket removed")
+	}
+	if _, ok := store.buckets["owner:rgee0"]; !ok {
+		t.Errorf("want bucket which is still refilling kept")
+	}
+}
+
+func newTestRateLimiter(t *testing.T, limitsFile string) (*rateLimiter, func()) {
+	listFunctions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		functions := []cachedFunction{
+			{Name: "alexellis-blog"},
+			{
+				Name:        "alexellis-api",
+				Annotations: map[string]string{rateLimitAnnotation: "1/m"},
+			},
+		}
+		bytesOut, _ := json.Marshal(functions)
+		w.Write(bytesOut)
+	}))
+
+	dir, err := ioutil.TempDir("", "edge-router-limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limitsPath := path.Join(dir, "limits")
+	ioutil.WriteFile(limitsPath, []byte(limitsFile), 0600)
+
+	limits := newRateLimiter(limitsPath, newFunctionCache(listFunctions.URL+"/", http.DefaultClient, time.Minute, 100), newMemoryStore())
+	if err := limits.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	return limits, func() {
+		listFunctions.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_rateLimiter_Allow(t *testing.T) {
+	limits, cleanup := newTestRateLimiter(t, `
+alexellis      3/m
+alexellis/blog 2/m
+`)
+	defer cleanup()
+
+	// The annotation is preferred to the limits of the owner
+	if allowed, _ := limits.Allow("alexellis", "api"); !allowed {
+		t.Fatalf("want first request to api allowed")
+	}
+	if allowed, wait := limits.Allow("alexellis", "api"); allowed || wait <= 0 {
+		t.Fatalf("want second request to api limited by its annotation, got: %t %s", allowed, wait)
+	}
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limits.Allow("alexellis", "blog"); !allowed {
+			t.Fatalf("want request %d to blog allowed", i+1)
+		}
+	}
+
+	// The owner has used their 3 requests, one of which was to api
+	if allowed, _ := limits.Allow("alexellis", "blog"); allowed {
+		t.Errorf("want third request to blog limited")
+	}
+	if allowed, _ := limits.Allow("Alexellis", "other"); allowed {
+		t.Errorf("want other functions limited by the owner")
+	}
+
+	if allowed, _ := limits.Allow("rgee0", "blog"); !allowed {
+		t.Errorf("want owner without a limit allowed")
+	}
+}
+
+func Test_rateLimiter_ReloadKeepsLimitsOnError(t *testing.T) {
+	limits, cleanup := newTestRateLimiter(t, "* 1/m\n")
+	defer cleanup()
+
+	ioutil.WriteFile(limits.Path, []byte("* 1/x\n"), 0600)
+	if err := limits.Reload(); err == nil {
+		t.Fatalf("want error for an invalid limits file")
+	}
+
+	if _, ok := limits.lookup(defaultLimitKey); !ok {
+		t.Errorf("want previous limits kept")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(buckets []limitBucket, now time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func Test_rateLimiter_AllowsWhenStoreFails(t *testing.T) {
+	limits := newRateLimiter("", nil, failingStore{})
+	limits.limits = map[string]rateLimit{defaultLimitKey: {Rate: 1, Burst: 1}}
+
+	if allowed, _ := limits.Allow("alexellis", "blog"); !allowed {
+		t.Errorf("want request allowed when the store cannot be reached")
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                       "1",
+		time.Millisecond * 200:  "1",
+		time.Millisecond * 1200: "2",
+		time.Minute:             "60",
+	}
+
+	for wait, want := range tests {
+		if got := retryAfter(wait); got != want {
+			t.Errorf("%s: want %s, got %s", wait, want, got)
+		}
+	}
+}
+
+func Test_makeHandler_RateLimited(t *testing.T) {
+	gatewayHandler := &gateway{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	limits, cleanup := newTestRateLimiter(t, "alexellis 1/m\n")
+	defer cleanup()
+
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*10, gateway.URL, nil, routerOptions{Limits: limits}),
+	})
+	defer router.Close()
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		gatewayHandler.RequestURI = ""
+
+		req, _ := http.NewRequest(http.MethodGet, router.URL+"/blog", nil)
+		req.Host = "alexellis.example.xyz"
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != want {
+			t.Fatalf("request %d status want: %d, got: %d", i+1, want, res.StatusCode)
+		}
+
+		if want == http.StatusTooManyRequests {
+			if got := res.Header.Get("Retry-After"); got != "60" {
+				t.Errorf("Retry-After want: %s, got: %s", "60", got)
+			}
+			if len(gatewayHandler.RequestURI) > 0 {
+				t.Errorf("want limited request not sent to the gateway")
+			}
+		}
+	}
+}
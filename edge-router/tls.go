@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// secretCertFile and secretKeyFile are the keys of a Kubernetes
+	// secret of type kubernetes.io/tls when it is mounted as a volume
+	secretCertFile = "tls.crt"
+	secretKeyFile  = "tls.key"
+
+	// defaultCertName is served when no certificate matches the SNI
+	// server name, otherwise the first certificate by name is used
+	defaultCertName = "default"
+)
+
+// certStore selects a certificate by the SNI server name from the pairs
+// found in Dir. A pair is either name.crt and name.key, or a directory
+// holding tls.crt and tls.key such as a mounted Kubernetes secret.
+type certStore struct {
+	Dir string
+
+	lock        sync.RWMutex
+	names       map[string]*tls.Certificate
+	fallback    *tls.Certificate
+	fingerprint string
+}
+
+func newCertStore(dir string) *certStore {
+	return &certStore{
+		Dir:   dir,
+		names: map[string]*tls.Certificate{},
+	}
+}
+
+type certPair struct {
+	Name     string
+	CertPath string
+	KeyPath  string
+}
+
+// findPairs lists the certificate and key pairs in dir by name
+func findPairs(dir string) ([]certPair, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := []certPair{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		entryPath := path.Join(dir, name)
+
+		// Follow symlinks, as used by Kubernetes for mounted secrets
+		if info, err := os.Stat(entryPath); err == nil && info.IsDir() {
+			certPath := path.Join(entryPath, secretCertFile)
+			if _, err := os.Stat(certPath); err == nil {
+				pairs = append(pairs, certPair{Name: name, CertPath: certPath, KeyPath: path.Join(entryPath, secretKeyFile)})
+			}
+			continue
+		}
+
+		if strings.HasSuffix(name, ".crt") {
+			base := strings.TrimSuffix(name, ".crt")
+			pairs = append(pairs, certPair{Name: base, CertPath: entryPath, KeyPath: path.Join(dir, base+".key")})
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Name < pairs[j].Name
+	})
+	return pairs, nil
+}
+
+// Load reads the certificates when any file has changed since the last
+// load, a certificate which cannot be read is skipped so that one bad
+// pair does not stop the others being renewed
+func (s *certStore) Load() error {
+	pairs, err := findPairs(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	contents := map[string][2][]byte{}
+	for _, pair := range pairs {
+		certPEM, certErr := ioutil.ReadFile(pair.CertPath)
+		keyPEM, keyErr := ioutil.ReadFile(pair.KeyPath)
+		if certErr != nil || keyErr != nil {
+			log.Printf("Unable to read certificate %s\n", pair.Name)
+			continue
+		}
+
+		contents[pair.Name] = [2][]byte{certPEM, keyPEM}
+		hash.Write([]byte(pair.Name))
+		hash.Write(certPEM)
+		hash.Write(keyPEM)
+	}
+
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+	s.lock.RLock()
+	unchanged := fingerprint == s.fingerprint
+	s.lock.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	names := map[string]*tls.Certificate{}
+	var fallback *tls.Certificate
+
+	for _, pair := range pairs {
+		content, ok := contents[pair.Name]
+		if !ok {
+			continue
+		}
+
+		cert, err := tls.X509KeyPair(content[0], content[1])
+		if err != nil {
+			log.Printf("Unable to load certificate %s: %s\n", pair.Name, err.Error())
+			continue
+		}
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			log.Printf("Unable to parse certificate %s: %s\n", pair.Name, err.Error())
+			continue
+		}
+		cert.Leaf = leaf
+
+		hosts := leaf.DNSNames
+		if len(hosts) == 0 && len(leaf.Subject.CommonName) > 0 {
+			hosts = []string{leaf.Subject.CommonName}
+		}
+		for _, host := range hosts {
+			host = strings.ToLower(host)
+			if _, exists := names[host]; !exists {
+				names[host] = &cert
+			}
+		}
+
+		if fallback == nil || pair.Name == defaultCertName {
+			fallback = &cert
+		}
+
+		log.Printf("Loaded certificate %s for %s, expires: %s\n", pair.Name, strings.Join(hosts, ", "), leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if fallback == nil {
+		return fmt.Errorf("no certificates found in %s", s.Dir)
+	}
+
+	s.lock.Lock()
+	s.names = names
+	s.fallback = fallback
+	s.fingerprint = fingerprint
+	s.lock.Unlock()
+
+	return nil
+}
+
+// Watch reloads the certificates every interval, the previous
+// certificates are kept when none can be loaded
+func (s *certStore) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.Load(); err != nil {
+			log.Printf("Unable to reload certificates: %s\n", err.Error())
+		}
+	}
+}
+
+// GetCertificate gives the certificate for the exact server name, then
+// a wildcard certificate for its parent domain, then the fallback
+func (s *certStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if cert, ok := s.names[name]; ok {
+		return cert, nil
+	}
+
+	if i := strings.Index(name, "."); i > 0 {
+		if cert, ok := s.names["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+
+	if s.fallback == nil {
+		return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+	}
+	return s.fallback, nil
+}
+
+// makeHSTSHandler tells browsers to only use HTTPS for the host
+func makeHSTSHandler(next http.Handler, maxAge time.Duration, includeSubdomains bool) http.Handler {
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// makeRedirectHandler sends plain HTTP requests to HTTPS, apart from
+// health checks from the orchestrator
+func makeRedirectHandler(next http.Handler, httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if len(httpsPort) > 0 && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for the hosts to certPath
+// and keyPath
+func writeCert(t *testing.T, certPath, keyPath string, hosts ...string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	os.MkdirAll(path.Dir(certPath), 0700)
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+func servedName(t *testing.T, certs *certStore, serverName string) string {
+	cert, err := certs.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func Test_certStore_GetCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edge-router-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A pair of files and a mounted Kubernetes secret
+	writeCert(t, path.Join(dir, "default.crt"), path.Join(dir, "default.key"), "*.example.xyz")
+	writeCert(t, path.Join(dir, "www-example-com", "tls.crt"), path.Join(dir, "www-example-com", "tls.key"), "www.example.com")
+
+	certs := newCertStore(dir)
+	if err := certs.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ServerName string
+		Want       string
+	}{
+		{"www.example.com", "www.example.com"},
+		{"WWW.Example.com", "www.example.com"},
+		{"alexellis.example.xyz", "*.example.xyz"},
+		{"unknown.example.org", "*.example.xyz"},
+		{"", "*.example.xyz"},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.ServerName, func(t *testing.T) {
+			if got := servedName(t, certs, testCase.ServerName); got != testCase.Want {
+				t.Errorf("certificate want: %s, got: %s", testCase.Want, got)
+			}
+		})
+	}
+}
+
+func Test_certStore_ReloadsOnChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edge-router-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCert(t, path.Join(dir, "default.crt"), path.Join(dir, "default.key"), "*.example.xyz")
+
+	certs := newCertStore(dir)
+	if err := certs.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := servedName(t, certs, "www.example.com"); got != "*.example.xyz" {
+		t.Fatalf("certificate want: %s, got: %s", "*.example.xyz", got)
+	}
+
+	writeCert(t, path.Join(dir, "www.crt"), path.Join(dir, "www.key"), "www.example.com")
+	if err := certs.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := servedName(t, certs, "www.example.com"); got != "www.example.com" {
+		t.Errorf("certificate want: %s, got: %s", "www.example.com", got)
+	}
+
+	// The previous certificates are kept when none can be loaded
+	os.Remove(path.Join(dir, "default.crt"))
+	os.Remove(path.Join(dir, "www.crt"))
+	if err := certs.Load(); err == nil {
+		t.Errorf("want error when no certificates are found")
+	}
+
+	if got := servedName(t, certs, "www.example.com"); got != "www.example.com" {
+		t.Errorf("certificate want: %s, got: %s", "www.example.com", got)
+	}
+}
+
+func Test_makeRedirectHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		Scenario string
+		Port     string
+		Host     string
+		Path     string
+		Status   int
+		Location string
+	}{
+		{"default port", "443", "alexellis.example.xyz:8080", "/fn1?q=1", http.StatusPermanentRedirect, "https://alexellis.example.xyz/fn1?q=1"},
+		{"other port", "8443", "www.example.com", "/", http.StatusPermanentRedirect, "https://www.example.com:8443/"},
+		{"health check", "443", "edge-router", "/healthz", http.StatusOK, ""},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, testCase.Path, nil)
+			req.Host = testCase.Host
+			rr := httptest.NewRecorder()
+
+			makeRedirectHandler(next, testCase.Port).ServeHTTP(rr, req)
+
+			if rr.Code != testCase.Status {
+				t.Errorf("status want: %d, got: %d", testCase.Status, rr.Code)
+			}
+			if got := rr.Header().Get("Location"); got != testCase.Location {
+				t.Errorf("location want: %s, got: %s", testCase.Location, got)
+			}
+		})
+	}
+}
+
+func Test_makeHSTSHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := makeHSTSHandler(next, time.Hour*24*365, true)
+
+	req := httptest.NewRequest(http.MethodGet, "https://www.example.com/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	want := "max-age=31536000; includeSubDomains"
+	if got := rr.Header().Get("Strict-Transport-Security"); got != want {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Strict-Transport-Security"); len(got) > 0 {
+		t.Errorf("want no header over HTTP, got: %q", got)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upgradeProxy tunnels requests which ask to upgrade the connection, such
+// as WebSockets, to the gateway. The tunnel is closed when no data has
+// been sent either way for IdleTimeout.
+type upgradeProxy struct {
+	IdleTimeout time.Duration
+	DialTimeout time.Duration
+
+	// TrustedProxies may set the X-Forwarded-Proto of the request
+	TrustedProxies []*net.IPNet
+
+	limiter *connLimiter
+}
+
+func newUpgradeProxy(idleTimeout, dialTimeout time.Duration, maxPerOwner int) *upgradeProxy {
+	return &upgradeProxy{
+		IdleTimeout: idleTimeout,
+		DialTimeout: dialTimeout,
+		limiter:     newConnLimiter(maxPerOwner),
+	}
+}
+
+// isUpgradeRequest is true when the client asks to switch protocols
+func isUpgradeRequest(r *http.Request) bool {
+	if len(r.Header.Get("Upgrade")) == 0 {
+		return false
+	}
+
+	for _, value := range r.Header["Connection"] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Serve sends the upgrade request to the upstream, when it agrees to
+// switch protocols the client's connection is hijacked and joined to
+// the upstream's until either side closes or the tunnel is idle.
+func (p *upgradeProxy) Serve(w http.ResponseWriter, r *http.Request, upstreamURL *url.URL, owner string) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection upgrade is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if !p.limiter.Acquire(owner) {
+		log.Printf("Upgrade rejected for %s, limit of %d connections reached\n", owner, p.limiter.Max)
+		http.Error(w, "too many open connections", http.StatusTooManyRequests)
+		return
+	}
+	defer p.limiter.Release(owner)
+
+	upstreamConn, err := p.dial(upstreamURL)
+	if err != nil {
+		log.Printf("Upgrade %s dial error: %s\n", upstreamURL, err.Error())
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer upstreamConn.Close()
+
+	req, err := newUpstreamRequest(r.Context(), r, upstreamURL.String(), p.TrustedProxies)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The hop-by-hop headers for the upgrade are needed by the upstream
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", r.Header.Get("Upgrade"))
+
+	upstreamConn.SetDeadline(time.Now().Add(p.DialTimeout))
+
+	if err := req.Write(upstreamConn); err != nil {
+		log.Printf("Upgrade %s write error: %s\n", upstreamURL, err.Error())
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	upstreamReader := bufio.NewReader(upstreamConn)
+	res, err := http.ReadResponse(upstreamReader, req)
+	if err != nil {
+		log.Printf("Upgrade %s read error: %s\n", upstreamURL, err.Error())
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Printf("Upstream %s status: %d\n", upstreamURL, res.StatusCode)
+
+	// The upstream declined, so its response is passed on as-is
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer res.Body.Close()
+
+		upstreamConn.SetDeadline(time.Time{})
+
+		copyHeaders(w.Header(), &res.Header)
+		removeHopHeaders(w.Header())
+		w.WriteHeader(res.StatusCode)
+		copyResponse(w, res.Body)
+		return
+	}
+
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("Upgrade hijack error: %s\n", err.Error())
+		return
+	}
+	defer clientConn.Close()
+
+	fmt.Fprintf(clientBuf, "HTTP/1.1 %s\r\n", res.Status)
+	res.Header.Write(clientBuf)
+	clientBuf.WriteString("\r\n")
+	if err := clientBuf.Flush(); err != nil {
+		log.Printf("Upgrade %s write error: %s\n", upstreamURL, err.Error())
+		return
+	}
+
+	log.Printf("Tunnel open to %s for %s\n", upstreamURL, owner)
+
+	p.tunnel(clientConn, clientBuf.Reader, upstreamConn, upstreamReader)
+
+	log.Printf("Tunnel closed to %s for %s\n", upstreamURL, owner)
+}
+
+// tunnel copies data both ways until either side closes, each read
+// extends the idle deadline of both connections. The readers hold any
+// data already buffered from their connection.
+func (p *upgradeProxy) tunnel(clientConn net.Conn, clientReader io.Reader, upstreamConn net.Conn, upstreamReader io.Reader) {
+	extend := func() {
+		deadline := time.Now().Add(p.IdleTimeout)
+		clientConn.SetDeadline(deadline)
+		upstreamConn.SetDeadline(deadline)
+	}
+	extend()
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst net.Conn, src io.Reader) {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				extend()
+				if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		done <- struct{}{}
+	}
+
+	go pipe(upstreamConn, clientReader)
+	go pipe(clientConn, upstreamReader)
+
+	// Closing both connections ends the other copy
+	<-done
+	clientConn.Close()
+	upstreamConn.Close()
+	<-done
+}
+
+func (p *upgradeProxy) dial(upstreamURL *url.URL) (net.Conn, error) {
+	host := upstreamURL.Host
+	if len(upstreamURL.Port()) == 0 {
+		if upstreamURL.Scheme == "https" {
+			host = net.JoinHostPort(upstreamURL.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(upstreamURL.Hostname(), "80")
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", host, p.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if upstreamURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: upstreamURL.Hostname()})
+		tlsConn.SetDeadline(time.Now().Add(p.DialTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+
+	return conn, nil
+}
+
+// connLimiter counts the open connections of each owner, a Max of 0
+// does not limit connections
+type connLimiter struct {
+	Max int
+
+	lock  sync.Mutex
+	conns map[string]int
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{
+		Max:   max,
+		conns: map[string]int{},
+	}
+}
+
+// Acquire is true when the owner may open another connection
+func (l *connLimiter) Acquire(owner string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.Max > 0 && l.conns[owner] >= l.Max {
+		return false
+	}
+	l.conns[owner]++
+	return true
+}
+
+// Release gives back a connection acquired by the owner
+func (l *connLimiter) Release(owner string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.conns[owner] <= 1 {
+		delete(l.conns, owner)
+		return
+	}
+	l.conns[owner]--
+}
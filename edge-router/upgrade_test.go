@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// echoUpgrade switches to an echo protocol and writes back each line
+type echoUpgrade struct {
+	Header http.Header
+}
+
+func (h *echoUpgrade) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Header = r.Header
+
+	if r.Header.Get("Upgrade") != "echo" {
+		http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	buf.Flush()
+
+	for {
+		line, err := buf.ReadString('\n')
+		if err != nil {
+			return
+		}
+		buf.WriteString(line)
+		buf.Flush()
+	}
+}
+
+func dialUpgrade(t *testing.T, routerURL, protocol string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", routerURL[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, routerURL+"/chat", nil)
+	req.Host = "alexellis.example.xyz"
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", protocol)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, res
+}
+
+func Test_isUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		Scenario   string
+		Connection string
+		Upgrade    string
+		Want       bool
+	}{
+		{Scenario: "websocket", Connection: "Upgrade", Upgrade: "websocket", Want: true},
+		{Scenario: "token in a list", Connection: "keep-alive, upgrade", Upgrade: "websocket", Want: true},
+		{Scenario: "no upgrade header", Connection: "Upgrade", Want: false},
+		{Scenario: "keep-alive only", Connection: "keep-alive", Upgrade: "websocket", Want: false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://alexellis.example.xyz/chat", nil)
+			r.Header.Set("Connection", testCase.Connection)
+			if len(testCase.Upgrade) > 0 {
+				r.Header.Set("Upgrade", testCase.Upgrade)
+			}
+
+			if got := isUpgradeRequest(r); got != testCase.Want {
+				t.Errorf("want %t, got %t", testCase.Want, got)
+			}
+		})
+	}
+}
+
+func Test_makeHandler_TunnelsUpgrade(t *testing.T) {
+	gatewayHandler := &echoUpgrade{}
+	gateway := httptest.NewServer(gatewayHandler)
+	defer gateway.Close()
+
+	upgrades := newUpgradeProxy(time.Second*5, time.Second*5, 10)
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*5, gateway.URL, nil, routerOptions{Upgrades: upgrades}),
+	})
+	defer router.Close()
+
+	conn, reader, res := dialUpgrade(t, router.URL, "echo")
+	defer conn.Close()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status want: %d, got: %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	if got := gatewayHandler.Header.Get("X-Forwarded-Host"); got != "alexellis.example.xyz" {
+		t.Errorf("X-Forwarded-Host want: %q, got: %q", "alexellis.example.xyz", got)
+	}
+
+	for _, want := range []string{"hello\n", "world\n"} {
+		conn.Write([]byte(want))
+
+		got, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("echo want: %q, got: %q", want, got)
+		}
+	}
+}
+
+func Test_makeHandler_UpgradeDeclined(t *testing.T) {
+	gateway := httptest.NewServer(&echoUpgrade{})
+	defer gateway.Close()
+
+	upgrades := newUpgradeProxy(time.Second*5, time.Second*5, 10)
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*5, gateway.URL, nil, routerOptions{Upgrades: upgrades}),
+	})
+	defer router.Close()
+
+	conn, _, res := dialUpgrade(t, router.URL, "websocket")
+	defer conn.Close()
+
+	if res.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("status want: %d, got: %d", http.StatusUpgradeRequired, res.StatusCode)
+	}
+}
+
+func Test_makeHandler_UpgradeLimitPerOwner(t *testing.T) {
+	gateway := httptest.NewServer(&echoUpgrade{})
+	defer gateway.Close()
+
+	upgrades := newUpgradeProxy(time.Second*5, time.Second*5, 1)
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*5, gateway.URL, nil, routerOptions{Upgrades: upgrades}),
+	})
+	defer router.Close()
+
+	first, _, res := dialUpgrade(t, router.URL, "echo")
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status want: %d, got: %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	second, _, res := dialUpgrade(t, router.URL, "echo")
+	second.Close()
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status want: %d, got: %d", http.StatusTooManyRequests, res.StatusCode)
+	}
+
+	first.Close()
+
+	// The connection is released once the tunnel closes
+	for i := 0; i < 50; i++ {
+		third, _, res := dialUpgrade(t, router.URL, "echo")
+		third.Close()
+		if res.StatusCode == http.StatusSwitchingProtocols {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Errorf("connection was not released after the tunnel closed")
+}
+
+func Test_makeHandler_UpgradeIdleTimeout(t *testing.T) {
+	gateway := httptest.NewServer(&echoUpgrade{})
+	defer gateway.Close()
+
+	upgrades := newUpgradeProxy(time.Millisecond*100, time.Second*5, 10)
+	router := httptest.NewServer(passHandler{
+		Next: makeHandler(http.DefaultClient, time.Second*5, gateway.URL, nil, routerOptions{Upgrades: upgrades}),
+	})
+	defer router.Close()
+
+	conn, reader, res := dialUpgrade(t, router.URL, "echo")
+	defer conn.Close()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status want: %d, got: %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Errorf("want the idle tunnel to be closed")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Errorf("tunnel was not closed by the router")
+	}
+}
+
+func Test_connLimiter(t *testing.T) {
+	limiter := newConnLimiter(2)
+
+	if !limiter.Acquire("alexellis") || !limiter.Acquire("alexellis") {
+		t.Fatalf("want two connections for alexellis")
+	}
+	if limiter.Acquire("alexellis") {
+		t.Errorf("want third connection for alexellis rejected")
+	}
+	if !limiter.Acquire("rgee0") {
+		t.Errorf("want connection for rgee0 as the limit is per owner")
+	}
+
+	limiter.Release("alexellis")
+	if !limiter.Acquire("alexellis") {
+		t.Errorf("want connection for alexellis after a release")
+	}
+
+	unlimited := newConnLimiter(0)
+	for i := 0; i < 5; i++ {
+		if !unlimited.Acquire("alexellis") {
+			t.Errorf("want no limit when max is 0")
+		}
+	}
+}
@@ -25,8 +25,7 @@ func (auth *FaaSAuth) Set(req *http.Request) error {
 }
 
 var (
-	timeout   = 5 * time.Second
-	namespace = ""
+	timeout = 5 * time.Second
 )
 
 // Handle grabs the logs for the fn that is named in the input
@@ -65,7 +64,15 @@ func Handle(req []byte) string {
 
 	ctx := context.Background()
 
-	formattedLogs, fmtErr := getFormattedLogs(*client, ctx, function)
+	namespace := sdk.FunctionNamespace(user)
+
+	var formattedLogs string
+	var fmtErr error
+	if len(namespace) > 0 {
+		formattedLogs, fmtErr = getNamespacedLogs(http.DefaultClient, gatewayURL, function, namespace)
+	} else {
+		formattedLogs, fmtErr = getFormattedLogs(*client, ctx, function)
+	}
 
 	if fmtErr != nil {
 		log.Fatalf("there was an error formatting logs for the function %q, %s", function, fmtErr)
@@ -91,6 +98,55 @@ func getFormattedLogs(client faasSDK.Client, ctx context.Context, function strin
 	return formattedLogs, nil
 }
 
+// getNamespacedLogs queries the gateway for the logs of a function outside of
+// the default namespace, which the logs request of the faas-cli client cannot do
+func getNamespacedLogs(c *http.Client, gatewayURL string, function string, namespace string) (string, error) {
+	if len(function) == 0 {
+		return "", errors.New("function name was empty, please provide a valid function name")
+	}
+
+	query := url.Values{}
+	query.Set("name", function)
+	query.Set("namespace", namespace)
+	query.Set("follow", "false")
+	query.Set("since", time.Now().Add(-1*time.Minute*30).Format(time.RFC3339))
+
+	req, _ := http.NewRequest(http.MethodGet, strings.TrimRight(gatewayURL, "/")+"/system/logs?"+query.Encode(), nil)
+	if err := sdk.AddBasicAuth(req); err != nil {
+		return "", fmt.Errorf("unable to add basic auth: %s", err.Error())
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to query logs, message: %s", err.Error())
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to query logs, status code: %d", res.StatusCode)
+	}
+
+	logChan := make(chan logs.Message)
+	go func() {
+		defer close(logChan)
+
+		decoder := json.NewDecoder(res.Body)
+		for decoder.More() {
+			msg := logs.Message{}
+			if err := decoder.Decode(&msg); err != nil {
+				log.Printf("cannot parse log results: %s", err.Error())
+				return
+			}
+			logChan <- msg
+		}
+	}()
+
+	return formatLogs(logChan), nil
+}
+
 func isUserFunction(function string, gatewayURL string, user string) (bool, error) {
 
 	if len(user) == 0 {
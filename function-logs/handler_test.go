@@ -2,6 +2,9 @@ package function
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/openfaas/faas-provider/logs"
@@ -185,3 +188,27 @@ func createLogMessageChan(messages []string) chan logs.Message {
 	}()
 	return logChan
 }
+
+func Test_getNamespacedLogs(t *testing.T) {
+	var gotQuery url.Values
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query()
+		w.Write([]byte(`{"name":"alexellis-fn1","text":"line one\n"}
+{"name":"alexellis-fn1","text":"line two\n"}
+`))
+	}))
+	defer gateway.Close()
+
+	got, err := getNamespacedLogs(http.DefaultClient, gateway.URL+"/", "alexellis-fn1", "openfaas-fn-alexellis")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if got != "line one\nline two" {
+		t.Errorf("unexpected logs: %q", got)
+	}
+
+	if gotQuery.Get("namespace") != "openfaas-fn-alexellis" || gotQuery.Get("name") != "alexellis-fn1" {
+		t.Errorf("unexpected query: %v", gotQuery)
+	}
+}
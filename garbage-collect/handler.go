@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -17,19 +18,21 @@ import (
 )
 
 const (
-	Source    = "garbage-collect"
-	namespace = ""
+	Source = "garbage-collect"
 )
 
 var timeout = 3 * time.Second
 
 //FaaSAuth Authentication type for OpenFaaS
 type FaaSAuth struct {
+	// Target is the gateway to authenticate with, when empty
+	// the credentials of the local gateway are used
+	Target sdk.DeployTarget
 }
 
 //Set add basic authentication to the request
 func (auth *FaaSAuth) Set(req *http.Request) error {
-	return sdk.AddBasicAuth(req)
+	return auth.Target.AddBasicAuth(req)
 }
 
 // Handle function cleans up functions which were removed or renamed
@@ -54,45 +57,86 @@ func Handle(req []byte) string {
 	}
 
 	gatewayURL := os.Getenv("gateway_url")
-	deployedFunctions, err := listFunctions(owner, gatewayURL)
 
+	targets, err := sdk.ReadDeployTargets()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	deployedList := ""
-	for _, fn := range deployedFunctions {
-		deployedList += fn.GetOwner() + "/" + fn.GetRepo() + ", "
-	}
+	// A target which cannot be reached does not stop the functions on
+	// the others from being removed, the errors are reported at the end
+	deleted := 0
+	failures := []string{}
+	for _, target := range targets.Targets {
+		client := faasSDK.NewClient(&FaaSAuth{Target: target}, target.GatewayURL, nil, &timeout)
+		namespace := target.FunctionNamespace(owner)
+
+		var deployedFunctions []openFaaSFunction
+		if target.IsLocal() {
+			deployedFunctions, err = listFunctions(owner, gatewayURL)
+		} else {
+			deployedFunctions, err = listTargetFunctions(client, owner, namespace)
+		}
 
-	log.Printf("Functions owned by %s:\n %s", owner, strings.Trim(deployedList, ", "))
+		if err != nil {
+			log.Printf("Unable to list functions on %s: %s", target.GatewayURL, err.Error())
+			failures = append(failures, fmt.Sprintf("%s: %s", target.GatewayURL, err.Error()))
+			continue
+		}
 
-	client := faasSDK.NewClient(&FaaSAuth{}, gatewayURL, nil, &timeout)
-	deleted := 0
-	for _, fn := range deployedFunctions {
-		if garbageReq.Repo == "*" ||
-			(fn.GetRepo() == garbageReq.Repo && !included(&fn, owner, garbageReq.Functions)) {
-			log.Printf("Delete: %s\n", fn.Name)
-			err = client.DeleteFunction(context.Background(), fn.Name, namespace)
-			if err != nil {
-				auditEvent := sdk.AuditEvent{
-					Message: fmt.Sprintf("Unable to delete function: `%s`", fn.Name),
-					Source:  Source,
+		deployedList := ""
+		for _, fn := range deployedFunctions {
+			deployedList += fn.GetOwner() + "/" + fn.GetRepo() + ", "
+		}
+
+		log.Printf("Functions owned by %s on %s:\n %s", owner, target.GatewayURL, strings.Trim(deployedList, ", "))
+
+		for _, fn := range deployedFunctions {
+			if garbageReq.Repo == "*" ||
+				(fn.GetRepo() == garbageReq.Repo && !included(&fn, owner, garbageReq.Functions)) {
+				log.Printf("Delete: %s\n", fn.Name)
+				err = client.DeleteFunction(context.Background(), fn.Name, namespace)
+				if err != nil {
+					auditEvent := sdk.AuditEvent{
+						Type:     sdk.AuditFunctionDeleteFailed,
+						Message:  fmt.Sprintf("Unable to delete function: `%s`", fn.Name),
+						Owner:    owner,
+						Repo:     fn.GetRepo(),
+						Function: fn.Name,
+						Error:    err.Error(),
+						Source:   Source,
+					}
+					sdk.PostAudit(auditEvent)
+					log.Println(err)
+
+					failures = append(failures, fmt.Sprintf("%s: %s", fn.Name, err.Error()))
+					continue
 				}
-				sdk.PostAudit(auditEvent)
-				log.Println(err)
+				deleted = deleted + 1
 			}
-			deleted = deleted + 1
 		}
 	}
 
+	message := fmt.Sprintf("Garbage collection ran for %s/%s - %d functions deleted.", garbageReq.Owner, garbageReq.Repo, deleted)
+
 	auditEvent := sdk.AuditEvent{
-		Message: fmt.Sprintf("Garbage collection ran for %s/%s - %d functions deleted.", garbageReq.Owner, garbageReq.Repo, deleted),
+		Type:    sdk.AuditGarbageCollected,
+		Message: message,
+		Owner:   garbageReq.Owner,
+		Repo:    garbageReq.Repo,
 		Source:  Source,
 	}
+	if len(failures) > 0 {
+		auditEvent.Error = strings.Join(failures, "; ")
+		auditEvent.Severity = sdk.SeverityWarning
+	}
 	sdk.PostAudit(auditEvent)
 
-	return fmt.Sprintf("Garbage collection ran for %s/%s - %d functions deleted.", garbageReq.Owner, garbageReq.Repo, deleted)
+	if len(failures) > 0 {
+		log.Fatalf("%s Errors: %s", message, strings.Join(failures, "; "))
+	}
+
+	return message
 }
 
 func validateRequestSigning(req []byte) (err error) {
@@ -118,9 +162,14 @@ func formatCloudName(name, owner string) string {
 }
 
 func included(fn *openFaaSFunction, owner string, functionStack []string) bool {
+	// A canary is kept for as long as its stable function is
+	fnName := fn.Name
+	if sdk.IsCanary(fn.Labels) {
+		fnName = sdk.StableName(fn.Name)
+	}
 
 	for _, name := range functionStack {
-		if strings.EqualFold(formatCloudName(name, owner), fn.Name) {
+		if strings.EqualFold(formatCloudName(name, owner), fnName) {
 			return true
 		}
 	}
@@ -129,33 +178,56 @@ func included(fn *openFaaSFunction, owner string, functionStack []string) bool {
 }
 
 func listFunctions(owner, gatewayURL string) ([]openFaaSFunction, error) {
+	request, _ := http.NewRequest(http.MethodGet, gatewayURL+"/function/list-functions?user="+url.QueryEscape(owner), nil)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
 
-	var err error
+	if response.Body != nil {
+		defer response.Body.Close()
+	}
 
-	request, _ := http.NewRequest(http.MethodGet, gatewayURL+"/function/list-functions?user="+owner, nil)
+	bodyBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
 
-	response, err := http.DefaultClient.Do(request)
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from list-functions", response.StatusCode)
+	}
 
-	if err == nil {
-		if response.Body != nil {
-			defer response.Body.Close()
+	functions := []openFaaSFunction{}
+	if err := json.Unmarshal(bodyBytes, &functions); err != nil {
+		return nil, err
+	}
 
-			bodyBytes, bErr := ioutil.ReadAll(response.Body)
-			if bErr != nil {
-				log.Fatal(bErr)
-			}
+	return functions, nil
+}
 
-			functions := []openFaaSFunction{}
-			mErr := json.Unmarshal(bodyBytes, &functions)
-			if mErr != nil {
-				log.Fatal(mErr)
-			}
+// listTargetFunctions lists the owner's functions on a target other than
+// the local gateway, which has no list-functions function to call
+func listTargetFunctions(client *faasSDK.Client, owner, namespace string) ([]openFaaSFunction, error) {
+	functions, err := client.ListFunctions(context.Background(), namespace)
+	if err != nil {
+		return nil, err
+	}
 
-			return functions, nil
+	owned := []openFaaSFunction{}
+	for _, fn := range functions {
+		if fn.Labels == nil || !strings.EqualFold((*fn.Labels)[sdk.FunctionLabelPrefix+"git-owner"], owner) {
+			continue
 		}
+
+		owned = append(owned, openFaaSFunction{
+			Name:   fn.Name,
+			Image:  fn.Image,
+			Labels: *fn.Labels,
+		})
 	}
 
-	return nil, fmt.Errorf("no functions found for user: %s", owner)
+	return owned, nil
 }
 
 type GarbageRequest struct {
@@ -27,6 +27,9 @@ const (
 	GitHub = "github"
 )
 
+// pipelineSpan covers the work done by git-tar for a push
+var pipelineSpan *sdk.Span
+
 // Handle clones the git repo and checks out the SHA then uses the
 // OpenFaaS CLI to shrinkwrap a tarball to be build with Docker
 func Handle(req []byte) []byte {
@@ -55,6 +58,18 @@ func Handle(req []byte) []byte {
 		os.Exit(-1)
 	}
 
+	// The build ID is passed by github-push, older versions did not set it
+	if len(pushEvent.BuildID) == 0 {
+		pushEvent.BuildID = sdk.BuildID(pushEvent.Repository.Owner.Login, pushEvent.Repository.Name, pushEvent.AfterCommitID)
+	}
+
+	log.Printf("Build %s for %s@%s", pushEvent.BuildID, pushEvent.Repository.FullName, pushEvent.AfterCommitID)
+
+	pipelineSpan = sdk.StartSpan(Source, Source, pushEvent.BuildID)
+	pipelineSpan.SetAttribute("owner", pushEvent.Repository.Owner.Login)
+	pipelineSpan.SetAttribute("repo", pushEvent.Repository.Name)
+	pipelineSpan.SetAttribute("sha", pushEvent.AfterCommitID)
+
 	statusEvent := sdk.BuildEventFromPushEvent(pushEvent)
 	status := sdk.BuildStatus(statusEvent, sdk.EmptyAuthToken)
 
@@ -70,7 +85,7 @@ func Handle(req []byte) []byte {
 			log.Printf(statusErr.Error())
 		}
 
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	if !hasStackFile {
@@ -83,15 +98,12 @@ func Handle(req []byte) []byte {
 			log.Printf(statusErr.Error())
 		}
 
-		auditEvent := sdk.AuditEvent{
-			Message: msg,
-			Owner:   pushEvent.Repository.Owner.Login,
-			Repo:    pushEvent.Repository.Name,
-			Source:  Source,
-		}
+		auditEvent := newAuditEvent(pushEvent, sdk.AuditPushRejected)
+		auditEvent.Message = msg
+		auditEvent.Error = msg
 		sdk.PostAudit(auditEvent)
 
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	fetcher := GitRepoFetcher{}
@@ -105,7 +117,7 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	if _, err := os.Stat(path.Join(clonePath, "template")); err == nil {
@@ -116,7 +128,7 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	stack, err := parseYAML(clonePath)
@@ -127,7 +139,7 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	if hasDockerfileFunction(stack.Functions) && !isDockerfileEnabled() {
@@ -136,7 +148,25 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(1)
+		exit(1)
+	}
+
+	if quotaErr := checkQuota(pushEvent, stack); quotaErr != nil {
+		msg := quotaErr.Error()
+		log.Println(msg)
+
+		status.AddStatus(sdk.StatusFailure, msg, sdk.StackContext)
+		statusErr := reportStatus(status, pushEvent.SCM)
+		if statusErr != nil {
+			log.Printf(statusErr.Error())
+		}
+
+		auditEvent := newAuditEvent(pushEvent, sdk.AuditPushRejected)
+		auditEvent.Message = fmt.Sprintf("git-tar rejected push: %s", msg)
+		auditEvent.Error = msg
+		sdk.PostAudit(auditEvent)
+
+		exit(-1)
 	}
 
 	err = fetchTemplates(clonePath)
@@ -149,7 +179,7 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	err = checkCompatibleTemplates(stack, clonePath)
@@ -162,7 +192,7 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	var shrinkWrapPath string
@@ -176,7 +206,7 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	var tars []tarEntry
@@ -190,7 +220,7 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	err = importSecrets(pushEvent, stack, clonePath)
@@ -203,7 +233,7 @@ func Handle(req []byte) []byte {
 		if statusErr != nil {
 			log.Printf(statusErr.Error())
 		}
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	err = deploy(tars, pushEvent, stack, status, payloadSecret)
@@ -218,7 +248,7 @@ func Handle(req []byte) []byte {
 			log.Printf(statusErr.Error())
 		}
 
-		os.Exit(-1)
+		exit(-1)
 	}
 
 	status.AddStatus(sdk.StatusSuccess, "stack is successfully deployed", sdk.StackContext)
@@ -241,17 +271,39 @@ func Handle(req []byte) []byte {
 
 	deploymentMessage := fmt.Sprintf("Deployed: %s, time taken: %.2fs", strings.TrimRight(tarMsg, ", "), completed.Seconds())
 
-	auditEvent := sdk.AuditEvent{
-		Message: deploymentMessage,
-		Owner:   pushEvent.Repository.Owner.Login,
-		Repo:    pushEvent.Repository.Name,
-		Source:  Source,
-	}
+	auditEvent := newAuditEvent(pushEvent, sdk.AuditPushCompleted)
+	auditEvent.Message = deploymentMessage
+	auditEvent.Duration = completed
 	sdk.PostAudit(auditEvent)
 
+	pipelineSpan.Finish()
+
 	return []byte(deploymentMessage + "\n")
 }
 
+// exit finishes the span for the build before exiting
+func exit(code int) {
+	if pipelineSpan != nil {
+		pipelineSpan.Finish()
+	}
+	os.Exit(code)
+}
+
+// newAuditEvent gives an audit event of the given type for the push
+func newAuditEvent(pushEvent sdk.PushEvent, eventType sdk.AuditEventType) sdk.AuditEvent {
+	owner := pushEvent.Repository.Owner.Login
+	repo := pushEvent.Repository.Name
+
+	return sdk.AuditEvent{
+		Type:    eventType,
+		Owner:   owner,
+		Repo:    repo,
+		Source:  Source,
+		SHA:     pushEvent.AfterCommitID,
+		BuildID: pushEvent.BuildID,
+	}
+}
+
 func garbageCollect(pushEvent sdk.PushEvent, stack *stack.Services) error {
 	var err error
 
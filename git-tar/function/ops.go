@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -402,12 +403,9 @@ func deployFunction(tarEntry tarEntry, pushEvent sdk.PushEvent, stack *stack.Ser
 
 		log.Printf("%s\n", msg)
 
-		auditEvent := sdk.AuditEvent{
-			Message: msg,
-			Owner:   pushEvent.Repository.Owner.Login,
-			Repo:    pushEvent.Repository.Name,
-			Source:  Source,
-		}
+		auditEvent := newAuditEvent(pushEvent, sdk.AuditBuildStarted)
+		auditEvent.Message = msg
+		auditEvent.Function = sdk.FormatServiceName(pushEvent.Repository.Owner.Login, tarEntry.functionName)
 		sdk.PostAudit(auditEvent)
 	}
 
@@ -424,6 +422,10 @@ func deployFunction(tarEntry tarEntry, pushEvent sdk.PushEvent, stack *stack.Ser
 
 	httpReq.Header.Add(sdk.CloudSignatureHeader, "sha1="+hex.EncodeToString(digest))
 
+	if pipelineSpan != nil {
+		pipelineSpan.Inject(httpReq)
+	}
+
 	httpReq.Header.Add("Repo", repoName)
 	httpReq.Header.Add("Owner", owner)
 	httpReq.Header.Add("Url", url)
@@ -470,6 +472,17 @@ func deployFunction(tarEntry tarEntry, pushEvent sdk.PushEvent, stack *stack.Ser
 		httpReq.Header.Add("Annotations", string(jsonBytes))
 	}
 
+	// Marshal limits and requests, these are checked against the operator's bounds by buildshiprun
+	if limits := stack.Functions[tarEntry.functionName].Limits; limits != nil {
+		jsonBytes, _ := json.Marshal(sdk.FunctionResources{Memory: limits.Memory, CPU: limits.CPU})
+		httpReq.Header.Add("Limits", string(jsonBytes))
+	}
+
+	if requests := stack.Functions[tarEntry.functionName].Requests; requests != nil {
+		jsonBytes, _ := json.Marshal(sdk.FunctionResources{Memory: requests.Memory, CPU: requests.CPU})
+		httpReq.Header.Add("Requests", string(jsonBytes))
+	}
+
 	res, reqErr := http.DefaultClient.Do(httpReq)
 
 	if reqErr != nil {
@@ -541,12 +554,8 @@ func importSecrets(pushEvent sdk.PushEvent, stack *stack.Services, clonePath str
 		return fmt.Errorf("import-secrets returned unknown error, status: %d", res.StatusCode)
 	}
 
-	auditEvent := sdk.AuditEvent{
-		Message: fmt.Sprintf("Parsed sealed secrets for owner: %s. Parsed %d secrets, from %d functions", owner, secretCount, len(stack.Functions)),
-		Owner:   pushEvent.Repository.Owner.Login,
-		Repo:    pushEvent.Repository.Name,
-		Source:  Source,
-	}
+	auditEvent := newAuditEvent(pushEvent, sdk.AuditSecretsImported)
+	auditEvent.Message = fmt.Sprintf("Parsed sealed secrets for owner: %s. Parsed %d secrets, from %d functions", owner, secretCount, len(stack.Functions))
 
 	sdk.PostAudit(auditEvent)
 
@@ -575,6 +584,14 @@ func formatTemplateRepos() ([]string, []error) {
 }
 
 func reportStatus(status *sdk.Status, SCM string) error {
+	if pipelineSpan != nil {
+		for _, commitStatus := range status.CommitStatuses {
+			if commitStatus.Status == sdk.StatusFailure {
+				pipelineSpan.SetError(errors.New(commitStatus.Description))
+			}
+		}
+	}
+
 	if SCM == GitHub {
 		reportGitHubStatus(status)
 	} else if SCM == GitLab {
@@ -609,6 +626,9 @@ func reportGitLabStatus(status *sdk.Status) {
 
 	digest := hmac.Sign(statusBytes, []byte(payloadSecret))
 	req.Header.Add(sdk.CloudSignatureHeader, "sha1="+hex.EncodeToString(digest))
+	if len(status.EventInfo.BuildID) > 0 {
+		req.Header.Add(sdk.BuildIDHeader, status.EventInfo.BuildID)
+	}
 
 	res, resErr := http.DefaultClient.Do(req)
 	if resErr != nil {
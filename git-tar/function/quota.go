@@ -0,0 +1,165 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/openfaas/faas-cli/stack"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// deployHistoryPageSize is the largest page served by deploy-history
+const deployHistoryPageSize = 100
+
+type ownerFunction struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+}
+
+type deployRecordPage struct {
+	Records []sdk.DeployRecord `json:"records"`
+	Total   int                `json:"total"`
+}
+
+// checkQuota rejects a push which would take the owner over their
+// maximum number of functions or builds per hour.
+func checkQuota(pushEvent sdk.PushEvent, services *stack.Services) error {
+	owner := pushEvent.Repository.Owner.Login
+
+	// A quota which cannot be read or checked rejects the push, so that
+	// the limits are never skipped when a dependency is unavailable
+	quotas, err := sdk.ReadQuotas()
+	if err != nil {
+		return fmt.Errorf("unable to check quota: %s", err.Error())
+	}
+	quota := quotas.Get(owner)
+
+	gatewayURL := os.Getenv("gateway_url")
+
+	if quota.MaxFunctions > 0 {
+		functions, err := listOwnerFunctions(gatewayURL, owner)
+		if err != nil {
+			return fmt.Errorf("unable to check quota: %s", err.Error())
+		}
+
+		if err := quota.CheckFunctions(countFunctions(functions, pushEvent.Repository.Name, services)); err != nil {
+			return err
+		}
+	}
+
+	if quota.MaxBuildsPerHour > 0 {
+		builds, err := countBuildsSince(gatewayURL, owner, time.Now().Add(-time.Hour))
+		if err != nil {
+			return fmt.Errorf("unable to check quota: %s", err.Error())
+		}
+
+		if err := quota.CheckBuilds(builds + len(services.Functions)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countFunctions gives the number of functions the owner will have
+// once the repo's functions are deployed, canaries are not counted.
+func countFunctions(functions []ownerFunction, repo string, services *stack.Services) int {
+	count := len(services.Functions)
+
+	for _, fn := range functions {
+		if sdk.IsCanary(fn.Labels) {
+			continue
+		}
+		if fn.Labels[sdk.FunctionLabelPrefix+"git-repo"] != repo {
+			count++
+		}
+	}
+
+	return count
+}
+
+func listOwnerFunctions(gatewayURL, owner string) ([]ownerFunction, error) {
+	functions := []ownerFunction{}
+
+	body, err := getJSON(gatewayURL + "function/list-functions?user=" + url.QueryEscape(owner))
+	if err != nil {
+		return functions, err
+	}
+
+	err = json.Unmarshal(body, &functions)
+	return functions, err
+}
+
+// countBuildsSince counts the deploy-history records for the owner
+// which were written after since.
+func countBuildsSince(gatewayURL, owner string, since time.Time) (int, error) {
+	count := 0
+
+	// A build deployed to several targets has a record for each
+	counted := map[string]bool{}
+
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("user", owner)
+		query.Set("page", strconv.Itoa(page))
+		query.Set("page_size", strconv.Itoa(deployHistoryPageSize))
+
+		body, err := getJSON(gatewayURL + "function/deploy-history?" + query.Encode())
+		if err != nil {
+			return count, err
+		}
+
+		records := deployRecordPage{}
+		if err := json.Unmarshal(body, &records); err != nil {
+			return count, err
+		}
+
+		// Records are sorted newest first
+		for _, record := range records.Records {
+			if record.Timestamp.Before(since) {
+				return count, nil
+			}
+
+			build := record.Function + "@" + record.SHA
+			if len(record.Target) > 0 && counted[build] {
+				continue
+			}
+			counted[build] = true
+			count++
+		}
+
+		if len(records.Records) == 0 || page*deployHistoryPageSize >= records.Total {
+			return count, nil
+		}
+	}
+}
+
+func getJSON(uri string) ([]byte, error) {
+	req, _ := http.NewRequest(http.MethodGet, uri, nil)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", res.StatusCode, uri)
+	}
+
+	return body, nil
+}
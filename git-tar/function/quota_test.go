@@ -0,0 +1,103 @@
+package function
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-cli/stack"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func Test_countFunctions(t *testing.T) {
+	services := &stack.Services{
+		Functions: map[string]stack.Function{
+			"fn1": {},
+			"fn2": {},
+		},
+	}
+
+	repoLabel := sdk.FunctionLabelPrefix + "git-repo"
+	functions := []ownerFunction{
+		{Name: "alexellis-fn1", Labels: map[string]string{repoLabel: "repo1"}},
+		{Name: "alexellis-fn1-canary", Labels: map[string]string{repoLabel: "repo1", sdk.CanaryLabel: "1"}},
+		{Name: "alexellis-fn3", Labels: map[string]string{repoLabel: "repo2"}},
+	}
+
+	if got := countFunctions(functions, "repo1", services); got != 3 {
+		t.Errorf("want 3 functions, got: %d", got)
+	}
+}
+
+func Test_countBuildsSince(t *testing.T) {
+	now := time.Now()
+	records := []sdk.DeployRecord{}
+	for i := 0; i < 150; i++ {
+		records = append(records, sdk.DeployRecord{Timestamp: now.Add(-time.Duration(i) * time.Minute)})
+	}
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := deployRecordPage{Total: len(records)}
+		if r.URL.Query().Get("page") == "1" {
+			page.Records = records[:deployHistoryPageSize]
+		} else {
+			page.Records = records[deployHistoryPageSize:]
+		}
+		bytesOut, _ := json.Marshal(page)
+		w.Write(bytesOut)
+	}))
+	defer gateway.Close()
+
+	got, err := countBuildsSince(gateway.URL+"/", "alexellis", now.Add(-time.Hour).Add(-time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if got != 61 {
+		t.Errorf("want 61 builds in the last hour, got: %d", got)
+	}
+}
+
+func Test_countBuildsSince_CountsEachBuildOnceAcrossTargets(t *testing.T) {
+	now := time.Now()
+	records := []sdk.DeployRecord{
+		{Function: "fn1", SHA: "abc", Target: "eu-west", Timestamp: now},
+		{Function: "fn1", SHA: "abc", Target: "us-east", Timestamp: now},
+		{Function: "fn2", SHA: "abc", Target: "eu-west", Timestamp: now},
+	}
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bytesOut, _ := json.Marshal(deployRecordPage{Total: len(records), Records: records})
+		w.Write(bytesOut)
+	}))
+	defer gateway.Close()
+
+	got, err := countBuildsSince(gateway.URL+"/", "alexellis", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if got != 2 {
+		t.Errorf("want 2 builds, got: %d", got)
+	}
+}
+
+func Test_checkQuota_UnreadableFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "git-tar")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("quotas_path", path.Join(dir, "missing.json"))
+	defer os.Unsetenv("quotas_path")
+
+	pushEvent := sdk.PushEvent{}
+	pushEvent.Repository.Owner.Login = "alexellis"
+
+	if err := checkQuota(pushEvent, &stack.Services{}); err == nil {
+		t.Errorf("want push rejected when the quotas cannot be read")
+	}
+}
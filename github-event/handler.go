@@ -73,6 +73,7 @@ func Handle(req []byte) string {
 		eventHeader != "installation" {
 
 		auditEvent := sdk.AuditEvent{
+			Type:    sdk.AuditWebhookRejected,
 			Message: "bad event: " + eventHeader,
 			Source:  Source,
 		}
@@ -110,14 +111,27 @@ func Handle(req []byte) string {
 			}
 		}
 
+		// The build ID is created here, at the start of the pipeline
+		buildID := sdk.NewBuildID()
+		span := sdk.StartSpan(Source, Source, buildID)
+		span.SetAttribute("owner", customer.Repository.Owner.Login)
+		span.SetAttribute("repo", customer.Repository.Name)
+		span.SetAttribute("sha", customer.AfterCommitID)
+
+		log.Printf("Build %s for %s@%s", buildID, customer.Repository.FullName, customer.AfterCommitID)
+
 		headers := map[string]string{
-			"X-Hub-Signature": xHubSignature,
-			"X-GitHub-Event":  eventHeader,
-			"Content-Type":    "application/json",
+			"X-Hub-Signature":     xHubSignature,
+			"X-GitHub-Event":      eventHeader,
+			"Content-Type":        "application/json",
+			sdk.BuildIDHeader:     buildID,
+			sdk.TraceParentHeader: span.TraceParent(),
 		}
 
 		forwardTo := "github-push"
 		body, statusCode, err := forward(req, forwardTo, headers)
+		span.SetError(err)
+		span.Finish()
 
 		if statusCode == http.StatusOK {
 			return fmt.Sprintf("[%s]: %d, %s", forwardTo, statusCode, body)
@@ -185,7 +199,9 @@ func Handle(req []byte) string {
 			}
 
 			auditEvent := sdk.AuditEvent{
+				Type:    sdk.AuditInstallationChanged,
 				Message: event.Installation.Account.Login + " added repositories: " + addedVal,
+				Owner:   event.Installation.Account.Login,
 				Source:  Source,
 			}
 
@@ -244,8 +260,13 @@ func validateCustomers(pushEvent *sdk.PushEvent, customers *sdk.Customers) error
 		}
 
 		auditEvent := sdk.AuditEvent{
+			Type:    sdk.AuditPushRejected,
 			Message: "Customer not found",
 			Owner:   owner,
+			Repo:    pushEvent.Repository.Name,
+			SHA:     pushEvent.AfterCommitID,
+			BuildID: sdk.BuildID(owner, pushEvent.Repository.Name, pushEvent.AfterCommitID),
+			Error:   notFound.Error(),
 			Source:  Source,
 		}
 
@@ -309,8 +330,11 @@ func forward(req []byte, function string, headers map[string]string) (string, in
 	if err != nil {
 		msg := "cannot post to " + function + ": " + err.Error()
 		auditEvent := sdk.AuditEvent{
-			Message: msg,
-			Source:  Source,
+			Type:     sdk.AuditDispatchFailed,
+			Message:  msg,
+			Function: function,
+			Error:    err.Error(),
+			Source:   Source,
 		}
 		sdk.PostAudit(auditEvent)
 		return "", http.StatusInternalServerError, fmt.Errorf(msg)
@@ -63,6 +63,18 @@ func Handle(req []byte) string {
 
 	pushEvent.SCM = SCM
 
+	// github-event creates the build ID, older versions did not pass one
+	pushEvent.BuildID = sdk.BuildIDFromEnv()
+	if len(pushEvent.BuildID) == 0 {
+		pushEvent.BuildID = sdk.NewBuildID()
+	}
+
+	span := sdk.StartSpan(Source, Source, pushEvent.BuildID)
+	span.SetAttribute("owner", pushEvent.Repository.Owner.Login)
+	span.SetAttribute("repo", pushEvent.Repository.Name)
+	span.SetAttribute("sha", pushEvent.AfterCommitID)
+	defer span.Finish()
+
 	eventInfo := sdk.BuildEventFromPushEvent(pushEvent)
 	status := sdk.BuildStatus(eventInfo, sdk.EmptyAuthToken)
 
@@ -88,8 +100,9 @@ func Handle(req []byte) string {
 	status.AddStatus(sdk.StatusPending, fmt.Sprintf("%s stack deploy is in progress", serviceValue), sdk.StackContext)
 	reportGitHubStatus(status)
 
-	statusCode, postErr := postEvent(pushEvent)
+	statusCode, postErr := postEvent(pushEvent, span)
 	if postErr != nil {
+		span.SetError(postErr)
 		status.AddStatus(sdk.StatusFailure, postErr.Error(), sdk.StackContext)
 		reportGitHubStatus(status)
 		return postErr.Error()
@@ -99,6 +112,8 @@ func Handle(req []byte) string {
 		Message: "Git-tar invoked",
 		Owner:   pushEvent.Repository.Owner.Login,
 		Repo:    pushEvent.Repository.Name,
+		SHA:     pushEvent.AfterCommitID,
+		BuildID: pushEvent.BuildID,
 		Source:  Source,
 	}
 
@@ -111,7 +126,7 @@ func formatPushEvent(pushEvent sdk.PushEvent) string {
 	return pushEvent.Repository.Owner.Login + "/" + pushEvent.Repository.Name + "@" + pushEvent.Ref + "#" + pushEvent.Ref + " [" + pushEvent.Repository.CloneURL + "]"
 }
 
-func postEvent(pushEvent sdk.PushEvent) (int, error) {
+func postEvent(pushEvent sdk.PushEvent, span *sdk.Span) (int, error) {
 	gatewayURL := os.Getenv("gateway_url")
 
 	payloadSecret, err := sdk.ReadSecret("payload-secret")
@@ -127,6 +142,7 @@ func postEvent(pushEvent sdk.PushEvent) (int, error) {
 
 	digest := hmac.Sign(body, []byte(payloadSecret))
 	httpReq.Header.Add(sdk.CloudSignatureHeader, "sha1="+hex.EncodeToString(digest))
+	span.Inject(httpReq)
 
 	res, reqErr := c.Do(httpReq)
 
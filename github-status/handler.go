@@ -87,13 +87,21 @@ func Handle(req []byte) string {
 		log.Printf("auth token is created")
 	}
 
+	span := sdk.StartSpan("github-status", "github-status", status.EventInfo.BuildID)
+	span.SetAttribute("owner", status.EventInfo.Owner)
+	span.SetAttribute("repo", status.EventInfo.Repository)
+
 	for _, commitStatus := range status.CommitStatuses {
 		err := reportToGithub(&commitStatus, &status.EventInfo)
 		if err != nil {
+			span.SetError(err)
+			span.Finish()
 			log.Fatalf("failed to report status %v, error: %s", status, err.Error())
 		}
 	}
 
+	span.Finish()
+
 	// marshal token
 	token = sdk.MarshalToken(token)
 
@@ -130,13 +130,26 @@ func Handle(req []byte) string {
 			return fmt.Sprintf("error while trying to connect to GitLab API: %s", err.Error())
 		}
 		if installed {
+			// The build ID is created here, at the start of the pipeline
+			buildID := sdk.NewBuildID()
+			span := sdk.StartSpan(Source, Source, buildID)
+			span.SetAttribute("owner", username)
+			span.SetAttribute("repo", eventInfo.GitLabProject.Name)
+			span.SetAttribute("sha", eventInfo.AfterCommitID)
+
+			log.Printf("Build %s for %s@%s", buildID, eventInfo.GitLabProject.PathWithNamespace, eventInfo.AfterCommitID)
+
 			headers := map[string]string{
-				"X-Gitlab-Token": xGitlabToken,
-				"X-Gitlab-Event": eventHeader,
-				"Content-Type":   "application/json",
+				"X-Gitlab-Token":      xGitlabToken,
+				"X-Gitlab-Event":      eventHeader,
+				"Content-Type":        "application/json",
+				sdk.BuildIDHeader:     buildID,
+				sdk.TraceParentHeader: span.TraceParent(),
 			}
 
 			body, statusCode, err := forward(req, "gitlab-push", headers)
+			span.SetError(err)
+			span.Finish()
 			if err != nil {
 				return fmt.Sprintf("error while forwarding to gitlab-push: %s", err.Error())
 			}
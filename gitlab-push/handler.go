@@ -76,8 +76,20 @@ func Handle(req []byte) string {
 		Installation: sdk.PushEventInstallation{
 			ID: gitlabPushEvent.GitLabProject.ID,
 		},
+		BuildID: sdk.BuildIDFromEnv(),
 	}
 
+	// gitlab-event creates the build ID, but may be an older version
+	if len(pushEvent.BuildID) == 0 {
+		pushEvent.BuildID = sdk.NewBuildID()
+	}
+
+	span := sdk.StartSpan(Source, Source, pushEvent.BuildID)
+	span.SetAttribute("owner", pushEvent.Repository.Owner.Login)
+	span.SetAttribute("repo", pushEvent.Repository.Name)
+	span.SetAttribute("sha", pushEvent.AfterCommitID)
+	defer span.Finish()
+
 	eventInfo := sdk.BuildEventFromPushEvent(pushEvent)
 	status := sdk.BuildStatus(eventInfo, sdk.EmptyAuthToken)
 
@@ -102,8 +114,9 @@ func Handle(req []byte) string {
 	status.AddStatus(sdk.StatusPending, fmt.Sprintf("%s stack deploy is in progress", serviceValue), sdk.StackContext)
 	reportGitLabStatus(status)
 
-	statusCode, postErr := postEvent(pushEvent)
+	statusCode, postErr := postEvent(pushEvent, span)
 	if postErr != nil {
+		span.SetError(postErr)
 		status.AddStatus(sdk.StatusFailure, postErr.Error(), sdk.StackContext)
 		reportGitLabStatus(status)
 		return fmt.Sprintf("error while posting event to git-tar: %s", postErr.Error())
@@ -121,7 +134,7 @@ func Handle(req []byte) string {
 	return fmt.Sprintf("Push - %v, git-tar status: %d", pushEvent, statusCode)
 }
 
-func postEvent(pushEvent sdk.PushEvent) (int, error) {
+func postEvent(pushEvent sdk.PushEvent, span *sdk.Span) (int, error) {
 	suffix := os.Getenv("dns_suffix")
 	gatewayURL := os.Getenv("gateway_url")
 	gatewayURL = sdk.CreateServiceURL(gatewayURL, suffix)
@@ -143,6 +156,7 @@ func postEvent(pushEvent sdk.PushEvent) (int, error) {
 	}
 	digest := hmac.Sign(body, []byte(payloadSecret))
 	httpReq.Header.Add("X-Cloud-Signature", "sha1="+hex.EncodeToString(digest))
+	span.Inject(httpReq)
 
 	c := http.Client{}
 	res, reqErr := c.Do(httpReq)
@@ -67,13 +67,12 @@ func Handle(req []byte) string {
 		return fmt.Sprintf("invalid owner name %s", event.owner)
 	}
 
-	name := strings.ToLower(userSecret.Metadata.Name)
-	ownerNormalized := strings.ToLower(event.owner)
-
-	if !strings.HasPrefix(name, ownerNormalized) {
-		return fmt.Errorf("unable to bind a secret which does not start with owner name: %s", ownerNormalized).Error()
+	if validateErr := validateSecret(userSecret, event.owner); validateErr != nil {
+		return validateErr.Error()
 	}
 
+	name := strings.ToLower(userSecret.Metadata.Name)
+
 	existingSS, err := ssc.SealedSecrets(userSecret.Metadata.Namespace).Get(name, metav1.GetOptions{})
 
 	if err == nil {
@@ -146,6 +145,30 @@ type eventInfo struct {
 	owner string
 }
 
+// validateSecret checks that the secret is named for the owner and, with
+// user namespaces, that it is in the owner's namespace
+func validateSecret(userSecret SealedSecret, owner string) error {
+	if userSecret.Metadata == nil {
+		return fmt.Errorf("unable to bind a secret without metadata")
+	}
+
+	name := strings.ToLower(userSecret.Metadata.Name)
+	ownerNormalized := strings.ToLower(owner)
+
+	if !strings.HasPrefix(name, ownerNormalized) {
+		return fmt.Errorf("unable to bind a secret which does not start with owner name: %s", ownerNormalized)
+	}
+
+	if sdk.UserNamespaces() {
+		namespace := sdk.FunctionNamespace(owner)
+		if userSecret.Metadata.Namespace != namespace {
+			return fmt.Errorf("unable to bind a secret outside of the owner's namespace: %s", namespace)
+		}
+	}
+
+	return nil
+}
+
 type SealedSecret struct {
 	ApiVersion string             `yaml:"apiVersion"`
 	Kind       string             `yaml:"kind"`
@@ -0,0 +1,40 @@
+package function
+
+import (
+	"os"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_validateSecret(t *testing.T) {
+	tests := []struct {
+		Scenario       string
+		UserNamespaces string
+		Name           string
+		Namespace      string
+		WantErr        bool
+	}{
+		{Scenario: "owner's secret", Name: "alexellis-api-key", Namespace: "openfaas-fn"},
+		{Scenario: "another owner's secret", Name: "rgee0-api-key", Namespace: "openfaas-fn", WantErr: true},
+		{Scenario: "owner's namespace", UserNamespaces: "true", Name: "alexellis-api-key", Namespace: "openfaas-fn-alexellis"},
+		{Scenario: "another namespace", UserNamespaces: "true", Name: "alexellis-api-key", Namespace: "openfaas-fn-rgee0", WantErr: true},
+		{Scenario: "default namespace", UserNamespaces: "true", Name: "alexellis-api-key", Namespace: "openfaas-fn", WantErr: true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			os.Setenv("user_namespaces", testCase.UserNamespaces)
+			defer os.Unsetenv("user_namespaces")
+
+			secret := SealedSecret{
+				Metadata: &metav1.ObjectMeta{Name: testCase.Name, Namespace: testCase.Namespace},
+			}
+
+			err := validateSecret(secret, "AlexEllis")
+			if (err != nil) != testCase.WantErr {
+				t.Errorf("want error %t, got: %v", testCase.WantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// failedLookupExpiry is how long a domain which could not be verified is
+// skipped for, it is shorter than the cache expiry so that a new TXT
+// record is picked up soon after it is added
+const failedLookupExpiry = time.Minute
+
+var errNotVerifiedRecently = errors.New("not verified when last looked up")
+
+// domainResult is a cached outcome of verifying a domain for an owner
+type domainResult struct {
+	Verified bool      `json:"verified"`
+	Expires  time.Time `json:"expires"`
+}
+
+// domainCache keeps the outcome of each TXT lookup in a file, since the
+// function runs in a new process for each request
+type domainCache struct {
+	Path    string
+	Expiry  time.Duration
+	results map[string]domainResult
+}
+
+func domainCachePath() string {
+	if val, ok := os.LookupEnv("domain_cache_path"); ok && len(val) > 0 {
+		return val
+	}
+	return "/tmp/list-functions-domains.json"
+}
+
+// domainCacheExpiry is how long a verified domain is served for before
+// its TXT record is looked up again
+func domainCacheExpiry() time.Duration {
+	if val, ok := os.LookupEnv("domain_cache_expiry"); ok && len(val) > 0 {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return time.Minute * 5
+}
+
+// domainLookupTimeout bounds each TXT lookup, so that one slow name
+// server cannot hold up the listing of every domain
+func domainLookupTimeout() time.Duration {
+	if val, ok := os.LookupEnv("domain_lookup_timeout"); ok && len(val) > 0 {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return time.Second * 2
+}
+
+// readDomainCache reads the cached results, a missing or invalid file
+// gives an empty cache
+func readDomainCache(path string, expiry time.Duration) *domainCache {
+	cache := &domainCache{Path: path, Expiry: expiry, results: map[string]domainResult{}}
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cache.results)
+	}
+	return cache
+}
+
+// Verify gives the cached result for the domain and owner or calls verify
+// with its own timeout and caches the result
+func (c *domainCache) Verify(ctx context.Context, domain, owner string, timeout time.Duration, now time.Time, verify func(ctx context.Context) error) error {
+	key := domain + " " + strings.ToLower(owner)
+	if result, ok := c.results[key]; ok && now.Before(result.Expires) {
+		if result.Verified {
+			return nil
+		}
+		return errNotVerifiedRecently
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := verify(lookupCtx)
+	if err != nil {
+		c.results[key] = domainResult{Verified: false, Expires: now.Add(failedLookupExpiry)}
+	} else {
+		c.results[key] = domainResult{Verified: true, Expires: now.Add(c.Expiry)}
+	}
+	return err
+}
+
+// Save writes the results which have not expired, the file is replaced in
+// one step as several requests may save at once
+func (c *domainCache) Save(now time.Time) error {
+	results := map[string]domainResult{}
+	for key, result := range c.results {
+		if now.Before(result.Expires) {
+			results[key] = result
+		}
+	}
+
+	data, _ := json.Marshal(results)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.Path), "domains")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.Path)
+}
@@ -0,0 +1,77 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_domainCache_Verify(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "list-functions")
+	defer os.RemoveAll(dir)
+	cachePath := path.Join(dir, "domains.json")
+
+	tests := []struct {
+		Scenario   string
+		Owner      string
+		After      time.Duration
+		Result     error
+		WantLookup bool
+		WantErr    bool
+	}{
+		{Scenario: "first lookup", Owner: "alexellis", WantLookup: true},
+		{Scenario: "verified result cached", Owner: "AlexEllis", After: time.Minute * 4, Result: errors.New("no such host")},
+		{Scenario: "verified result expired", Owner: "alexellis", After: time.Minute * 5, Result: errors.New("no such host"), WantLookup: true, WantErr: true},
+		{Scenario: "failed result cached", Owner: "alexellis", After: time.Minute * 5, WantErr: true},
+		{Scenario: "failed result expired", Owner: "alexellis", After: time.Minute * 6, WantLookup: true},
+	}
+
+	now := time.Now()
+	for _, testCase := range tests {
+		t.Run(testCase.Scenario, func(t *testing.T) {
+			// Each request reads the cache saved by the last one
+			cache := readDomainCache(cachePath, time.Minute*5)
+
+			looked := false
+			err := cache.Verify(context.Background(), "www.example.com", testCase.Owner, time.Second, now.Add(testCase.After), func(ctx context.Context) error {
+				looked = true
+				if _, ok := ctx.Deadline(); !ok {
+					t.Errorf("want a deadline for the lookup")
+				}
+				return testCase.Result
+			})
+
+			if looked != testCase.WantLookup {
+				t.Errorf("lookup want: %t, got: %t", testCase.WantLookup, looked)
+			}
+			if (err != nil) != testCase.WantErr {
+				t.Errorf("error want: %t, got: %v", testCase.WantErr, err)
+			}
+
+			if err := cache.Save(now.Add(testCase.After)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func Test_domainCache_LookupTimesOut(t *testing.T) {
+	cache := readDomainCache(path.Join(os.TempDir(), "list-functions-missing", "domains.json"), time.Minute)
+
+	start := time.Now()
+	err := cache.Verify(context.Background(), "www.example.com", "alexellis", time.Millisecond*50, start, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err == nil {
+		t.Fatalf("want error when the lookup times out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want lookup cancelled after its timeout, took: %s", elapsed)
+	}
+}
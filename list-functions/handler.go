@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -23,8 +24,7 @@ func (auth *FaaSAuth) Set(req *http.Request) error {
 }
 
 var (
-	timeout   = 3 * time.Second
-	namespace = ""
+	timeout = 3 * time.Second
 )
 
 // Handle takes the functions which are built
@@ -37,14 +37,28 @@ func Handle(req []byte) string {
 
 	client := faasSDK.NewClient(&FaaSAuth{}, gatewayURL, nil, &timeout)
 
+	vals, _ := url.ParseQuery(os.Getenv("Http_Query"))
+
+	// The edge-router reads the verified custom domains of all owners
+	if vals.Get("domains") == "true" || vals.Get("domains") == "1" {
+		cache := readDomainCache(domainCachePath(), domainCacheExpiry())
+		domains, err := listDomains(context.Background(), client, sdk.NewTXTResolver(), cache)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := cache.Save(time.Now()); err != nil {
+			log.Printf("Unable to save the domain cache: %s", err.Error())
+		}
+
+		bytesOut, _ := json.Marshal(domains)
+		return string(bytesOut)
+	}
+
 	user := string(req)
 	if len(user) == 0 {
-		if query, exists := os.LookupEnv("Http_Query"); exists {
-			vals, _ := url.ParseQuery(query)
-			userQuery := vals.Get("user")
-			if len(userQuery) > 0 {
-				user = userQuery
-			}
+		if userQuery := vals.Get("user"); len(userQuery) > 0 {
+			user = userQuery
 		}
 	}
 
@@ -52,7 +66,7 @@ func Handle(req []byte) string {
 		return "User is required as POST or querystring i.e. ?user=alexellis."
 	}
 
-	functions, err := client.ListFunctions(context.Background(), namespace)
+	functions, err := client.ListFunctions(context.Background(), sdk.FunctionNamespace(user))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -71,3 +85,86 @@ func Handle(req []byte) string {
 	bytesOut, _ := json.Marshal(filtered)
 	return string(bytesOut)
 }
+
+// functionLister is the part of the OpenFaaS client used by listDomains
+type functionLister interface {
+	ListFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error)
+	ListNamespaces(ctx context.Context) ([]string, error)
+}
+
+// listDomains gives the custom domains claimed by functions with the
+// custom-domain annotation where the TXT record names the function's
+// owner, when two functions claim a domain the first by name is used.
+// Each lookup has its own timeout and its result is kept in the cache.
+func listDomains(ctx context.Context, client functionLister, resolver sdk.TXTResolver, cache *domainCache) ([]sdk.CustomDomain, error) {
+	namespaces := []string{""}
+	if sdk.UserNamespaces() {
+		all, err := client.ListNamespaces(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := strings.ToLower(sdk.NamespacePrefix())
+		for _, namespace := range all {
+			if strings.HasPrefix(namespace, prefix) {
+				namespaces = append(namespaces, namespace)
+			}
+		}
+	}
+
+	functions := []types.FunctionStatus{}
+	for _, namespace := range namespaces {
+		found, err := client.ListFunctions(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, found...)
+	}
+
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+
+	domains := []sdk.CustomDomain{}
+	claimed := map[string]string{}
+
+	for _, fn := range functions {
+		if fn.Annotations == nil || fn.Labels == nil {
+			continue
+		}
+
+		claim, ok := (*fn.Annotations)[sdk.CustomDomainAnnotation]
+		owner := (*fn.Labels)[sdk.FunctionLabelPrefix+"git-owner"]
+		if !ok || len(owner) == 0 {
+			continue
+		}
+
+		domain, err := sdk.NormalizeDomain(claim)
+		if err != nil {
+			log.Printf("Custom domain for %s: %s", fn.Name, err.Error())
+			continue
+		}
+
+		if by, exists := claimed[domain]; exists {
+			log.Printf("Custom domain %s for %s is already claimed by %s", domain, fn.Name, by)
+			continue
+		}
+
+		err = cache.Verify(ctx, domain, owner, domainLookupTimeout(), time.Now(), func(ctx context.Context) error {
+			return sdk.VerifyDomain(ctx, resolver, domain, owner)
+		})
+		if err != nil {
+			log.Printf("Custom domain %s for %s is not verified: %s", domain, fn.Name, err.Error())
+			continue
+		}
+
+		claimed[domain] = fn.Name
+		domains = append(domains, sdk.CustomDomain{
+			Domain:   domain,
+			Owner:    strings.ToLower(owner),
+			Function: fn.Name,
+		})
+	}
+
+	return domains, nil
+}
@@ -0,0 +1,100 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+type fakeLister struct {
+	Functions map[string][]types.FunctionStatus
+}
+
+func (f fakeLister) ListFunctions(ctx context.Context, namespace string) ([]types.FunctionStatus, error) {
+	return f.Functions[namespace], nil
+}
+
+func (f fakeLister) ListNamespaces(ctx context.Context) ([]string, error) {
+	namespaces := []string{}
+	for namespace := range f.Functions {
+		if len(namespace) > 0 {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces, nil
+}
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := f[name]; ok {
+		return records, nil
+	}
+	return nil, fmt.Errorf("no such host")
+}
+
+func newFunctionStatus(name, owner, domain string) types.FunctionStatus {
+	labels := map[string]string{sdk.FunctionLabelPrefix + "git-owner": owner}
+	annotations := map[string]string{}
+	if len(domain) > 0 {
+		annotations[sdk.CustomDomainAnnotation] = domain
+	}
+	return types.FunctionStatus{Name: name, Labels: &labels, Annotations: &annotations}
+}
+
+func Test_listDomains(t *testing.T) {
+	os.Setenv("user_namespaces", "true")
+	defer os.Unsetenv("user_namespaces")
+
+	lister := fakeLister{
+		Functions: map[string][]types.FunctionStatus{
+			"": {
+				newFunctionStatus("system-dashboard", "system", ""),
+			},
+			"openfaas-fn-alexellis": {
+				newFunctionStatus("alexellis-blog", "alexellis", "WWW.example.com"),
+				newFunctionStatus("alexellis-api", "alexellis", "api.example.com"),
+				newFunctionStatus("alexellis-www", "alexellis", "www.example.com"),
+			},
+			"openfaas-fn-rgee0": {
+				newFunctionStatus("rgee0-shop", "rgee0", "shop.example.com"),
+			},
+		},
+	}
+
+	resolver := fakeResolver{
+		"_openfaas-cloud.www.example.com":  {"openfaas-cloud-owner=alexellis"},
+		"_openfaas-cloud.shop.example.com": {"openfaas-cloud-owner=alexellis"},
+	}
+
+	dir, _ := ioutil.TempDir("", "list-functions")
+	defer os.RemoveAll(dir)
+
+	cache := readDomainCache(path.Join(dir, "domains.json"), time.Minute)
+	domains, err := listDomains(context.Background(), lister, resolver, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// api.example.com has no record, shop.example.com names another owner
+	// and alexellis-www claims a domain already claimed by alexellis-blog
+	want := []sdk.CustomDomain{
+		{Domain: "www.example.com", Owner: "alexellis", Function: "alexellis-blog"},
+	}
+
+	if len(domains) != len(want) {
+		t.Fatalf("want %d domains, got %d: %v", len(want), len(domains), domains)
+	}
+	for i := range want {
+		if domains[i] != want[i] {
+			t.Errorf("want %v, got %v", want[i], domains[i])
+		}
+	}
+}
@@ -3,11 +3,13 @@ module github.com/openfaas/openfaas-cloud/metrics
 go 1.13
 
 require (
+	github.com/alexellis/hmac v0.0.0-20180624210714-d5d71edd7bc7 // indirect
 	github.com/beorn7/perks v0.0.0-20180321164747-3a771d992973
 	github.com/golang/protobuf v1.2.0
 	github.com/matttproud/golang_protobuf_extensions v1.0.1
 	github.com/openfaas/faas v0.0.0-20191227175319-80b6976c1063
 	github.com/openfaas/faas-provider v0.0.0-20191011092439-98c25c3919da
+	github.com/openfaas/openfaas-cloud v0.0.0-20200303103051-6c3e056a6ac4
 	github.com/prometheus/client_golang v0.8.0
 	github.com/prometheus/client_model v0.0.0-20180712105110-5c3871d89910
 	github.com/prometheus/common v0.0.0-20180801064454-c7de2306084e
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/openfaas/faas/gateway/metrics"
+	"github.com/openfaas/openfaas-cloud/sdk"
 )
 
 type Metrics struct {
@@ -26,8 +27,7 @@ func Handle(req []byte) string {
 	}
 
 	if ns == "" {
-		// TODO: read from env-var for environments where this is overridden
-		ns = "openfaas-fn"
+		ns = getDefaultNamespace()
 	}
 
 	host := os.Getenv("prometheus_host")
@@ -54,6 +54,25 @@ func Handle(req []byte) string {
 	return string(res)
 }
 
+// getDefaultNamespace gives the owner's namespace when user_namespaces is
+// enabled, otherwise the function_namespace env-var or openfaas-fn
+func getDefaultNamespace() string {
+	if sdk.UserNamespaces() {
+		if query, exists := os.LookupEnv("Http_Query"); exists {
+			vals, _ := url.ParseQuery(query)
+			if user := vals.Get("user"); len(user) > 0 {
+				return sdk.FunctionNamespace(user)
+			}
+		}
+	}
+
+	if ns := os.Getenv("function_namespace"); len(ns) > 0 {
+		return ns
+	}
+
+	return "openfaas-fn"
+}
+
 func parseMetricsWindow() string {
 	if query, exists := os.LookupEnv("Http_Query"); exists {
 		vals, _ := url.ParseQuery(query)
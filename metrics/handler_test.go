@@ -146,3 +146,26 @@ func Test_parseMetricsWindow_whenMetricsWindowIsSetInQuery(t *testing.T) {
 		t.Errorf("Expected: %s, got: %s", expected, got)
 	}
 }
+
+func Test_getDefaultNamespace(t *testing.T) {
+	defer os.Setenv("user_namespaces", "")
+	defer os.Setenv("function_namespace", "")
+
+	os.Setenv("Http_Query", "function=alexellis-hooks&user=AlexEllis")
+
+	os.Setenv("user_namespaces", "")
+	os.Setenv("function_namespace", "")
+	if got := getDefaultNamespace(); got != "openfaas-fn" {
+		t.Errorf("want openfaas-fn, got %s", got)
+	}
+
+	os.Setenv("function_namespace", "functions")
+	if got := getDefaultNamespace(); got != "functions" {
+		t.Errorf("want functions, got %s", got)
+	}
+
+	os.Setenv("user_namespaces", "true")
+	if got := getDefaultNamespace(); got != "openfaas-fn-alexellis" {
+		t.Errorf("want openfaas-fn-alexellis, got %s", got)
+	}
+}
@@ -101,10 +101,13 @@ func main() {
 }
 
 func buildHandler(w http.ResponseWriter, r *http.Request) {
+	span := sdk.StartSpanFromRequest("of-builder", "build", r)
+	defer span.Finish()
 
 	dt, err := build(w, r, buildArgs)
 
 	if err != nil {
+		span.SetError(err)
 		w.WriteHeader(500)
 
 		if dt == nil {
@@ -182,6 +185,14 @@ func build(w http.ResponseWriter, r *http.Request, buildArgs map[string]string)
 		cfg.Frontend = DefaultFrontEnd
 	}
 
+	// The build ID is only logged once it is known to be hex, so that a
+	// request cannot add lines of its own to the log
+	prefix := ""
+	if buildID := sdk.BuildIDFromRequest(r); len(buildID) > 0 {
+		prefix = fmt.Sprintf("[%s] ", buildID)
+		log.Printf("Build %s for %s", buildID, cfg.Ref)
+	}
+
 	insecure := "false"
 	if val, exists := os.LookupEnv("insecure"); exists {
 		insecure = val
@@ -253,21 +264,21 @@ func build(w http.ResponseWriter, r *http.Request, buildArgs map[string]string)
 					msg = fmt.Sprintf("v: %s %v", startedVal, v.Name)
 				}
 				build.Append(msg)
-				fmt.Printf("%s\n", msg)
+				fmt.Printf("%s%s\n", prefix, msg)
 
 			}
 			for _, s := range s.Statuses {
 				msg := fmt.Sprintf("s: %s %s %d", s.Timestamp.Format(time.RFC3339), s.ID, s.Current)
 				build.Append(msg)
 
-				fmt.Printf("status: %s %s %d\n", s.Vertex, s.ID, s.Current)
+				fmt.Printf("%sstatus: %s %s %d\n", prefix, s.Vertex, s.ID, s.Current)
 			}
 			for _, l := range s.Logs {
 
 				msg := fmt.Sprintf("l: %s %s", l.Timestamp.Format(time.RFC3339), l.Data)
 				build.Append(msg)
 
-				fmt.Printf("log: %s\n%s\n", l.Vertex, l.Data)
+				fmt.Printf("%slog: %s\n%s\n", prefix, l.Vertex, l.Data)
 			}
 
 		}
@@ -47,11 +47,18 @@ func Handle(req []byte) string {
 
 		reader := bytes.NewReader([]byte(pipelineLog.Data))
 		fullPath := getPath(bucketName, &pipelineLog)
+
+		opts := minio.PutObjectOptions{}
+		if len(pipelineLog.BuildID) > 0 {
+			log.Printf("Build %s for %s", pipelineLog.BuildID, fullPath)
+			opts.UserMetadata = map[string]string{"build-id": pipelineLog.BuildID}
+		}
+
 		n, err := minioClient.PutObject(bucketName,
 			fullPath,
 			reader,
 			int64(reader.Len()),
-			minio.PutObjectOptions{})
+			opts)
 
 		if err != nil {
 			log.Printf("error writing: %s, error: %s", fullPath, err.Error())
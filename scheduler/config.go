@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchedulerConfig configuration for the scheduler
+type SchedulerConfig struct {
+	Port       string
+	GatewayURL string
+
+	// InvokeTimeout is how long to wait for a scheduled function
+	InvokeTimeout time.Duration
+
+	// StatePath is a file recording the last minute which was scheduled,
+	// so that runs missed while the scheduler was down can be recorded
+	StatePath string
+
+	// MaxMissed is how far back missed runs are looked for
+	MaxMissed time.Duration
+
+	// SignRequests adds an X-Cloud-Signature to each invocation
+	SignRequests bool
+}
+
+// NewSchedulerConfig creates a SchedulerConfig by loading
+// config from environmental variables.
+func NewSchedulerConfig() SchedulerConfig {
+	cfg := SchedulerConfig{
+		Port:         "8080",
+		GatewayURL:   "http://gateway.openfaas:8080/",
+		SignRequests: true,
+	}
+
+	if val, exists := os.LookupEnv("port"); exists && len(val) > 0 {
+		cfg.Port = val
+	}
+
+	if val, exists := os.LookupEnv("gateway_url"); exists && len(val) > 0 {
+		cfg.GatewayURL = val
+	}
+
+	if !strings.HasSuffix(cfg.GatewayURL, "/") {
+		cfg.GatewayURL = cfg.GatewayURL + "/"
+	}
+
+	cfg.InvokeTimeout = parseIntOrDurationValue(os.Getenv("invoke_timeout"), time.Second*60)
+	cfg.MaxMissed = parseIntOrDurationValue(os.Getenv("max_missed"), time.Hour*24)
+	cfg.StatePath = os.Getenv("state_path")
+
+	if val, exists := os.LookupEnv("sign_requests"); exists && len(val) > 0 {
+		cfg.SignRequests = val != "false" && val != "0"
+	}
+
+	return cfg
+}
+
+func parseIntOrDurationValue(val string, fallback time.Duration) time.Duration {
+	if len(val) > 0 {
+		parsedVal, parseErr := strconv.Atoi(val)
+		if parseErr == nil && parsedVal >= 0 {
+			return time.Duration(parsedVal) * time.Second
+		}
+	}
+
+	duration, durationErr := time.ParseDuration(val)
+	if durationErr != nil {
+		return fallback
+	}
+	return duration
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/alexellis/hmac"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+const (
+	// schedulerHeader marks an invocation by the scheduler, the edge-router
+	// removes it from requests from outside of the cluster
+	schedulerHeader = "X-Cloud-Scheduler"
+
+	// scheduledTimeHeader is the minute the invocation was scheduled for
+	scheduledTimeHeader = "X-Scheduled-Time"
+)
+
+// scheduledFunction is a function with a schedule annotation
+type scheduledFunction struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// Ref gives the name used to invoke the function
+func (f scheduledFunction) Ref() string {
+	return sdk.FunctionRef(f.Name, f.Namespace)
+}
+
+// Owner of the function from its labels
+func (f scheduledFunction) Owner() string {
+	return f.Labels[sdk.FunctionLabelPrefix+"git-owner"]
+}
+
+// gateway lists and invokes functions through the OpenFaaS gateway
+type gateway struct {
+	URL    string
+	Client *http.Client
+
+	// Secret signs each invocation when set
+	Secret string
+}
+
+// ListScheduled gives the OpenFaaS Cloud functions which have a schedule
+func (g *gateway) ListScheduled() ([]scheduledFunction, error) {
+	namespaces := []string{""}
+	if sdk.UserNamespaces() {
+		if err := g.get("system/namespaces", &namespaces); err != nil {
+			return nil, err
+		}
+	}
+
+	scheduled := []scheduledFunction{}
+	for _, namespace := range namespaces {
+		path := "system/functions"
+		if len(namespace) > 0 {
+			path = path + "?namespace=" + namespace
+		}
+
+		functions := []scheduledFunction{}
+		if err := g.get(path, &functions); err != nil {
+			return nil, err
+		}
+
+		for _, fn := range functions {
+			if fn.Labels[sdk.FunctionLabelPrefix+"git-cloud"] != "1" {
+				continue
+			}
+			if _, ok := fn.Annotations[sdk.ScheduleAnnotation]; !ok {
+				continue
+			}
+
+			fn.Namespace = namespace
+			scheduled = append(scheduled, fn)
+		}
+	}
+
+	return scheduled, nil
+}
+
+// Invoke calls a function for the minute it was scheduled
+func (g *gateway) Invoke(ctx context.Context, fn scheduledFunction, scheduled time.Time) (int, error) {
+	req, _ := http.NewRequest(http.MethodPost, g.URL+"function/"+fn.Ref(), nil)
+
+	scheduledTime := scheduled.UTC().Format(time.RFC3339)
+	req.Header.Set(schedulerHeader, "1")
+	req.Header.Set(scheduledTimeHeader, scheduledTime)
+
+	if len(g.Secret) > 0 {
+		digest := hmac.Sign(signedInvocation(fn.Ref(), scheduledTime), []byte(g.Secret))
+		req.Header.Set(sdk.CloudSignatureHeader, "sha1="+hex.EncodeToString(digest))
+	}
+
+	res, err := g.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+		ioutil.ReadAll(res.Body)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// signedInvocation is the message signed for an invocation, as the
+// body is empty the function and time are signed to prevent a replay
+func signedInvocation(function, scheduledTime string) []byte {
+	return []byte(function + "\n" + scheduledTime)
+}
+
+func (g *gateway) get(path string, out interface{}) error {
+	req, _ := http.NewRequest(http.MethodGet, g.URL+path, nil)
+
+	if err := sdk.AddBasicAuth(req); err != nil {
+		return err
+	}
+
+	res, err := g.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from %s: %d, %s", path, res.StatusCode, string(bytes.TrimSpace(body)))
+	}
+
+	return json.Unmarshal(body, out)
+}
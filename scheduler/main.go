@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+func main() {
+	cfg := NewSchedulerConfig()
+
+	log.Printf("Gateway URL: %s\n", cfg.GatewayURL)
+	log.Printf("Invoke timeout: %s\n", cfg.InvokeTimeout)
+
+	gw := &gateway{
+		URL: cfg.GatewayURL,
+		Client: &http.Client{
+			Timeout: cfg.InvokeTimeout + time.Second,
+		},
+	}
+
+	if cfg.SignRequests {
+		secret, err := sdk.ReadSecret("payload-secret")
+		if err != nil {
+			log.Fatalf("sign_requests is enabled but the payload-secret is unavailable: %s", err.Error())
+		}
+		gw.Secret = secret
+	}
+
+	s := newScheduler(gw, gw, cfg)
+	go s.Run()
+
+	router := http.NewServeMux()
+	router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	log.Printf("Using port %s\n", cfg.Port)
+
+	server := &http.Server{
+		Addr:           ":" + cfg.Port,
+		Handler:        router,
+		ReadTimeout:    time.Second * 10,
+		WriteTimeout:   time.Second * 10,
+		MaxHeaderBytes: 1 << 20,
+	}
+
+	log.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+// Source of the audit events posted by the scheduler
+const Source = "scheduler"
+
+// lister gives the functions with a schedule
+type lister interface {
+	ListScheduled() ([]scheduledFunction, error)
+}
+
+// invoker calls a function for a scheduled minute
+type invoker interface {
+	Invoke(ctx context.Context, fn scheduledFunction, scheduled time.Time) (int, error)
+}
+
+// missedRun records the runs of a function which did not happen,
+// because the scheduler was not running at the time
+type missedRun struct {
+	Function string
+	Owner    string
+	Count    int
+	First    time.Time
+	Last     time.Time
+}
+
+// schedulerState is saved after each tick
+type schedulerState struct {
+	LastTick time.Time `json:"lastTick"`
+}
+
+// scheduler invokes functions on the minutes given by their schedule
+type scheduler struct {
+	Functions lister
+	Invoker   invoker
+	Config    SchedulerConfig
+
+	// Record is called for each function with missed runs
+	Record func(missed missedRun)
+
+	functions []scheduledFunction
+	lastTick  time.Time
+
+	// invalid holds the expressions which have already been reported
+	invalid map[string]string
+}
+
+func newScheduler(functions lister, invoker invoker, config SchedulerConfig) *scheduler {
+	s := &scheduler{
+		Functions: functions,
+		Invoker:   invoker,
+		Config:    config,
+		Record:    recordMissed,
+		invalid:   map[string]string{},
+	}
+
+	if state, err := readState(config.StatePath); err != nil {
+		log.Printf("Unable to read state: %s", err.Error())
+	} else {
+		s.lastTick = state.LastTick
+	}
+
+	return s
+}
+
+// Run ticks at the start of every minute
+func (s *scheduler) Run() {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(next.Sub(now))
+
+		s.Tick(time.Now())
+	}
+}
+
+// Tick records runs missed since the last tick then invokes the
+// functions which are due in the minute of now
+func (s *scheduler) Tick(now time.Time) {
+	now = now.UTC().Truncate(time.Minute)
+	if !now.After(s.lastTick) {
+		return
+	}
+
+	functions, err := s.Functions.ListScheduled()
+	if err != nil {
+		log.Printf("Unable to list functions, using the last known list: %s", err.Error())
+	} else {
+		s.functions = functions
+	}
+
+	schedules := s.parseSchedules()
+
+	if !s.lastTick.IsZero() {
+		for _, missed := range findMissed(s.functions, schedules, s.lastTick, now, s.Config.MaxMissed) {
+			s.Record(missed)
+		}
+	}
+
+	for _, fn := range s.functions {
+		schedule, ok := schedules[fn.Ref()]
+		if !ok || !schedule.Matches(now) {
+			continue
+		}
+
+		go s.invoke(fn, now)
+	}
+
+	s.lastTick = now
+	if err := writeState(s.Config.StatePath, schedulerState{LastTick: now}); err != nil {
+		log.Printf("Unable to write state: %s", err.Error())
+	}
+}
+
+func (s *scheduler) invoke(fn scheduledFunction, scheduled time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.InvokeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	status, err := s.Invoker.Invoke(ctx, fn, scheduled)
+	if err != nil {
+		log.Printf("Scheduled run of %s at %s failed: %s", fn.Ref(), scheduled.Format(time.RFC3339), err.Error())
+
+		sdk.PostAudit(sdk.AuditEvent{
+			Type:     sdk.AuditDispatchFailed,
+			Source:   Source,
+			Owner:    fn.Owner(),
+			Function: fn.Name,
+			Error:    err.Error(),
+			Message:  fmt.Sprintf("scheduled run of %s at %s failed: %s", fn.Name, scheduled.Format(time.RFC3339), err.Error()),
+		})
+		return
+	}
+
+	log.Printf("Invoked %s, status: %d (%.2fs)", fn.Ref(), status, time.Since(start).Seconds())
+}
+
+// parseSchedules parses the schedule of each function, invalid
+// expressions are reported once and then skipped
+func (s *scheduler) parseSchedules() map[string]*sdk.Schedule {
+	schedules := map[string]*sdk.Schedule{}
+
+	for _, fn := range s.functions {
+		expr := fn.Annotations[sdk.ScheduleAnnotation]
+
+		schedule, err := sdk.ParseSchedule(expr)
+		if err != nil {
+			if s.invalid[fn.Ref()] != expr {
+				s.invalid[fn.Ref()] = expr
+				log.Printf("Skipping %s: %s", fn.Ref(), err.Error())
+
+				sdk.PostAudit(sdk.AuditEvent{
+					Type:     sdk.AuditScheduleInvalid,
+					Source:   Source,
+					Owner:    fn.Owner(),
+					Function: fn.Name,
+					Error:    err.Error(),
+					Message:  fmt.Sprintf("not scheduling %s: %s", fn.Name, err.Error()),
+				})
+			}
+			continue
+		}
+
+		delete(s.invalid, fn.Ref())
+		schedules[fn.Ref()] = schedule
+	}
+
+	return schedules
+}
+
+// findMissed gives the runs due after lastTick and before now, looking
+// back no further than maxMissed
+func findMissed(functions []scheduledFunction, schedules map[string]*sdk.Schedule, lastTick, now time.Time, maxMissed time.Duration) []missedRun {
+	from := lastTick.Add(time.Minute)
+	if oldest := now.Add(-maxMissed); from.Before(oldest) {
+		from = oldest
+	}
+
+	missed := map[string]*missedRun{}
+	order := []string{}
+
+	for t := from; t.Before(now); t = t.Add(time.Minute) {
+		for _, fn := range functions {
+			ref := fn.Ref()
+			schedule, ok := schedules[ref]
+			if !ok || !schedule.Matches(t) {
+				continue
+			}
+
+			run, ok := missed[ref]
+			if !ok {
+				run = &missedRun{Function: ref, Owner: fn.Owner(), First: t}
+				missed[ref] = run
+				order = append(order, ref)
+			}
+			run.Count++
+			run.Last = t
+		}
+	}
+
+	runs := []missedRun{}
+	for _, ref := range order {
+		runs = append(runs, *missed[ref])
+	}
+	return runs
+}
+
+// recordMissed logs missed runs and posts them to the audit log
+func recordMissed(missed missedRun) {
+	message := fmt.Sprintf("missed %d scheduled run(s) of %s between %s and %s",
+		missed.Count, missed.Function, missed.First.Format(time.RFC3339), missed.Last.Format(time.RFC3339))
+
+	log.Println(message)
+
+	sdk.PostAudit(sdk.AuditEvent{
+		Type:     sdk.AuditScheduleMissed,
+		Source:   Source,
+		Owner:    missed.Owner,
+		Function: missed.Function,
+		Message:  message,
+	})
+}
+
+func readState(statePath string) (schedulerState, error) {
+	state := schedulerState{}
+	if len(statePath) == 0 {
+		return state, nil
+	}
+
+	data, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+func writeState(statePath string, state schedulerState) error {
+	if len(statePath) == 0 {
+		return nil
+	}
+
+	data, _ := json.Marshal(state)
+
+	tmpPath := statePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, statePath)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/alexellis/hmac"
+	"github.com/openfaas/openfaas-cloud/sdk"
+)
+
+type fakeLister struct {
+	functions []scheduledFunction
+}
+
+func (f *fakeLister) ListScheduled() ([]scheduledFunction, error) {
+	return f.functions, nil
+}
+
+type fakeInvoker struct {
+	invoked chan string
+}
+
+func (f *fakeInvoker) Invoke(ctx context.Context, fn scheduledFunction, scheduled time.Time) (int, error) {
+	f.invoked <- fn.Ref()
+	return http.StatusOK, nil
+}
+
+func newFunction(name, schedule string) scheduledFunction {
+	return scheduledFunction{
+		Name:        name,
+		Labels:      map[string]string{sdk.FunctionLabelPrefix + "git-owner": "alexellis"},
+		Annotations: map[string]string{sdk.ScheduleAnnotation: schedule},
+	}
+}
+
+func Test_Tick_InvokesDueFunctions(t *testing.T) {
+	functions := &fakeLister{functions: []scheduledFunction{
+		newFunction("alexellis-every-minute", "* * * * *"),
+		newFunction("alexellis-hourly", "@hourly"),
+		newFunction("alexellis-invalid", "every minute"),
+	}}
+	invoker := &fakeInvoker{invoked: make(chan string, 10)}
+
+	s := newScheduler(functions, invoker, SchedulerConfig{InvokeTimeout: time.Second, MaxMissed: time.Hour})
+	s.Tick(time.Date(2020, time.March, 2, 10, 15, 30, 0, time.UTC))
+
+	select {
+	case got := <-invoker.invoked:
+		if got != "alexellis-every-minute" {
+			t.Errorf("want alexellis-every-minute invoked, got: %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("want a function to be invoked")
+	}
+
+	select {
+	case got := <-invoker.invoked:
+		t.Errorf("want one invocation, also got: %s", got)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	if _, ok := s.invalid["alexellis-invalid"]; !ok {
+		t.Errorf("want the invalid schedule to be recorded")
+	}
+}
+
+func Test_Tick_RecordsMissedRunsFromState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	statePath := path.Join(dir, "state.json")
+	lastTick := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	if err := writeState(statePath, schedulerState{LastTick: lastTick}); err != nil {
+		t.Fatal(err)
+	}
+
+	functions := &fakeLister{functions: []scheduledFunction{
+		newFunction("alexellis-every-five", "*/5 * * * *"),
+	}}
+	invoker := &fakeInvoker{invoked: make(chan string, 10)}
+
+	s := newScheduler(functions, invoker, SchedulerConfig{InvokeTimeout: time.Second, MaxMissed: time.Hour, StatePath: statePath})
+
+	missed := []missedRun{}
+	s.Record = func(run missedRun) {
+		missed = append(missed, run)
+	}
+
+	now := lastTick.Add(time.Minute * 20)
+	s.Tick(now)
+
+	if len(missed) != 1 {
+		t.Fatalf("want missed runs for one function, got: %+v", missed)
+	}
+
+	// 10:05, 10:10 and 10:15, 10:20 is invoked
+	if missed[0].Count != 3 || missed[0].Owner != "alexellis" {
+		t.Errorf("want 3 missed runs for alexellis, got: %+v", missed[0])
+	}
+
+	state, err := readState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.LastTick.Equal(now) {
+		t.Errorf("want last tick saved as %s, got: %s", now, state.LastTick)
+	}
+}
+
+func Test_findMissed_LimitedToMaxMissed(t *testing.T) {
+	fn := newFunction("alexellis-every-minute", "* * * * *")
+	schedule, _ := sdk.ParseSchedule("* * * * *")
+
+	now := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	missed := findMissed([]scheduledFunction{fn}, map[string]*sdk.Schedule{fn.Ref(): schedule}, now.Add(-time.Hour*48), now, time.Minute*10)
+
+	if len(missed) != 1 || missed[0].Count != 10 {
+		t.Errorf("want 10 missed runs, got: %+v", missed)
+	}
+}
+
+func Test_gateway_ListScheduledAndInvoke(t *testing.T) {
+	os.Setenv("basic_auth", "false")
+
+	var invoked *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/system/functions":
+			w.Write([]byte(`[
+  {"name": "alexellis-cron", "labels": {"com.openfaas.cloud.git-cloud": "1"}, "annotations": {"schedule": "* * * * *"}},
+  {"name": "alexellis-http", "labels": {"com.openfaas.cloud.git-cloud": "1"}, "annotations": {}},
+  {"name": "nodeinfo", "labels": {}, "annotations": {"schedule": "* * * * *"}}
+]`))
+		default:
+			invoked = r
+		}
+	}))
+	defer server.Close()
+
+	gw := &gateway{URL: server.URL + "/", Client: http.DefaultClient, Secret: "secret"}
+
+	functions, err := gw.ListScheduled()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(functions) != 1 || functions[0].Name != "alexellis-cron" {
+		t.Fatalf("want alexellis-cron only, got: %+v", functions)
+	}
+
+	scheduled := time.Date(2020, time.March, 2, 10, 15, 0, 0, time.UTC)
+	if _, err := gw.Invoke(context.Background(), functions[0], scheduled); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if invoked == nil || invoked.URL.Path != "/function/alexellis-cron" {
+		t.Fatalf("want alexellis-cron invoked, got: %v", invoked)
+	}
+
+	if invoked.Header.Get(schedulerHeader) != "1" {
+		t.Errorf("want %s header", schedulerHeader)
+	}
+
+	scheduledTime := invoked.Header.Get(scheduledTimeHeader)
+	if scheduledTime != "2020-03-02T10:15:00Z" {
+		t.Errorf("want scheduled time, got: %s", scheduledTime)
+	}
+
+	digest := hmac.Sign(signedInvocation("alexellis-cron", scheduledTime), []byte("secret"))
+	if got := invoked.Header.Get(sdk.CloudSignatureHeader); got != "sha1="+hex.EncodeToString(digest) {
+		t.Errorf("want signed invocation, got: %s", got)
+	}
+}
@@ -2,13 +2,143 @@ package sdk
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/alexellis/hmac"
+)
+
+// AuditEventType says what happened in an AuditEvent
+type AuditEventType string
+
+const (
+	// AuditWebhookRejected is for a webhook from the SCM which cannot be handled
+	AuditWebhookRejected AuditEventType = "webhook.rejected"
+	// AuditInstallationChanged is for repositories added to the GitHub App
+	AuditInstallationChanged AuditEventType = "installation.changed"
+	// AuditPushRejected is for a push which will not be built
+	AuditPushRejected AuditEventType = "push.rejected"
+	// AuditPushCompleted is for a push whose functions have all been built
+	AuditPushCompleted AuditEventType = "push.completed"
+	// AuditDispatchFailed is for a request to another function which failed
+	AuditDispatchFailed AuditEventType = "dispatch.failed"
+	// AuditSecretsImported is for SealedSecrets imported from a repo
+	AuditSecretsImported AuditEventType = "secrets.imported"
+	// AuditBuildStarted is for a function which is being built
+	AuditBuildStarted AuditEventType = "build.started"
+	// AuditBuildFailed is for a function which could not be built
+	AuditBuildFailed AuditEventType = "build.failed"
+	// AuditDeploySucceeded is for a function which has been deployed
+	AuditDeploySucceeded AuditEventType = "deploy.succeeded"
+	// AuditDeployFailed is for a function which could not be deployed
+	AuditDeployFailed AuditEventType = "deploy.failed"
+	// AuditDeployRejected is for a function over its owner's quota
+	AuditDeployRejected AuditEventType = "deploy.rejected"
+	// AuditFunctionDeleteFailed is for a function which could not be removed
+	AuditFunctionDeleteFailed AuditEventType = "function.delete_failed"
+	// AuditGarbageCollected is for functions removed from a repo
+	AuditGarbageCollected AuditEventType = "garbage.collected"
+	// AuditScheduleMissed is for scheduled invocations which did not run
+	AuditScheduleMissed AuditEventType = "schedule.missed"
+	// AuditScheduleInvalid is for a function whose schedule cannot be parsed
+	AuditScheduleInvalid AuditEventType = "schedule.invalid"
+)
+
+// Severity of an AuditEvent
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
 )
 
+// Severity gives the default severity for an event of this type
+func (t AuditEventType) Severity() Severity {
+	switch t {
+	case AuditBuildFailed, AuditDeployFailed, AuditDispatchFailed, AuditFunctionDeleteFailed:
+		return SeverityError
+	case AuditWebhookRejected, AuditPushRejected, AuditDeployRejected, AuditScheduleMissed, AuditScheduleInvalid:
+		return SeverityWarning
+	}
+	return SeverityInfo
+}
+
+// AuditEvent is posted to the audit-event function. Source, Message,
+// Owner and Repo are always set, the other fields are set where they are
+// known so that events can be filtered such as by type, repo and SHA.
+type AuditEvent struct {
+	Source  string
+	Message string
+	Owner   string
+	Repo    string
+
+	Type     AuditEventType `json:",omitempty"`
+	Severity Severity       `json:",omitempty"`
+	SHA      string         `json:",omitempty"`
+	Function string         `json:",omitempty"`
+
+	// Duration of the step being reported on, such as a build
+	Duration time.Duration `json:",omitempty"`
+
+	// Timestamp is set by PostAudit when empty
+	Timestamp time.Time
+
+	// BuildID correlates the events from each step of the pipeline
+	BuildID string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+
+	// Sequence, PrevHash and Hash chain the events together when
+	// they are persisted by audit-event
+	Sequence int64  `json:",omitempty"`
+	PrevHash string `json:",omitempty"`
+	Hash     string `json:",omitempty"`
+}
+
+// Text renders the event as a single line, as posted to Slack
+func (e AuditEvent) Text() string {
+	return fmt.Sprintf("[%s] %s/%s: '%s'",
+		e.Source,
+		e.Owner,
+		e.Repo,
+		e.Message)
+}
+
+// BuildID gives an ID for a commit, for when a function was not passed
+// the ID generated by NewBuildID at the start of the pipeline
+func BuildID(owner, repo, sha string) string {
+	if len(sha) == 0 {
+		return ""
+	}
+
+	digest := sha256.Sum256([]byte(strings.ToLower(owner+"/"+repo) + "@" + sha))
+	return hex.EncodeToString(digest[:16])
+}
+
+// setDefaults fills in the timestamp and severity of an event
+func (e *AuditEvent) setDefaults(now time.Time) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = now
+	}
+
+	if len(e.Severity) == 0 {
+		e.Severity = e.Type.Severity()
+		if len(e.Error) > 0 && e.Severity == SeverityInfo {
+			e.Severity = SeverityError
+		}
+	}
+}
+
 func PostAudit(auditEvent AuditEvent) {
+	auditEvent.setDefaults(time.Now().UTC())
+
 	c := http.Client{}
 	bytesOut, _ := json.Marshal(&auditEvent)
 	reader := bytes.NewBuffer(bytesOut)
@@ -21,6 +151,15 @@ func PostAudit(auditEvent AuditEvent) {
 
 	req, _ := http.NewRequest(http.MethodPost, auditURL, reader)
 
+	// audit-event only accepts events signed with the payload secret
+	payloadSecret, err := ReadSecret("payload-secret")
+	if err != nil {
+		log.Println("PostAudit", err)
+		return
+	}
+	digest := hmac.Sign(bytesOut, []byte(payloadSecret))
+	req.Header.Add(CloudSignatureHeader, "sha1="+hex.EncodeToString(digest))
+
 	res, err := c.Do(req)
 	if err != nil {
 		log.Println("PostAudit", err)
@@ -30,10 +169,3 @@ func PostAudit(auditEvent AuditEvent) {
 		defer res.Body.Close()
 	}
 }
-
-type AuditEvent struct {
-	Source  string
-	Message string
-	Owner   string
-	Repo    string
-}
@@ -0,0 +1,75 @@
+package sdk
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func Test_AuditEvent_Text(t *testing.T) {
+	event := AuditEvent{Source: "git-tar", Owner: "alexellis", Repo: "fn", Message: "built"}
+
+	want := "[git-tar] alexellis/fn: 'built'"
+	if got := event.Text(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func Test_AuditEvent_setDefaults(t *testing.T) {
+	now := time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		title string
+		event AuditEvent
+		want  Severity
+	}{
+		{"from type", AuditEvent{Type: AuditDeployFailed}, SeverityError},
+		{"warning type", AuditEvent{Type: AuditDeployRejected}, SeverityWarning},
+		{"invalid schedule with error", AuditEvent{Type: AuditScheduleInvalid, Error: "bad expression"}, SeverityWarning},
+		{"untyped", AuditEvent{}, SeverityInfo},
+		{"untyped with error", AuditEvent{Error: "timeout"}, SeverityError},
+		{"given severity is kept", AuditEvent{Type: AuditDeployFailed, Severity: SeverityWarning}, SeverityWarning},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			tc.event.setDefaults(now)
+
+			if tc.event.Severity != tc.want {
+				t.Errorf("want severity %s, got %s", tc.want, tc.event.Severity)
+			}
+			if !tc.event.Timestamp.Equal(now) {
+				t.Errorf("want timestamp %s, got %s", now, tc.event.Timestamp)
+			}
+		})
+	}
+}
+
+func Test_AuditEvent_UnmarshalsOldEvents(t *testing.T) {
+	event := AuditEvent{}
+	err := json.Unmarshal([]byte(`{"Source":"git-tar","Message":"built","Owner":"alexellis","Repo":"fn"}`), &event)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if event.Source != "git-tar" || len(event.Type) > 0 {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func Test_BuildID(t *testing.T) {
+	id := BuildID("alexellis", "fn", "04b7f4b")
+
+	if len(id) != 32 {
+		t.Errorf("want 32 characters, got %q", id)
+	}
+	if BuildID("AlexEllis", "fn", "04b7f4b") != id {
+		t.Errorf("want the owner to be compared without case")
+	}
+	if BuildID("alexellis", "fn", "5f0cbb6") == id {
+		t.Errorf("want a different ID for another commit")
+	}
+	if BuildID("alexellis", "fn", "") != "" {
+		t.Errorf("want no ID without a SHA")
+	}
+}
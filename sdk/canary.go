@@ -0,0 +1,170 @@
+package sdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// CanarySuffix is appended to the name of a stable function
+	// to give the name of its canary i.e. alexellis-fn1-canary
+	CanarySuffix = "-canary"
+
+	// CanaryLabel marks a function as the canary of a stable function
+	CanaryLabel = FunctionLabelPrefix + "canary"
+
+	// CanaryWeightAnnotation is set by users in stack.yml to opt into canary
+	// deployments, the value is the percentage of traffic (1-99) for the canary
+	CanaryWeightAnnotation = FunctionLabelPrefix + "canary.weight"
+
+	// CanarySpecAnnotation holds the SHA256 of the canary's CanarySpec. The
+	// spec holds environment variables and secret names, so it is kept in a
+	// Secret which owners cannot read rather than on the function.
+	CanarySpecAnnotation = FunctionLabelPrefix + "canary.spec"
+)
+
+// CanarySpec holds the parts of the deployment which cannot be read back
+// from the gateway, so that the canary can be re-deployed as the stable
+// function when promoted
+type CanarySpec struct {
+	EnvVars                map[string]string `json:"envVars,omitempty"`
+	Secrets                []string          `json:"secrets,omitempty"`
+	LimitsMemory           string            `json:"limitsMemory,omitempty"`
+	LimitsCPU              string            `json:"limitsCPU,omitempty"`
+	RequestsMemory         string            `json:"requestsMemory,omitempty"`
+	RequestsCPU            string            `json:"requestsCPU,omitempty"`
+	ReadOnlyRootFilesystem bool              `json:"readOnlyRootFilesystem"`
+}
+
+// FormatCanaryName gives the canary's name for a stable function
+func FormatCanaryName(serviceName string) string {
+	return serviceName + CanarySuffix
+}
+
+// StableName gives the stable function's name for a canary
+func StableName(canaryName string) string {
+	return strings.TrimSuffix(canaryName, CanarySuffix)
+}
+
+// IsCanary returns true when the labels mark a function as a canary
+func IsCanary(labels map[string]string) bool {
+	return labels[CanaryLabel] == "1"
+}
+
+// MarshalCanarySpec encodes a CanarySpec for use in an annotation
+func MarshalCanarySpec(spec CanarySpec) (string, error) {
+	bytesOut, err := json.Marshal(spec)
+	return string(bytesOut), err
+}
+
+// UnmarshalCanarySpec decodes a CanarySpec from an annotation
+func UnmarshalCanarySpec(value string) (CanarySpec, error) {
+	spec := CanarySpec{}
+	err := json.Unmarshal([]byte(value), &spec)
+	return spec, err
+}
+
+// CanarySpecNamespace is where the Secrets holding each CanarySpec are
+// kept, no functions are deployed there so owners cannot mount them
+func CanarySpecNamespace() string {
+	if val, ok := os.LookupEnv("canary_spec_namespace"); ok && len(val) > 0 {
+		return val
+	}
+	return "openfaas-canaries"
+}
+
+// canarySpecName gives the name of the Secret for a canary, the namespace
+// is included as owners may share a name across namespaces
+func canarySpecName(canaryName, namespace string) string {
+	return "canary-spec-" + FunctionRef(canaryName, namespace)
+}
+
+func canarySpecPath(canaryName, namespace string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", CanarySpecNamespace(), canarySpecName(canaryName, namespace))
+}
+
+func hashCanarySpec(encoded []byte) string {
+	digest := sha256.Sum256(encoded)
+	return hex.EncodeToString(digest[:])
+}
+
+// WriteCanarySpec stores the spec for a canary, replacing any spec of an
+// earlier canary of the same name, and gives its hash for the annotation
+func WriteCanarySpec(k *KubeClient, canaryName, namespace string, spec CanarySpec) (string, error) {
+	encoded, err := MarshalCanarySpec(spec)
+	if err != nil {
+		return "", err
+	}
+
+	metadata := map[string]interface{}{
+		"name": canarySpecName(canaryName, namespace),
+		"labels": map[string]string{
+			"openfaas-cloud": "1",
+		},
+	}
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   metadata,
+		"data": map[string][]byte{
+			"spec": []byte(encoded),
+		},
+	}
+
+	existing := struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+	}{}
+
+	path := canarySpecPath(canaryName, namespace)
+	found, err := k.Get(path, &existing)
+	if err != nil {
+		return "", err
+	}
+
+	if found {
+		metadata["resourceVersion"] = existing.Metadata.ResourceVersion
+		err = k.Update(path, secret)
+	} else {
+		err = k.Create(fmt.Sprintf("/api/v1/namespaces/%s/secrets", CanarySpecNamespace()), secret)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return hashCanarySpec([]byte(encoded)), nil
+}
+
+// ReadCanarySpec reads the stored spec for a canary, which must match the
+// hash in the canary's annotation
+func ReadCanarySpec(k *KubeClient, canaryName, namespace, hash string) (CanarySpec, error) {
+	secret := struct {
+		Data map[string][]byte `json:"data"`
+	}{}
+
+	found, err := k.Get(canarySpecPath(canaryName, namespace), &secret)
+	if err != nil {
+		return CanarySpec{}, err
+	}
+	if !found {
+		return CanarySpec{}, fmt.Errorf("no spec is stored for %s", canaryName)
+	}
+
+	encoded := secret.Data["spec"]
+	if len(hash) == 0 || hashCanarySpec(encoded) != hash {
+		return CanarySpec{}, fmt.Errorf("the spec stored for %s does not match the canary", canaryName)
+	}
+
+	return UnmarshalCanarySpec(string(encoded))
+}
+
+// DeleteCanarySpec removes the stored spec once a canary is promoted or
+// removed
+func DeleteCanarySpec(k *KubeClient, canaryName, namespace string) error {
+	return k.Delete(canarySpecPath(canaryName, namespace))
+}
@@ -0,0 +1,88 @@
+package sdk
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeSecrets serves the secrets API of Kubernetes from a map
+func fakeSecrets(t *testing.T, secrets map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := "/api/v1/namespaces/openfaas-canaries/secrets"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+		switch r.Method {
+		case http.MethodGet:
+			body, ok := secrets[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		case http.MethodPost, http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			secret := struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			}{}
+			json.Unmarshal(body, &secret)
+			secrets[secret.Metadata.Name] = body
+			if r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusCreated)
+			}
+		case http.MethodDelete:
+			delete(secrets, name)
+		}
+	}))
+}
+
+func Test_CanarySpec_WriteReadDelete(t *testing.T) {
+	secrets := map[string][]byte{}
+	api := fakeSecrets(t, secrets)
+	defer api.Close()
+
+	k := &KubeClient{BaseURL: api.URL, Client: http.DefaultClient}
+	namespace := "openfaas-fn-alexellis"
+
+	first, err := WriteCanarySpec(k, "alexellis-fn1-canary", namespace, CanarySpec{EnvVars: map[string]string{"mode": "test"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, ok := secrets["canary-spec-alexellis-fn1-canary.openfaas-fn-alexellis"]; !ok {
+		t.Fatalf("want the spec stored as a secret, got: %v", secrets)
+	}
+
+	spec, err := ReadCanarySpec(k, "alexellis-fn1-canary", namespace, first)
+	if err != nil || spec.EnvVars["mode"] != "test" {
+		t.Errorf("want the spec read back, got: %+v %v", spec, err)
+	}
+
+	second, err := WriteCanarySpec(k, "alexellis-fn1-canary", namespace, CanarySpec{EnvVars: map[string]string{"mode": "prod"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if _, err := ReadCanarySpec(k, "alexellis-fn1-canary", namespace, first); err == nil {
+		t.Errorf("want an error for the hash of a replaced spec")
+	}
+	if spec, err := ReadCanarySpec(k, "alexellis-fn1-canary", namespace, second); err != nil || spec.EnvVars["mode"] != "prod" {
+		t.Errorf("want the new spec, got: %+v %v", spec, err)
+	}
+
+	if err := DeleteCanarySpec(k, "alexellis-fn1-canary", namespace); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, err := ReadCanarySpec(k, "alexellis-fn1-canary", namespace, second); err == nil {
+		t.Errorf("want an error once the spec is deleted")
+	}
+}
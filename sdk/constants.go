@@ -3,6 +3,32 @@ package sdk
 const (
 	//CloudSignatureHeader header name to pass signed payload secret
 	CloudSignatureHeader = "X-Cloud-Signature"
+	// BuildIDHeader carries the ID of the build between the functions of the pipeline
+	BuildIDHeader = "X-Cloud-Build-Id"
+	// TraceParentHeader carries the parent span in the W3C trace context format
+	TraceParentHeader = "Traceparent"
 	// FunctionLabelPrefix is a prefix for openfaas labels inside functions
 	FunctionLabelPrefix = "com.openfaas.cloud."
+	// RateLimitAnnotation limits the requests to a function through the edge-router, i.e. 10/s or 600/m
+	RateLimitAnnotation = FunctionLabelPrefix + "rate-limit"
+	// RateLimitBurstAnnotation is the number of requests allowed at once, defaults to the count of the rate limit
+	RateLimitBurstAnnotation = FunctionLabelPrefix + "rate-limit.burst"
+	// CORSOriginsAnnotation is a comma-separated list of origins allowed to call a function from a browser, or *
+	CORSOriginsAnnotation = FunctionLabelPrefix + "cors.origins"
+	// CORSMethodsAnnotation is a comma-separated list of methods allowed in a CORS preflight
+	CORSMethodsAnnotation = FunctionLabelPrefix + "cors.methods"
+	// CORSHeadersAnnotation is a comma-separated list of request headers allowed in a CORS preflight
+	CORSHeadersAnnotation = FunctionLabelPrefix + "cors.headers"
+	// CORSCredentialsAnnotation allows cookies on cross-origin requests when "true"
+	CORSCredentialsAnnotation = FunctionLabelPrefix + "cors.credentials"
+	// CORSMaxAgeAnnotation is how many seconds a browser may cache a CORS preflight for
+	CORSMaxAgeAnnotation = FunctionLabelPrefix + "cors.max-age"
+	// IPAllowAnnotation is a comma-separated list of IP addresses or CIDRs allowed to invoke a function
+	IPAllowAnnotation = FunctionLabelPrefix + "ip-allow"
+	// MaxBodyBytesAnnotation is the largest request body accepted for a function by the edge-router
+	MaxBodyBytesAnnotation = FunctionLabelPrefix + "max-body-bytes"
+	// PrivateAnnotation limits a function to its owner and those in PrivateAllowAnnotation when "true"
+	PrivateAnnotation = FunctionLabelPrefix + "private"
+	// PrivateAllowAnnotation is a comma-separated list of users and organizations allowed to invoke a private function
+	PrivateAllowAnnotation = FunctionLabelPrefix + "private.allow"
 )
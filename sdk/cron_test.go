@@ -0,0 +1,71 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ParseSchedule_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("want error for %q", expr)
+		}
+	}
+}
+
+func Test_Schedule_Matches(t *testing.T) {
+	// Monday
+	at := time.Date(2020, time.March, 2, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"* * * * *", true},
+		{"*/5 * * * *", true},
+		{"*/10 * * * *", false},
+		{"15 10 * * *", true},
+		{"0,15,30 9-11 * * *", true},
+		{"15 10 * * mon", true},
+		{"15 10 * * 0,7", false},
+		{"15 10 * mar *", true},
+		{"15 10 1 * *", false},
+		// day of month or day of week when both are restricted
+		{"15 10 1 * 1", true},
+		{"@hourly", false},
+		{"@daily", false},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSchedule(test.expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", test.expr, err.Error())
+		}
+		if got := s.Matches(at); got != test.want {
+			t.Errorf("%q want: %t, got: %t", test.expr, test.want, got)
+		}
+	}
+}
+
+func Test_Schedule_MatchesSundayAsSeven(t *testing.T) {
+	s, err := ParseSchedule("0 0 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sunday := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if !s.Matches(sunday) {
+		t.Errorf("want 7 to match Sunday")
+	}
+}
@@ -0,0 +1,77 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alexellis/hmac"
+)
+
+// DeployRecord is an entry in the deployment history of a
+// function, written by buildshiprun after each deployment
+type DeployRecord struct {
+	Owner    string `json:"owner"`
+	Repo     string `json:"repo"`
+	Function string `json:"function"`
+	SHA      string `json:"sha"`
+	Image    string `json:"image"`
+
+	// Result is either StatusSuccess or StatusFailure
+	Result string `json:"result"`
+
+	// Message gives detail on the result such as the error
+	Message string `json:"message,omitempty"`
+
+	// Duration of the build and deployment in seconds
+	Duration float64 `json:"duration"`
+
+	// Trigger is the event which caused the deployment i.e. "github push"
+	Trigger string `json:"trigger"`
+
+	// Target is the name of the gateway deployed to, empty for the local gateway
+	Target string `json:"target,omitempty"`
+
+	// Webhook is the delivery of this record to the owner's webhook
+	Webhook *WebhookDelivery `json:"webhook,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookDelivery records the delivery of a deploy record to an owner's webhook
+type WebhookDelivery struct {
+	// ID is sent in the X-Cloud-Delivery header
+	ID string `json:"id"`
+
+	// URL of the webhook without its query-string
+	URL string `json:"url"`
+
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Delivered  bool   `json:"delivered"`
+}
+
+// PostDeployRecord sends a record signed with the payload secret to a
+// function such as gateway:8080/function/deploy-history
+func PostDeployRecord(record DeployRecord, functionURL, payloadSecret string) (int, error) {
+	bytesOut, _ := json.Marshal(&record)
+
+	req, _ := http.NewRequest(http.MethodPost, functionURL, bytes.NewReader(bytesOut))
+
+	digest := hmac.Sign(bytesOut, []byte(payloadSecret))
+	req.Header.Add(CloudSignatureHeader, "sha1="+hex.EncodeToString(digest))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,95 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// CustomDomainAnnotation is set by users in stack.yml to serve a
+	// function at a hostname they own i.e. www.example.com
+	CustomDomainAnnotation = "com.openfaas.cloud.custom-domain"
+
+	// DomainVerificationPrefix is prepended to a custom domain to give
+	// the name of the TXT record which proves ownership
+	DomainVerificationPrefix = "_openfaas-cloud."
+
+	// DomainVerificationKey is the key of the TXT record's value, which
+	// must name the owner i.e. openfaas-cloud-owner=alexellis
+	DomainVerificationKey = "openfaas-cloud-owner"
+)
+
+// CustomDomain maps a verified hostname to an owner's function
+type CustomDomain struct {
+	Domain   string `json:"domain"`
+	Owner    string `json:"owner"`
+	Function string `json:"function"`
+}
+
+// TXTResolver looks up TXT records, net.DefaultResolver is used
+// outside of tests
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NewTXTResolver gives the system's resolver
+func NewTXTResolver() TXTResolver {
+	return net.DefaultResolver
+}
+
+// NormalizeDomain lower-cases the domain and validates that it is a
+// hostname with at least two labels
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+
+	if len(domain) == 0 || len(domain) > 253 {
+		return "", fmt.Errorf("domain must be between 1 and 253 characters")
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("domain %q must have at least two labels", domain)
+	}
+
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("domain %q has an invalid label %q", domain, label)
+		}
+		for _, r := range label {
+			if !((r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-') {
+				return "", fmt.Errorf("domain %q has an invalid label %q", domain, label)
+			}
+		}
+	}
+
+	return domain, nil
+}
+
+// VerifyDomain checks that the TXT record for the domain names the
+// owner, i.e. for www.example.com and alexellis:
+// _openfaas-cloud.www.example.com TXT "openfaas-cloud-owner=alexellis"
+func VerifyDomain(ctx context.Context, resolver TXTResolver, domain, owner string) error {
+	normalized, err := NormalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	name := DomainVerificationPrefix + normalized
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return fmt.Errorf("unable to look up TXT record %s: %s", name, err.Error())
+	}
+
+	for _, record := range records {
+		parts := strings.SplitN(strings.TrimSpace(record), "=", 2)
+		if len(parts) == 2 &&
+			strings.EqualFold(strings.TrimSpace(parts[0]), DomainVerificationKey) &&
+			strings.EqualFold(strings.TrimSpace(parts[1]), owner) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("TXT record %s must be %q", name, DomainVerificationKey+"="+strings.ToLower(owner))
+}
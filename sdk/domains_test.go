@@ -0,0 +1,72 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := f[name]; ok {
+		return records, nil
+	}
+	return nil, fmt.Errorf("no such host")
+}
+
+func Test_NormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain  string
+		want    string
+		wantErr bool
+	}{
+		{"www.example.com", "www.example.com", false},
+		{" WWW.Example.com. ", "www.example.com", false},
+		{"example", "", true},
+		{"-bad.example.com", "", true},
+		{"under_score.example.com", "", true},
+		{"empty..example.com", "", true},
+		{"", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.domain, func(t *testing.T) {
+			got, err := NormalizeDomain(test.domain)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("want error: %t, got: %v", test.wantErr, err)
+			}
+			if got != test.want {
+				t.Errorf("want: %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_VerifyDomain(t *testing.T) {
+	resolver := fakeResolver{
+		"_openfaas-cloud.www.example.com":  {"v=spf1 -all", "openfaas-cloud-owner=AlexEllis"},
+		"_openfaas-cloud.blog.example.com": {"openfaas-cloud-owner=rgee0"},
+	}
+
+	tests := []struct {
+		name    string
+		domain  string
+		owner   string
+		wantErr bool
+	}{
+		{"record names the owner", "www.example.com", "alexellis", false},
+		{"record is for another owner", "blog.example.com", "alexellis", true},
+		{"no record", "api.example.com", "alexellis", true},
+		{"invalid domain", "example", "alexellis", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyDomain(context.Background(), resolver, test.domain, test.owner)
+			if test.wantErr != (err != nil) {
+				t.Errorf("want error: %t, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
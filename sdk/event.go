@@ -22,6 +22,20 @@ type Event struct {
 	RepoURL        string            `json:"repourl"`
 	Labels         map[string]string `json:"labels"`
 	Annotations    map[string]string `json:"annotations"`
+
+	// BuildID correlates the logs, statuses and audit events of a build
+	BuildID string `json:"build-id,omitempty"`
+
+	// Limits and Requests are the resources given in the user's stack.yml
+	Limits   *FunctionResources `json:"limits,omitempty"`
+	Requests *FunctionResources `json:"requests,omitempty"`
+}
+
+// FunctionResources are the memory and CPU for a function
+// as written in stack.yml i.e. 128Mi and 100m
+type FunctionResources struct {
+	Memory string `json:"memory,omitempty"`
+	CPU    string `json:"cpu,omitempty"`
 }
 
 // BuildEventFromPushEvent function to build Event from PushEvent
@@ -43,6 +57,7 @@ func BuildEventFromPushEvent(pushEvent PushEvent) *Event {
 
 	info.SHA = pushEvent.AfterCommitID
 	info.InstallationID = pushEvent.Installation.ID
+	info.BuildID = pushEvent.BuildID
 
 	return &info
 }
@@ -19,6 +19,9 @@ type PushEvent struct {
 	AfterCommitID string `json:"after"`
 	Installation  PushEventInstallation
 	SCM           string // SCM field is for internal use and not provided by GitHub
+
+	// BuildID is set by github-push and not provided by GitHub
+	BuildID string `json:"build_id,omitempty"`
 }
 
 // Owner is the owner of a GitHub repo
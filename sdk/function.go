@@ -1,5 +1,7 @@
 package sdk
 
+import "regexp"
+
 type Function struct {
 	Name            string            `json:"name"`
 	Image           string            `json:"image"`
@@ -8,3 +10,13 @@ type Function struct {
 	Labels          map[string]string `json:"labels"`
 	Annotations     map[string]string `json:"annotations"`
 }
+
+// validName starts and ends with an alphanumeric character, so cannot be
+// . or .. or contain a path separator
+var validName = regexp.MustCompile("^[a-zA-Z0-9]([a-zA-Z0-9._-]*[a-zA-Z0-9])?$")
+
+// ValidName is true for an owner, repo or function name which is safe to
+// use as part of a file path or object key
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
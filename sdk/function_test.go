@@ -0,0 +1,29 @@
+package sdk
+
+import "testing"
+
+func Test_ValidName(t *testing.T) {
+	tests := []struct {
+		Name string
+		Want bool
+	}{
+		{"alexellis", true},
+		{"super-pancake", true},
+		{"openfaas.github.io", true},
+		{"fn_1", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../x", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"_chain", false},
+		{"fn-", false},
+	}
+
+	for _, test := range tests {
+		if got := ValidName(test.Name); got != test.Want {
+			t.Errorf("%q: want %t, got %t", test.Name, test.Want, got)
+		}
+	}
+}
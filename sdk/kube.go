@@ -0,0 +1,155 @@
+package sdk
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const serviceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubeClient reads and writes objects through the Kubernetes API using
+// the service account of the function
+type KubeClient struct {
+	BaseURL string
+	Token   string
+
+	// Namespace the function is running in
+	Namespace string
+
+	Client *http.Client
+}
+
+// NewInClusterClient uses the service account mounted into the function
+func NewInClusterClient(timeout time.Duration) (*KubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 || len(port) == 0 {
+		return nil, fmt.Errorf("KUBERNETES_SERVICE_HOST is not set, this needs Kubernetes")
+	}
+
+	token, err := ioutil.ReadFile(serviceAccountPath + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account token: %s", err.Error())
+	}
+
+	caCert, err := ioutil.ReadFile(serviceAccountPath + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account CA: %s", err.Error())
+	}
+
+	namespace, _ := ioutil.ReadFile(serviceAccountPath + "/namespace")
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(caCert)
+
+	return &KubeClient{
+		BaseURL:   "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: strings.TrimSpace(string(namespace)),
+		Client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: rootCAs},
+			},
+		},
+	}, nil
+}
+
+// Create posts an object to the API, an object which already exists is
+// not treated as an error.
+func (k *KubeClient) Create(path string, object interface{}) error {
+	res, resBody, err := k.do(http.MethodPost, path, object)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusConflict:
+		return nil
+	}
+
+	return fmt.Errorf("unexpected status code %d from %s: %s", res.StatusCode, path, string(resBody))
+}
+
+// Get reads an object from the API into out, found is false when the
+// object does not exist
+func (k *KubeClient) Get(path string, out interface{}) (bool, error) {
+	res, resBody, err := k.do(http.MethodGet, path, nil)
+	if err != nil {
+		return false, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, json.Unmarshal(resBody, out)
+	case http.StatusNotFound:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unexpected status code %d from %s: %s", res.StatusCode, path, string(resBody))
+}
+
+// Update replaces an object, which must hold the resourceVersion it
+// was read with
+func (k *KubeClient) Update(path string, object interface{}) error {
+	res, resBody, err := k.do(http.MethodPut, path, object)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s: %s", res.StatusCode, path, string(resBody))
+	}
+	return nil
+}
+
+// Delete removes an object, an object which does not exist is not treated
+// as an error
+func (k *KubeClient) Delete(path string) error {
+	res, resBody, err := k.do(http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNotFound:
+		return nil
+	}
+
+	return fmt.Errorf("unexpected status code %d from %s: %s", res.StatusCode, path, string(resBody))
+}
+
+func (k *KubeClient) do(method, path string, object interface{}) (*http.Response, []byte, error) {
+	var body []byte
+	if object != nil {
+		var err error
+		if body, err = json.Marshal(object); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	req, _ := http.NewRequest(method, k.BaseURL+path, bytes.NewReader(body))
+	if object != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(k.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+k.Token)
+	}
+
+	res, err := k.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, _ := ioutil.ReadAll(res.Body)
+	return res, resBody, nil
+}
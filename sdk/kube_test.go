@@ -0,0 +1,45 @@
+package sdk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_KubeClient_Get(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/namespaces/openfaas-fn" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"metadata": {"name": "openfaas-fn"}}`))
+	}))
+	defer api.Close()
+
+	k := &KubeClient{BaseURL: api.URL, Token: "token", Client: http.DefaultClient}
+
+	namespace := struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}{}
+
+	found, err := k.Get("/api/v1/namespaces/openfaas-fn", &namespace)
+	if err != nil || !found || namespace.Metadata.Name != "openfaas-fn" {
+		t.Errorf("want namespace found, got: %t %v %v", found, namespace, err)
+	}
+
+	found, err = k.Get("/api/v1/namespaces/other", &namespace)
+	if err != nil || found {
+		t.Errorf("want not found without an error, got: %t %v", found, err)
+	}
+
+	k.Token = "wrong"
+	if _, err = k.Get("/api/v1/namespaces/openfaas-fn", &namespace); err == nil {
+		t.Errorf("want error for unauthorized")
+	}
+}
@@ -0,0 +1,69 @@
+package sdk
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultNamespacePrefix is used to name each owner's namespace
+// when namespace_prefix is not set i.e. openfaas-fn-alexellis
+const defaultNamespacePrefix = "openfaas-fn-"
+
+// maxNamespaceLength is the limit for a DNS-1123 label
+const maxNamespaceLength = 63
+
+// UserNamespaces returns true when each owner's functions are deployed
+// into a dedicated namespace, set via the user_namespaces env-var
+func UserNamespaces() bool {
+	val := os.Getenv("user_namespaces")
+	return val == "true" || val == "1"
+}
+
+// FunctionNamespace gives the namespace for an owner's functions, an
+// empty string means the default namespace of the gateway
+func FunctionNamespace(owner string) string {
+	if !UserNamespaces() {
+		return ""
+	}
+
+	return FormatNamespace(NamespacePrefix(), owner)
+}
+
+// NamespacePrefix is prepended to each owner to give the namespace of
+// their functions, set via the namespace_prefix env-var
+func NamespacePrefix() string {
+	prefix := os.Getenv("namespace_prefix")
+	if len(prefix) == 0 {
+		prefix = defaultNamespacePrefix
+	}
+	return prefix
+}
+
+// FormatNamespace joins the prefix and owner into a valid namespace name
+// of lower-case alphanumeric characters and dashes
+func FormatNamespace(prefix, owner string) string {
+	name := []rune{}
+	for _, r := range strings.ToLower(prefix + owner) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			name = append(name, r)
+		} else {
+			name = append(name, '-')
+		}
+	}
+
+	formatted := string(name)
+	if len(formatted) > maxNamespaceLength {
+		formatted = formatted[:maxNamespaceLength]
+	}
+
+	return strings.Trim(formatted, "-")
+}
+
+// FunctionRef gives the name used to invoke a function through the
+// gateway, functions outside the default namespace are suffixed with it
+func FunctionRef(functionName, namespace string) string {
+	if len(namespace) == 0 {
+		return functionName
+	}
+	return functionName + "." + namespace
+}
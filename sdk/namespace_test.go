@@ -0,0 +1,60 @@
+package sdk
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_FunctionNamespace_Disabled(t *testing.T) {
+	os.Setenv("user_namespaces", "false")
+
+	if got := FunctionNamespace("alexellis"); got != "" {
+		t.Errorf("want default namespace, got: %q", got)
+	}
+}
+
+func Test_FunctionNamespace_Enabled(t *testing.T) {
+	os.Setenv("user_namespaces", "true")
+	defer os.Setenv("user_namespaces", "")
+
+	os.Setenv("namespace_prefix", "")
+	if got := FunctionNamespace("AlexEllis"); got != "openfaas-fn-alexellis" {
+		t.Errorf("want openfaas-fn-alexellis, got: %q", got)
+	}
+
+	os.Setenv("namespace_prefix", "tenant-")
+	defer os.Setenv("namespace_prefix", "")
+	if got := FunctionNamespace("alexellis"); got != "tenant-alexellis" {
+		t.Errorf("want tenant-alexellis, got: %q", got)
+	}
+}
+
+func Test_FormatNamespace(t *testing.T) {
+	tests := []struct {
+		owner string
+		want  string
+	}{
+		{owner: "alexellis", want: "openfaas-fn-alexellis"},
+		{owner: "some_group.name", want: "openfaas-fn-some-group-name"},
+		{owner: "a-very-long-owner-name-which-goes-over-the-limit-for-a-label-", want: "openfaas-fn-a-very-long-owner-name-which-goes-over-the-limit-fo"},
+	}
+
+	for _, test := range tests {
+		got := FormatNamespace("openfaas-fn-", test.owner)
+		if got != test.want {
+			t.Errorf("want %q, got %q", test.want, got)
+		}
+		if len(got) > maxNamespaceLength {
+			t.Errorf("namespace %q is longer than %d", got, maxNamespaceLength)
+		}
+	}
+}
+
+func Test_FunctionRef(t *testing.T) {
+	if got := FunctionRef("alexellis-fn1", ""); got != "alexellis-fn1" {
+		t.Errorf("want alexellis-fn1, got: %s", got)
+	}
+	if got := FunctionRef("alexellis-fn1", "openfaas-fn-alexellis"); got != "alexellis-fn1.openfaas-fn-alexellis" {
+		t.Errorf("want alexellis-fn1.openfaas-fn-alexellis, got: %s", got)
+	}
+}
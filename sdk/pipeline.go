@@ -8,4 +8,5 @@ type PipelineLog struct {
 	Function  string
 	Source    string
 	Data      string
+	BuildID   string `json:",omitempty"`
 }
@@ -0,0 +1,107 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Quota limits what a customer can deploy, a zero value means
+// that no limit applies
+type Quota struct {
+	// MemoryLimitMB is the memory limit for each function in MB
+	MemoryLimitMB int `json:"memoryLimitMB,omitempty"`
+
+	// CPULimitMilli is the CPU limit for each function in milliCPU
+	CPULimitMilli int `json:"cpuLimitMilli,omitempty"`
+
+	// MaxReplicas caps com.openfaas.scale.max for each function
+	MaxReplicas int `json:"maxReplicas,omitempty"`
+
+	// MaxFunctions is the number of functions across all repos
+	MaxFunctions int `json:"maxFunctions,omitempty"`
+
+	// MaxBuildsPerHour is the number of function builds in any hour
+	MaxBuildsPerHour int `json:"maxBuildsPerHour,omitempty"`
+}
+
+// Quotas are read from the file given by the quotas_path env-var
+type Quotas struct {
+	// Default applies to every owner
+	Default Quota `json:"default"`
+
+	// Owners overrides the default quota for an owner
+	Owners map[string]Quota `json:"owners"`
+}
+
+// ReadQuotas reads quotas from the file at quotas_path, when the
+// env-var is not set no limits apply.
+func ReadQuotas() (*Quotas, error) {
+	quotas := &Quotas{}
+
+	quotasPath := os.Getenv("quotas_path")
+	if len(quotasPath) == 0 {
+		return quotas, nil
+	}
+
+	data, err := ioutil.ReadFile(quotasPath)
+	if err != nil {
+		return quotas, fmt.Errorf("unable to read quotas from %s: %s", quotasPath, err.Error())
+	}
+
+	if err := json.Unmarshal(data, quotas); err != nil {
+		return quotas, fmt.Errorf("unable to parse quotas from %s: %s", quotasPath, err.Error())
+	}
+
+	return quotas, nil
+}
+
+// Get returns the quota for an owner, where each limit not
+// set for the owner is taken from the default
+func (q *Quotas) Get(owner string) Quota {
+	quota := q.Default
+
+	for name, ownerQuota := range q.Owners {
+		if !strings.EqualFold(name, owner) {
+			continue
+		}
+
+		if ownerQuota.MemoryLimitMB > 0 {
+			quota.MemoryLimitMB = ownerQuota.MemoryLimitMB
+		}
+		if ownerQuota.CPULimitMilli > 0 {
+			quota.CPULimitMilli = ownerQuota.CPULimitMilli
+		}
+		if ownerQuota.MaxReplicas > 0 {
+			quota.MaxReplicas = ownerQuota.MaxReplicas
+		}
+		if ownerQuota.MaxFunctions > 0 {
+			quota.MaxFunctions = ownerQuota.MaxFunctions
+		}
+		if ownerQuota.MaxBuildsPerHour > 0 {
+			quota.MaxBuildsPerHour = ownerQuota.MaxBuildsPerHour
+		}
+	}
+
+	return quota
+}
+
+// CheckFunctions returns an error when count functions would
+// exceed the quota
+func (q Quota) CheckFunctions(count int) error {
+	if q.MaxFunctions > 0 && count > q.MaxFunctions {
+		return fmt.Errorf("quota exceeded: %d functions requested, the limit is %d", count, q.MaxFunctions)
+	}
+	return nil
+}
+
+// CheckBuilds returns an error when count builds within an
+// hour would exceed the quota
+func (q Quota) CheckBuilds(count int) error {
+	if q.MaxBuildsPerHour > 0 && count > q.MaxBuildsPerHour {
+		return fmt.Errorf("quota exceeded: %d builds in the last hour, the limit is %d per hour", count, q.MaxBuildsPerHour)
+	}
+	return nil
+}
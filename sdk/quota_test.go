@@ -0,0 +1,70 @@
+package sdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_ReadQuotas_NoPath(t *testing.T) {
+	os.Setenv("quotas_path", "")
+
+	quotas, err := ReadQuotas()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if quota := quotas.Get("alexellis"); quota != (Quota{}) {
+		t.Errorf("want no limits, got: %+v", quota)
+	}
+}
+
+func Test_ReadQuotas_OwnerOverridesDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quotas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	quotasPath := path.Join(dir, "quotas.json")
+	ioutil.WriteFile(quotasPath, []byte(`{
+  "default": {"memoryLimitMB": 128, "maxFunctions": 10, "maxBuildsPerHour": 20},
+  "owners": {"AlexEllis": {"memoryLimitMB": 512, "maxReplicas": 2}}
+}`), 0600)
+
+	os.Setenv("quotas_path", quotasPath)
+	defer os.Setenv("quotas_path", "")
+
+	quotas, err := ReadQuotas()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	want := Quota{MemoryLimitMB: 512, MaxReplicas: 2, MaxFunctions: 10, MaxBuildsPerHour: 20}
+	if got := quotas.Get("alexellis"); got != want {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+
+	want = Quota{MemoryLimitMB: 128, MaxFunctions: 10, MaxBuildsPerHour: 20}
+	if got := quotas.Get("rgee0"); got != want {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+}
+
+func Test_Quota_Checks(t *testing.T) {
+	quota := Quota{MaxFunctions: 2, MaxBuildsPerHour: 5}
+
+	if err := quota.CheckFunctions(2); err != nil {
+		t.Errorf("want no error at the limit, got: %s", err.Error())
+	}
+	if err := quota.CheckFunctions(3); err == nil {
+		t.Errorf("want error above the limit")
+	}
+	if err := quota.CheckBuilds(6); err == nil {
+		t.Errorf("want error above the limit")
+	}
+	if err := (Quota{}).CheckBuilds(100); err != nil {
+		t.Errorf("want no error without a limit, got: %s", err.Error())
+	}
+}
@@ -28,6 +28,10 @@ const (
 	tokenKey        = "token"
 )
 
+// maxDescriptionLength is the longest description GitHub accepts for a
+// commit status
+const maxDescriptionLength = 140
+
 const authTokenPattern = "^[A-Za-z0-9-_.]*"
 
 var validToken = regexp.MustCompile(authTokenPattern)
@@ -79,11 +83,27 @@ func (status *Status) AddStatus(state string, desc string, context string) {
 		status.CommitStatuses = make(map[string]CommitStatus)
 	}
 
+	suffix := ""
+	if len(status.EventInfo.BuildID) > 0 {
+		suffix = fmt.Sprintf(" (build %s)", FormatShortSHA(status.EventInfo.BuildID))
+	}
+	desc = truncateDescription(desc, maxDescriptionLength-len(suffix)) + suffix
+
 	// the status.CommitStatuses is a map hashed against the context
 	// it replace the old commit status if added for same context
 	status.CommitStatuses[context] = CommitStatus{Status: state, Description: desc, Context: context}
 }
 
+// truncateDescription shortens the description to max characters, ending
+// it with "..." when any of it was cut off
+func truncateDescription(desc string, max int) string {
+	runes := []rune(desc)
+	if len(runes) <= max {
+		return desc
+	}
+	return string(runes[:max-3]) + "..."
+}
+
 // Marshal marshals a status into json
 func (status *Status) Marshal() ([]byte, error) {
 	return json.Marshal(status)
@@ -135,6 +155,10 @@ func (status *Status) Report(gateway string, payloadSecret string) (string, erro
 		httpReq.Header.Add(CloudSignatureHeader, "sha1="+hex.EncodeToString(digest))
 	}
 
+	if len(status.EventInfo.BuildID) > 0 {
+		httpReq.Header.Add(BuildIDHeader, status.EventInfo.BuildID)
+	}
+
 	res, err := c.Do(httpReq)
 	if err != nil {
 		return "", err
@@ -0,0 +1,37 @@
+package sdk
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_AddStatus(t *testing.T) {
+	cases := []struct {
+		title   string
+		buildID string
+		desc    string
+		want    string
+	}{
+		{"without a build", "", "function deployed", "function deployed"},
+		{"with a build", "f4e36b07a2b5d9b1", "function deployed", "function deployed (build f4e36b0)"},
+		{"long description without a build", "", strings.Repeat("a", 200), strings.Repeat("a", 137) + "..."},
+		{"long description with a build", "f4e36b07a2b5d9b1", strings.Repeat("a", 200), strings.Repeat("a", 121) + "... (build f4e36b0)"},
+		{"description which fits exactly", "f4e36b07a2b5d9b1", strings.Repeat("a", 124), strings.Repeat("a", 124) + " (build f4e36b0)"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			status := BuildStatus(&Event{BuildID: tc.buildID}, EmptyAuthToken)
+			status.AddStatus(StatusSuccess, tc.desc, StackContext)
+
+			got := status.CommitStatuses[StackContext].Description
+			if got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+			if n := utf8.RuneCountInString(got); n > maxDescriptionLength {
+				t.Errorf("want at most %d characters, got %d", maxDescriptionLength, n)
+			}
+		})
+	}
+}
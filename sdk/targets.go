@@ -0,0 +1,195 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TargetsAnnotation selects the deployment targets of a function as
+// a comma-separated list of target names
+const TargetsAnnotation = "com.openfaas.cloud.targets"
+
+// DeployTarget is an OpenFaaS gateway which functions can be deployed to
+type DeployTarget struct {
+	// Name is shown in the commit status, i.e. eu-west
+	Name string `json:"name"`
+
+	// GatewayURL of the target i.e. https://gateway.eu-west.example.com/
+	GatewayURL string `json:"gatewayURL"`
+
+	// BasicAuthUserSecret and BasicAuthPasswordSecret name the secrets
+	// holding credentials for the gateway, when not set the credentials
+	// of the local gateway are used
+	BasicAuthUserSecret     string `json:"basicAuthUserSecret,omitempty"`
+	BasicAuthPasswordSecret string `json:"basicAuthPasswordSecret,omitempty"`
+
+	// RepositoryURL is the registry the target pulls images from,
+	// defaults to the repository_url env-var
+	RepositoryURL string `json:"repositoryURL,omitempty"`
+
+	// Namespace for functions on the target, defaults to the
+	// namespace given by FunctionNamespace
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// DeployTargets are read from the file given by the deploy_targets_path env-var
+type DeployTargets struct {
+	Targets []DeployTarget `json:"targets"`
+
+	// Default names the targets used when a function has no
+	// annotation and its owner has no entry, defaults to all
+	Default []string `json:"default,omitempty"`
+
+	// Owners restricts an owner to the named targets
+	Owners map[string][]string `json:"owners,omitempty"`
+}
+
+// ReadDeployTargets reads targets from the file at deploy_targets_path, when
+// the env-var is not set the only target is the local gateway_url
+func ReadDeployTargets() (*DeployTargets, error) {
+	targetsPath := os.Getenv("deploy_targets_path")
+	if len(targetsPath) == 0 {
+		return &DeployTargets{
+			Targets: []DeployTarget{{GatewayURL: os.Getenv("gateway_url")}},
+		}, nil
+	}
+
+	data, err := ioutil.ReadFile(targetsPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read deploy targets from %s: %s", targetsPath, err.Error())
+	}
+
+	targets := &DeployTargets{}
+	if err := json.Unmarshal(data, targets); err != nil {
+		return nil, fmt.Errorf("unable to parse deploy targets from %s: %s", targetsPath, err.Error())
+	}
+
+	if len(targets.Targets) == 0 {
+		return nil, fmt.Errorf("no deploy targets found in %s", targetsPath)
+	}
+
+	for i, target := range targets.Targets {
+		if len(target.Name) == 0 || len(target.GatewayURL) == 0 {
+			return nil, fmt.Errorf("deploy target %d needs a name and gatewayURL", i)
+		}
+		if !strings.HasSuffix(target.GatewayURL, "/") {
+			targets.Targets[i].GatewayURL = target.GatewayURL + "/"
+		}
+	}
+
+	return targets, nil
+}
+
+// Select gives the targets for an owner's function, the targets annotation
+// takes precedence over the owner's entry which takes precedence over the
+// default. An annotation may only name targets allowed for the owner.
+func (t *DeployTargets) Select(owner string, annotations map[string]string) ([]DeployTarget, error) {
+	allowed := t.names()
+	selected := t.Default
+
+	for name, ownerTargets := range t.Owners {
+		if strings.EqualFold(name, owner) {
+			allowed = ownerTargets
+			selected = ownerTargets
+		}
+	}
+
+	if val := strings.TrimSpace(annotations[TargetsAnnotation]); len(val) > 0 {
+		selected = []string{}
+		for _, name := range strings.Split(val, ",") {
+			name = strings.TrimSpace(name)
+			if !containsName(allowed, name) {
+				return nil, fmt.Errorf("deploy target %q is not available", name)
+			}
+			selected = append(selected, name)
+		}
+	}
+
+	if len(selected) == 0 {
+		selected = allowed
+	}
+
+	targets := []DeployTarget{}
+	for _, name := range selected {
+		target, ok := t.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown deploy target %q", name)
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// Get finds a target by name
+func (t *DeployTargets) Get(name string) (DeployTarget, bool) {
+	for _, target := range t.Targets {
+		if target.Name == name {
+			return target, true
+		}
+	}
+	return DeployTarget{}, false
+}
+
+func (t *DeployTargets) names() []string {
+	names := []string{}
+	for _, target := range t.Targets {
+		names = append(names, target.Name)
+	}
+	return names
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Context gives the commit status context for a function deployed to the
+// target, the context of the local gateway is unchanged
+func (t DeployTarget) Context(function string) string {
+	if len(t.Name) == 0 {
+		return BuildFunctionContext(function)
+	}
+	return fmt.Sprintf("%s (%s)", BuildFunctionContext(function), t.Name)
+}
+
+// FunctionNamespace gives the namespace for an owner's functions on the target
+func (t DeployTarget) FunctionNamespace(owner string) string {
+	if len(t.Namespace) > 0 {
+		return t.Namespace
+	}
+	return FunctionNamespace(owner)
+}
+
+// IsLocal returns true when the target is the gateway of OpenFaaS Cloud itself
+func (t DeployTarget) IsLocal() bool {
+	return strings.TrimSuffix(t.GatewayURL, "/") == strings.TrimSuffix(os.Getenv("gateway_url"), "/")
+}
+
+// AddBasicAuth adds the credentials for the target's gateway to a request
+func (t DeployTarget) AddBasicAuth(req *http.Request) error {
+	if len(t.BasicAuthUserSecret) == 0 || len(t.BasicAuthPasswordSecret) == 0 {
+		return AddBasicAuth(req)
+	}
+
+	user, err := ReadSecret(t.BasicAuthUserSecret)
+	if err != nil {
+		return fmt.Errorf("unable to read credentials for %s: %s", t.Name, err.Error())
+	}
+
+	password, err := ReadSecret(t.BasicAuthPasswordSecret)
+	if err != nil {
+		return fmt.Errorf("unable to read credentials for %s: %s", t.Name, err.Error())
+	}
+
+	req.SetBasicAuth(user, password)
+	return nil
+}
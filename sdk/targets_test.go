@@ -0,0 +1,113 @@
+package sdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_ReadDeployTargets_NoPath(t *testing.T) {
+	os.Setenv("deploy_targets_path", "")
+	os.Setenv("gateway_url", "http://gateway:8080/")
+	defer os.Setenv("gateway_url", "")
+
+	targets, err := ReadDeployTargets()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	selected, err := targets.Select("alexellis", map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if len(selected) != 1 || !selected[0].IsLocal() {
+		t.Fatalf("want the local gateway only, got: %+v", selected)
+	}
+
+	if context := selected[0].Context("fn1"); context != "fn1" {
+		t.Errorf("want context unchanged, got: %s", context)
+	}
+}
+
+func Test_ReadDeployTargets_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	targetsPath := path.Join(dir, "targets.json")
+	ioutil.WriteFile(targetsPath, []byte(`{
+  "targets": [
+    {"name": "eu-west", "gatewayURL": "https://gateway.eu-west.example.com"},
+    {"name": "us-east", "gatewayURL": "https://gateway.us-east.example.com/", "namespace": "functions"}
+  ],
+  "default": ["eu-west"],
+  "owners": {"AlexEllis": ["us-east"]}
+}`), 0600)
+
+	os.Setenv("deploy_targets_path", targetsPath)
+	defer os.Setenv("deploy_targets_path", "")
+
+	targets, err := ReadDeployTargets()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	euWest, _ := targets.Get("eu-west")
+	if euWest.GatewayURL != "https://gateway.eu-west.example.com/" {
+		t.Errorf("want trailing slash added, got: %s", euWest.GatewayURL)
+	}
+
+	tests := []struct {
+		title       string
+		owner       string
+		annotations map[string]string
+		want        []string
+		wantErr     bool
+	}{
+		{"default", "rgee0", map[string]string{}, []string{"eu-west"}, false},
+		{"owner setting", "alexellis", map[string]string{}, []string{"us-east"}, false},
+		{"annotation", "rgee0", map[string]string{TargetsAnnotation: "us-east, eu-west"}, []string{"us-east", "eu-west"}, false},
+		{"annotation outside owner setting", "alexellis", map[string]string{TargetsAnnotation: "eu-west"}, nil, true},
+		{"unknown target", "rgee0", map[string]string{TargetsAnnotation: "ap-south"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			selected, err := targets.Select(test.owner, test.annotations)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got: %+v", selected)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			names := []string{}
+			for _, target := range selected {
+				names = append(names, target.Name)
+			}
+			if len(names) != len(test.want) {
+				t.Fatalf("want: %v, got: %v", test.want, names)
+			}
+			for i := range names {
+				if names[i] != test.want[i] {
+					t.Errorf("want: %v, got: %v", test.want, names)
+				}
+			}
+		})
+	}
+
+	usEast, _ := targets.Get("us-east")
+	if context := usEast.Context("fn1"); context != "fn1 (us-east)" {
+		t.Errorf("want context with target name, got: %s", context)
+	}
+	if namespace := usEast.FunctionNamespace("alexellis"); namespace != "functions" {
+		t.Errorf("want target namespace, got: %s", namespace)
+	}
+}
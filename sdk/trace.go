@@ -0,0 +1,275 @@
+package sdk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StdoutExporter logs each span as a line of JSON to stderr, so that
+	// spans are kept apart from the response of a function
+	StdoutExporter = "stdout"
+	// OTLPExporter posts spans to an OpenTelemetry collector with OTLP/HTTP
+	OTLPExporter = "otlp"
+)
+
+var traceIDPattern = regexp.MustCompile("^[0-9a-f]{32}$")
+
+// NewBuildID gives a random ID for a build, which is also used as
+// the trace ID for its spans
+func NewBuildID() string {
+	return randomHex(16)
+}
+
+// BuildIDFromEnv reads the build ID passed in the X-Cloud-Build-Id header
+func BuildIDFromEnv() string {
+	return parseBuildID(os.Getenv("Http_" + strings.Replace(BuildIDHeader, "-", "_", -1)))
+}
+
+// BuildIDFromRequest reads the build ID from the X-Cloud-Build-Id header
+// of a request, for services which are not functions
+func BuildIDFromRequest(r *http.Request) string {
+	return parseBuildID(r.Header.Get(BuildIDHeader))
+}
+
+// parseBuildID gives an empty ID unless the value was made by
+// NewBuildID, so that it can be logged and used as a trace ID
+func parseBuildID(value string) string {
+	buildID := strings.ToLower(value)
+	if !traceIDPattern.MatchString(buildID) {
+		return ""
+	}
+	return buildID
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Span records the time spent in one stage of the pipeline, spans are
+// only exported when trace_exporter is set to stdout or otlp
+type Span struct {
+	Service      string
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	Error        string
+}
+
+// StartSpan starts a span for the build, the parent is read from the
+// Traceparent header when it belongs to the same trace
+func StartSpan(service, name, buildID string) *Span {
+	return startSpan(service, name, buildID, os.Getenv("Http_"+TraceParentHeader))
+}
+
+// StartSpanFromRequest is StartSpan for services which are not functions,
+// the build ID and parent are read from the headers of the request
+func StartSpanFromRequest(service, name string, r *http.Request) *Span {
+	return startSpan(service, name, BuildIDFromRequest(r), r.Header.Get(TraceParentHeader))
+}
+
+func startSpan(service, name, buildID, traceParent string) *Span {
+	span := &Span{
+		Service:    service,
+		Name:       name,
+		TraceID:    traceID(buildID),
+		SpanID:     randomHex(8),
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+	}
+
+	if len(buildID) > 0 {
+		span.Attributes["openfaas.cloud.build_id"] = buildID
+	}
+
+	if traceID, parentID, ok := parseTraceParent(traceParent); ok && traceID == span.TraceID {
+		span.ParentSpanID = parentID
+	}
+
+	return span
+}
+
+// StartChild starts a span within this one
+func (s *Span) StartChild(name string) *Span {
+	child := &Span{
+		Service:      s.Service,
+		Name:         name,
+		TraceID:      s.TraceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: s.SpanID,
+		Start:        time.Now(),
+		Attributes:   map[string]string{},
+	}
+
+	for k, v := range s.Attributes {
+		child.Attributes[k] = v
+	}
+	return child
+}
+
+// SetAttribute records a key and value on the span
+func (s *Span) SetAttribute(key, value string) {
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+// Inject adds the build ID and this span as the parent to a request
+// for the next stage of the pipeline
+func (s *Span) Inject(req *http.Request) {
+	if buildID, ok := s.Attributes["openfaas.cloud.build_id"]; ok {
+		req.Header.Set(BuildIDHeader, buildID)
+	}
+	req.Header.Set(TraceParentHeader, s.TraceParent())
+}
+
+// TraceParent gives the value of the Traceparent header for a request
+// made within this span
+func (s *Span) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
+
+// Finish ends the span and exports it
+func (s *Span) Finish() {
+	s.End = time.Now()
+
+	if err := exportSpan(s, os.Getenv("trace_exporter")); err != nil {
+		log.Printf("unable to export span %s: %s", s.Name, err.Error())
+	}
+}
+
+// traceID uses the build ID as the trace ID, or a hash of it when it
+// was not generated by NewBuildID
+func traceID(buildID string) string {
+	if traceIDPattern.MatchString(buildID) {
+		return buildID
+	}
+	if len(buildID) == 0 {
+		return randomHex(16)
+	}
+
+	digest := sha256.Sum256([]byte(buildID))
+	return hex.EncodeToString(digest[:16])
+}
+
+func parseTraceParent(value string) (string, string, bool) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(value)), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func exportSpan(s *Span, exporter string) error {
+	switch exporter {
+	case "":
+		return nil
+	case StdoutExporter:
+		bytesOut, err := json.Marshal(otlpRequest(s))
+		if err != nil {
+			return err
+		}
+		log.Println(string(bytesOut))
+		return nil
+	case OTLPExporter:
+		return postSpan(s)
+	}
+
+	return fmt.Errorf("unsupported trace_exporter: %q, use %q or %q", exporter, StdoutExporter, OTLPExporter)
+}
+
+func postSpan(s *Span) error {
+	endpoint := os.Getenv("otlp_endpoint")
+	if len(endpoint) == 0 {
+		endpoint = "http://otel-collector.openfaas:4318"
+	}
+
+	bytesOut, err := json.Marshal(otlpRequest(s))
+	if err != nil {
+		return err
+	}
+
+	c := http.Client{Timeout: 3 * time.Second}
+	res, err := c.Post(strings.TrimRight(endpoint, "/")+"/v1/traces", "application/json", bytes.NewReader(bytesOut))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status from collector: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// otlpRequest encodes the span as an OTLP/HTTP JSON export request
+func otlpRequest(s *Span) map[string]interface{} {
+	attributes := []map[string]interface{}{}
+	for k, v := range s.Attributes {
+		attributes = append(attributes, otlpAttribute(k, v))
+	}
+
+	status := map[string]interface{}{"code": 1}
+	if len(s.Error) > 0 {
+		status = map[string]interface{}{"code": 2, "message": s.Error}
+	}
+
+	span := map[string]interface{}{
+		"traceId":           s.TraceID,
+		"spanId":            s.SpanID,
+		"name":              s.Name,
+		"kind":              2,
+		"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+	if len(s.ParentSpanID) > 0 {
+		span["parentSpanId"] = s.ParentSpanID
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []interface{}{otlpAttribute("service.name", s.Service)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "openfaas-cloud"},
+						"spans": []interface{}{span},
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttribute(key, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"key":   key,
+		"value": map[string]interface{}{"stringValue": value},
+	}
+}
@@ -0,0 +1,146 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_NewBuildID(t *testing.T) {
+	id := NewBuildID()
+
+	if !traceIDPattern.MatchString(id) {
+		t.Errorf("want 32 hex characters, got %q", id)
+	}
+	if NewBuildID() == id {
+		t.Errorf("want a new ID each time")
+	}
+}
+
+func Test_BuildIDFromEnv(t *testing.T) {
+	defer os.Unsetenv("Http_X_Cloud_Build_Id")
+
+	os.Setenv("Http_X_Cloud_Build_Id", "0AF7651916CD43DD8448EB211C80319C")
+	if got := BuildIDFromEnv(); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("want the build ID in lower case, got %q", got)
+	}
+
+	os.Setenv("Http_X_Cloud_Build_Id", "$(rm -rf /)")
+	if got := BuildIDFromEnv(); got != "" {
+		t.Errorf("want an invalid build ID to be ignored, got %q", got)
+	}
+}
+
+func Test_StartSpanFromRequest(t *testing.T) {
+	buildID := NewBuildID()
+	req := httptest.NewRequest(http.MethodPost, "/build", nil)
+	req.Header.Set(BuildIDHeader, strings.ToUpper(buildID))
+	req.Header.Set(TraceParentHeader, "00-"+buildID+"-00f067aa0ba902b7-01")
+
+	span := StartSpanFromRequest("of-builder", "build", req)
+	if span.TraceID != buildID || span.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("want the trace and parent from the request, got %q %q", span.TraceID, span.ParentSpanID)
+	}
+
+	req.Header.Set(BuildIDHeader, "build\nINFO forged")
+	if got := BuildIDFromRequest(req); got != "" {
+		t.Errorf("want an invalid build ID to be ignored, got %q", got)
+	}
+}
+
+func Test_traceID(t *testing.T) {
+	buildID := NewBuildID()
+	if traceID(buildID) != buildID {
+		t.Errorf("want the build ID to be the trace ID")
+	}
+
+	legacy := traceID("5c3e6a9f0b1d2e4f")
+	if !traceIDPattern.MatchString(legacy) || legacy != traceID("5c3e6a9f0b1d2e4f") {
+		t.Errorf("want a stable trace ID for other build IDs, got %q", legacy)
+	}
+}
+
+func Test_StartSpan_ReadsParent(t *testing.T) {
+	buildID := NewBuildID()
+	os.Setenv("Http_Traceparent", "00-"+buildID+"-00f067aa0ba902b7-01")
+	defer os.Unsetenv("Http_Traceparent")
+
+	span := StartSpan("git-tar", "git-tar", buildID)
+	if span.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("want the parent from the header, got %q", span.ParentSpanID)
+	}
+
+	other := StartSpan("git-tar", "git-tar", NewBuildID())
+	if len(other.ParentSpanID) > 0 {
+		t.Errorf("want no parent from another trace, got %q", other.ParentSpanID)
+	}
+}
+
+func Test_Span_Inject(t *testing.T) {
+	buildID := NewBuildID()
+	span := StartSpan("github-push", "github-push", buildID)
+	child := span.StartChild("post git-tar")
+
+	req, _ := http.NewRequest(http.MethodPost, "http://gateway:8080/function/git-tar", nil)
+	child.Inject(req)
+
+	if req.Header.Get(BuildIDHeader) != buildID {
+		t.Errorf("want build ID header %s, got %s", buildID, req.Header.Get(BuildIDHeader))
+	}
+
+	want := "00-" + buildID + "-" + child.SpanID + "-01"
+	if req.Header.Get(TraceParentHeader) != want {
+		t.Errorf("want traceparent %s, got %s", want, req.Header.Get(TraceParentHeader))
+	}
+	if child.ParentSpanID != span.SpanID {
+		t.Errorf("want the child's parent to be the span")
+	}
+}
+
+func Test_exportSpan_OTLP(t *testing.T) {
+	var body map[string]interface{}
+	var path string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+	}))
+	defer s.Close()
+
+	os.Setenv("otlp_endpoint", s.URL)
+	defer os.Unsetenv("otlp_endpoint")
+
+	span := StartSpan("buildshiprun", "buildshiprun", NewBuildID())
+	span.SetError(errors.New("unable to deploy"))
+	span.End = span.Start
+
+	if err := exportSpan(span, OTLPExporter); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if path != "/v1/traces" {
+		t.Errorf("want /v1/traces, got %s", path)
+	}
+
+	out, _ := json.Marshal(body)
+	for _, want := range []string{`"traceId":"` + span.TraceID + `"`, `"stringValue":"buildshiprun"`, `"code":2`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("want %s in %s", want, string(out))
+		}
+	}
+}
+
+func Test_exportSpan_Disabled(t *testing.T) {
+	if err := exportSpan(&Span{}, ""); err != nil {
+		t.Errorf("want no error when tracing is off, got %s", err.Error())
+	}
+	if err := exportSpan(&Span{}, "zipkin"); err == nil {
+		t.Errorf("want an error for an unknown exporter")
+	}
+}